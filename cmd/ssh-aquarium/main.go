@@ -2,38 +2,332 @@ package main
 
 import (
 	"flag"
+	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/signal"
+	"slices"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/acuqa/ssh-aquarium/internal/aquarium"
+	"github.com/acuqa/ssh-aquarium/internal/assets"
+	"github.com/acuqa/ssh-aquarium/internal/cluster"
+	"github.com/acuqa/ssh-aquarium/internal/connection"
+	"github.com/acuqa/ssh-aquarium/internal/directory"
+	"github.com/acuqa/ssh-aquarium/internal/doorbell"
+	"github.com/acuqa/ssh-aquarium/internal/federation"
+	"github.com/acuqa/ssh-aquarium/internal/fuzz"
+	"github.com/acuqa/ssh-aquarium/internal/hooks"
+	"github.com/acuqa/ssh-aquarium/internal/loadtest"
+	"github.com/acuqa/ssh-aquarium/internal/memory"
+	"github.com/acuqa/ssh-aquarium/internal/replay"
+	"github.com/acuqa/ssh-aquarium/internal/schedule"
 	"github.com/acuqa/ssh-aquarium/internal/sshserver"
+	"github.com/acuqa/ssh-aquarium/internal/store"
+	"github.com/acuqa/ssh-aquarium/internal/timelapse"
 	"github.com/acuqa/ssh-aquarium/internal/webserver"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "replay" {
+		runReplay(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "fuzz" {
+		runFuzz(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "loadtest" {
+		runLoadtest(os.Args[2:])
+		return
+	}
+
 	port := flag.Int("port", 1234, "SSH server port")
 	webPort := flag.Int("web-port", 8080, "Web server port")
+	corsOrigins := flag.String("cors-origins", "", "Comma-separated origins (https://example.com, or *) whose web pages may read the JSON API")
+	apiToken := flag.String("api-token", "", "Bearer token required by the JSON API, empty for open access")
 	hostKeyPath := flag.String("host-key", "./ssh_keys/host_key_rsa_4096", "Path to SSH host key")
 	debug := flag.Bool("debug", false, "Debug mode (1 fish, 1 FPS)")
+	themeName := flag.String("theme", "ocean", "Tank theme (ocean, lagoon, abyss, none)")
+	floorSpec := flag.String("floor", aquarium.DefaultFloor, "Floor strips from top to bottom as name:rows (sand, gravel, rock), or none")
+	design := flag.String("design", "", "Design string from `layout export` that sets up every room, instead of -theme and -floor")
+	labels := flag.String("labels", string(aquarium.LabelsStatus), "Where fish names are shown: status (status row) or fish (next to each fish, better on tall terminals)")
+	maxBandwidth := flag.Int("max-bandwidth", 0, "Bytes per second sent to each connection, 0 for unlimited; decoration is dropped first")
+	handshakeTimeout := flag.Duration("handshake-timeout", sshserver.DefaultLimits.HandshakeTimeout, "Time a client has to finish the SSH handshake and authentication")
+	startTimeout := flag.Duration("start-timeout", sshserver.DefaultLimits.StartTimeout, "Time a client has after the handshake to ask for a shell or a command")
+	maxHandshakes := flag.Int("max-handshakes", sshserver.DefaultLimits.MaxHandshakes, "Handshakes in flight at once; further connections are dropped until some finish")
+	frameBytes := flag.Int("frame-budget", 0, "Bytes a single frame may take, 0 for unlimited; decoration is culled first")
+	frameTime := flag.Duration("frame-time", aquarium.DefaultFrameTime, "Time rendering and sending a frame may take before decoration is culled, 0 for unlimited")
+	stormInterval := flag.Duration("storm-interval", aquarium.DefaultStormInterval, "Average time between storms in a room, 0 to disable")
+	schedulePath := flag.String("schedule", "", "Path to a file of events (frenzy, storm, announce) to run in rooms at times given as cron expressions")
+	hooksPath := flag.String("hooks", "", "Path to a file of shell commands run on events (on_connect, on_milestone, on_storm), each given the event as JSON on stdin")
+	goodbyePath := flag.String("goodbye", "", "Path to a text/template printed when a session ends, with .Username, .Room, .Duration, .Pops, .WebURL and more, and {{qr .WebURL}} for a QR code")
+	webURL := flag.String("web-url", "", "Public URL of the web page, e.g. https://acqua.fly.dev, shown in the status row, the guestbook and on the goodbye screen")
+	doorbellCommand := flag.String("doorbell-command", "", "Shell command run when someone starts watching, with ACQUA_VISITOR, ACQUA_FINGERPRINT, ACQUA_REMOTE_ADDR and ACQUA_MISSED set")
+	doorbellWebhook := flag.String("doorbell-webhook", "", "URL POSTed a JSON description of each visitor")
+	doorbellInterval := flag.Duration("doorbell-interval", doorbell.DefaultInterval, "Least time between two doorbell rings; visitors in between are counted in the next one")
+	schooling := flag.String("schooling", "", "How fish of a species swim together as name=weight: separation, alignment, cohesion (defaults 1.5, 2, 0.2) and radius in pixels (200), or off")
+	cooldowns := flag.String("cooldowns", "", "How long each user waits between actions that affect everyone, e.g. food=5s,poke=2s,chat=3s (defaults), 0 to turn one off")
+	admins := flag.String("admins", "", "Comma-separated SSH key fingerprints (SHA256:...) allowed to run admin commands")
+	roomAccess := flag.String("room-access", "", "Path to a file restricting rooms to SSH keys (<room> key SHA256:...) or a passphrase (<room> passphrase <phrase>)")
+	restoreWindow := flag.Duration("restore-window", 10*time.Minute, "Restore tanks saved at shutdown when restarted within this window, 0 to disable")
+	stateDir := flag.String("state-dir", "./state", "Directory for persistent state such as tanks, users' fish and settings, session history, statistics and terminal capabilities, empty to keep nothing")
+	flushInterval := flag.Duration("flush-interval", time.Minute, "How often tanks, statistics and session history are saved to -state-dir besides at shutdown, 0 for only at shutdown")
+	storeBackend := flag.String("store", "dir", "Where persistent state is kept: dir (JSON files in -state-dir), sqlite (state.db in -state-dir) or memory (forgotten on restart)")
+	roomNames := flag.String("rooms", "lobby", "Comma-separated list of rooms; the first one is where users arrive")
+	clusterRedis := flag.String("cluster-redis", "", "Redis address (host:port or redis:// URL) for sharing the aquarium between instances")
+	clusterChannel := flag.String("cluster-channel", "acqua", "Redis pub/sub channel used for cluster replication")
+	nodeID := flag.String("node-id", "", "Unique node name in cluster mode (defaults to hostname)")
+	federationPeers := flag.String("federation-peers", "", "Path to the opt-in list of federated peer aquariums (enables federation)")
+	federationName := flag.String("federation-name", "", "Name of this aquarium in the federation (defaults to hostname)")
+	federationKey := flag.String("federation-key", "./federation_key.pem", "Path to the Ed25519 key used to sign outgoing fish")
+	federationChance := flag.Float64("federation-chance", 0.05, "Chance that a fish hitting a side wall swims off to a peer")
+	directoryURL := flag.String("directory", "", "URL of a public aquarium directory, e.g. https://acqua.fly.dev/directory, for the list command and the /aquariums page")
+	announce := flag.String("announce", "", "Public SSH address (host or host:port) to announce to -directory; leave empty to stay unlisted")
+	announceName := flag.String("announce-name", "", "Name shown in the directory (defaults to hostname)")
+	serveDirectory := flag.Bool("serve-directory", false, "Host a public aquarium directory at /directory on the web port")
+	assetsDir := flag.String("assets", "", "Directory whose fish.png and fish-right.png replace the built-in fish sprites; files it lacks stay built in")
+	watchSprites := flag.Bool("watch-sprites", false, "Re-upload the fish sprites to everyone connected whenever fish.png or fish-right.png in -assets change (SIGHUP always does)")
+	federationVisit := flag.Duration("federation-visit", 30*time.Second, "How long migrating fish stay with a peer")
+	gcPercent := flag.Int("gc-percent", 0, "Heap growth in percent that starts a garbage collection, like GOGC; negative collects only at -memory-limit, 0 keeps GOGC")
+	memoryLimit := flag.String("memory-limit", "", "Soft memory limit like GOMEMLIMIT, e.g. 400MiB; the garbage collector works harder near it")
+	ballast := flag.String("ballast", "", "Heap ballast, e.g. 64MiB: never touched, so it costs no RAM, but fewer garbage collections run on small heaps")
+	timelapseInterval := flag.Duration("timelapse-interval", timelapse.DefaultOptions.Interval, "Time between pictures of the default room for /api/timelapse.gif, 0 to disable")
+	timelapseFrames := flag.Int("timelapse-frames", timelapse.DefaultOptions.Frames, "Pictures kept for /api/timelapse.gif")
 	flag.Parse()
 
-	// Create aquarium manager
-	aquariumMgr := aquarium.NewManager()
+	limit, err := memory.ParseSize(*memoryLimit)
+	if err != nil {
+		log.Fatalf("Invalid memory limit: %v", err)
+	}
+	ballastSize, err := memory.ParseSize(*ballast)
+	if err != nil {
+		log.Fatalf("Invalid ballast: %v", err)
+	}
+	memory.Apply(memory.Tuning{GCPercent: *gcPercent, MemoryLimit: limit, Ballast: ballastSize})
+	if *assetsDir != "" {
+		if err := assets.SetDir(*assetsDir); err != nil {
+			log.Fatalf("Invalid assets: %v", err)
+		}
+	}
+
+	// Create one aquarium manager per room
+	rooms := aquarium.NewRegistry(strings.Split(*roomNames, ","))
 	if *debug {
-		aquariumMgr.SetDebugMode(true)
+		rooms.SetDebugMode(true)
+	}
+	theme, ok := aquarium.ThemeByName(*themeName)
+	if !ok {
+		log.Fatalf("Unknown theme %q", *themeName)
+	}
+	rooms.SetTheme(theme)
+	floor, err := aquarium.ParseFloor(*floorSpec)
+	if err != nil {
+		log.Fatalf("Invalid floor: %v", err)
+	}
+	rooms.SetFloor(floor)
+	labelMode, err := aquarium.ParseLabelMode(*labels)
+	if err != nil {
+		log.Fatalf("Invalid labels: %v", err)
+	}
+	rooms.SetLabelMode(labelMode)
+	rooms.SetBandwidthCap(*maxBandwidth)
+	rooms.SetFrameBudget(aquarium.FrameBudget{Bytes: *frameBytes, Time: *frameTime})
+	rooms.SetStormInterval(*stormInterval)
+	schoolingWeights, err := aquarium.ParseSchooling(*schooling)
+	if err != nil {
+		log.Fatalf("Invalid schooling: %v", err)
+	}
+	rooms.SetSchooling(schoolingWeights)
+	cooldownDurations, err := aquarium.ParseCooldowns(*cooldowns)
+	if err != nil {
+		log.Fatalf("Invalid cooldowns: %v", err)
+	}
+	rooms.SetCooldowns(cooldownDurations)
+	rooms.SetAdmins(strings.Split(*admins, ","))
+	if *roomAccess != "" {
+		access, err := aquarium.LoadRoomAccess(*roomAccess)
+		if err != nil {
+			log.Fatalf("Failed to load room access: %v", err)
+		}
+		if err := rooms.SetRoomAccess(access); err != nil {
+			log.Fatalf("Invalid room access: %v", err)
+		}
+	}
+
+	// Persistent state is optional, the aquarium works without it
+	if !slices.Contains(store.Backends, *storeBackend) {
+		log.Fatalf("Unknown store %q, expected one of %s", *storeBackend, strings.Join(store.Backends, ", "))
+	}
+	var state store.Store
+	if *stateDir == "" && *storeBackend != "memory" {
+		log.Printf("Persistent state disabled: no -state-dir")
+	} else if state, err = store.OpenBackend(*storeBackend, *stateDir); err != nil {
+		log.Printf("Persistent state disabled: %v", err)
+	} else {
+		if err := rooms.SetStore(state); err != nil {
+			log.Printf("Failed to restore room layouts: %v", err)
+		}
+		if *restoreWindow > 0 {
+			if err := rooms.RestoreSnapshot(state, *restoreWindow); err != nil {
+				log.Printf("Failed to restore tanks: %v", err)
+			}
+		}
+	}
+
+	// A design sets up every room whatever the tanks were restored with
+	if *design != "" {
+		layout, err := aquarium.ParseDesign(*design)
+		if err != nil {
+			log.Fatalf("Invalid design: %v", err)
+		}
+		if err := rooms.ApplyLayout(layout); err != nil {
+			log.Fatalf("Invalid design: %v", err)
+		}
 	}
+
+	// Run hooks on events if configured
+	if *hooksPath != "" {
+		h, err := hooks.Load(*hooksPath)
+		if err != nil {
+			log.Fatalf("Failed to load hooks: %v", err)
+		}
+		rooms.SetEvents(h.Fire)
+	}
+
+	// Run scheduled events if configured
+	var scheduler *schedule.Scheduler
+	if *schedulePath != "" {
+		entries, err := schedule.Load(*schedulePath)
+		if err != nil {
+			log.Fatalf("Failed to load schedule: %v", err)
+		}
+		if scheduler, err = schedule.New(rooms, entries); err != nil {
+			log.Fatalf("Invalid schedule: %v", err)
+		}
+		scheduler.Start()
+		log.Printf("Scheduled %d events", len(entries))
+	}
+
+	// Federation and cluster replication share the default room
+	aquariumMgr := rooms.Default()
 	
 	// Create SSH server
-	server, err := sshserver.New(*port, *hostKeyPath, aquariumMgr)
+	server, err := sshserver.New(*port, *hostKeyPath, rooms)
 	if err != nil {
 		log.Fatalf("Failed to create SSH server: %v", err)
 	}
+	server.SetLimits(sshserver.Limits{
+		HandshakeTimeout: *handshakeTimeout,
+		StartTimeout:     *startTimeout,
+		MaxHandshakes:    *maxHandshakes,
+	})
+	goodbye, err := connection.NewGoodbye(connection.DefaultGoodbye, *webURL)
+	if *goodbyePath != "" {
+		goodbye, err = connection.LoadGoodbye(*goodbyePath, *webURL)
+	}
+	if err != nil {
+		log.Fatalf("Failed to load goodbye screen: %v", err)
+	}
+	server.SetGoodbye(goodbye)
+	server.SetWebURL(*webURL)
+	rooms.SetWebURL(*webURL)
+	if *doorbellCommand != "" || *doorbellWebhook != "" {
+		server.SetDoorbell(doorbell.New(*doorbellCommand, *doorbellWebhook, *doorbellInterval))
+	}
+	if state != nil {
+		if err := server.Capabilities().SetStore(state); err != nil {
+			log.Printf("Failed to load terminal capabilities: %v", err)
+		}
+	}
 
 	// Create web server
-	webSrv := webserver.New(*webPort, aquariumMgr)
+	webSrv := webserver.New(*webPort, rooms)
+	webSrv.SetCORSOrigins(strings.Split(*corsOrigins, ","))
+	webSrv.SetAPIToken(*apiToken)
+
+	// Take pictures of the default room for the time-lapse if enabled
+	var recorder *timelapse.Recorder
+	if *timelapseInterval > 0 && *timelapseFrames > 0 {
+		left, right, err := connection.SpriteImages()
+		if err != nil {
+			log.Printf("Time-lapse draws fish as blobs: %v", err)
+		}
+		opts := timelapse.DefaultOptions
+		opts.Interval, opts.Frames = *timelapseInterval, *timelapseFrames
+		recorder = timelapse.New(aquariumMgr, left, right, opts)
+		recorder.Start()
+		webSrv.SetTimelapse(recorder)
+	}
+
+	// Link up with federated peers if configured
+	if *federationPeers != "" {
+		peers, err := federation.LoadPeers(*federationPeers)
+		if err != nil {
+			log.Fatalf("Failed to load federation peers: %v", err)
+		}
+		key, err := federation.LoadOrCreateKey(*federationKey)
+		if err != nil {
+			log.Fatalf("Failed to load federation key: %v", err)
+		}
+		name := *federationName
+		if name == "" {
+			name, _ = os.Hostname()
+		}
+
+		fed := federation.New(name, key, peers, aquariumMgr)
+		webSrv.Handle(federation.VisitPath, fed)
+		aquariumMgr.SetMigration(fed.Migrate, *federationChance, *federationVisit)
+		log.Printf("Federation enabled as %q with %d peers, public key %s", name, len(peers), fed.PublicKey())
+	}
+
+	// Host and use the public directory if configured
+	var dirClient *directory.Client
+	if *serveDirectory {
+		dir := directory.New()
+		webSrv.Handle(directory.Path, dir)
+		if *directoryURL == "" {
+			server.SetDirectory(dir)
+			webSrv.SetDirectory(dir)
+		}
+		log.Printf("Hosting a public aquarium directory at %s", directory.Path)
+	}
+	if *directoryURL != "" {
+		dirClient = directory.NewClient(*directoryURL)
+		server.SetDirectory(dirClient)
+		webSrv.SetDirectory(dirClient)
+	}
+	if *announce != "" {
+		if dirClient == nil {
+			log.Fatalf("-announce needs -directory")
+		}
+		name := *announceName
+		if name == "" {
+			name, _ = os.Hostname()
+		}
+		dirClient.Announce(func() directory.Entry {
+			population := 0
+			for _, room := range rooms.Rooms() {
+				population += room.Population
+			}
+			return directory.Entry{Name: name, Address: *announce, Population: population}
+		})
+		log.Printf("Announcing %q at %s to %s", name, *announce, *directoryURL)
+	}
+
+	// Join the cluster if configured
+	var clusterNode *cluster.Node
+	if *clusterRedis != "" {
+		id := *nodeID
+		if id == "" {
+			id, _ = os.Hostname()
+		}
+		clusterNode = cluster.New(id, *clusterRedis, *clusterChannel, aquariumMgr)
+		clusterNode.Start()
+	}
 
 	// Start SSH server
 	if err := server.Start(); err != nil {
@@ -53,6 +347,30 @@ func main() {
 	log.Println("(Any username/password will work)")
 	log.Printf("Web interface: http://localhost:%d", *webPort)
 
+	// Artists can iterate on the fish without anyone reconnecting: SIGHUP,
+	// or any change with -watch-sprites, re-uploads the sprites
+	hupCh := make(chan os.Signal, 1)
+	signal.Notify(hupCh, syscall.SIGHUP)
+	go func() {
+		for range hupCh {
+			if err := connection.ReloadSprites(rooms); err != nil {
+				log.Printf("Failed to reload sprites: %v", err)
+			}
+		}
+	}()
+	stopWatching := make(chan struct{})
+	if *watchSprites {
+		go connection.WatchSprites(rooms, time.Second, stopWatching)
+	}
+
+	// Save periodically so a crash loses at most one interval
+	stopFlushing, flushed := make(chan struct{}), make(chan struct{})
+	if state != nil && *flushInterval > 0 {
+		go flush(rooms, state, *flushInterval, *restoreWindow > 0, stopFlushing, flushed)
+	} else {
+		close(flushed)
+	}
+
 	// Wait for interrupt signal
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
@@ -63,9 +381,31 @@ func main() {
 	// Start shutdown in goroutine with timeout
 	done := make(chan struct{})
 	go func() {
+		// Save the tanks first so a restart picks up where we left off,
+		// once a periodic save still running is done
+		close(stopFlushing)
+		<-flushed
+		if state != nil && *restoreWindow > 0 {
+			if err := rooms.SaveSnapshot(state); err != nil {
+				log.Printf("Failed to save tanks: %v", err)
+			}
+		}
+		close(stopWatching)
+		if scheduler != nil {
+			scheduler.Stop()
+		}
+		if recorder != nil {
+			recorder.Stop()
+		}
 		server.Stop()
 		webSrv.Stop()
-		aquariumMgr.Stop()
+		if dirClient != nil {
+			dirClient.Stop()
+		}
+		if clusterNode != nil {
+			clusterNode.Stop()
+		}
+		rooms.Stop()
 		close(done)
 	}()
 	
@@ -77,4 +417,199 @@ func main() {
 		log.Println("Shutdown timeout - forcing exit")
 		os.Exit(1)
 	}
-}
\ No newline at end of file
+}
+
+// flush saves the rooms' state every interval until stop is closed, with
+// the tanks if they are restored at startup. It closes done once it
+// stopped, so no save of its own runs past that.
+func flush(rooms *aquarium.Registry, state store.Store, interval time.Duration, tanks bool, stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		rooms.Flush()
+		if tanks {
+			if err := rooms.SaveSnapshot(state); err != nil {
+				log.Printf("Failed to save tanks: %v", err)
+			}
+		}
+	}
+}
+
+// runReplay plays a scripted session into a private tank and records it,
+// e.g. for demo GIFs or for comparing rendering changes.
+func runReplay(args []string) {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	output := fs.String("o", "-", "Output file, - for stdout")
+	format := fs.String("format", "raw", "Output format: raw (terminal stream) or cast (asciicast v2)")
+	themeName := fs.String("theme", "ocean", "Tank theme (ocean, lagoon, abyss, none)")
+	floorSpec := fs.String("floor", aquarium.DefaultFloor, "Floor strips from top to bottom as name:rows (sand, gravel, rock), or none")
+	labels := fs.String("labels", string(aquarium.LabelsStatus), "Where fish names are shown: status or fish")
+	age := fs.Duration("age", 0, "Pretend the tank has been running this long, e.g. 720h for fully grown coral")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: ssh-aquarium replay [flags] script")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		log.Fatalf("Failed to open script: %v", err)
+	}
+	script, err := replay.Parse(f)
+	f.Close()
+	if err != nil {
+		log.Fatalf("Invalid script: %v", err)
+	}
+
+	theme, ok := aquarium.ThemeByName(*themeName)
+	if !ok {
+		log.Fatalf("Unknown theme %q", *themeName)
+	}
+	floor, err := aquarium.ParseFloor(*floorSpec)
+	if err != nil {
+		log.Fatalf("Invalid floor: %v", err)
+	}
+	room := aquarium.NewManager()
+	room.SetTheme(theme)
+	room.SetFloor(floor)
+	labelMode, err := aquarium.ParseLabelMode(*labels)
+	if err != nil {
+		log.Fatalf("Invalid labels: %v", err)
+	}
+	room.SetLabelMode(labelMode)
+	room.SetFounded(time.Now().Add(-*age))
+	defer room.Stop()
+
+	out := os.Stdout
+	if *output != "-" {
+		if out, err = os.Create(*output); err != nil {
+			log.Fatalf("Failed to create output: %v", err)
+		}
+		defer out.Close()
+	}
+	rec, err := replay.NewRecorder(*format, out, script.Columns, script.Rows)
+	if err != nil {
+		log.Fatalf("Failed to start recording: %v", err)
+	}
+	if err := replay.Run(script, room, rec); err != nil {
+		log.Fatalf("Replay failed: %v", err)
+	}
+}
+
+// runFuzz replays captured and mutated client input against connection
+// handlers and reports input that panics, hangs or grows the heap.
+func runFuzz(args []string) {
+	fs := flag.NewFlagSet("fuzz", flag.ExitOnError)
+	iterations := fs.Int("n", 10000, "Sessions to replay")
+	seed := fs.Int64("seed", time.Now().UnixNano(), "Seed for the mutations, to repeat a run")
+	pace := fs.Duration("pace", 0, "Pause before each read of the input, e.g. 30ms so frames are drawn in between")
+	timeout := fs.Duration("timeout", 10*time.Second, "Time after which a session counts as hanging")
+	maxHeap := fs.Uint64("max-heap", 256<<20, "Bytes of heap in use the run may grow to, 0 for no limit")
+	crashers := fs.String("crashers", "./fuzz-crashers", "Directory failing inputs are saved to, empty to not save them")
+	verbose := fs.Bool("v", false, "Show the server log")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: ssh-aquarium fuzz [flags] [input...]")
+		fmt.Fprintln(fs.Output(), "Inputs hold one Go quoted string per read, e.g. saved crashers; they are replayed as is, then mutated.")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	var corpus []fuzz.Input
+	for _, path := range fs.Args() {
+		f, err := os.Open(path)
+		if err != nil {
+			log.Fatalf("Failed to open input: %v", err)
+		}
+		input, err := fuzz.ParseInput(f)
+		f.Close()
+		if err != nil {
+			log.Fatalf("Invalid input %s: %v", path, err)
+		}
+		corpus = append(corpus, input)
+	}
+
+	log.Printf("Fuzzing %d sessions with seed %d", *iterations, *seed)
+	if !*verbose {
+		log.SetOutput(io.Discard)
+	}
+	result, err := fuzz.Run(fuzz.Options{
+		Iterations: *iterations,
+		Seed:       *seed,
+		Corpus:     corpus,
+		Pace:       *pace,
+		Timeout:    *timeout,
+		MaxHeap:    *maxHeap,
+		Crashers:   *crashers,
+	})
+	log.SetOutput(os.Stderr)
+	if err != nil {
+		log.Fatalf("Fuzzing failed: %v", err)
+	}
+
+	log.Printf("Replayed %d sessions, %d bytes in, %d bytes out; heap %d bytes, %d goroutines left over",
+		result.Sessions, result.Bytes, result.Written, result.Heap, result.Goroutines)
+	for _, failure := range result.Failures {
+		log.Printf("Session %d: %s %s", failure.Iteration, failure.Reason, failure.Path)
+	}
+	if len(result.Failures) > 0 {
+		os.Exit(1)
+	}
+}
+
+func runLoadtest(args []string) {
+	fs := flag.NewFlagSet("loadtest", flag.ExitOnError)
+	sessions := fs.Int("n", 50, "Sessions to keep open at once")
+	duration := fs.Duration("d", 30*time.Second, "How long each session stays")
+	ramp := fs.Duration("ramp", 10*time.Second, "Time over which the sessions connect")
+	columns := fs.Int("cols", 80, "Terminal width of each session")
+	rows := fs.Int("rows", 24, "Terminal height of each session")
+	input := fs.Duration("input", 2*time.Second, "Average pause between clicks of each session, 0 for none")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: ssh-aquarium loadtest [flags] host:port")
+		fmt.Fprintln(fs.Output(), "Opens sessions with simulated terminals against an instance and reports how frames arrive.")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	log.Printf("Opening %d sessions to %s for %v each", *sessions, fs.Arg(0), *duration)
+	result, err := loadtest.Run(loadtest.Options{
+		Addr:     fs.Arg(0),
+		Sessions: *sessions,
+		Duration: *duration,
+		Ramp:     *ramp,
+		Columns:  *columns,
+		Rows:     *rows,
+		Input:    *input,
+	})
+	if err != nil {
+		log.Fatalf("Load test failed: %v", err)
+	}
+
+	seconds := max(duration.Seconds(), 1) * float64(max(result.Connected, 1))
+	log.Printf("%d sessions connected, %d failed", result.Connected, result.Failed)
+	for msg, count := range result.Errors {
+		log.Printf("  %dx %s", count, msg)
+	}
+	log.Printf("Frames: %d, %.1f per session and second, %.0f bytes per session and second",
+		result.Frames, float64(result.Frames)/seconds, float64(result.Bytes)/seconds)
+	log.Printf("First frame:    %v", result.FirstFrame)
+	log.Printf("Frame gap:      %v", result.FrameGap)
+	log.Printf("Click to frame: %v, %d clicks sent", result.Click, result.Clicks)
+	if result.Failed > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,124 @@
+package aquarium
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// RoomAccess restricts who may enter a room: users with one of the listed
+// SSH keys, and anyone who knows the passphrase if there is one. Rooms
+// without rules are open to everyone.
+type RoomAccess struct {
+	Keys       map[string]bool // SSH key fingerprints (SHA256:...) let in
+	Passphrase string
+}
+
+// Access is what it takes a client to enter a room.
+type Access int
+
+const (
+	AccessOpen       Access = iota // walk right in
+	AccessPassphrase               // type the room's passphrase first
+	AccessDenied                   // not on the list
+)
+
+// LoadRoomAccess reads access rules from a file with one rule per line:
+// a room, then "key" and an SSH key fingerprint or "passphrase" and the
+// rest of the line. A room may list any number of keys but only one
+// passphrase. Blank lines and lines starting with # are skipped.
+func LoadRoomAccess(path string) (map[string]RoomAccess, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open room access: %w", err)
+	}
+	defer file.Close()
+
+	access := make(map[string]RoomAccess)
+	scanner := bufio.NewScanner(file)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("%s:%d: expected <room> key <fingerprint> or <room> passphrase <phrase>", path, lineNo)
+		}
+		room, kind := fields[0], fields[1]
+		rules := access[room]
+		switch kind {
+		case "key":
+			if len(fields) != 3 || !strings.HasPrefix(fields[2], "SHA256:") {
+				return nil, fmt.Errorf("%s:%d: expected a key fingerprint like SHA256:..., got %q", path, lineNo, strings.Join(fields[2:], " "))
+			}
+			if rules.Keys == nil {
+				rules.Keys = make(map[string]bool)
+			}
+			rules.Keys[fields[2]] = true
+		case "passphrase":
+			if rules.Passphrase != "" {
+				return nil, fmt.Errorf("%s:%d: room %q already has a passphrase", path, lineNo, room)
+			}
+			// The phrase is everything after the second field, inner
+			// spaces included. The line is trimmed, so the room starts it.
+			rest := strings.TrimLeftFunc(line[len(room):], unicode.IsSpace)
+			rules.Passphrase = strings.TrimSpace(rest[len(kind):])
+		default:
+			return nil, fmt.Errorf("%s:%d: unknown rule %q, expected key or passphrase", path, lineNo, kind)
+		}
+		access[room] = rules
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read room access: %w", err)
+	}
+	return access, nil
+}
+
+// SetRoomAccess restricts rooms to the given rules. The first room stays
+// open, every connection arrives there.
+func (r *Registry) SetRoomAccess(access map[string]RoomAccess) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for name := range access {
+		if _, ok := r.rooms[name]; !ok {
+			return fmt.Errorf("unknown room %q", name)
+		}
+		if name == r.order[0] {
+			return fmt.Errorf("room %q is where everyone arrives and can't be restricted", name)
+		}
+	}
+	r.access = access
+	return nil
+}
+
+// Access returns what it takes client to enter the named room. Admins
+// enter every room.
+func (r *Registry) Access(name string, client ClientInfo) Access {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	rules, ok := r.access[name]
+	switch {
+	case !ok:
+		return AccessOpen
+	case client.Fingerprint != "" && (rules.Keys[client.Fingerprint] || r.admins[client.Fingerprint]):
+		return AccessOpen
+	case rules.Passphrase != "":
+		return AccessPassphrase
+	}
+	return AccessDenied
+}
+
+// CheckPassphrase reports whether phrase is the named room's passphrase.
+func (r *Registry) CheckPassphrase(name, phrase string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	want := r.access[name].Passphrase
+	return want != "" && subtle.ConstantTimeCompare([]byte(phrase), []byte(want)) == 1
+}
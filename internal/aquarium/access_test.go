@@ -0,0 +1,32 @@
+package aquarium
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadRoomAccess(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access")
+	rules := "# room  rule\n" +
+		"passphrase-lab  passphrase  open sesame \n" +
+		"keyroom\tkey\tSHA256:abc\n" +
+		"keyroom passphrase key passphrase\n"
+	if err := os.WriteFile(path, []byte(rules), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	access, err := LoadRoomAccess(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := access["passphrase-lab"].Passphrase; got != "open sesame" {
+		t.Errorf("passphrase of a room named after the keyword is %q, want %q", got, "open sesame")
+	}
+	if got := access["keyroom"].Passphrase; got != "key passphrase" {
+		t.Errorf("passphrase containing the keyword is %q, want %q", got, "key passphrase")
+	}
+	if !access["keyroom"].Keys["SHA256:abc"] {
+		t.Error("key rule is missing")
+	}
+}
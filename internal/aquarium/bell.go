@@ -0,0 +1,29 @@
+package aquarium
+
+import "time"
+
+// bellInterval is the least time between two bells of a connection, so a
+// busy room doesn't beep all the time.
+const bellInterval = 10 * time.Second
+
+// ringLocked rings the terminal bell of a connection that asked for it, with
+// the next frame, and says why in a notice. Callers must hold m.mu.
+func (m *Manager) ringLocked(conn *Connection, text string, now time.Time) {
+	if !conn.Client.Settings.Bell || now.Sub(conn.bellAt) < bellInterval {
+		return
+	}
+	conn.bellAt = now
+	conn.bell = true
+	m.notifyLocked(conn, text, now)
+}
+
+// ringOthersLocked rings the bells of everyone in the room but conn's own
+// session, e.g. when it joined. Callers must hold m.mu.
+func (m *Manager) ringOthersLocked(conn *Connection, text string, now time.Time) {
+	for _, other := range m.connections {
+		if other == conn || other.Client.Username == conn.Client.Username && other.Client.RemoteAddr == conn.Client.RemoteAddr {
+			continue // e.g. the other side of a split view
+		}
+		m.ringLocked(other, text, now)
+	}
+}
@@ -0,0 +1,130 @@
+package aquarium
+
+import (
+	"log"
+	"math"
+	"math/rand"
+	"time"
+)
+
+const (
+	DefaultSpecies = "clownfish"
+
+	MateDistance  = 120.0 // pixels between fish centers
+	CourtshipTime = 10.0  // seconds two fish must stay close before breeding
+	BreedChance   = 0.2   // chance per second once courtship is complete
+	BreedCooldown = 2 * time.Minute
+	FryFollowTime = 45 * time.Second
+	FrySize       = 0.4
+	MaxFry        = 6
+)
+
+type fishPair [2]uint64
+
+// updateBreeding lets well-fed fish of the same species that stay close
+// together spawn fry, and steers fry after their parent. Callers must hold
+// m.mu.
+func (m *Manager) updateBreeding(fishData []*Fish, config *TerminalConfig, now time.Time, deltaTime float64) {
+	fryCount := 0
+	adults := make([]*Fish, 0, len(fishData))
+
+	for _, fish := range fishData {
+		if !fish.AwayUntil.IsZero() {
+			continue
+		}
+		if fish.ParentID != 0 {
+			fryCount++
+			m.followParent(fish, now, deltaTime)
+			continue
+		}
+		if fish.LeaveAt.IsZero() && fish.Hunger < WellFedHunger && now.Sub(fish.LastBred) > BreedCooldown {
+			adults = append(adults, fish)
+		}
+	}
+
+	courtship := make(map[fishPair]float64)
+	for i, a := range adults {
+		for _, b := range adults[i+1:] {
+			if a.Species != b.Species || fishDistance(a, b) > MateDistance {
+				continue
+			}
+
+			pair := fishPair{min(a.ID, b.ID), max(a.ID, b.ID)}
+			courtship[pair] = m.courtship[pair] + deltaTime
+			if courtship[pair] < CourtshipTime || fryCount >= MaxFry || rand.Float64() >= BreedChance*deltaTime {
+				continue
+			}
+
+			m.spawnFry(a, b, config, now)
+			a.LastBred = now
+			b.LastBred = now
+			fryCount++
+			delete(courtship, pair)
+		}
+	}
+	m.courtship = courtship
+}
+
+func (m *Manager) spawnFry(a, b *Fish, config *TerminalConfig, now time.Time) {
+	parent := a
+	if rand.Intn(2) == 0 {
+		parent = b
+	}
+
+	fryID := m.fishCounter.Add(1)
+	fry := NewFish(fryID, 0, config, "", parent.Color)
+	fry.Species = parent.Species
+	fry.Size = FrySize
+	fry.ParentID = parent.ID
+	fry.FollowUntil = now.Add(FryFollowTime)
+	fry.PosX = (a.PosX + b.PosX) / 2
+	fry.PosY = (a.PosY + b.PosY) / 2
+
+	m.fish[fryID] = fry
+	log.Printf("Fry %d born to %s and %s", fryID, a.Username, b.Username)
+}
+
+// followParent keeps a fry swimming just behind its parent. Once it has
+// grown up or lost its parent it swims off through the next wall.
+func (m *Manager) followParent(fry *Fish, now time.Time, deltaTime float64) {
+	if !fry.LeaveAt.IsZero() {
+		return
+	}
+
+	parent, ok := m.fish[fry.ParentID]
+	if !ok || !parent.AwayUntil.IsZero() || now.After(fry.FollowUntil) {
+		fry.LeaveAt = time.Now() // leaving runs on wall time, like for visitors
+		return
+	}
+
+	targetX := parent.PosX - fry.Width()
+	if parent.VelX < 0 {
+		targetX = parent.PosX + parent.Width()
+	}
+	targetY := parent.PosY + parent.Height()/2
+
+	fry.steerTo(targetX, targetY, 2, deltaTime)
+}
+
+// steerTo turns the fish towards a point. strength is the fraction of the
+// velocity corrected per second.
+func (f *Fish) steerTo(x, y, strength, deltaTime float64) {
+	dx := x - (f.PosX + f.Width()/2)
+	dy := y - (f.PosY + f.Height()/2)
+	dist := math.Hypot(dx, dy)
+	if dist < 1 {
+		return
+	}
+
+	speed := math.Max(math.Hypot(f.VelX, f.VelY), 60)
+	blend := math.Min(1, strength*deltaTime)
+	f.VelX += (dx/dist*speed - f.VelX) * blend
+	f.VelY += (dy/dist*speed - f.VelY) * blend
+}
+
+func fishDistance(a, b *Fish) float64 {
+	return math.Hypot(
+		(a.PosX+a.Width()/2)-(b.PosX+b.Width()/2),
+		(a.PosY+a.Height()/2)-(b.PosY+b.Height()/2),
+	)
+}
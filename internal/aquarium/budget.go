@@ -0,0 +1,167 @@
+package aquarium
+
+import (
+	"log"
+	"time"
+
+	"github.com/acuqa/ssh-aquarium/internal/metrics"
+)
+
+const (
+	// DefaultFrameTime is how long rendering and sending a frame may take
+	// before decoration is culled, well within a frame at 30 FPS.
+	DefaultFrameTime = 25 * time.Millisecond
+
+	// cullRecovery is how many frames in a row must stay well within the
+	// time budget before a culled layer comes back.
+	cullRecovery = 30
+)
+
+// Layers that can be culled, lowest priority first. Fish placements, food
+// and the status bar are never culled.
+const (
+	cullBackground = iota // drifting light shafts
+	cullEffects           // bubbles, splashes and crowns
+	cullLabels            // names floating next to fish
+	cullLayers
+)
+
+// FrameBudget limits what a single frame may cost. Frames over budget lose
+// decoration, lowest priority first, before fish are touched.
+type FrameBudget struct {
+	Bytes int           // bytes per frame, 0 for unlimited
+	Time  time.Duration // time to render and send a frame, 0 for unlimited
+}
+
+// CullStats counts the layers left out of frames to stay within the frame
+// budget.
+type CullStats struct {
+	Frames     uint64 `json:"frames"`     // frames with at least one layer culled
+	Background uint64 `json:"background"` // frames without drifting light shafts
+	Effects    uint64 `json:"effects"`    // frames without bubbles, splashes and crowns
+	Labels     uint64 `json:"labels"`     // frames without floating names
+	Bytes      uint64 `json:"bytes"`      // bytes left out
+	Level      int    `json:"level"`      // layers culled because frames take too long
+}
+
+func (s *CullStats) add(other CullStats) {
+	s.Frames += other.Frames
+	s.Background += other.Background
+	s.Effects += other.Effects
+	s.Labels += other.Labels
+	s.Bytes += other.Bytes
+	s.Level = max(s.Level, other.Level)
+}
+
+// culler keeps frames within the frame budget. Frames over the byte budget
+// lose layers until they fit; frames that took too long make the following
+// frames lose a layer more, until frames are fast again.
+type culler struct {
+	budget FrameBudget
+	level  int  // layers culled for time
+	calm   int  // frames in a row well within the time budget
+	stale  bool // culled decoration may still be on screen
+	stats  CullStats
+}
+
+// cull drops layers from f, lowest priority first. It reports whether f is
+// the first complete frame after layers were culled: decoration drawn before
+// culling started was never cleared, so terminals need a full redraw.
+func (c *culler) cull(f *frame) bool {
+	layers := [cullLayers]*string{&f.background, &f.effects, &f.labels}
+	counters := [cullLayers]*uint64{&c.stats.Background, &c.stats.Effects, &c.stats.Labels}
+
+	size := len(f.output) + len(f.status)
+	for _, p := range f.placements {
+		size += len(p.command) // at most, connections only get those that changed
+	}
+	for _, layer := range layers {
+		size += len(*layer)
+	}
+
+	dropped := false
+	for i, layer := range layers {
+		overBytes := c.budget.Bytes > 0 && size > c.budget.Bytes
+		if i >= c.level && !overBytes {
+			break
+		}
+		if *layer == "" {
+			continue
+		}
+		size -= len(*layer)
+		c.stats.Bytes += uint64(len(*layer))
+		*counters[i]++
+		*layer = ""
+		dropped = true
+	}
+	if dropped {
+		c.stats.Frames++
+		c.stale = true
+		return false
+	}
+	stale := c.stale
+	c.stale = false
+	return stale
+}
+
+// took adapts the layers culled for time to how long the last frame took.
+func (c *culler) took(elapsed time.Duration) {
+	if c.budget.Time <= 0 {
+		c.level = 0
+		return
+	}
+	if elapsed > c.budget.Time {
+		metrics.FrameOverruns.Inc()
+	}
+	switch {
+	case elapsed > c.budget.Time && c.level < cullLayers:
+		c.level++
+		c.calm = 0
+		log.Printf("Frame took %v, culling %d decoration layers", elapsed.Round(100*time.Microsecond), c.level)
+	case elapsed < c.budget.Time/2:
+		c.calm++
+		if c.calm >= cullRecovery && c.level > 0 {
+			c.level--
+			c.calm = 0
+			log.Printf("Frames are fast again, culling %d decoration layers", c.level)
+		}
+	default:
+		c.calm = 0
+	}
+	c.stats.Level = c.level
+}
+
+// SetFrameBudget limits what a single frame may cost.
+func (m *Manager) SetFrameBudget(budget FrameBudget) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.culler.budget = budget
+}
+
+// CullStats returns what was culled to stay within the frame budget.
+func (m *Manager) CullStats() CullStats {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.culler.stats
+}
+
+// SetFrameBudget limits what a single frame may cost in every room.
+func (r *Registry) SetFrameBudget(budget FrameBudget) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, room := range r.rooms {
+		room.SetFrameBudget(budget)
+	}
+}
+
+// CullStats adds up what every room culled to stay within the frame budget.
+func (r *Registry) CullStats() CullStats {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var stats CullStats
+	for _, room := range r.rooms {
+		stats.add(room.CullStats())
+	}
+	return stats
+}
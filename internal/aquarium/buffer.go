@@ -7,6 +7,19 @@ import (
 
 type UpdateBuffer struct {
 	commands []string
+	effects  []string  // decorative, the first to go for connections over their bandwidth cap
+	backdrop []string  // decoration behind everything, the first to go when a frame is over budget
+	target   *[]string // where commands currently go, nil for commands
+	water    *Water
+	placements []fishPlacement // fish placed, kept apart from the commands
+	deleted    []placementKey  // fish placements deleted by the commands
+}
+
+// fishPlacement is the command placing a fish. Connections are only sent
+// the placements that changed since the last frame they got.
+type fishPlacement struct {
+	key     placementKey
+	command string
 }
 
 func NewUpdateBuffer() *UpdateBuffer {
@@ -15,38 +28,121 @@ func NewUpdateBuffer() *UpdateBuffer {
 	}
 }
 
+// SetWater sets the background used when drawing or clearing cells.
+func (b *UpdateBuffer) SetWater(water *Water) {
+	b.water = water
+}
+
+// Decorate records everything draw adds as decorative.
+func (b *UpdateBuffer) Decorate(draw func()) {
+	b.target = &b.effects
+	draw()
+	b.target = nil
+}
+
+// DecorateBackground records everything draw adds as decorative
+// background, such as drifting light shafts.
+func (b *UpdateBuffer) DecorateBackground(draw func()) {
+	b.target = &b.backdrop
+	draw()
+	b.target = nil
+}
+
+func (b *UpdateBuffer) add(command string) {
+	if b.target != nil {
+		*b.target = append(*b.target, command)
+		return
+	}
+	b.commands = append(b.commands, command)
+}
+
+func (b *UpdateBuffer) background(row, col int) string {
+	if b.water == nil {
+		return ""
+	}
+	return b.water.Background(row, col)
+}
+
 func (b *UpdateBuffer) AddClearCell(row, col int) {
-	b.commands = append(b.commands, fmt.Sprintf("\x1b[%d;%dH ", row, col))
+	if bg := b.background(row, col); bg != "" {
+		b.add(fmt.Sprintf("\x1b[%d;%dH%s%s\x1b[0m", row, col, bg, b.water.Glyph(row, col)))
+		return
+	}
+	b.add(fmt.Sprintf("\x1b[%d;%dH ", row, col))
 }
 
 func (b *UpdateBuffer) AddText(row, col int, text string) {
-	b.commands = append(b.commands, fmt.Sprintf("\x1b[%d;%dH%s", row, col, text))
+	if bg := b.background(row, col); bg != "" {
+		b.add(fmt.Sprintf("\x1b[%d;%dH%s%s\x1b[0m", row, col, bg, text))
+		return
+	}
+	b.add(fmt.Sprintf("\x1b[%d;%dH%s", row, col, text))
+}
+
+// AddBackgroundFill repaints the whole water area and the floor below it.
+func (b *UpdateBuffer) AddBackgroundFill() {
+	if b.water == nil {
+		return
+	}
+	for row := 1; row <= b.water.rows; row++ {
+		var line strings.Builder
+		fmt.Fprintf(&line, "\x1b[%d;1H", row)
+		current, currentFg := "", ""
+		for col := 1; col <= b.water.columns; col++ {
+			if bg := b.water.Background(row, col); bg != current {
+				line.WriteString(bg)
+				current = bg
+			}
+			tile := b.water.tile(row, col)
+			if tile.fg != "" && tile.fg != currentFg {
+				line.WriteString(tile.fg)
+				currentFg = tile.fg
+			}
+			line.WriteString(tile.glyph)
+		}
+		line.WriteString("\x1b[0m")
+		b.add(line.String())
+	}
 }
 
-func (b *UpdateBuffer) AddFishPlacement(row, col, imageID int, placementID uint64, width, height, xOffset, yOffset int) {
-	// Move cursor to position
-	b.commands = append(b.commands, fmt.Sprintf("\x1b[%d;%dH", row, col))
-	
-	// Add Kitty graphics placement command
-	b.commands = append(b.commands, fmt.Sprintf("\x1b_Ga=p,i=%d,p=%d,c=%d,r=%d,C=1,X=%d,Y=%d,q=1\x1b\\", 
-		imageID, placementID, width, height, xOffset, yOffset))
+func (b *UpdateBuffer) AddFishPlacement(row, col, imageID int, placementID uint64, width, height, xOffset, yOffset, z int) {
+	// Move cursor to position and add Kitty graphics placement command
+	command := fmt.Sprintf("\x1b[%d;%dH\x1b_Ga=p,i=%d,p=%d,c=%d,r=%d,C=1,X=%d,Y=%d,z=%d,q=1\x1b\\",
+		row, col, imageID, placementID, width, height, xOffset, yOffset, z)
+	b.placements = append(b.placements, fishPlacement{placementKey{imageID, placementID}, command})
 }
 
 func (b *UpdateBuffer) AddDeletePlacement(imageID int, placementID uint64) {
-	b.commands = append(b.commands, fmt.Sprintf("\x1b_Ga=d,d=i,i=%d,p=%d,q=1\x1b\\", imageID, placementID))
+	b.add(fmt.Sprintf("\x1b_Ga=d,d=i,i=%d,p=%d,q=1\x1b\\", imageID, placementID))
+	b.deleted = append(b.deleted, placementKey{imageID, placementID})
 }
 
 
 func (b *UpdateBuffer) AddStatusText(row, col int, text string) {
 	// Gray color text
-	b.commands = append(b.commands, fmt.Sprintf("\x1b[%d;%dH\x1b[90m%s\x1b[0m", row, col, text))
+	b.add(fmt.Sprintf("\x1b[%d;%dH\x1b[90m%s\x1b[0m", row, col, text))
 }
 
 func (b *UpdateBuffer) AddColoredStatusText(row, col int, text, color string) {
 	// Colored text with reset
-	b.commands = append(b.commands, fmt.Sprintf("\x1b[%d;%dH%s%s\x1b[0m", row, col, color, text))
+	b.add(fmt.Sprintf("\x1b[%d;%dH%s%s\x1b[0m", row, col, color, text))
 }
 
 func (b *UpdateBuffer) String() string {
+	return b.Essential() + b.Background() + b.Effects()
+}
+
+// Essential returns everything but decoration.
+func (b *UpdateBuffer) Essential() string {
 	return strings.Join(b.commands, "")
+}
+
+// Effects returns the decorative commands.
+func (b *UpdateBuffer) Effects() string {
+	return strings.Join(b.effects, "")
+}
+
+// Background returns the decorative background commands.
+func (b *UpdateBuffer) Background() string {
+	return strings.Join(b.backdrop, "")
 }
\ No newline at end of file
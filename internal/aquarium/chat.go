@@ -0,0 +1,125 @@
+package aquarium
+
+import (
+	"log"
+	"math"
+	"strings"
+	"time"
+)
+
+const (
+	// MaxChatMessage is how many characters a chat bubble holds.
+	MaxChatMessage = 40
+
+	// ChatDuration is how long a chat bubble is shown.
+	ChatDuration = 5 * time.Second
+
+	chatColor = "\x1b[38;5;235;48;5;255m" // dark text on a white bubble
+)
+
+// shownChat is a chat message floating above a fish.
+type shownChat struct {
+	text  string
+	until time.Time
+}
+
+// Say shows a message in a speech bubble above the fish of a connection,
+// to everyone in the room. Control characters are dropped and long
+// messages cut short.
+func (m *Manager) Say(connID uint64, message string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	conn, exists := m.connections[connID]
+	if !exists {
+		return
+	}
+	text := []rune(strings.TrimSpace(sanitizeLabel(message)))
+	if len(text) == 0 {
+		return
+	}
+	if len(text) > MaxChatMessage {
+		text = text[:MaxChatMessage]
+	}
+	now := time.Now()
+	if len(conn.FishIDs) == 0 {
+		m.notifyLocked(conn, "chat: no fish of yours here", now)
+		return
+	}
+	if wait := m.cooldowns.Take(conn.Client, ActionChat, now); wait > 0 {
+		m.notifyLocked(conn, "chat: "+FormatWait(wait), now)
+		return
+	}
+
+	log.Printf("Connection %d: '%s' says %q", connID, conn.Client.Username, string(text))
+	until := now.Add(ChatDuration)
+	for _, fishID := range conn.FishIDs {
+		m.chats[fishID] = shownChat{string(text), until}
+	}
+	m.notify()
+}
+
+// renderChats draws chat bubbles above their fish, or below fish too close
+// to the surface, and clears the cells of bubbles that moved or ended.
+// Callers must hold m.mu.
+func (m *Manager) renderChats(fishData []*Fish, buf *UpdateBuffer, config *TerminalConfig, now time.Time) {
+	type bubble struct {
+		cell
+		text []rune
+	}
+	var bubbles []bubble
+	for _, fish := range fishData {
+		shown, ok := m.chats[fish.ID]
+		if !ok {
+			continue
+		}
+		if now.After(shown.until) {
+			delete(m.chats, fish.ID)
+			continue
+		}
+		if !fish.AwayUntil.IsZero() {
+			continue
+		}
+
+		// One row over the emotes, so both can be seen at once
+		text := []rune(" " + shown.text + " ")
+		if len(text) > config.Columns {
+			continue // Terminal narrower than the bubble
+		}
+		row := int(fish.PosY/float64(config.CellHeight)) - 1
+		if row < 1 {
+			row = int(math.Ceil((fish.PosY+fish.Height())/float64(config.CellHeight))) + 1
+		}
+		center := int((fish.PosX+fish.Width()/2)/float64(config.CellWidth)) + 1
+		col := min(max(1, center-len(text)/2), config.Columns-len(text)+1)
+		if row > config.Rows-config.FloorRows-1 {
+			continue
+		}
+		bubbles = append(bubbles, bubble{cell{row, col}, text})
+	}
+	for id := range m.chats {
+		if _, ok := m.fish[id]; !ok {
+			delete(m.chats, id) // the fish left
+		}
+	}
+
+	drawn := make(map[cell]bool)
+	for _, b := range bubbles {
+		for i := range b.text {
+			drawn[cell{b.Row, b.Col + i}] = true
+		}
+	}
+	for _, old := range m.chatCells {
+		if !drawn[old] {
+			buf.AddClearCell(old.Row, old.Col)
+		}
+	}
+
+	m.chatCells = m.chatCells[:0]
+	for _, b := range bubbles {
+		buf.AddText(b.Row, b.Col, chatColor+string(b.text)+"\x1b[39;49m")
+		for i := range b.text {
+			m.chatCells = append(m.chatCells, cell{b.Row, b.Col + i})
+		}
+	}
+}
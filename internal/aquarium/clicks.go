@@ -0,0 +1,173 @@
+package aquarium
+
+import (
+	"errors"
+	"log"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/acuqa/ssh-aquarium/internal/store"
+)
+
+const (
+	clickSaveInterval = 30 * time.Second
+	crownGlyph        = "\x1b[38;5;220m♛"
+)
+
+// ClickCounts is how often each fish was clicked on one day, keyed by the
+// fish's name.
+type ClickCounts = store.ClickCounts
+
+// ClickStats counts clicks per fish for the current day (UTC). It is shared
+// by all rooms and optionally persisted to a state directory.
+type ClickStats struct {
+	mu       sync.Mutex
+	counts   ClickCounts
+	store    store.Store
+	dirty    bool
+	lastSave time.Time
+}
+
+func NewClickStats() *ClickStats {
+	return &ClickStats{
+		counts: ClickCounts{Day: today(), Counts: make(map[string]int)},
+	}
+}
+
+func today() string {
+	return time.Now().UTC().Format("2006-01-02")
+}
+
+// SetStore loads today's counts from state and saves future clicks there.
+func (c *ClickStats) SetStore(state store.Store) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.store = state
+	counts, err := state.LoadClicks()
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	if counts.Day == c.counts.Day && counts.Counts != nil {
+		c.counts = counts
+	}
+	return nil
+}
+
+// Record counts a click on the named fish.
+func (c *ClickStats) Record(name string) {
+	if name == "" {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.rollover()
+	c.counts.Counts[name]++
+	c.dirty = true
+	if time.Since(c.lastSave) >= clickSaveInterval {
+		c.saveLocked()
+	}
+}
+
+// Top returns the most-clicked fish of the day, or "" if nothing was
+// clicked yet. Ties go to the alphabetically first name.
+func (c *ClickStats) Top() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.rollover()
+	top, best := "", 0
+	for name, count := range c.counts.Counts {
+		if count > best || (count == best && name < top) {
+			top, best = name, count
+		}
+	}
+	return top
+}
+
+// Snapshot returns a copy of today's counts.
+func (c *ClickStats) Snapshot() ClickCounts {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.rollover()
+	counts := ClickCounts{Day: c.counts.Day, Counts: make(map[string]int, len(c.counts.Counts))}
+	for name, count := range c.counts.Counts {
+		counts.Counts[name] = count
+	}
+	return counts
+}
+
+// Save writes unsaved counts to the state directory.
+func (c *ClickStats) Save() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.saveLocked()
+}
+
+func (c *ClickStats) saveLocked() {
+	if c.store == nil || !c.dirty {
+		return
+	}
+	if err := c.store.SaveClicks(c.counts); err != nil {
+		log.Printf("Failed to save click statistics: %v", err)
+		return
+	}
+	c.dirty = false
+	c.lastSave = time.Now()
+}
+
+// rollover starts a fresh count at midnight UTC.
+func (c *ClickStats) rollover() {
+	if day := today(); day != c.counts.Day {
+		c.counts = ClickCounts{Day: day, Counts: make(map[string]int)}
+		c.dirty = true
+	}
+}
+
+type cell struct{ Row, Col int }
+
+// renderCrowns draws a crown above every fish carrying the name of the day's
+// most-clicked fish and clears crowns that moved or lost their title.
+func (m *Manager) renderCrowns(fishData []*Fish, buf *UpdateBuffer, config *TerminalConfig) {
+	top := m.clicks.Top()
+
+	var crowns []cell
+	if top != "" {
+		for _, fish := range fishData {
+			if fish.Username != top || !fish.AwayUntil.IsZero() {
+				continue
+			}
+			row := int(fish.PosY / float64(config.CellHeight))
+			col := int((fish.PosX+fish.Width()/2)/float64(config.CellWidth)) + 1
+			if row < 1 || col < 1 || col > config.Columns || slices.Contains(m.emoteCells, cell{row, col}) {
+				continue // an emote takes the crown's place for a moment
+			}
+			crowns = append(crowns, cell{row, col})
+		}
+	}
+
+	for _, old := range m.crowns {
+		stale := true
+		for _, c := range crowns {
+			if c == old {
+				stale = false
+				break
+			}
+		}
+		if stale {
+			buf.AddClearCell(old.Row, old.Col)
+		}
+	}
+	for _, c := range crowns {
+		buf.AddText(c.Row, c.Col, crownGlyph)
+	}
+	m.crowns = crowns
+}
@@ -0,0 +1,187 @@
+package aquarium
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Action is something a user does that everyone in the room sees.
+type Action string
+
+const (
+	ActionFood Action = "food" // dropping a food pellet
+	ActionPoke Action = "poke" // clicking your fish so it blows bubbles and turns
+	ActionChat Action = "chat" // saying something in a bubble above your fish
+)
+
+// DefaultCooldowns keep a single user from flooding a public tank.
+var DefaultCooldowns = map[Action]time.Duration{
+	ActionFood: 5 * time.Second,
+	ActionPoke: 2 * time.Second,
+	ActionChat: 3 * time.Second,
+}
+
+// noticeDuration is how long a notice such as a cooldown stays on screen.
+const noticeDuration = 3 * time.Second
+
+// Cooldowns limit how often each user may take actions that affect
+// everyone. Users are told apart by SSH key, or by address for password
+// logins, so reconnecting or switching rooms doesn't reset a cooldown.
+type Cooldowns struct {
+	mu        sync.Mutex
+	durations map[Action]time.Duration
+	last      map[string]map[Action]time.Time // by user
+	exempt    map[string]bool                 // SSH key fingerprints without cooldowns
+	swept     time.Time
+}
+
+func NewCooldowns() *Cooldowns {
+	c := &Cooldowns{last: make(map[string]map[Action]time.Time)}
+	c.SetDurations(DefaultCooldowns)
+	return c
+}
+
+// ParseCooldowns parses cooldowns such as "food=5s,poke=2s". Actions left
+// out keep their default, 0 turns a cooldown off.
+func ParseCooldowns(spec string) (map[Action]time.Duration, error) {
+	durations := make(map[Action]time.Duration, len(DefaultCooldowns))
+	for action, d := range DefaultCooldowns {
+		durations[action] = d
+	}
+	for _, part := range strings.Split(spec, ",") {
+		if part = strings.TrimSpace(part); part == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(part, "=")
+		action := Action(strings.TrimSpace(name))
+		if _, known := DefaultCooldowns[action]; !ok || !known {
+			return nil, fmt.Errorf("expected action=duration with action food, poke or chat, got %q", part)
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid cooldown %q", value)
+		}
+		durations[action] = d
+	}
+	return durations, nil
+}
+
+// SetDurations changes how long users wait between actions.
+func (c *Cooldowns) SetDurations(durations map[Action]time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.durations = make(map[Action]time.Duration, len(durations))
+	for action, d := range durations {
+		c.durations[action] = d
+	}
+}
+
+// SetExempt lets the users with these key fingerprints, e.g. admins, act
+// without cooldowns.
+func (c *Cooldowns) SetExempt(fingerprints []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.exempt = make(map[string]bool, len(fingerprints))
+	for _, fp := range fingerprints {
+		if fp != "" {
+			c.exempt[fp] = true
+		}
+	}
+}
+
+// Take records the action if the client's cooldown for it is over, and
+// otherwise returns how long the client still has to wait.
+func (c *Cooldowns) Take(client ClientInfo, action Action, now time.Time) time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cooldown := c.durations[action]
+	if cooldown <= 0 || c.exempt[client.Fingerprint] {
+		return 0
+	}
+	c.sweepLocked(now)
+
+	user := cooldownUser(client)
+	if wait := c.last[user][action].Add(cooldown).Sub(now); wait > 0 {
+		return wait
+	}
+	if c.last[user] == nil {
+		c.last[user] = make(map[Action]time.Time)
+	}
+	c.last[user][action] = now
+	return 0
+}
+
+// sweepLocked forgets users whose cooldowns are all over, once a minute.
+func (c *Cooldowns) sweepLocked(now time.Time) {
+	if now.Sub(c.swept) < time.Minute {
+		return
+	}
+	c.swept = now
+	for user, actions := range c.last {
+		active := false
+		for action, at := range actions {
+			active = active || now.Sub(at) < c.durations[action]
+		}
+		if !active {
+			delete(c.last, user)
+		}
+	}
+}
+
+// cooldownUser identifies a user for cooldowns.
+func cooldownUser(client ClientInfo) string {
+	if client.Fingerprint != "" {
+		return client.Fingerprint
+	}
+	host, _, err := net.SplitHostPort(client.RemoteAddr)
+	if err != nil {
+		return client.RemoteAddr
+	}
+	return host
+}
+
+// FormatWait says how long to wait, e.g. "try again in 4s".
+func FormatWait(wait time.Duration) string {
+	return fmt.Sprintf("try again in %.0fs", math.Ceil(wait.Seconds()))
+}
+
+// notifyLocked shows a notice to one connection for a few seconds, in the
+// top right corner of the tank. Callers must hold m.mu.
+func (m *Manager) notifyLocked(conn *Connection, text string, now time.Time) {
+	conn.notice = sanitizeLabel(text)
+	conn.noticeUntil = now.Add(noticeDuration)
+	m.notify()
+}
+
+// renderNotice draws the connection's notice, or clears it once it is
+// over. Callers must hold m.mu.
+func (m *Manager) renderNotice(conn *Connection, water *Water, config *TerminalConfig, now time.Time) string {
+	if conn.notice == "" && conn.noticeCols == 0 {
+		return ""
+	}
+	buf := NewUpdateBuffer()
+	buf.SetWater(water)
+
+	// Clear what was drawn before, unless the same text covers it again
+	text := []rune(" " + conn.notice + " ")
+	if now.After(conn.noticeUntil) {
+		conn.notice = ""
+		text = nil
+	}
+	if conn.noticeCols != len(text) {
+		for col := config.Columns - conn.noticeCols + 1; col <= config.Columns; col++ {
+			buf.AddClearCell(1, col)
+		}
+	}
+	conn.noticeCols = 0
+	if len(text) > 0 && len(text) <= config.Columns {
+		buf.AddText(1, config.Columns-len(text)+1, "\x1b[48;5;236m\x1b[97m"+string(text))
+		conn.noticeCols = len(text)
+	}
+	return buf.String()
+}
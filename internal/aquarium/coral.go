@@ -0,0 +1,82 @@
+package aquarium
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	// CoralMaturity is how long a tank has to run before its coral is fully
+	// grown.
+	CoralMaturity = 30 * 24 * time.Hour
+
+	coralStages    = 120  // growth steps until maturity, each repaints the tank once
+	coralChance    = 0.04 // chance a column grows a coral colony
+	coralMaxHeight = 6    // rows of the tallest fully grown colony
+	coralRow       = -1   // cellHash row for coral, apart from the floor rows
+)
+
+// coralKind is how one kind of coral looks, stem from the bottom up and a
+// tip on top.
+type coralKind struct {
+	fg   string
+	stem string
+	tip  string
+}
+
+var coralKinds = []coralKind{
+	{"\x1b[38;5;204m", "┃", "ψ"}, // pink branching coral
+	{"\x1b[38;5;209m", "│", "Y"}, // orange sea fan
+	{"\x1b[38;5;141m", "┃", "♣"}, // purple cauliflower coral
+	{"\x1b[38;5;174m", "╽", "¥"}, // soft coral
+}
+
+// coralStage returns how far coral has grown in a tank of the given age,
+// from 0 to coralStages.
+func coralStage(age time.Duration) int {
+	if age <= 0 {
+		return 0
+	}
+	return min(coralStages, int(float64(coralStages)*age.Seconds()/CoralMaturity.Seconds()))
+}
+
+// layoutCoral places the coral colonies growing up from the floor. Like the
+// floor, colonies depend only on the seed and their column; each sprouts at
+// its own point in the tank's life and grows to its own height.
+func layoutCoral(columns, depth, stage int, seed int64) map[cell]floorTile {
+	coral := make(map[cell]floorTile)
+	if stage == 0 || depth <= 0 {
+		return coral
+	}
+	progress := float64(stage) / coralStages
+
+	for col := 1; col <= columns; col++ {
+		h := cellHash(seed, coralRow, col)
+		if float64(h&0xffff)/0x10000 >= coralChance {
+			continue
+		}
+		kind := coralKinds[(h>>16)%uint64(len(coralKinds))]
+		maxHeight := 1 + int((h>>24)%coralMaxHeight)
+		sprout := float64(h>>32&0xff) / 0x100 * 0.6 // late colonies sprout up to 60% into the tank's life
+
+		growth := (progress - sprout) / (1 - sprout)
+		height := min(int(math.Ceil(growth*float64(maxHeight))), maxHeight, depth/2)
+		for i := 0; i < height; i++ {
+			glyph := kind.stem
+			if i == height-1 {
+				glyph = kind.tip
+			}
+			coral[cell{Row: depth - i, Col: col}] = floorTile{kind.fg, glyph}
+		}
+	}
+	return coral
+}
+
+// SetFounded sets when the tank started running, which decides how far its
+// coral has grown.
+func (m *Manager) SetFounded(t time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.founded = t
+	m.notify()
+}
@@ -0,0 +1,133 @@
+package aquarium
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// debugColor is the SGR color of the debug overlay, bright magenta to stand
+// out from every theme.
+const debugColor = "\x1b[95m"
+
+// debugArrows point along a velocity, indexed by octant counterclockwise from
+// east. Rows grow downwards, so north is negative y.
+var debugArrows = [8]string{"→", "↗", "↑", "↖", "←", "↙", "↓", "↘"}
+
+// ToggleDebugOverlay shows or hides the fish AI debug overlay for one
+// connection and reports whether it is now shown.
+func (m *Manager) ToggleDebugOverlay(connID uint64) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	conn, exists := m.connections[connID]
+	if !exists {
+		return false
+	}
+	conn.debugOverlay = !conn.debugOverlay
+
+	// Redraw so the overlay disappears at once when turned off
+	conn.dirty.Store(true)
+	conn.lastRefresh = time.Time{}
+	m.notify()
+	return conn.debugOverlay
+}
+
+// renderDebugOverlay draws each fish's bounding box, its velocity as an
+// arrow of one second's travel, and what it steers towards: the nearest food
+// pellet, or a fry's parent. Cells drawn last frame that are not drawn again
+// are cleared.
+func (m *Manager) renderDebugOverlay(fishData []*Fish, buf *UpdateBuffer, config *TerminalConfig) {
+	m.mu.RLock()
+	overlay := make(map[cell]string)
+	var order []cell
+	put := func(row, col int, text string) {
+		if row < 1 || row >= config.Rows || col < 1 || col > config.Columns {
+			return
+		}
+		c := cell{row, col}
+		if _, ok := overlay[c]; !ok {
+			order = append(order, c)
+		}
+		overlay[c] = text
+	}
+	text := func(row, col int, s string) {
+		for _, r := range s {
+			put(row, col, string(r))
+			col++
+		}
+	}
+
+	cw, ch := float64(config.CellWidth), float64(config.CellHeight)
+	for _, fish := range fishData {
+		if !fish.AwayUntil.IsZero() {
+			continue
+		}
+
+		// Bounding box, one cell outside the fish so the image doesn't hide it
+		y := fish.PosY + fish.bobbingOffset()
+		top := int(y / ch)
+		bottom := int(math.Ceil((y+fish.Height())/ch)) + 1
+		left := int(fish.PosX / cw)
+		right := int(math.Ceil((fish.PosX+fish.Width())/cw)) + 1
+		for col := left + 1; col < right; col++ {
+			put(top, col, "─")
+			put(bottom, col, "─")
+		}
+		for row := top + 1; row < bottom; row++ {
+			put(row, left, "│")
+			put(row, right, "│")
+		}
+		put(top, left, "┌")
+		put(top, right, "┐")
+		put(bottom, left, "└")
+		put(bottom, right, "┘")
+		text(bottom+1, left, fmt.Sprintf("v%+.0f,%+.0f h%.0f%%", fish.VelX, fish.VelY, fish.Hunger*100))
+
+		// Velocity: where the fish will be in one second, from its center
+		cx, cy := fish.PosX+fish.Width()/2, y+fish.Height()/2
+		dx, dy := fish.VelX/cw, fish.VelY/ch
+		if steps := int(math.Max(math.Abs(dx), math.Abs(dy))); steps > 0 {
+			octant := int(math.Round(math.Atan2(-fish.VelY, fish.VelX)/(math.Pi/4)+8)) % 8
+			for i := 1; i <= steps; i++ {
+				row := int(cy/ch+dy*float64(i)/float64(steps)) + 1
+				col := int(cx/cw+dx*float64(i)/float64(steps)) + 1
+				if row > top && row < bottom && col > left && col < right {
+					continue // under the fish
+				}
+				glyph := "·"
+				if i == steps {
+					glyph = debugArrows[octant]
+				}
+				put(row, col, glyph)
+			}
+		}
+
+		// Steering target
+		var tx, ty float64
+		var what string
+		if parent, ok := m.fish[fish.ParentID]; ok && fish.ParentID != 0 && fish.LeaveAt.IsZero() {
+			tx, ty, what = parent.PosX+parent.Width()/2, parent.PosY+parent.Height()/2, "parent"
+		} else if len(m.pellets) > 0 {
+			pellet := m.nearestPellet(fish)
+			tx, ty, what = pellet.X, pellet.Y, "food"
+		}
+		if what != "" {
+			row, col := int(ty/ch)+1, int(tx/cw)+1
+			put(row, col, "×")
+			text(top, left+1, what)
+		}
+	}
+	m.mu.RUnlock()
+
+	for _, old := range m.debugCells {
+		if _, ok := overlay[old]; !ok {
+			buf.AddClearCell(old.Row, old.Col)
+		}
+	}
+	m.debugCells = m.debugCells[:0]
+	for _, c := range order {
+		buf.AddText(c.Row, c.Col, debugColor+overlay[c])
+		m.debugCells = append(m.debugCells, c)
+	}
+}
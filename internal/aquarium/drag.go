@@ -0,0 +1,150 @@
+package aquarium
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	dragCoast     = 2 * time.Second // a flung fish eases back to its own pace
+	dragRecovery  = 1.5             // share of the difference to its pace a coasting fish makes up per second
+	maxFling      = 1200.0          // pixels per second a fish can be flung at
+	dragSmoothing = 0.5             // weight of the latest move in the fling velocity
+)
+
+// fishDrag is a user's own fish held with the mouse. The fish follows the
+// pointer while the button is held, and once it is released swims off with
+// the speed it was moved at, slowing down to its own pace.
+type fishDrag struct {
+	fishID     uint64
+	offX, offY float64 // from the fish's corner to where it was grabbed
+	x, y       float64 // where the pointer is, in pixels
+	moved      bool    // it was dragged, not just clicked
+	at         time.Time
+	velX, velY float64   // of the pointer, pixels per second
+	paceX      float64   // the fish's speed when it was grabbed
+	paceY      float64   // and how fast it was climbing or sinking
+	released   time.Time // zero while held
+	flung      bool      // the fish got the pointer's speed
+}
+
+// grabFish takes hold of a fish clicked at x, y. Callers must hold m.mu.
+func (m *Manager) grabFish(conn *Connection, fish *Fish, x, y float64, now time.Time) {
+	if fish.Remote || !fish.AwayUntil.IsZero() || !fish.LeaveAt.IsZero() {
+		return
+	}
+	if m.drags == nil {
+		m.drags = make(map[uint64]*fishDrag)
+	}
+	m.drags[conn.ID] = &fishDrag{
+		fishID: fish.ID,
+		offX:   x - fish.PosX,
+		offY:   y - fish.PosY,
+		x:      x,
+		y:      y,
+		at:     now,
+		paceX:  math.Abs(fish.VelX),
+		paceY:  fish.VelY,
+	}
+}
+
+// HandleMouseDrag moves the fish the connection holds to a cell while the
+// button is held, or lets go of it once released. Spectators move their
+// laser dot instead.
+func (m *Manager) HandleMouseDrag(connID uint64, col, row int, released bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	conn, exists := m.connections[connID]
+	if m.termConfig == nil || !exists {
+		return
+	}
+	if p := conn.projection.Load(); p != nil {
+		row, col = p.WorldCell(row, col)
+	}
+	now := time.Now()
+
+	if len(conn.FishIDs) == 0 {
+		if !released {
+			m.movePointer(conn, row, col, now)
+		}
+		return
+	}
+	drag, ok := m.drags[connID]
+	if !ok || !drag.released.IsZero() {
+		return
+	}
+	if released {
+		if !drag.moved {
+			delete(m.drags, connID) // a click, the fish keeps swimming
+			return
+		}
+		// A pointer that stopped before letting go doesn't fling
+		if now.Sub(drag.at) > 100*time.Millisecond {
+			drag.velX, drag.velY = 0, 0
+		}
+		drag.released = now
+		m.notify()
+		return
+	}
+
+	x := float64((col-1)*m.termConfig.CellWidth + m.termConfig.CellWidth/2)
+	y := float64((row-1)*m.termConfig.CellHeight + m.termConfig.CellHeight/2)
+	if dt := now.Sub(drag.at).Seconds(); dt > 0 {
+		drag.velX += ((x-drag.x)/dt - drag.velX) * dragSmoothing
+		drag.velY += ((y-drag.y)/dt - drag.velY) * dragSmoothing
+	}
+	drag.x, drag.y, drag.at, drag.moved = x, y, now, true
+	m.notify()
+}
+
+// followDrags keeps held fish under the pointer, facing the way they are
+// moved, and eases flung fish back to their own pace. Callers must hold
+// m.mu.
+func (m *Manager) followDrags(fishData []*Fish, config *TerminalConfig, deltaTime float64, now time.Time) {
+	for connID, drag := range m.drags {
+		var fish *Fish
+		for _, f := range fishData {
+			if f.ID == drag.fishID {
+				fish = f
+			}
+		}
+		_, watching := m.connections[connID]
+		if fish == nil || !watching && drag.released.IsZero() {
+			delete(m.drags, connID)
+			continue
+		}
+
+		if drag.released.IsZero() {
+			if !drag.moved {
+				continue
+			}
+			fish.PosX = max(0, min(drag.x-drag.offX, float64(config.Columns*config.CellWidth)-fish.Width()))
+			fish.PosY = max(0, min(drag.y-drag.offY, tankHeight(config)-fish.Height()))
+			if drag.velX != 0 {
+				fish.VelX = math.Copysign(drag.paceX, drag.velX)
+			}
+			continue
+		}
+
+		if !drag.flung {
+			// Off it goes at the speed it was moved at
+			velX, velY := drag.velX, drag.velY
+			if speed := math.Hypot(velX, velY); speed > maxFling {
+				velX, velY = velX/speed*maxFling, velY/speed*maxFling
+			}
+			if velX == 0 && velY == 0 {
+				velX = math.Copysign(drag.paceX, fish.VelX)
+			}
+			fish.VelX, fish.VelY = velX, velY
+			drag.flung = true
+		}
+		pace := math.Min(1, dragRecovery*deltaTime)
+		if now.Sub(drag.released) >= dragCoast {
+			pace = 1
+			delete(m.drags, connID)
+		}
+		fish.VelX += (math.Copysign(drag.paceX, fish.VelX) - fish.VelX) * pace
+		fish.VelY += (drag.paceY - fish.VelY) * pace
+	}
+}
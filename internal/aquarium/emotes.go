@@ -0,0 +1,94 @@
+package aquarium
+
+import "time"
+
+// Emote is a short reaction a user shows above their fish.
+type Emote struct {
+	Name  string
+	Glyph string // one or two cells, with its color
+}
+
+// Emotes are picked with the number keys, in this order.
+var Emotes = []Emote{
+	{"heart", "\x1b[38;5;204m♥"},
+	{"zzz", "\x1b[38;5;153mzZ"},
+	{"exclamation", "\x1b[1;38;5;226m!\x1b[22m"},
+}
+
+// EmoteDuration is how long an emote is shown.
+const EmoteDuration = 2 * time.Second
+
+// shownEmote is an emote above a fish.
+type shownEmote struct {
+	emote Emote
+	until time.Time
+}
+
+// ShowEmote shows an emote above the fish of a connection, to everyone in
+// the room.
+func (m *Manager) ShowEmote(connID uint64, emote Emote) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	conn, exists := m.connections[connID]
+	if !exists {
+		return
+	}
+	until := time.Now().Add(EmoteDuration)
+	for _, fishID := range conn.FishIDs {
+		m.emotes[fishID] = shownEmote{emote, until}
+	}
+	m.notify()
+}
+
+// renderEmotes draws the emotes above their fish and clears the cells of
+// emotes that moved or ended. Callers must hold m.mu.
+func (m *Manager) renderEmotes(fishData []*Fish, buf *UpdateBuffer, config *TerminalConfig, now time.Time) {
+	var cells []labelCell
+	for _, fish := range fishData {
+		shown, ok := m.emotes[fish.ID]
+		if !ok {
+			continue
+		}
+		if now.After(shown.until) {
+			delete(m.emotes, fish.ID)
+			continue
+		}
+		if !fish.AwayUntil.IsZero() {
+			continue
+		}
+
+		// Right above the fish, where a crown would be
+		row := int(fish.PosY / float64(config.CellHeight))
+		col := int((fish.PosX+fish.Width()/2)/float64(config.CellWidth)) + 1
+		if row < 1 || col < 1 || col > config.Columns-1 {
+			continue
+		}
+		cells = append(cells, labelCell{cell{row, col}, shown.emote.Glyph})
+	}
+	for id := range m.emotes {
+		if _, ok := m.fish[id]; !ok {
+			delete(m.emotes, id) // the fish left
+		}
+	}
+
+	// Emotes are at most two cells wide, clear both
+	drawn := make(map[cell]bool, 2*len(cells))
+	for _, c := range cells {
+		drawn[c.cell] = true
+		drawn[cell{c.Row, c.Col + 1}] = true
+	}
+	for _, old := range m.emoteCells {
+		for _, c := range []cell{old, {old.Row, old.Col + 1}} {
+			if !drawn[c] {
+				buf.AddClearCell(c.Row, c.Col)
+			}
+		}
+	}
+
+	m.emoteCells = m.emoteCells[:0]
+	for _, c := range cells {
+		buf.AddText(c.Row, c.Col, c.text)
+		m.emoteCells = append(m.emoteCells, c.cell)
+	}
+}
@@ -0,0 +1,82 @@
+package aquarium
+
+import (
+	"bytes"
+	"unicode/utf8"
+)
+
+// tokenKind is what a token of terminal output is.
+type tokenKind int
+
+const (
+	tokenText    tokenKind = iota // one character
+	tokenControl                  // a C0 control byte or DEL
+	tokenCSI                      // control sequence: ESC [ parameters final byte
+	tokenAPC                      // application program command, used by Kitty graphics: ESC _ ... ESC \
+	tokenDCS                      // device control string, used by Sixel images: ESC P ... ESC \
+	tokenOSC                      // operating system command, used by hyperlinks: ESC ] ... ESC \ or BEL
+	tokenEscape                   // any other escape, ESC and one byte
+	tokenPartial                  // a sequence cut off at the end of the output
+)
+
+// token is a piece of terminal output. Frame filters such as projections,
+// viewports and color adaptation walk output token by token, so they agree
+// on where sequences end.
+type token struct {
+	kind  tokenKind
+	raw   []byte // the whole token
+	body  []byte // parameters of a CSI, contents of an APC, DCS or OSC
+	final byte   // final byte of a CSI
+}
+
+// nextToken returns the token data starts with. data must not be empty.
+func nextToken(data []byte) token {
+	if data[0] != 0x1b {
+		if data[0] < 0x20 || data[0] == 0x7f {
+			return token{kind: tokenControl, raw: data[:1]}
+		}
+		_, size := utf8.DecodeRune(data)
+		return token{kind: tokenText, raw: data[:size]}
+	}
+	if len(data) == 1 {
+		return token{kind: tokenPartial, raw: data}
+	}
+
+	switch data[1] {
+	case '[':
+		end := 2
+		for end < len(data) && (data[end] < 0x40 || data[end] > 0x7e) {
+			end++
+		}
+		if end == len(data) {
+			return token{kind: tokenPartial, raw: data}
+		}
+		return token{kind: tokenCSI, raw: data[:end+1], body: data[2:end], final: data[end]}
+
+	case '_', 'P':
+		end := bytes.Index(data[2:], []byte("\x1b\\"))
+		if end < 0 {
+			return token{kind: tokenPartial, raw: data}
+		}
+		kind := tokenAPC
+		if data[1] == 'P' {
+			kind = tokenDCS
+		}
+		return token{kind: kind, raw: data[:2+end+2], body: data[2 : 2+end]}
+
+	case ']':
+		for i := 2; i < len(data); i++ {
+			switch {
+			case data[i] == '\a':
+				return token{kind: tokenOSC, raw: data[:i+1], body: data[2:i]}
+			case data[i] == 0x1b && i+1 < len(data) && data[i+1] == '\\':
+				return token{kind: tokenOSC, raw: data[:i+2], body: data[2:i]}
+			}
+		}
+		return token{kind: tokenPartial, raw: data}
+	}
+	if data[1] == 0x1b {
+		return token{kind: tokenEscape, raw: data[:1]} // cut off by the next one
+	}
+	return token{kind: tokenEscape, raw: data[:2]}
+}
@@ -0,0 +1,39 @@
+package aquarium
+
+import "testing"
+
+func TestNextToken(t *testing.T) {
+	for _, tt := range []struct {
+		data string
+		kind tokenKind
+		raw  string
+		body string
+	}{
+		{"a\x1b[0m", tokenText, "a", ""},
+		{"░x", tokenText, "░", ""},
+		{"\r\n", tokenControl, "\r", ""},
+		{"\x1b[12;4Hx", tokenCSI, "\x1b[12;4H", "12;4"},
+		{"\x1b_Ga=d,q=1\x1b\\x", tokenAPC, "\x1b_Ga=d,q=1\x1b\\", "Ga=d,q=1"},
+		{"\x1bPq#0;2;0;0;0\x1b\\x", tokenDCS, "\x1bPq#0;2;0;0;0\x1b\\", "q#0;2;0;0;0"},
+		{"\x1b]8;;https://acqua.fish\ax", tokenOSC, "\x1b]8;;https://acqua.fish\a", "8;;https://acqua.fish"},
+		{"\x1b]8;;\x1b\\x", tokenOSC, "\x1b]8;;\x1b\\", "8;;"},
+		{"\x1b7x", tokenEscape, "\x1b7", ""},
+		{"\x1b\x1b[m", tokenEscape, "\x1b", ""},
+		{"\x1b[38;5", tokenPartial, "\x1b[38;5", ""},
+		{"\x1b_Ga=p", tokenPartial, "\x1b_Ga=p", ""},
+		{"\x1b", tokenPartial, "\x1b", ""},
+	} {
+		got := nextToken([]byte(tt.data))
+		if got.kind != tt.kind || string(got.raw) != tt.raw || string(got.body) != tt.body {
+			t.Errorf("nextToken(%q) = %v %q %q, want %v %q %q", tt.data, got.kind, got.raw, got.body, tt.kind, tt.raw, tt.body)
+		}
+	}
+}
+
+func TestAdaptOutputKeepsSequences(t *testing.T) {
+	data := "\x1b[1;1H\x1b[38;2;0;0;255m░\x1b]8;;https://acqua.fish/é\x1b\\·\x1b_Ga=d\x1b\\"
+	want := "\x1b[1;1H\x1b[38;5;21m.\x1b]8;;https://acqua.fish/é\x1b\\.\x1b_Ga=d\x1b\\"
+	if got := string(adaptOutput([]byte(data), Colors256, true)); got != want {
+		t.Errorf("adaptOutput = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,63 @@
+package aquarium
+
+import "time"
+
+// Events the aquarium reports to its EventFunc.
+const (
+	EventConnect   = "connect"   // someone started watching
+	EventMilestone = "milestone" // a celebrated visitor arrived
+	EventStorm     = "storm"     // a storm rolled in
+)
+
+// Event is something that happened in the aquarium, for integrations.
+type Event struct {
+	Name        string    `json:"event"`
+	Room        string    `json:"room"`
+	Username    string    `json:"username,omitempty"`
+	Fingerprint string    `json:"fingerprint,omitempty"` // SHA256 key fingerprint, empty for password logins
+	RemoteAddr  string    `json:"remote_addr,omitempty"`
+	Visitors    int       `json:"visitors,omitempty"` // unique visitors so far, for connect and milestone
+	At          time.Time `json:"at"`
+}
+
+// EventFunc is told about events. It is called with locks held, so it must
+// not block or call back into the aquarium.
+type EventFunc func(Event)
+
+// SetEvents has fn told about events in every room.
+func (r *Registry) SetEvents(fn EventFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = fn
+	for name, room := range r.rooms {
+		room.setEvents(name, fn)
+	}
+}
+
+// emit tells the EventFunc, if any, about an event.
+func (r *Registry) emit(event Event) {
+	r.mu.RLock()
+	fn := r.events
+	r.mu.RUnlock()
+	if fn != nil {
+		event.At = time.Now()
+		fn(event)
+	}
+}
+
+func (m *Manager) setEvents(room string, fn EventFunc) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.room = room
+	m.events = fn
+}
+
+// emitLocked tells the EventFunc, if any, about an event in the room.
+// Callers must hold m.mu.
+func (m *Manager) emitLocked(event Event, now time.Time) {
+	if m.events != nil {
+		event.Room = m.room
+		event.At = now
+		m.events(event)
+	}
+}
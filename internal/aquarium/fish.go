@@ -3,6 +3,7 @@ package aquarium
 import (
 	"math"
 	"math/rand"
+	"time"
 )
 
 const (
@@ -12,6 +13,17 @@ const (
 	BobbingFrequency = 4.8  // bobbing cycles per second (was 0.08 * 60fps)
 	BubbleSpawnRate  = 0.06 // bubbles per second (was 0.001 * 60fps)
 	BubbleSpeed      = 240.0 // pixels per second (was 4.0 * 60fps)
+
+	HungerRate      = 1.0 / 180 // hunger gained per second, starving after 3 minutes
+	WellFedHunger   = 0.3       // fish below this hunger grow
+	GrowthRate      = 0.01      // size gained per second while well-fed
+	MaxFishSize     = 2.0
+	HungrySlowdown  = 0.5  // fraction of speed lost when starving
+	PelletNutrition = 0.35 // hunger removed by one food pellet
+
+	DepthShrink  = 0.45 // fraction of size lost by the farthest fish
+	DepthSpeed   = 0.04 // most depth drifted per second
+	depthZLayers = 100  // z-index steps between the nearest and farthest fish
 )
 
 type Fish struct {
@@ -28,6 +40,24 @@ type Fish struct {
 	BubblesToClear []struct{ Row, Col int }
 	Username    string
 	Color       string
+	Remote      bool      // mirrored from another cluster node
+	EdgeHit     int       // -1 when the fish bounced off the left wall this frame, 1 for the right wall
+	AwayUntil   time.Time // visiting a federated aquarium until then
+	AwayEdge    int       // wall the fish left through
+	LeaveAt     time.Time // visitor from a federated aquarium heads home after this
+	Hunger      float64   // 0 when full, 1 when starving
+	Size        float64   // render scale, grows while well-fed
+	Eaten       int       // food pellets eaten, across sessions for owned fish
+	Species     string
+	ParentID    uint64    // set for fry following a parent
+	FollowUntil time.Time // fry stops following its parent after this
+	LastBred    time.Time
+	NPC         bool      // unowned fish added by the population policy
+	ParkedFor   string    // owner of a restored fish, who gets it back on reconnecting
+	Turbulence  float64   // how stirred up the water is, 0 when calm and 1 in a storm
+	Depth       float64   // 0 at the front glass, 1 at the back of the tank
+	VelDepth    float64   // depth per second
+	cruise      float64   // speed schooling keeps the fish at, 0 until it first schools
 }
 
 type Bubble struct {
@@ -37,71 +67,129 @@ type Bubble struct {
 	Age     int
 	PrevCol int
 	PrevRow int
+	Owner   uint64 // connection whose fish blew the bubble, 0 for unowned fish
+	Popped  bool   // clicked, removed on the next update
 }
 
-func NewFish(id, ownerID uint64, termWidth, termHeight, cellWidth, cellHeight int, username, color string) *Fish {
-	// Reserve space for floor tiles and status bar
-	// Floor tiles are 48x48 pixels, so they might take more than 1 row
-	tilePixelSize := 48
-	tileHeight := (tilePixelSize + cellHeight - 1) / cellHeight
-	floorHeight := tileHeight * cellHeight
-	statusHeight := cellHeight
-	usableHeight := termHeight - floorHeight - statusHeight
+func NewFish(id, ownerID uint64, config *TerminalConfig, username, color string) *Fish {
+	termWidth := config.Columns * config.CellWidth
+	
+	// Reserve space for the floor and status bar
+	usableHeight := tankHeight(config)
 	
 	return &Fish{
 		ID:          id,
 		OwnerID:     ownerID,
 		PlacementID: id,
 		PosX:        rand.Float64() * float64(termWidth-ImagePixelWidth),
-		PosY:        rand.Float64() * float64(usableHeight-ImagePixelHeight),
-		VelX:        (rand.Float64() - 0.5) * 4.8 * float64(cellWidth),  // pixels per second (was 0.08 * 60fps)
-		VelY:        (rand.Float64() - 0.5) * 1.2 * float64(cellHeight), // pixels per second (was 0.02 * 60fps)
+		PosY:        rand.Float64() * (usableHeight - ImagePixelHeight),
+		VelX:        (rand.Float64() - 0.5) * 4.8 * float64(config.CellWidth),  // pixels per second (was 0.08 * 60fps)
+		VelY:        (rand.Float64() - 0.5) * 1.2 * float64(config.CellHeight), // pixels per second (was 0.02 * 60fps)
 		BobbingTime: rand.Float64() * 100,
+		Depth:       rand.Float64(),
+		VelDepth:    (rand.Float64()*2 - 1) * DepthSpeed,
 		Bubbles:     make([]*Bubble, 0),
 		Username:    username,
 		Color:       color,
+		Size:        1,
+		Species:     DefaultSpecies,
 	}
 }
 
+// tankHeight returns the pixel height fish can swim in, excluding the floor
+// and the status bar.
+func tankHeight(config *TerminalConfig) float64 {
+	waterRows := config.Rows - config.FloorRows - 1
+	return float64(waterRows * config.CellHeight)
+}
+
+// Width returns the rendered pixel width of the fish.
+func (f *Fish) Width() float64 {
+	return ImagePixelWidth * f.scale()
+}
+
+// Height returns the rendered pixel height of the fish.
+func (f *Fish) Height() float64 {
+	return ImagePixelHeight * f.scale()
+}
+
+// scale is the fish's size as drawn: far fish look smaller.
+func (f *Fish) scale() float64 {
+	return f.size() * (1 - DepthShrink*f.Depth)
+}
+
+func (f *Fish) size() float64 {
+	if f.Size <= 0 {
+		return 1
+	}
+	return f.Size
+}
+
+// clampDepth keeps a depth received from elsewhere inside the tank.
+func clampDepth(depth float64) float64 {
+	return math.Max(0, math.Min(1, depth))
+}
+
+// Eat feeds the fish one food pellet.
+func (f *Fish) Eat() {
+	f.Hunger = math.Max(0, f.Hunger-PelletNutrition)
+	f.Eaten++
+}
+
 func (f *Fish) Update(config *TerminalConfig, deltaTime float64) {
 	termPixelWidth := float64(config.Columns * config.CellWidth)
-	termPixelHeight := float64(config.Rows * config.CellHeight)
 	
-	// Reserve space for floor tiles and status bar
-	// Floor tiles are 48x48 pixels, so they might take more than 1 row
-	tilePixelSize := 48.0
-	tileHeight := (tilePixelSize + float64(config.CellHeight) - 1) / float64(config.CellHeight)
-	floorHeight := tileHeight * float64(config.CellHeight)
-	statusHeight := float64(config.CellHeight)
-	usableHeight := termPixelHeight - floorHeight - statusHeight
+	// Reserve space for the floor and status bar
+	usableHeight := tankHeight(config)
 	
-	// Update position with delta time scaling
-	f.PosX += f.VelX * deltaTime
-	f.PosY += f.VelY * deltaTime
+	// Hunger builds up over time, well-fed fish grow
+	f.Hunger = math.Min(1, f.Hunger+HungerRate*deltaTime)
+	if f.Hunger < WellFedHunger {
+		f.Size = math.Min(MaxFishSize, f.size()+GrowthRate*deltaTime)
+	}
+	
+	// Update position with delta time scaling, hungry fish are sluggish
+	speed := 1 - HungrySlowdown*f.Hunger
+	f.PosX += f.VelX * speed * deltaTime
+	f.PosY += f.VelY * speed * deltaTime
 	
 	// Wall bouncing
-	if f.PosX+ImagePixelWidth > termPixelWidth {
+	f.EdgeHit = 0
+	if f.PosX+f.Width() > termPixelWidth {
 		f.VelX = -math.Abs(f.VelX)
-		f.PosX = termPixelWidth - ImagePixelWidth
+		f.PosX = termPixelWidth - f.Width()
+		f.EdgeHit = 1
 	} else if f.PosX < 0 {
 		f.VelX = math.Abs(f.VelX)
 		f.PosX = 0
+		f.EdgeHit = -1
 	}
 	
 	// Prevent fish from touching the floor (keep fish in usable area)
-	if f.PosY+ImagePixelHeight > usableHeight {
+	if f.PosY+f.Height() > usableHeight {
 		f.VelY = -math.Abs(f.VelY)
-		f.PosY = usableHeight - ImagePixelHeight
+		f.PosY = usableHeight - f.Height()
 	} else if f.PosY < 0 {
 		f.VelY = math.Abs(f.VelY)
 		f.PosY = 0
 	}
 	
+	// Drift slowly towards the front or back of the tank
+	f.Depth += f.VelDepth * deltaTime
+	if f.Depth > 1 {
+		f.Depth = 1
+		f.VelDepth = -math.Abs(f.VelDepth)
+	} else if f.Depth < 0 {
+		f.Depth = 0
+		f.VelDepth = math.Abs(f.VelDepth)
+	}
+	
 	// Update bobbing
 	f.BobbingTime += BobbingFrequency * deltaTime
 	
-	// Spawn bubbles occasionally (rate per second)
-	if rand.Float64() < BubbleSpawnRate * deltaTime {
+	// Spawn bubbles occasionally (rate per second), a lot more in a storm
+	bubbleRate := BubbleSpawnRate * (1 + (stormBubbles-1)*f.Turbulence)
+	if rand.Float64() < bubbleRate * deltaTime {
 		f.spawnBubble()
 	}
 	
@@ -110,33 +198,58 @@ func (f *Fish) Update(config *TerminalConfig, deltaTime float64) {
 }
 
 func (f *Fish) Render(buf *UpdateBuffer, config *TerminalConfig) {
-	// Clear any bubbles that went off-screen
-	for _, toClear := range f.BubblesToClear {
-		buf.AddClearCell(toClear.Row, toClear.Col)
-	}
-	f.BubblesToClear = f.BubblesToClear[:0] // Clear the slice
-	
-	// Calculate bobbing offset (triangular wave: 0, 6, 12, 6, 0, 6, 12, 6...)
-	bobbingOffset := 0.0
-	step := int(f.BobbingTime) % 4
-	switch step {
-	case 0:
-		bobbingOffset = 0                    // 0 pixels
-	case 1:
-		bobbingOffset = BobbingAmplitude / 2 // 6 pixels
-	case 2:
-		bobbingOffset = BobbingAmplitude     // 12 pixels
-	case 3:
-		bobbingOffset = BobbingAmplitude / 2 // 6 pixels
-	}
+	// Bubbles are decorative, they go first when bandwidth is short
+	buf.Decorate(func() { f.renderBubbles(buf, config) })
 	
-	finalY := f.PosY + bobbingOffset
+	finalY := f.PosY + f.bobbingOffset()
 	col := int(f.PosX/float64(config.CellWidth)) + 1
 	xOffset := int(f.PosX) % config.CellWidth
 	row := int(finalY/float64(config.CellHeight)) + 1
 	yOffset := int(finalY) % config.CellHeight
 	
-	// Render bubbles
+	// Determine image ID based on direction
+	imageID, right := SpriteImageIDs()
+	if f.VelX > 0 {
+		imageID = right
+	}
+	
+	// Delete old placement if image ID changed (like Node.js)
+	if f.LastImageID != 0 && f.LastImageID != imageID {
+		buf.AddDeletePlacement(f.LastImageID, f.PlacementID)
+	}
+	f.LastImageID = imageID
+	
+	// Calculate cell dimensions for image
+	imageCellWidth := (int(f.Width()) + config.CellWidth - 1) / config.CellWidth
+	imageCellHeight := (int(f.Height()) + config.CellHeight - 1) / config.CellHeight
+	
+	// Add fish placement command
+	// Near fish are drawn over far ones
+	z := int((1 - f.Depth) * depthZLayers)
+	buf.AddFishPlacement(row, col, imageID, f.PlacementID, imageCellWidth, imageCellHeight, xOffset, yOffset, z)
+}
+
+// bobbingOffset returns how far the fish is bobbed down, a triangular wave
+// of 0, 6, 12, 6, 0... pixels that swings wider in a storm.
+func (f *Fish) bobbingOffset() float64 {
+	amplitude := BobbingAmplitude * (1 + (stormBobbing-1)*f.Turbulence)
+	switch int(f.BobbingTime) % 4 {
+	case 1, 3:
+		return amplitude / 2
+	case 2:
+		return amplitude
+	default:
+		return 0
+	}
+}
+
+func (f *Fish) renderBubbles(buf *UpdateBuffer, config *TerminalConfig) {
+	// Clear any bubbles that went off-screen
+	for _, toClear := range f.BubblesToClear {
+		buf.AddClearCell(toClear.Row, toClear.Col)
+	}
+	f.BubblesToClear = f.BubblesToClear[:0] // Clear the slice
+	
 	for _, bubble := range f.Bubbles {
 		// Clear previous bubble position
 		if bubble.PrevCol > 0 && bubble.PrevRow > 0 {
@@ -153,47 +266,14 @@ func (f *Fish) Render(buf *UpdateBuffer, config *TerminalConfig) {
 			bubble.PrevRow = bubbleRow
 		}
 	}
-	
-	// Determine image ID based on direction
-	imageID := 1 // left-facing
-	if f.VelX > 0 {
-		imageID = 2 // right-facing
-	}
-	
-	// Delete old placement if image ID changed (like Node.js)
-	if f.LastImageID != 0 && f.LastImageID != imageID {
-		buf.AddDeletePlacement(f.LastImageID, f.PlacementID)
-	}
-	f.LastImageID = imageID
-	
-	// Calculate cell dimensions for image
-	imageCellWidth := (ImagePixelWidth + config.CellWidth - 1) / config.CellWidth
-	imageCellHeight := (ImagePixelHeight + config.CellHeight - 1) / config.CellHeight
-	
-	// Add fish placement command
-	buf.AddFishPlacement(row, col, imageID, f.PlacementID, imageCellWidth, imageCellHeight, xOffset, yOffset)
 }
 
 func (f *Fish) CheckCollision(mouseX, mouseY int) bool {
-	// Calculate bobbing offset (same as in Render)
-	bobbingOffset := 0.0
-	step := int(f.BobbingTime) % 4
-	switch step {
-	case 0:
-		bobbingOffset = 0                    // 0 pixels
-	case 1:
-		bobbingOffset = BobbingAmplitude / 2 // 6 pixels
-	case 2:
-		bobbingOffset = BobbingAmplitude     // 12 pixels
-	case 3:
-		bobbingOffset = BobbingAmplitude / 2 // 6 pixels
-	}
-	
 	// Use the actual rendered position (including bobbing)
-	finalY := f.PosY + bobbingOffset
+	finalY := f.PosY + f.bobbingOffset()
 	
-	return mouseX >= int(f.PosX) && mouseX <= int(f.PosX)+ImagePixelWidth &&
-		mouseY >= int(finalY) && mouseY <= int(finalY)+ImagePixelHeight
+	return mouseX >= int(f.PosX) && mouseX <= int(f.PosX+f.Width()) &&
+		mouseY >= int(finalY) && mouseY <= int(finalY+f.Height())
 }
 
 func (f *Fish) OnClick() {
@@ -203,8 +283,9 @@ func (f *Fish) OnClick() {
 		bubble := &Bubble{
 			X:    f.PosX + 32 + (rand.Float64()-0.5)*20,
 			Y:    f.PosY - 2 - float64(i*5),
-			Char: bubbleChars[rand.Intn(len(bubbleChars))],
-			Age:  0,
+			Char:  bubbleChars[rand.Intn(len(bubbleChars))],
+			Age:   0,
+			Owner: f.OwnerID,
 		}
 		f.Bubbles = append(f.Bubbles, bubble)
 	}
@@ -225,10 +306,11 @@ func (f *Fish) OnClick() {
 func (f *Fish) spawnBubble() {
 	bubbleChars := []string{"°", "o", "O", "•"}
 	bubble := &Bubble{
-		X:    f.PosX + ImagePixelWidth/2,
+		X:    f.PosX + f.Width()/2,
 		Y:    f.PosY - 2,
-		Char: bubbleChars[rand.Intn(len(bubbleChars))],
-		Age:  0,
+		Char:  bubbleChars[rand.Intn(len(bubbleChars))],
+		Age:   0,
+		Owner: f.OwnerID,
 	}
 	f.Bubbles = append(f.Bubbles, bubble)
 }
@@ -238,6 +320,9 @@ func (f *Fish) updateBubbles(config *TerminalConfig, deltaTime float64) {
 	activeBubbles := make([]*Bubble, 0, len(f.Bubbles))
 	
 	for _, bubble := range f.Bubbles {
+		if bubble.Popped {
+			continue // Its splash takes over the cell
+		}
 		bubble.Y -= BubbleSpeed * deltaTime
 		bubble.Age++
 		
@@ -0,0 +1,57 @@
+package aquarium
+
+import "sort"
+
+// FishInfo is a snapshot of a fish for dashboards and the web API.
+type FishInfo struct {
+	ID       uint64  `json:"id"`
+	Room     string  `json:"room,omitempty"`
+	Username string  `json:"username,omitempty"`
+	Species  string  `json:"species"`
+	Size     float64 `json:"size"`
+	Hunger   float64 `json:"hunger"`
+	Depth    float64 `json:"depth"`
+	NPC      bool    `json:"npc,omitempty"`
+	Remote   bool    `json:"remote,omitempty"`
+	Away     bool    `json:"away,omitempty"` // visiting a federated aquarium
+}
+
+// FishInfo returns information about every fish in the tank, ordered by ID.
+func (m *Manager) FishInfo() []FishInfo {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	infos := make([]FishInfo, 0, len(m.fish))
+	for _, fish := range m.fish {
+		infos = append(infos, FishInfo{
+			ID:       fish.ID,
+			Username: fish.Username,
+			Species:  fish.Species,
+			Size:     fish.size(),
+			Hunger:   fish.Hunger,
+			Depth:    fish.Depth,
+			NPC:      fish.NPC,
+			Remote:   fish.Remote,
+			Away:     !fish.AwayUntil.IsZero(),
+		})
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].ID < infos[j].ID
+	})
+	return infos
+}
+
+// FishInfo returns the fish of all rooms.
+func (r *Registry) FishInfo() []FishInfo {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var infos []FishInfo
+	for _, name := range r.order {
+		for _, info := range r.rooms[name].FishInfo() {
+			info.Room = name
+			infos = append(infos, info)
+		}
+	}
+	return infos
+}
@@ -0,0 +1,150 @@
+package aquarium
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DefaultFloor is the floor used when none is configured: roughly the three
+// rows the old 48px floor tiles took on common cell sizes.
+const DefaultFloor = "sand:1,gravel:1,rock:1"
+
+// decorationChance is the chance a column of the top floor row carries a
+// plant, coral or shell.
+const decorationChance = 0.06
+
+// FloorStrip is one horizontal layer of the tank floor.
+type FloorStrip struct {
+	Name  string
+	Rows  int
+	Color [3]uint8 // background
+	Grain [3]uint8 // color of the tile glyphs
+	Tiles []string // glyph variants, picked per cell
+}
+
+var floorStrips = []FloorStrip{
+	{Name: "sand", Color: [3]uint8{176, 156, 104}, Grain: [3]uint8{140, 118, 72}, Tiles: []string{" ", " ", " ", "·", ".", ","}},
+	{Name: "gravel", Color: [3]uint8{112, 100, 84}, Grain: [3]uint8{84, 74, 62}, Tiles: []string{" ", "∘", "°", "░", "·"}},
+	{Name: "rock", Color: [3]uint8{64, 64, 70}, Grain: [3]uint8{44, 44, 50}, Tiles: []string{"▒", "▓", "░", " "}},
+}
+
+var floorDecorations = []floorTile{
+	{"\x1b[38;5;71m", "ψ"},  // plant
+	{"\x1b[38;5;209m", "¥"}, // coral
+	{"\x1b[38;5;223m", "@"}, // shell
+}
+
+// Floor is the stack of strips at the bottom of the tank, top strip first.
+type Floor []FloorStrip
+
+// ParseFloor reads a floor spec like "sand:2,rock:1". A strip without a row
+// count is one row tall; "none" or an empty spec means no floor.
+func ParseFloor(spec string) (Floor, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" || spec == "none" {
+		return nil, nil
+	}
+
+	var floor Floor
+	for _, part := range strings.Split(spec, ",") {
+		name, count, hasCount := strings.Cut(strings.TrimSpace(part), ":")
+		rows := 1
+		if hasCount {
+			n, err := strconv.Atoi(count)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("invalid row count %q for floor strip %q", count, name)
+			}
+			rows = n
+		}
+
+		strip, ok := floorStripByName(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown floor strip %q", name)
+		}
+		strip.Rows = rows
+		floor = append(floor, strip)
+	}
+	return floor, nil
+}
+
+func floorStripByName(name string) (FloorStrip, bool) {
+	for _, strip := range floorStrips {
+		if strip.Name == name {
+			return strip, true
+		}
+	}
+	return FloorStrip{}, false
+}
+
+// Rows returns the number of terminal rows the floor takes.
+func (f Floor) Rows() int {
+	rows := 0
+	for _, strip := range f {
+		rows += strip.Rows
+	}
+	return rows
+}
+
+func (f Floor) String() string {
+	parts := make([]string, 0, len(f))
+	for _, strip := range f {
+		parts = append(parts, fmt.Sprintf("%s:%d", strip.Name, strip.Rows))
+	}
+	return strings.Join(parts, ",")
+}
+
+// floorLayout is the floor laid out for a tank width. Each cell depends only
+// on the seed and its position, so the same seed gives the same floor and
+// resizing the tank keeps the part that is still visible.
+type floorLayout struct {
+	background []string      // SGR background per floor row
+	cells      [][]floorTile // per floor row and column
+}
+
+type floorTile struct {
+	fg    string // SGR foreground
+	glyph string
+}
+
+func newFloorLayout(floor Floor, columns int, seed int64) *floorLayout {
+	layout := &floorLayout{}
+	for _, strip := range floor {
+		bg := fmt.Sprintf("\x1b[48;2;%d;%d;%dm", strip.Color[0], strip.Color[1], strip.Color[2])
+		fg := fmt.Sprintf("\x1b[38;2;%d;%d;%dm", strip.Grain[0], strip.Grain[1], strip.Grain[2])
+		for i := 0; i < strip.Rows; i++ {
+			y := len(layout.cells)
+			row := make([]floorTile, columns)
+			for col := range row {
+				h := cellHash(seed, y, col)
+				row[col] = floorTile{fg, strip.Tiles[h%uint64(len(strip.Tiles))]}
+
+				// Decorations sit on the top floor row
+				if y == 0 && float64(h>>32&0xffff)/0x10000 < decorationChance {
+					row[col] = floorDecorations[(h>>48)%uint64(len(floorDecorations))]
+				}
+			}
+			layout.background = append(layout.background, bg)
+			layout.cells = append(layout.cells, row)
+		}
+	}
+	return layout
+}
+
+// cellHash mixes a seed and cell position into well-distributed bits
+// (splitmix64).
+func cellHash(seed int64, row, col int) uint64 {
+	x := uint64(seed) + uint64(row)<<32 + uint64(col)
+	x += 0x9e3779b97f4a7c15
+	x = (x ^ x>>30) * 0xbf58476d1ce4e5b9
+	x = (x ^ x>>27) * 0x94d049bb133111eb
+	return x ^ x>>31
+}
+
+func mustParseFloor(spec string) Floor {
+	floor, err := ParseFloor(spec)
+	if err != nil {
+		panic(err)
+	}
+	return floor
+}
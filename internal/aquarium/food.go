@@ -0,0 +1,165 @@
+package aquarium
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+const (
+	PelletSinkSpeed = 40.0 // pixels per second
+	PelletLifetime  = 60 * time.Second
+	MaxPellets      = 20
+	pelletGlyph     = "\x1b[38;5;137m▪"
+	frenzyPellets   = 12 // dropped across the tank by a feeding frenzy
+	feedPellets     = 3  // dropped by a user's feeding
+)
+
+// Pellet is a piece of food sinking through the tank.
+type Pellet struct {
+	X       float64
+	Y       float64
+	Dropped time.Time
+	PrevCol int
+	PrevRow int
+}
+
+// DropFood adds a food pellet at the given pixel position. It reports
+// whether the pellet was added.
+func (m *Manager) DropFood(x, y float64) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.termConfig == nil || len(m.pellets) >= MaxPellets {
+		return false
+	}
+
+	m.pellets = append(m.pellets, &Pellet{X: x, Y: y, Dropped: m.clock.at(time.Now())})
+	m.notify()
+	return true
+}
+
+// Feed drops a few pellets at random columns of the surface for a
+// connection's user, like clicking open water but without aiming.
+func (m *Manager) Feed(connID uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	conn, exists := m.connections[connID]
+	if !exists || m.termConfig == nil || len(m.pellets) >= MaxPellets {
+		return
+	}
+	now := time.Now()
+	if wait := m.cooldowns.Take(conn.Client, ActionFood, now); wait > 0 {
+		m.notifyLocked(conn, "food: "+FormatWait(wait), now)
+		return
+	}
+	width := float64(m.termConfig.Columns * m.termConfig.CellWidth)
+	for i := 0; i < feedPellets && len(m.pellets) < MaxPellets; i++ {
+		m.pellets = append(m.pellets, &Pellet{X: rand.Float64() * width, Y: 0, Dropped: m.clock.at(now)})
+	}
+	m.notify()
+}
+
+// FeedingFrenzy drops pellets all across the surface at once and announces
+// it.
+func (m *Manager) FeedingFrenzy() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.termConfig == nil {
+		return
+	}
+	now := time.Now()
+	width := float64(m.termConfig.Columns * m.termConfig.CellWidth)
+	for i := 0; i < frenzyPellets && len(m.pellets) < MaxPellets; i++ {
+		x := width * (float64(i) + 0.2 + 0.6*rand.Float64()) / frenzyPellets
+		m.pellets = append(m.pellets, &Pellet{X: x, Y: 0, Dropped: m.clock.at(now)})
+	}
+	m.announceLocked("feeding frenzy!", now)
+}
+
+// updateFood sinks pellets, steers fish towards the nearest one and lets
+// fish eat pellets they reach. Callers must hold m.mu.
+func (m *Manager) updateFood(fishData []*Fish, config *TerminalConfig, now time.Time, deltaTime float64, buf *UpdateBuffer) {
+	if len(m.pellets) == 0 {
+		return
+	}
+
+	floor := tankHeight(config)
+	remaining := m.pellets[:0]
+
+	for _, pellet := range m.pellets {
+		pellet.Y = math.Min(pellet.Y+PelletSinkSpeed*deltaTime, floor-1)
+
+		eaten := false
+		for _, fish := range fishData {
+			if !fish.AwayUntil.IsZero() {
+				continue
+			}
+			if pellet.X >= fish.PosX && pellet.X <= fish.PosX+fish.Width() &&
+				pellet.Y >= fish.PosY && pellet.Y <= fish.PosY+fish.Height() {
+				fish.Eat()
+				eaten = true
+				break
+			}
+		}
+
+		if eaten || now.Sub(pellet.Dropped) > PelletLifetime {
+			if pellet.PrevRow > 0 {
+				buf.AddClearCell(pellet.PrevRow, pellet.PrevCol)
+			}
+			continue
+		}
+		remaining = append(remaining, pellet)
+	}
+	m.pellets = remaining
+
+	for _, fish := range fishData {
+		if !fish.AwayUntil.IsZero() || len(m.pellets) == 0 {
+			continue
+		}
+		pellet := m.nearestPellet(fish)
+		// Hungrier fish turn harder
+		fish.steerTo(pellet.X, pellet.Y, 0.5+2.5*fish.Hunger, deltaTime)
+	}
+}
+
+func (m *Manager) nearestPellet(fish *Fish) *Pellet {
+	centerX := fish.PosX + fish.Width()/2
+	centerY := fish.PosY + fish.Height()/2
+
+	var nearest *Pellet
+	best := math.Inf(1)
+	for _, pellet := range m.pellets {
+		if d := math.Hypot(pellet.X-centerX, pellet.Y-centerY); d < best {
+			best = d
+			nearest = pellet
+		}
+	}
+	return nearest
+}
+
+var fullnessLevels = []rune("▁▂▃▄▅▆▇█")
+
+// fullnessMeter returns a one-cell bar showing how well-fed a fish is.
+func fullnessMeter(hunger float64) string {
+	level := int((1 - hunger) * float64(len(fullnessLevels)-1))
+	level = max(0, min(level, len(fullnessLevels)-1))
+	return string(fullnessLevels[level])
+}
+
+// renderFood draws pellets at their current cells. Callers must hold m.mu.
+func (m *Manager) renderFood(buf *UpdateBuffer, config *TerminalConfig) {
+	for _, pellet := range m.pellets {
+		col := int(pellet.X/float64(config.CellWidth)) + 1
+		row := int(pellet.Y/float64(config.CellHeight)) + 1
+		if pellet.PrevRow > 0 && (col != pellet.PrevCol || row != pellet.PrevRow) {
+			buf.AddClearCell(pellet.PrevRow, pellet.PrevCol)
+		}
+		// Redraw every frame, bubbles and light shafts may paint over it
+		buf.AddText(row, col, pelletGlyph)
+		pellet.PrevCol = col
+		pellet.PrevRow = row
+	}
+}
@@ -0,0 +1,236 @@
+package aquarium
+
+import (
+	"log"
+	"strings"
+	"time"
+)
+
+const (
+	// RefreshInterval limits how often a lagging client gets a full redraw.
+	RefreshInterval = 5 * time.Second
+
+	// slowFrameThreshold marks a frame write as stalled. The client most
+	// likely missed intermediate state while it was blocked.
+	slowFrameThreshold = 250 * time.Millisecond
+
+	// syncBegin and syncEnd wrap a frame in a synchronized update (mode
+	// 2026) for terminals that support it: they show the frame once it
+	// arrived whole instead of drawing it while it comes in, so bubbles and
+	// status text don't flicker.
+	syncBegin = "\x1b[?2026h"
+	syncEnd   = "\x1b[?2026l"
+)
+
+// frame is one rendered animation tick.
+type frame struct {
+	output      string // deletes, pellets and background
+	background  string // drifting light shafts
+	effects     string // bubbles, crowns and other decoration
+	labels      string // names floating next to fish
+	unlabels    string // clears where names floated last frame
+	status      string // status bar, empty when it was not redrawn
+	bareStatus  string // status bar without names, for connections hiding labels
+	blankStatus string // erases the status row, for connections entering photo mode
+	debug       string // fish AI debug overlay
+
+	placements []fishPlacement       // every fish, sent where they changed
+	deleted    []placementKey        // fish placements deleted by output
+	expected   map[placementKey]bool // every fish placement, set on audit frames
+}
+
+// frameTarget is a connection receiving the current frame.
+type frameTarget struct {
+	conn        *Connection
+	photo       bool              // skip the status bar and names
+	refresh     bool              // prepend a full redraw
+	still       bool              // reduced motion, skip decoration
+	hideLabels  bool              // skip names
+	debug       bool              // add the debug overlay
+	nightLight  bool              // tint colors warm and dim
+	recolor     *strings.Replacer // paint the water in the user's theme
+	notice      string            // this connection's notice, drawn or cleared
+	bell        bool              // ring the terminal bell
+	eraseStatus bool              // blank the status row, photo mode started
+}
+
+// needsRefresh reports whether the connection dropped frames since its last
+// full redraw and is due for another one. Callers must hold m.mu.
+func (c *Connection) needsRefresh(now time.Time) bool {
+	if now.Sub(c.lastRefresh) < RefreshInterval || !c.dirty.Swap(false) {
+		return false
+	}
+	c.lastRefresh = now
+	return true
+}
+
+// Refresh gives a connection a full redraw with the next frame, e.g. after
+// its output moved to another part of the terminal, or when it joined: the
+// redraw brings the water, floor and status bar, and the frame places every
+// fish where it is, so nobody looks at an empty tank waiting for the status
+// bar's next turn.
+func (m *Manager) Refresh(connID uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	conn, exists := m.connections[connID]
+	if !exists {
+		return
+	}
+	conn.refresh()
+	m.notify()
+}
+
+// refresh schedules a full redraw with the next frame.
+func (c *Connection) refresh() {
+	c.dirty.Store(true)
+	c.lastRefresh = time.Time{}
+}
+
+// frameDropped records a frame that failed or stalled on its way to the
+// client and schedules a full redraw.
+func (c *Connection) frameDropped() {
+	c.droppedFrames.Add(1)
+	c.dirty.Store(true)
+}
+
+// DroppedFrames returns how many frames failed or stalled for this client.
+func (c *Connection) DroppedFrames() uint64 {
+	return c.droppedFrames.Load()
+}
+
+// renderRefresh builds a full redraw: every placement is deleted and the
+// background and status bar repainted. The frame it goes out with places
+// every fish again, so the client converges to the current state.
+func (m *Manager) renderRefresh(water *Water, config *TerminalConfig, aquarium *Aquarium, withStatus, names bool) string {
+	buf := NewUpdateBuffer()
+	buf.SetWater(water)
+	buf.commands = append(buf.commands, "\x1b_Ga=d,d=a,q=1\x1b\\")
+	buf.AddBackgroundFill()
+	if withStatus && aquarium != nil {
+		m.renderStatus(buf, config, aquarium, names)
+	}
+	return buf.String()
+}
+
+// allowance refills the connection's byte budget at bandwidthCap bytes per
+// second, with at most one second of burst, and returns it.
+func (c *Connection) allowance(bandwidthCap int, now time.Time) float64 {
+	if c.budgetAt.IsZero() {
+		c.budget = float64(bandwidthCap)
+	} else {
+		c.budget += now.Sub(c.budgetAt).Seconds() * float64(bandwidthCap)
+		c.budget = min(c.budget, float64(bandwidthCap))
+	}
+	c.budgetAt = now
+	return c.budget
+}
+
+// broadcastFrame queues the frame for every target, skipping those whose
+// client hasn't taken the last frames yet. Connections over their bandwidth
+// cap only get the essential part of the frame and catch up on decoration
+// with a full redraw once they have budget again.
+func (m *Manager) broadcastFrame(targets []frameTarget, f frame, refresh func(withStatus, names bool) string, debugMode bool, bandwidthCap int) {
+	now := time.Now()
+
+	for _, target := range targets {
+		if target.conn.outboxFree() == 0 {
+			// The client hasn't taken the last frames yet, skip this one
+			// rather than wait for it
+			target.conn.frameDropped()
+			if debugMode {
+				log.Printf("Connection %d: frame dropped, client backed up", target.conn.ID)
+			}
+			continue
+		}
+		status := f.status
+		changed, same := target.conn.placementDiff(&f)
+		essential := f.output + changed + f.labels
+		if target.hideLabels {
+			status = f.bareStatus
+			essential = f.output + changed
+		}
+		if target.photo {
+			// Names shown before photo mode started are erased once, they
+			// come back with the next frame after it
+			essential = f.output + changed
+			if target.conn.labelsShown {
+				essential += f.unlabels
+			}
+		}
+		target.conn.labelsShown = f.labels != "" && !target.hideLabels && !target.photo
+		if target.debug {
+			essential += f.debug
+		}
+		essential += target.notice
+		if target.bell {
+			essential += "\a"
+		}
+		if target.photo {
+			status = ""
+			if target.eraseStatus {
+				status = f.blankStatus
+			}
+		}
+		full := essential + f.background + f.effects
+		if target.still {
+			full = essential
+		}
+
+		data := full + status
+		if bandwidthCap > 0 {
+			allowance := target.conn.allowance(bandwidthCap, now)
+			switch {
+			case float64(len(data)) <= allowance:
+			case float64(len(essential)+len(status)) <= allowance || allowance >= float64(bandwidthCap):
+				// Fish first, decoration is redrawn once there is budget again
+				data = essential + status
+				target.conn.dirty.Store(true)
+			default:
+				// Not even the fish fit, skip the frame. The next one places
+				// every fish again and a redraw catches up on the rest.
+				target.conn.dirty.Store(true)
+				if debugMode {
+					log.Printf("Connection %d: over bandwidth cap, skipping frame", target.conn.ID)
+				}
+				continue
+			}
+		}
+		redrawn := false
+		if target.refresh {
+			redraw := refresh(!target.photo && f.status == "", !target.hideLabels)
+			if bandwidthCap > 0 && float64(len(redraw)+len(data)+len(same)) > target.conn.budget {
+				target.conn.dirty.Store(true) // try again later
+			} else {
+				data = redraw + data + same
+				redrawn = true
+				if dropped := target.conn.DroppedFrames(); dropped > 0 {
+					log.Printf("Connection %d: full redraw after %d dropped frames", target.conn.ID, dropped)
+				}
+			}
+		}
+		target.conn.track(&f, redrawn)
+		if f.expected != nil {
+			data += target.conn.orphans(f.expected)
+		}
+		if bandwidthCap > 0 {
+			target.conn.budget -= float64(len(data))
+		}
+
+		if target.recolor != nil {
+			data = target.recolor.Replace(data)
+		}
+		if !target.conn.Client.Hyperlinks {
+			data = StripHyperlinks(data)
+		}
+		out := target.conn.project(data)
+		if target.nightLight {
+			out = nightFilter(out)
+		}
+		if target.conn.Client.Caps.SyncOutput {
+			out = append(append([]byte(syncBegin), out...), syncEnd...)
+		}
+		target.conn.send(out, true)
+		m.sendUpload(target.conn, bandwidthCap)
+	}
+}
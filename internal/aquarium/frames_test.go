@@ -0,0 +1,39 @@
+package aquarium
+
+import (
+	"strings"
+	"testing"
+)
+
+// newFrameTarget returns a connection whose frames pile up in its outbox
+// for the test to read.
+func newFrameTarget() frameTarget {
+	conn := &Connection{
+		Stream:   discardStream{},
+		renderer: NewRenderer(GraphicsKitty),
+		outbox:   make(chan outgoing, outboxSize),
+	}
+	return frameTarget{conn: conn}
+}
+
+// TestBandwidthCapDropsDecoration sends a frame whose decoration doesn't
+// fit the cap.
+func TestBandwidthCapDropsDecoration(t *testing.T) {
+	m := NewManager()
+	defer m.Stop()
+	capped, free := newFrameTarget(), newFrameTarget()
+	f := frame{output: strings.Repeat("f", 100), effects: strings.Repeat("e", 300)}
+
+	m.broadcastFrame([]frameTarget{capped}, f, nil, false, 200)
+	m.broadcastFrame([]frameTarget{free}, f, nil, false, 0)
+
+	if got := string((<-capped.conn.outbox).data); got != f.output {
+		t.Errorf("capped connection got %d bytes, want only the %d essential ones", len(got), len(f.output))
+	}
+	if !capped.conn.dirty.Load() {
+		t.Error("capped connection isn't marked for a redraw of the dropped decoration")
+	}
+	if got := string((<-free.conn.outbox).data); got != f.output+f.effects {
+		t.Errorf("uncapped connection got %d bytes, want the whole frame of %d", len(got), len(f.output+f.effects))
+	}
+}
@@ -0,0 +1,173 @@
+package aquarium
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/acuqa/ssh-aquarium/internal/store"
+)
+
+const (
+	// MaxGuestbookMessage is the longest message a visitor can sign with.
+	MaxGuestbookMessage = 140
+
+	maxGuestbookEntries = 500 // approved entries kept, the oldest are dropped
+	maxGuestbookPending = 50  // entries waiting for an admin
+)
+
+// GuestbookEntry is a message a visitor left.
+type GuestbookEntry = store.GuestbookEntry
+
+// Guestbook keeps the messages visitors leave. Entries are shown once an
+// admin approved them, optionally kept in a state directory.
+type Guestbook struct {
+	mu      sync.Mutex
+	entries []GuestbookEntry // oldest first
+	nextID  uint64
+	store   store.Store
+}
+
+func NewGuestbook() *Guestbook {
+	return &Guestbook{nextID: 1}
+}
+
+// SetStore loads the guestbook from state and saves changes there.
+func (g *Guestbook) SetStore(state store.Store) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.store = state
+	entries, err := state.LoadGuestbook()
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	g.entries = entries
+	for _, entry := range entries {
+		g.nextID = max(g.nextID, entry.ID+1)
+	}
+	return nil
+}
+
+// Sign adds a message. Entries by admins are approved right away, all
+// others wait for an admin.
+func (g *Guestbook) Sign(name, message string, approved bool) (GuestbookEntry, error) {
+	message = strings.Join(strings.Fields(sanitizeLabel(message)), " ")
+	switch {
+	case message == "":
+		return GuestbookEntry{}, errors.New("the message is empty")
+	case utf8.RuneCountInString(message) > MaxGuestbookMessage:
+		return GuestbookEntry{}, fmt.Errorf("messages can be at most %d characters", MaxGuestbookMessage)
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if !approved && len(g.pendingLocked()) >= maxGuestbookPending {
+		return GuestbookEntry{}, errors.New("too many messages are waiting for approval, try again later")
+	}
+	entry := GuestbookEntry{
+		ID:       g.nextID,
+		Name:     strings.TrimSpace(sanitizeLabel(name)),
+		Message:  message,
+		SignedAt: time.Now(),
+		Approved: approved,
+	}
+	g.nextID++
+	g.entries = append(g.entries, entry)
+	g.trimLocked()
+	return entry, g.saveLocked()
+}
+
+// Entries returns the approved entries, newest first.
+func (g *Guestbook) Entries() []GuestbookEntry {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	entries := make([]GuestbookEntry, 0, len(g.entries))
+	for i := len(g.entries) - 1; i >= 0; i-- {
+		if g.entries[i].Approved {
+			entries = append(entries, g.entries[i])
+		}
+	}
+	return entries
+}
+
+// Pending returns the entries waiting for an admin, oldest first.
+func (g *Guestbook) Pending() []GuestbookEntry {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.pendingLocked()
+}
+
+func (g *Guestbook) pendingLocked() []GuestbookEntry {
+	var pending []GuestbookEntry
+	for _, entry := range g.entries {
+		if !entry.Approved {
+			pending = append(pending, entry)
+		}
+	}
+	return pending
+}
+
+// Approve shows an entry to everyone.
+func (g *Guestbook) Approve(id uint64) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for i := range g.entries {
+		if g.entries[i].ID == id {
+			g.entries[i].Approved = true
+			g.trimLocked()
+			return g.saveLocked()
+		}
+	}
+	return fmt.Errorf("no entry %d", id)
+}
+
+// Remove deletes an entry, approved or not.
+func (g *Guestbook) Remove(id uint64) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for i := range g.entries {
+		if g.entries[i].ID == id {
+			g.entries = append(g.entries[:i], g.entries[i+1:]...)
+			return g.saveLocked()
+		}
+	}
+	return fmt.Errorf("no entry %d", id)
+}
+
+// trimLocked drops the oldest approved entries beyond maxGuestbookEntries.
+func (g *Guestbook) trimLocked() {
+	approved := 0
+	for _, entry := range g.entries {
+		if entry.Approved {
+			approved++
+		}
+	}
+	kept := g.entries[:0]
+	for _, entry := range g.entries {
+		if entry.Approved && approved > maxGuestbookEntries {
+			approved--
+			continue
+		}
+		kept = append(kept, entry)
+	}
+	g.entries = kept
+}
+
+func (g *Guestbook) saveLocked() error {
+	if g.store == nil {
+		return nil
+	}
+	return g.store.SaveGuestbook(g.entries)
+}
@@ -0,0 +1,98 @@
+package aquarium
+
+import (
+	"errors"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/acuqa/ssh-aquarium/internal/store"
+)
+
+const maxHistory = 1000 // ended sessions kept, the oldest are dropped
+
+// PastSession is a session that ended. Like visitors, it doesn't keep the
+// client's address.
+type PastSession = store.Session
+
+// History keeps the most recent sessions that ended, optionally in a state
+// directory. It is saved along with the statistics rather than on every
+// session.
+type History struct {
+	mu       sync.Mutex
+	sessions []PastSession // oldest first
+	store    store.Store
+	dirty    bool
+}
+
+func NewHistory() *History {
+	return &History{}
+}
+
+// SetStore loads the session history from state and saves it there.
+func (h *History) SetStore(state store.Store) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.store = state
+	sessions, err := state.LoadSessions()
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	h.sessions = sessions
+	return nil
+}
+
+// Record adds a session of room that ended at now.
+func (h *History) Record(room string, info SessionInfo, now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.sessions = append(h.sessions, PastSession{
+		Room:         room,
+		Username:     info.Username,
+		Fingerprint:  info.Fingerprint,
+		TermProgram:  info.TermProgram,
+		Started:      info.ConnectedAt,
+		Duration:     now.Sub(info.ConnectedAt).Round(time.Second),
+		FramesSent:   info.FramesSent,
+		BytesSent:    info.BytesSent,
+		SessionBytes: info.SessionBytes,
+	})
+	if n := len(h.sessions) - maxHistory; n > 0 {
+		h.sessions = append(h.sessions[:0:0], h.sessions[n:]...)
+	}
+	h.dirty = true
+}
+
+// Recent returns up to n sessions, the latest first.
+func (h *History) Recent(n int) []PastSession {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	n = min(n, len(h.sessions))
+	recent := make([]PastSession, 0, n)
+	for i := len(h.sessions) - 1; i >= len(h.sessions)-n; i-- {
+		recent = append(recent, h.sessions[i])
+	}
+	return recent
+}
+
+// Save writes the history to the state directory if it changed.
+func (h *History) Save() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.store == nil || !h.dirty {
+		return
+	}
+	if err := h.store.SaveSessions(h.sessions); err != nil {
+		log.Printf("Failed to save session history: %v", err)
+		return
+	}
+	h.dirty = false
+}
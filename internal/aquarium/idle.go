@@ -0,0 +1,41 @@
+package aquarium
+
+import "time"
+
+// idleInterval is how often an idle tank still refreshes ambient state such
+// as the status bar clock.
+const idleInterval = 3 * time.Second
+
+// notify wakes the animation loop if it is sleeping on an idle tank.
+func (m *Manager) notify() {
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+}
+
+// isIdle reports whether nothing in the tank would visibly change on the
+// next frame. Callers must hold m.mu.
+func (m *Manager) isIdle() bool {
+	if m.repaint || len(m.pellets) > 0 || len(m.removedFish) > 0 || len(m.warps) > 0 || len(m.mirrors) > 0 || len(m.refused) > 0 || len(m.poofs) > 0 || len(m.pointers) > 0 || len(m.drags) > 0 || len(m.confetti) > 0 || !m.celebrateAt.IsZero() {
+		return false
+	}
+	// Overlays end or get cleared with a frame of their own
+	if len(m.splashes) > 0 || len(m.emotes) > 0 || len(m.emoteCells) > 0 || len(m.chats) > 0 || len(m.chatCells) > 0 {
+		return false
+	}
+	for _, fish := range m.fish {
+		if fish.AwayUntil.IsZero() {
+			return false
+		}
+	}
+	for _, conn := range m.connections {
+		if conn.uploading() {
+			return false // uploads go out after frames
+		}
+		if conn.notice != "" || conn.noticeCols > 0 || conn.dirty.Load() {
+			return false // a notice to draw or clear, or a redraw after dropped frames
+		}
+	}
+	return true
+}
@@ -0,0 +1,68 @@
+package aquarium
+
+import (
+	"testing"
+	"time"
+)
+
+// newIdleRoom returns a room whose only fish is away visiting, which is
+// idle until something shows up.
+func newIdleRoom(t *testing.T) (*Manager, uint64, *Fish) {
+	t.Helper()
+	m := newTestRoom(t)
+	connID, fish := addTestFish(t, m, "nemo", 40, 80)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	fish.AwayUntil = time.Now().Add(time.Minute)
+	m.repaint = false
+	for _, conn := range m.connections {
+		conn.dirty.Store(false)
+	}
+	if !m.isIdle() {
+		t.Fatal("a tank whose only fish is away is not idle")
+	}
+	return m, connID, fish
+}
+
+func TestIdleTankWithEmote(t *testing.T) {
+	m, _, fish := newIdleRoom(t)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.emotes[fish.ID] = shownEmote{Emotes[0], time.Now().Add(EmoteDuration)}
+	if m.isIdle() {
+		t.Error("tank with an emote showing is idle")
+	}
+	delete(m.emotes, fish.ID)
+	m.emoteCells = append(m.emoteCells, cell{3, 10})
+	if m.isIdle() {
+		t.Error("tank with an emote left to clear is idle")
+	}
+}
+
+func TestIdleTankWithNotice(t *testing.T) {
+	m, connID, _ := newIdleRoom(t)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	conn := m.connections[connID]
+	m.notifyLocked(conn, "food: try again in 3s", time.Now())
+	if m.isIdle() {
+		t.Error("tank with a notice showing is idle")
+	}
+	conn.notice, conn.noticeCols = "", 24
+	if m.isIdle() {
+		t.Error("tank with a notice left to clear is idle")
+	}
+}
+
+func TestIdleTankWithDroppedFrames(t *testing.T) {
+	m, connID, _ := newIdleRoom(t)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.connections[connID].frameDropped()
+	if m.isIdle() {
+		t.Error("tank owing a redraw after dropped frames is idle")
+	}
+}
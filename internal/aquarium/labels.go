@@ -0,0 +1,123 @@
+package aquarium
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// LabelMode is where fish names are shown.
+type LabelMode string
+
+const (
+	LabelsStatus LabelMode = "status" // in the status row under each fish
+	LabelsFish   LabelMode = "fish"   // floating right below or above each fish
+)
+
+// ParseLabelMode checks a label mode given on the command line.
+func ParseLabelMode(s string) (LabelMode, error) {
+	switch mode := LabelMode(s); mode {
+	case LabelsStatus, LabelsFish:
+		return mode, nil
+	}
+	return "", fmt.Errorf("unknown label mode %q", s)
+}
+
+// SetLabelMode switches where fish names are shown.
+func (m *Manager) SetLabelMode(mode LabelMode) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.labelMode = mode
+	if m.aquarium != nil {
+		m.aquarium.LastStatusUpdate = time.Time{} // names move in or out of the status row
+	}
+	m.notify()
+}
+
+// labelCell is one character of a floating label.
+type labelCell struct {
+	cell
+	text string // SGR color and character
+}
+
+// renderFishLabels draws each fish's name right below it, or above it near
+// the floor, keeping labels inside the tank and apart from each other. Cells
+// of labels that moved are cleared. Without fish, all labels are cleared.
+func (m *Manager) renderFishLabels(fishData []*Fish, buf *UpdateBuffer, config *TerminalConfig) {
+	waterRows := config.Rows - config.FloorRows - 1
+
+	type floating struct {
+		statusLabel
+		rows [2]int // below and above the fish
+	}
+	labels := make([]floating, 0, len(fishData))
+	for _, fish := range fishData {
+		if fish.Username == "" || !fish.AwayUntil.IsZero() {
+			continue
+		}
+		label := newStatusLabel(fish, config)
+		label.want = min(max(1, label.want), config.Columns-label.width()+1)
+		if label.want < 1 {
+			continue // Terminal narrower than the label
+		}
+
+		top := fish.PosY + fish.bobbingOffset()
+		below := int(math.Ceil((top+fish.Height())/float64(config.CellHeight))) + 1
+		above := int(top / float64(config.CellHeight))
+		labels = append(labels, floating{label, [2]int{below, above}})
+	}
+
+	// Place labels left to right, each below its fish if there is room and
+	// above it otherwise; labels that fit nowhere are left out this frame
+	sort.Slice(labels, func(i, j int) bool {
+		if labels[i].want != labels[j].want {
+			return labels[i].want < labels[j].want
+		}
+		return labels[i].name < labels[j].name
+	})
+
+	taken := make(map[int][][2]int) // row -> occupied column ranges
+	free := func(row, start, end int) bool {
+		for _, r := range taken[row] {
+			if start <= r[1]+1 && end >= r[0]-1 {
+				return false
+			}
+		}
+		return true
+	}
+
+	var cells []labelCell
+	for _, label := range labels {
+		end := label.want + label.width() - 1
+		for _, row := range label.rows {
+			if row < 1 || row > waterRows || !free(row, label.want, end) {
+				continue
+			}
+			taken[row] = append(taken[row], [2]int{label.want, end})
+			col := label.want
+			for _, r := range label.name + label.meter {
+				cells = append(cells, labelCell{cell{row, col}, label.color + string(r)})
+				col++
+			}
+			break
+		}
+	}
+
+	drawn := make(map[cell]bool, len(cells))
+	for _, c := range cells {
+		drawn[c.cell] = true
+	}
+	for _, old := range m.labelCells {
+		if !drawn[old] {
+			buf.AddClearCell(old.Row, old.Col)
+		}
+	}
+
+	// Redraw every frame, bubbles and light shafts may paint over labels
+	m.labelCells = m.labelCells[:0]
+	for _, c := range cells {
+		buf.AddText(c.Row, c.Col, c.text)
+		m.labelCells = append(m.labelCells, c.cell)
+	}
+}
@@ -0,0 +1,196 @@
+package aquarium
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/acuqa/ssh-aquarium/internal/store"
+)
+
+// designPrefix starts every design string, 1 is the version of its format.
+const designPrefix = "acqua1/"
+
+// Layout is how a tank is set up, independent of who is in it, so admins
+// can save setups such as "minimal" or "party" and switch between them.
+type Layout store.Layout
+
+// MaxNPCFish limits the unowned fish a tank can be told to keep.
+const MaxNPCFish = 20
+
+// Layout returns the tank's current setup.
+func (m *Manager) Layout() Layout {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return Layout{
+		Theme:      m.theme.Name,
+		Floor:      m.floor.String(),
+		LayoutSeed: m.layoutSeed,
+		NPCFish:    m.npcFish,
+	}
+}
+
+// ApplyLayout switches the tank to a saved setup and repaints it.
+func (m *Manager) ApplyLayout(layout Layout) error {
+	theme, ok := ThemeByName(layout.Theme)
+	if !ok {
+		return fmt.Errorf("unknown theme %q", layout.Theme)
+	}
+	floor, err := ParseFloor(layout.Floor)
+	if err != nil {
+		return err
+	}
+
+	m.SetTheme(theme)
+	m.SetFloor(floor)
+	m.SetLayoutSeed(layout.LayoutSeed)
+	m.SetNPCFish(layout.NPCFish)
+	return nil
+}
+
+// Design encodes the layout as a short string such as
+// "acqua1/ocean/sand:1,gravel:1,rock:1/1y2p0ij32e8e7/0", so people can share
+// the look of their tank with other aquariums.
+func (l Layout) Design() string {
+	return designPrefix + strings.Join([]string{
+		l.Theme,
+		l.Floor,
+		strconv.FormatInt(l.LayoutSeed, 36),
+		strconv.Itoa(l.NPCFish),
+	}, "/")
+}
+
+// ParseDesign decodes a design string made by Layout.Design.
+func ParseDesign(design string) (Layout, error) {
+	rest, ok := strings.CutPrefix(strings.TrimSpace(design), designPrefix)
+	if !ok {
+		return Layout{}, fmt.Errorf("not a design, expected it to start with %q", designPrefix)
+	}
+	parts := strings.Split(rest, "/")
+	if len(parts) != 4 {
+		return Layout{}, errors.New("incomplete design, expected theme/floor/seed/fish")
+	}
+	if _, ok := ThemeByName(parts[0]); !ok {
+		return Layout{}, fmt.Errorf("unknown theme %q", parts[0])
+	}
+	floor, err := ParseFloor(parts[1])
+	if err != nil {
+		return Layout{}, err
+	}
+	seed, err := strconv.ParseInt(parts[2], 36, 64)
+	if err != nil {
+		return Layout{}, fmt.Errorf("invalid seed %q", parts[2])
+	}
+	npc, err := strconv.Atoi(parts[3])
+	if err != nil || npc < 0 || npc > MaxNPCFish {
+		return Layout{}, fmt.Errorf("invalid fish count %q, expected 0 to %d", parts[3], MaxNPCFish)
+	}
+	return Layout{Theme: parts[0], Floor: floor.String(), LayoutSeed: seed, NPCFish: npc}, nil
+}
+
+// SetNPCFish keeps at least count unowned fish in the tank, however many
+// people are watching.
+func (m *Manager) SetNPCFish(count int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.npcFish = max(0, min(count, MaxNPCFish))
+	m.notify()
+}
+
+// ApplyLayout switches every room to a setup, e.g. a shared design.
+func (r *Registry) ApplyLayout(layout Layout) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, room := range r.rooms {
+		if err := room.ApplyLayout(layout); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SaveLayout saves the room's current setup under name.
+func (r *Registry) SaveLayout(name, room string) error {
+	m := r.Room(room)
+	if m == nil {
+		return fmt.Errorf("unknown room %q", room)
+	}
+
+	return r.updateLayouts(func(slots map[string]Layout) {
+		slots[name] = m.Layout()
+	})
+}
+
+// LoadLayout switches the room to the setup saved under name.
+func (r *Registry) LoadLayout(name, room string) error {
+	m := r.Room(room)
+	if m == nil {
+		return fmt.Errorf("unknown room %q", room)
+	}
+
+	slots, err := r.Layouts()
+	if err != nil {
+		return err
+	}
+	layout, ok := slots[name]
+	if !ok {
+		return fmt.Errorf("no saved layout %q", name)
+	}
+	return m.ApplyLayout(layout)
+}
+
+// DeleteLayout removes a saved setup.
+func (r *Registry) DeleteLayout(name string) error {
+	var found bool
+	err := r.updateLayouts(func(slots map[string]Layout) {
+		_, found = slots[name]
+		delete(slots, name)
+	})
+	if err == nil && !found {
+		return fmt.Errorf("no saved layout %q", name)
+	}
+	return err
+}
+
+// Layouts returns the saved setups by name.
+func (r *Registry) Layouts() (map[string]Layout, error) {
+	r.mu.RLock()
+	state := r.store
+	r.mu.RUnlock()
+	if state == nil {
+		return nil, errors.New("persistent state is disabled")
+	}
+
+	saved, err := state.LoadLayouts()
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	slots := make(map[string]Layout, len(saved))
+	for name, layout := range saved {
+		slots[name] = Layout(layout)
+	}
+	return slots, nil
+}
+
+// updateLayouts changes the saved setups and stores them again.
+func (r *Registry) updateLayouts(change func(map[string]Layout)) error {
+	r.layoutMu.Lock()
+	defer r.layoutMu.Unlock()
+
+	slots, err := r.Layouts()
+	if err != nil {
+		return err
+	}
+	change(slots)
+
+	r.mu.RLock()
+	state := r.store
+	r.mu.RUnlock()
+	saved := make(map[string]store.Layout, len(slots))
+	for name, layout := range slots {
+		saved[name] = store.Layout(layout)
+	}
+	return state.SaveLayouts(saved)
+}
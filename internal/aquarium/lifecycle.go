@@ -0,0 +1,123 @@
+package aquarium
+
+import (
+	"log"
+	"time"
+)
+
+// animationStopTimeout bounds how long shutdown waits for the animation loop.
+const animationStopTimeout = 2 * time.Second
+
+// run owns the aquarium lifecycle. Connections joining and leaving and the
+// animation loop starting and stopping all happen here one at a time, so
+// waiting for the animation loop never happens while m.mu is held.
+func (m *Manager) run() {
+	defer close(m.stopped)
+
+	for {
+		select {
+		case req := <-m.requests:
+			req()
+		case <-m.quit:
+			m.shutdown()
+			return
+		}
+	}
+}
+
+// do runs fn on the lifecycle goroutine and waits for it to finish. It
+// reports false without running fn once the manager has stopped.
+func (m *Manager) do(fn func()) bool {
+	done := make(chan struct{})
+	req := func() {
+		defer close(done)
+		fn()
+	}
+
+	select {
+	case m.requests <- req:
+		<-done
+		return true
+	case <-m.stopped:
+		return false
+	}
+}
+
+// stopAnimation signals the animation loop to stop and waits for it. It must
+// only be called from the lifecycle goroutine without holding m.mu, since the
+// loop takes the lock to finish its current frame.
+func (m *Manager) stopAnimation() {
+	m.mu.Lock()
+	stop := m.animationStop
+	m.animationStop = nil
+	m.mu.Unlock()
+
+	if stop == nil {
+		return
+	}
+
+	log.Printf("Stopping animation loop...")
+	close(stop)
+
+	done := make(chan struct{})
+	go func() {
+		m.animationWg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		log.Printf("Animation loop stopped")
+	case <-time.After(animationStopTimeout):
+		log.Printf("Animation loop stop timeout")
+	}
+}
+
+// reset drops the aquarium and everything swimming in it.
+func (m *Manager) reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.termConfig = nil
+	m.aquarium = nil
+	m.fish = make(map[uint64]*Fish)
+	m.remoteFish = make(map[string]map[uint64]uint64)
+	m.remoteSeen = make(map[string]time.Time)
+	m.removedFish = nil
+	m.warps = nil
+	m.mirrors = nil
+	m.refused = nil
+	m.localStates = nil
+	m.pellets = nil
+	m.water = nil
+	m.crowns = nil
+	m.splashes = nil
+	m.poofs = nil
+	m.pointers = nil
+	m.drags = nil
+	m.confetti = nil
+	m.celebrateAt = time.Time{}
+	m.labelCells = nil
+	m.population = PopulationPolicy{}
+	m.stormUntil = time.Time{}
+	m.ticker = tickerMessage{}
+	m.fishCounter.Store(0)
+}
+
+// shutdown stops the animation and closes all remaining connections.
+func (m *Manager) shutdown() {
+	m.stopAnimation()
+
+	m.mu.Lock()
+	log.Printf("Closing %d connections...", len(m.connections))
+	for _, conn := range m.connections {
+		conn.closeOutbox()
+		conn.Stream.Close()
+		conn.dropUploads()
+	}
+	m.connections = make(map[uint64]*Connection)
+	m.connCounter.Store(0)
+	m.mu.Unlock()
+
+	m.reset()
+}
@@ -0,0 +1,67 @@
+package aquarium
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// hyperlinkMarks matches the OSC 8 sequences that start and end links.
+var hyperlinkMarks = regexp.MustCompile("\x1b\\]8;[^;\x1b\a]*;[^\x1b\a]*(?:\x1b\\\\|\a)")
+
+// Hyperlink makes text a link to target with OSC 8, which terminals that
+// support it open on click. Frames are stripped of links for other
+// terminals, leaving the text, so it should make sense on its own.
+func Hyperlink(target, text string) string {
+	return "\x1b]8;;" + sanitizeLink(target) + "\x1b\\" + text + "\x1b]8;;\x1b\\"
+}
+
+// StripHyperlinks removes OSC 8 links from s, leaving their text.
+func StripHyperlinks(s string) string {
+	if !strings.Contains(s, "\x1b]8;") {
+		return s
+	}
+	return hyperlinkMarks.ReplaceAllString(s, "")
+}
+
+// sanitizeLink keeps a link target from ending the sequence early.
+func sanitizeLink(target string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return -1
+		}
+		return r
+	}, target)
+}
+
+// linkText returns how a web address is shown: without the scheme and a
+// trailing slash.
+func linkText(address string) string {
+	u, err := url.Parse(address)
+	if err != nil || u.Host == "" {
+		return address
+	}
+	return strings.TrimSuffix(u.Host+u.Path, "/")
+}
+
+// SetWebURL shows the aquarium's web page in the status row, as a link on
+// terminals that support them. Empty hides it.
+func (m *Manager) SetWebURL(address string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.webURL = address
+	if m.aquarium != nil {
+		m.aquarium.LastStatusUpdate = time.Time{}
+	}
+	m.notify()
+}
+
+// SetWebURL shows the aquarium's web page in the status row of every room.
+func (r *Registry) SetWebURL(address string) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, room := range r.rooms {
+		room.SetWebURL(address)
+	}
+}
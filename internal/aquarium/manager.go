@@ -3,9 +3,14 @@ package aquarium
 import (
 	"fmt"
 	"log"
+	"math/rand"
 	"sync"
 	"sync/atomic"
+	"strings"
 	"time"
+	"unicode/utf8"
+
+	"github.com/acuqa/ssh-aquarium/internal/metrics"
 )
 
 // Dark color palette for usernames (works well on dark terminals)
@@ -32,6 +37,68 @@ type Manager struct {
 	debugMode     bool
 	lastUpdate    time.Time
 	aquarium      *Aquarium
+	remoteFish    map[string]map[uint64]uint64 // node ID -> remote fish ID -> local fish ID
+	remoteSeen    map[string]time.Time
+	removedFish   []*Fish
+	warps         []fishWarp // fish moved by an admin, on the next frame
+	mirrors       map[*Fish]FishState // state published for mirrored fish, applied on the next frame
+	refused       []*Fish // fish a peer refused to host, back on the next frame
+	localStates   []FishState // local fish as of the last frame, published to peers
+	pellets       []*Pellet
+	courtship     map[fishPair]float64 // seconds pairs of fish spent close together
+	theme         Theme
+	repaint       bool // repaint the water background on the next frame
+	resized       bool // the tank changed size, fit its contents on the next frame
+	water         *Water
+	floor         Floor
+	layoutSeed    int64 // lays out floor tiles and decorations
+	founded       time.Time // the tank has been running since then, coral grows with its age
+	population    PopulationPolicy
+	npcFish       int // unowned fish kept regardless of population
+	schooling     Schooling
+	statusPage    int // page of names shown when they don't fit the status row
+	bandwidthCap  int // bytes per second per connection, 0 for unlimited
+	pending       []Snapshot // restored before anyone configured the tank
+	lastNPC       time.Time
+	lastAudit     time.Time // placements were last checked then
+	clicks        *ClickStats
+	crowns        []cell // where crowns were drawn last frame
+	pops          *PopStats
+	owners        *Owners
+	cooldowns     *Cooldowns
+	splashes      []splash
+	poofs         []poof // fish of connections that left, bursting into bubbles
+	pointers      map[uint64]*laserPointer // of spectators, by connection ID
+	drags         map[uint64]*fishDrag     // fish held with the mouse, by connection ID
+	confetti      []confetti // celebrating a visitor milestone
+	celebrateAt   time.Time  // confetti goes up with the next frame
+	labelMode     LabelMode
+	labelCells    []cell                // where floating labels were drawn last frame
+	debugCells    []cell                // where the debug overlay was drawn last frame
+	emotes        map[uint64]shownEmote // by fish ID
+	emoteCells    []cell                // where emotes were drawn last frame
+	chats         map[uint64]shownChat  // by fish ID
+	chatCells     []cell                // where chat bubbles were drawn last frame
+	widgets       []StatusWidget
+	webURL        string // the aquarium's web page, linked in the status row
+	ticker        tickerMessage
+	stormUntil    time.Time     // a storm rages until then
+	stormInterval time.Duration // average time between storms, 0 for none
+	clock         simClock      // simulation time, runs at the simulation speed
+	culler        culler        // keeps frames within the frame budget
+	loop          roomLoop      // watched by the room supervisor
+	wake          chan struct{} // nudges an idle animation loop
+	requests      chan func()   // lifecycle changes, run one at a time by run
+	quit          chan struct{}
+	stopped       chan struct{}
+	stopOnce      sync.Once
+
+	migrate           MigrationFunc
+	migrationChance   float64
+	migrationDuration time.Duration
+
+	room   string    // the room's name, for events
+	events EventFunc // told about storms
 }
 
 type Aquarium struct {
@@ -44,15 +111,51 @@ type TerminalConfig struct {
 	Rows       int
 	CellWidth  int
 	CellHeight int
+	FloorRows  int // rows taken by the floor, set by the manager
 }
 
 type Connection struct {
-	ID       uint64
-	Stream   ConnectionStream
-	FishIDs  []uint64
-	Username string
-	Color    string
-	mu       sync.Mutex
+	ID          uint64
+	Stream      ConnectionStream
+	FishIDs     []uint64
+	Username    string
+	Color       string
+	Client      ClientInfo
+	ConnectedAt time.Time
+	PhotoUntil  time.Time     // UI hidden for screenshots until then
+	Latency     time.Duration // smoothed round-trip time to the client
+	mu          sync.Mutex
+
+	droppedFrames atomic.Uint64
+	framesSent    atomic.Uint64
+	bytesSent     atomic.Uint64
+	dirty         atomic.Bool // frames were dropped since the last full redraw
+	lastRefresh   time.Time
+	budget        float64   // bytes this connection may still be sent under a bandwidth cap
+	budgetAt      time.Time // when budget was last refilled
+	assignedColor string    // handed out on connecting, used unless the user picked one
+	placements    map[placementKey]string // fish placement commands sent, owned by the animation loop
+	labelsShown   bool      // floating names are on screen, owned by the animation loop
+	debugOverlay  bool      // show the fish AI debug overlay
+	nightShown    bool      // frames are tinted by the night light
+	notice        string    // shown to this connection only, e.g. a cooldown
+	noticeUntil   time.Time
+	noticeCols    int // columns the notice took when last drawn
+	bell          bool      // ring the terminal bell with the next frame
+	eraseStatus   bool      // blank the status row with the next frame, photo mode started
+	bellAt        time.Time // when the bell last rang
+	recolorer     *strings.Replacer // paints water in the user's theme, nil for the room's
+	recolorWater  *Water            // recolorer was made for
+	recolorTheme  string
+	terminal      TerminalConfig             // size of the client's terminal, zero until known
+	projection    atomic.Pointer[Projection] // onto terminal, nil if it has the tank's size
+	renderer      Renderer                   // draws fish with the terminal's graphics protocol
+	uploadMu      sync.Mutex
+	uploads       []pendingUpload // sent in slices after frames, oldest first
+	outbox        chan outgoing   // written to Stream by drainOutbox
+	outboxDone    chan struct{}
+	outboxDrained chan struct{} // closed once drainOutbox stopped writing
+	outboxOnce    sync.Once
 }
 
 type ConnectionStream interface {
@@ -61,10 +164,32 @@ type ConnectionStream interface {
 }
 
 func NewManager() *Manager {
-	return &Manager{
+	m := &Manager{
 		fish:        make(map[uint64]*Fish),
 		connections: make(map[uint64]*Connection),
+		remoteFish:  make(map[string]map[uint64]uint64),
+		remoteSeen:  make(map[string]time.Time),
+		theme:       Themes[0],
+		clicks:      NewClickStats(),
+		pops:        NewPopStats(),
+		cooldowns:   NewCooldowns(),
+		emotes:      make(map[uint64]shownEmote),
+		chats:       make(map[uint64]shownChat),
+		floor:       mustParseFloor(DefaultFloor),
+		layoutSeed:  rand.Int63(),
+		founded:     time.Now(),
+		labelMode:   LabelsStatus,
+		stormInterval: DefaultStormInterval,
+		schooling:     DefaultSchooling,
+		clock:       newSimClock(),
+		culler:      culler{budget: FrameBudget{Time: DefaultFrameTime}},
+		wake:        make(chan struct{}, 1),
+		requests:    make(chan func()),
+		quit:        make(chan struct{}),
+		stopped:     make(chan struct{}),
 	}
+	go m.run()
+	return m
 }
 
 func (m *Manager) SetDebugMode(debug bool) {
@@ -73,77 +198,189 @@ func (m *Manager) SetDebugMode(debug bool) {
 	m.debugMode = debug
 }
 
-func (m *Manager) assignUserColor() string {
+// SetTheme switches the tank theme and repaints the background.
+func (m *Manager) SetTheme(theme Theme) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.theme = theme
+	m.repaint = true
+	m.notify()
+}
+
+func (m *Manager) GetTheme() Theme {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.theme
+}
+
+// RepaintBackground redraws the water background on the next frame, e.g.
+// after a client joined or its terminal was resized.
+func (m *Manager) RepaintBackground() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.repaint = true
+	m.notify()
+}
+
+// SetBandwidthCap limits how many bytes per second each connection is sent.
+// Zero removes the limit.
+func (m *Manager) SetBandwidthCap(bytesPerSecond int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.bandwidthCap = bytesPerSecond
+}
+
+// LayoutSeed returns the seed the floor layout is generated from.
+func (m *Manager) LayoutSeed() int64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.layoutSeed
+}
+
+// SetLayoutSeed replaces the floor layout, e.g. with one restored from disk.
+func (m *Manager) SetLayoutSeed(seed int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.layoutSeed = seed
+	m.water = nil
+	m.repaint = true
+	m.notify()
+}
+
+func (m *Manager) assignUserColor(client ClientInfo) string {
+	// Returning users get the color their fish had
+	if m.owners != nil {
+		if color, ok := m.owners.ownedColor(client.Fingerprint); ok {
+			return color
+		}
+	}
+
 	// Cycle through colors based on connection count
 	colorIndex := int(m.connCounter.Load()-1) % len(userColors)
 	return userColors[colorIndex]
 }
 
-func (m *Manager) AddConnection(stream ConnectionStream, username string) uint64 {
-	connID := m.connCounter.Add(1)
-	
-	conn := &Connection{
-		ID:       connID,
-		Stream:   stream,
-		FishIDs:  make([]uint64, 0, 100),
-		Username: username,
-		Color:    m.assignUserColor(),
-	}
-	
-	m.mu.Lock()
-	m.connections[connID] = conn
-	isFirst := len(m.connections) == 1
-	m.mu.Unlock()
-	
-	// If first connection, create aquarium
-	if isFirst {
-		now := time.Now()
-		m.aquarium = &Aquarium{
-			StartTime:        now,
-			LastStatusUpdate: now.Add(-3 * time.Second), // Force immediate render
+// AddConnection registers a client and creates the aquarium for the first one.
+func (m *Manager) AddConnection(stream ConnectionStream, client ClientInfo) uint64 {
+	var connID uint64
+	m.do(func() {
+		connID = m.connCounter.Add(1)
+		
+		conn := &Connection{
+			ID:            connID,
+			Stream:        adaptStream(stream, client),
+			FishIDs:       make([]uint64, 0, 100),
+			Client:        client,
+			ConnectedAt:   time.Now(),
+			assignedColor: m.assignUserColor(client),
+			renderer:      NewRenderer(client.Graphics),
 		}
-		log.Printf("Created new aquarium")
-	}
+		
+		conn.startOutbox()
+		
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		m.applySettings(conn)
+		m.connections[connID] = conn
+		m.ringOthersLocked(conn, conn.Username+" joined", time.Now())
+		
+		// If first connection, create aquarium
+		if len(m.connections) == 1 {
+			now := time.Now()
+			m.aquarium = &Aquarium{
+				StartTime:        now,
+				LastStatusUpdate: now.Add(-3 * time.Second), // Force immediate render
+			}
+			log.Printf("Created new aquarium")
+		}
+	})
 	
 	return connID
 }
 
+// RemoveConnection unregisters a client and destroys the aquarium once the
+// last one left. It returns once a frame still being written to the
+// client is out, so the caller can draw something else.
 func (m *Manager) RemoveConnection(connID uint64) {
+	var removed *Connection
+	defer func() {
+		if removed != nil {
+			removed.waitOutbox(outboxDrainTimeout)
+		}
+	}()
+	m.do(func() {
+		m.mu.Lock()
+		conn, exists := m.connections[connID]
+		if !exists {
+			m.mu.Unlock()
+			return
+		}
+		removed = conn
+		
+		// Remember the user's fish and remove those owned by this
+		// connection. Spectators, e.g. of a split view, have none.
+		if m.owners != nil && len(conn.FishIDs) > 0 {
+			if fish, ok := m.fish[conn.FishIDs[0]]; ok {
+				m.owners.leave(conn, fish, time.Now())
+			}
+		}
+		for _, fishID := range conn.FishIDs {
+			if fish, ok := m.fish[fishID]; ok {
+				// Trigger poof effect before removal
+				m.createPoofEffect(fish)
+				delete(m.fish, fishID)
+			}
+		}
+		
+		delete(m.connections, connID)
+		conn.closeOutbox()
+		conn.dropUploads()
+		last := len(m.connections) == 0
+		m.mu.Unlock()
+		
+		// Stop animation and destroy aquarium if no more connections
+		if last {
+			log.Printf("Destroying aquarium - no more connections")
+			m.stopAnimation()
+			m.reset()
+		}
+	})
+}
+
+// SetTerminalConfig sets the tank's geometry, usually the terminal of the
+// first connection. Fish swim in its pixels, and frames are rendered for it
+// and projected onto terminals of other sizes.
+func (m *Manager) SetTerminalConfig(config *TerminalConfig) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	
-	conn, exists := m.connections[connID]
-	if !exists {
-		return
-	}
-	
-	// Remove fish owned by this connection
-	for _, fishID := range conn.FishIDs {
-		if fish, ok := m.fish[fishID]; ok {
-			// Trigger poof effect before removal
-			m.createPoofEffect(fish)
-			delete(m.fish, fishID)
-		}
+	tank := *config
+	tank.FloorRows = m.floor.Rows()
+	m.termConfig = &tank
+	for _, conn := range m.connections {
+		m.projectLocked(conn)
 	}
 	
-	delete(m.connections, connID)
-	
-	// Stop animation and destroy aquarium if no more connections
-	if len(m.connections) == 0 && m.animationStop != nil {
-		log.Printf("Destroying aquarium - no more connections")
-		close(m.animationStop)
-		m.animationWg.Wait()
-		m.animationStop = nil
-		m.termConfig = nil
-		m.aquarium = nil
-		m.fishCounter.Store(0)
+	// Release fish restored while nobody was watching
+	pending := m.pending
+	m.pending = nil
+	for _, snap := range pending {
+		m.adoptLocked(snap)
 	}
 }
 
-func (m *Manager) SetTerminalConfig(config *TerminalConfig) {
+// SetFloor replaces the floor strips at the bottom of the tank.
+func (m *Manager) SetFloor(floor Floor) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	m.termConfig = config
+	m.floor = floor
+	if m.termConfig != nil {
+		tank := *m.termConfig
+		tank.FloorRows = floor.Rows()
+		m.termConfig = &tank
+	}
+	m.water = nil // rebuilt with the new floor on the next frame
+	m.repaint = true
+	m.notify()
 }
 
 func (m *Manager) GetTerminalConfig() *TerminalConfig {
@@ -165,44 +402,53 @@ func (m *Manager) AddFish(connID uint64, count int) []uint64 {
 	count = 1
 	
 	fishIDs := make([]uint64, 0, count)
-	termPixelWidth := m.termConfig.Columns * m.termConfig.CellWidth
-	termPixelHeight := m.termConfig.Rows * m.termConfig.CellHeight
-	
 	for i := 0; i < count; i++ {
+		// Owners returning after a restart get their fish back
+		if fish := m.reclaimParkedFish(conn); fish != nil {
+			conn.FishIDs = append(conn.FishIDs, fish.ID)
+			fishIDs = append(fishIDs, fish.ID)
+			continue
+		}
+		
 		fishID := m.fishCounter.Add(1)
-		fish := NewFish(fishID, connID, termPixelWidth, termPixelHeight, m.termConfig.CellWidth, m.termConfig.CellHeight, conn.Username, conn.Color)
+		fish := NewFish(fishID, connID, m.termConfig, conn.Username, conn.Color)
+		if m.owners != nil {
+			m.owners.restoreOwned(fish, conn.Client.Fingerprint)
+		}
 		
 		m.fish[fishID] = fish
 		conn.FishIDs = append(conn.FishIDs, fishID)
 		fishIDs = append(fishIDs, fishID)
 	}
+	m.notify()
 	
 	return fishIDs
 }
 
 func (m *Manager) StartAnimation() {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-	
-	if m.animationStop != nil {
-		return // Already running
-	}
-	
-	m.animationStop = make(chan struct{})
-	m.animationWg.Add(1)
-	m.lastUpdate = time.Now()
-	
-	go m.animationLoop()
+	m.do(func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		
+		if m.animationStop != nil || len(m.connections) == 0 {
+			return // Already running, or everyone left in the meantime
+		}
+		
+		m.animationStop = make(chan struct{})
+		m.animationWg.Add(1)
+		m.lastUpdate = time.Now()
+		
+		go m.animationLoop(m.animationStop)
+	})
 }
 
-func (m *Manager) animationLoop() {
+func (m *Manager) animationLoop(stopChan chan struct{}) {
 	defer m.animationWg.Done()
 	
 	// Use 1 FPS in debug mode, 30 FPS otherwise
 	interval := 33333333 * time.Nanosecond // ~30 FPS
 	m.mu.RLock()
 	debugMode := m.debugMode
-	stopChan := m.animationStop
 	m.mu.RUnlock()
 	
 	if debugMode {
@@ -212,7 +458,10 @@ func (m *Manager) animationLoop() {
 		log.Printf("Animation loop starting in normal mode (30 FPS)")
 	}
 	
-	ticker := time.NewTicker(interval)
+	// The room supervisor slows down rooms that take more than their share
+	// of the CPUs
+	current := m.loop.interval(interval)
+	ticker := time.NewTicker(current)
 	defer ticker.Stop()
 	
 	for {
@@ -221,12 +470,38 @@ func (m *Manager) animationLoop() {
 			log.Printf("Animation loop received stop signal")
 			return
 		case <-ticker.C:
-			m.updateAndBroadcast()
+			if next := m.loop.interval(interval); next != current {
+				current = next
+				ticker.Reset(current)
+			}
+			if !m.updateAndBroadcast() {
+				continue
+			}
 		}
+		
+		// Nothing moves, sleep until something changes instead of
+		// sending empty frames
+		ticker.Stop()
+		if debugMode {
+			log.Printf("Tank idle, pausing animation")
+		}
+		select {
+		case <-stopChan:
+			log.Printf("Animation loop received stop signal")
+			return
+		case <-m.wake:
+		case <-time.After(idleInterval):
+		}
+		m.mu.Lock()
+		m.lastUpdate = time.Now()
+		m.mu.Unlock()
+		ticker.Reset(current)
 	}
 }
 
-func (m *Manager) updateAndBroadcast() {
+// updateAndBroadcast renders and sends one frame. It reports whether the
+// tank is idle afterwards.
+func (m *Manager) updateAndBroadcast() bool {
 	// Check if we should stop first (without any locks)
 	m.mu.RLock()
 	stopChan := m.animationStop
@@ -235,7 +510,7 @@ func (m *Manager) updateAndBroadcast() {
 	if stopChan != nil {
 		select {
 		case <-stopChan:
-			return
+			return false
 		default:
 		}
 	}
@@ -244,13 +519,35 @@ func (m *Manager) updateAndBroadcast() {
 	
 	if len(m.connections) == 0 || m.termConfig == nil {
 		m.mu.Unlock()
-		return
+		return false
 	}
 	
-	// Calculate delta time
+	// Calculate delta time. The simulation runs on its own clock so a
+	// slowed down or sped up tank stays consistent: everything that moves
+	// uses deltaTime, and everything timed uses simNow.
 	now := time.Now()
-	deltaTime := now.Sub(m.lastUpdate).Seconds() // Raw delta time in seconds
+	deltaTime := now.Sub(m.lastUpdate).Seconds() * m.clock.speed
 	m.lastUpdate = now
+	simNow := m.clock.at(now)
+	if m.resized {
+		m.resized = false
+		m.settleResize()
+	}
+	
+	// Ambient behavior follows the number of people watching
+	policy := populationPolicy(len(m.connections))
+	policy.NPCFish = max(policy.NPCFish, m.npcFish)
+	if m.aquarium != nil {
+		m.updatePopulation(policy, m.termConfig, simNow)
+	}
+	
+	// Storms stir up the water and darken it
+	turbulence := m.updateWeather(now, deltaTime)
+	theme := m.theme
+	if turbulence > 0 {
+		policy = policy.stormy()
+		theme = theme.stormy()
+	}
 	
 	// Copy data we need while holding lock
 	fishData := make([]*Fish, 0, len(m.fish))
@@ -259,22 +556,146 @@ func (m *Manager) updateAndBroadcast() {
 	}
 	termConfig := m.termConfig
 	debugMode := m.debugMode
+	labelMode := m.labelMode
+	bandwidthCap := m.bandwidthCap
+	removedFish := m.removedFish
+	m.removedFish = nil
+	warps := m.warps
+	m.warps = nil
+	mirrors := m.mirrors
+	m.mirrors = nil
+	refused := m.refused
+	m.refused = nil
+	repaint := m.repaint
+	m.repaint = false
+	
+	// Water covers everything above the status row
+	coral := coralStage(now.Sub(m.founded))
+	if m.water == nil || m.water.theme != theme || m.water.columns != m.termConfig.Columns || m.water.rows != m.termConfig.Rows-1 || m.water.coralStage != coral {
+		m.water = newWater(theme, m.floor, m.termConfig.Columns, m.termConfig.Rows-1, m.layoutSeed, coral, simNow)
+		repaint = true
+	}
+	water := m.water
 	
 	// Copy connections for broadcasting
-	connData := make([]ConnectionStream, 0, len(m.connections))
+	targets := make([]frameTarget, 0, len(m.connections))
+	forceStatus := false
+	hidingLabels := false
+	erasingStatus := false
+	debugging := false
 	for _, conn := range m.connections {
-		connData = append(connData, conn.Stream)
+		active, ended := m.photoModeActive(conn, now)
+		forceStatus = forceStatus || ended
+		settings := conn.Client.Settings
+		hidingLabels = hidingLabels || settings.HideLabels
+		debugging = debugging || conn.debugOverlay
+		night := settings.NightLight && conn.Client.LateNight(now)
+		if night != conn.nightShown {
+			// Recolor what is already on screen
+			conn.nightShown = night
+			conn.refresh()
+		}
+		targets = append(targets, frameTarget{
+			conn:       conn,
+			photo:      active,
+			refresh:    conn.needsRefresh(now),
+			still:      settings.ReducedMotion,
+			hideLabels: settings.HideLabels,
+			debug:      conn.debugOverlay,
+			nightLight: night,
+			recolor:    conn.recolor(water),
+			notice:     m.renderNotice(conn, water, termConfig, now),
+			bell:       conn.bell,
+			eraseStatus: conn.eraseStatus,
+		})
+		erasingStatus = erasingStatus || conn.eraseStatus
+		conn.bell = false
+		conn.eraseStatus = false
 	}
 	
 	m.mu.Unlock()
 	
 	// Update fish without holding lock
 	updateBuf := NewUpdateBuffer()
-	fishCount := 0
+	updateBuf.SetWater(water)
+	if repaint {
+		updateBuf.AddBackgroundFill()
+	} else {
+		updateBuf.DecorateBackground(func() { water.drift(simNow, updateBuf) })
+	}
+	for _, fish := range removedFish {
+		if fish.LastImageID != 0 {
+			updateBuf.AddDeletePlacement(fish.LastImageID, fish.PlacementID)
+		}
+	}
+	for _, warp := range warps {
+		warp.apply(updateBuf, termConfig)
+	}
+	for fish, state := range mirrors {
+		mirror(fish, state, termConfig)
+	}
+	for _, fish := range refused {
+		if !fish.AwayUntil.IsZero() {
+			fish.AwayUntil = now
+		}
+	}
+	current := policy.current(simNow, termConfig)
+	for _, fish := range fishData {
+		if fish.AwayUntil.IsZero() {
+			fish.Turbulence = turbulence
+			fish.Update(termConfig, deltaTime*policy.Pace)
+			fish.PosX += current * deltaTime
+		}
+	}
+	
+	// Food is shared state, update it under the lock
+	m.mu.Lock()
+	m.updateFood(fishData, termConfig, simNow, deltaTime, updateBuf)
+	m.renderFood(updateBuf, termConfig)
+	updateBuf.Decorate(func() { m.renderSplashes(updateBuf, now) })
+	m.renderPoofs(updateBuf, termConfig, now)
+	m.renderPointers(updateBuf, termConfig, now)
+	updateBuf.Decorate(func() { m.renderConfetti(updateBuf, termConfig, now) })
+	m.updateSchooling(fishData, deltaTime)
+	m.followPointers(fishData, deltaTime, now)
+	m.followDrags(fishData, termConfig, deltaTime, now)
+	m.updateBreeding(fishData, termConfig, simNow, deltaTime)
+	m.mu.Unlock()
+	
+	rendered := make([]*Fish, 0, len(fishData))
 	for _, fish := range fishData {
-		fish.Update(termConfig, deltaTime)
+		if m.updateMigration(fish, updateBuf, termConfig) {
+			continue
+		}
 		fish.Render(updateBuf, termConfig)
-		fishCount++
+		rendered = append(rendered, fish)
+	}
+	fishCount := len(rendered)
+	localStates := localFishStates(fishData, termConfig)
+	m.mu.Lock()
+	m.localStates = localStates
+	m.renderEmotes(rendered, updateBuf, termConfig, now)
+	m.renderChats(rendered, updateBuf, termConfig, now)
+	m.mu.Unlock()
+	updateBuf.Decorate(func() { m.renderCrowns(rendered, updateBuf, termConfig) })
+	labelBuf := NewUpdateBuffer()
+	labelBuf.SetWater(water)
+	unlabelBuf := NewUpdateBuffer() // erases last frame's names, for photo mode
+	unlabelBuf.SetWater(water)
+	for _, c := range m.labelCells {
+		unlabelBuf.AddClearCell(c.Row, c.Col)
+	}
+	if labelMode == LabelsFish {
+		m.renderFishLabels(rendered, labelBuf, termConfig)
+	} else if len(m.labelCells) > 0 {
+		m.renderFishLabels(nil, labelBuf, termConfig)
+	}
+	debugBuf := NewUpdateBuffer()
+	debugBuf.SetWater(water)
+	if debugging {
+		m.renderDebugOverlay(rendered, debugBuf, termConfig)
+	} else {
+		m.debugCells = m.debugCells[:0]
 	}
 	
 	// Render status bar (every 3 seconds) if aquarium exists
@@ -285,37 +706,100 @@ func (m *Manager) updateAndBroadcast() {
 	if aquarium != nil {
 		// Check if we should render status bar (every 3 seconds)
 		now := time.Now()
-		if now.Sub(aquarium.LastStatusUpdate) >= 3*time.Second {
+		if forceStatus || now.Sub(aquarium.LastStatusUpdate) >= 3*time.Second {
 			renderStatus = true
 			aquarium.LastStatusUpdate = now
+			m.statusPage++
 		}
 	}
 	m.mu.Unlock()
 	
-	// Render status bar only when needed (every 3 seconds)
+	// Render status bar only when needed (every 3 seconds). It is kept
+	// separate so connections in photo mode can skip it.
+	statusBuf := NewUpdateBuffer()
+	bareStatusBuf := NewUpdateBuffer()
+	blankStatusBuf := NewUpdateBuffer()
+	if erasingStatus {
+		for col := 1; col <= termConfig.Columns; col++ {
+			blankStatusBuf.AddClearCell(termConfig.Rows, col)
+		}
+	}
 	if renderStatus {
-		m.renderStatus(updateBuf, termConfig, aquarium)
+		m.renderStatus(statusBuf, termConfig, aquarium, true)
+		if hidingLabels {
+			m.renderStatus(bareStatusBuf, termConfig, aquarium, false)
+		}
 	}
 	
 	// Get render output
-	output := updateBuf.String()
+	f := frame{
+		output:     updateBuf.Essential(),
+		background: updateBuf.Background(),
+		effects:    updateBuf.Effects(),
+		labels:     labelBuf.String(),
+		unlabels:   unlabelBuf.String(),
+		status:     statusBuf.String(),
+		bareStatus: bareStatusBuf.String(),
+		blankStatus: blankStatusBuf.String(),
+		debug:      debugBuf.String(),
+		placements: updateBuf.placements,
+		deleted:    updateBuf.deleted,
+	}
+	m.mu.Lock()
+	f.expected = m.expectedPlacements(rendered, now)
+	m.mu.Unlock()
+	
+	// Frames over budget lose decoration before fish. Once everything fits
+	// again, leftovers are cleaned up with a full redraw, like after
+	// dropped frames.
+	m.mu.Lock()
+	if m.culler.cull(&f) {
+		for _, target := range targets {
+			target.conn.dirty.Store(true)
+		}
+	}
+	m.mu.Unlock()
 	
 	// Debug logging
 	if debugMode && fishCount > 0 {
-		log.Printf("Animation tick: updating %d fish, output length: %d", fishCount, len(output))
+		log.Printf("Animation tick: updating %d fish, output length: %d", fishCount, len(f.output)+len(f.effects))
 	}
 	
-	// Broadcast to all connections
-	for _, conn := range connData {
-		conn.Write([]byte(output))
+	// Broadcast to all connections, lagging ones get a full redraw first
+	refresh := func(withStatus, names bool) string {
+		return m.renderRefresh(water, termConfig, aquarium, withStatus, names)
 	}
+	m.broadcastFrame(targets, f, refresh, debugMode, bandwidthCap)
+	
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.culler.took(time.Since(now))
+	m.loop.took(time.Since(now))
+	metrics.Frames.Inc()
+	return m.isIdle()
 }
 
 func (m *Manager) HandleMouseClick(connID uint64, button, col, row int) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	
-	if m.termConfig == nil || button != 0 { // Only handle left click
+	conn, exists := m.connections[connID]
+	if m.termConfig == nil || !exists || button != 0 { // Only handle left click
+		return
+	}
+	if p := conn.projection.Load(); p != nil {
+		row, col = p.WorldCell(row, col)
+	}
+	now := time.Now()
+	
+	// Bubbles are drawn over fish, so they are hit first
+	if m.popBubble(connID, row, col) {
+		return
+	}
+	
+	// Spectators point at the water instead of feeding
+	if len(conn.FishIDs) == 0 {
+		m.movePointer(conn, row, col, now)
 		return
 	}
 	
@@ -323,37 +807,102 @@ func (m *Manager) HandleMouseClick(connID uint64, button, col, row int) {
 	mouseY := (row - 1) * m.termConfig.CellHeight
 	
 	// Check collision with fish
+	var clicked *Fish
 	for _, fish := range m.fish {
 		if fish.CheckCollision(mouseX, mouseY) {
-			// Only allow clicking own fish
+			if clicked == nil {
+				clicked = fish
+			}
+			
+			// Only allow clicking own fish, which can then be dragged
 			if fish.OwnerID != connID {
 				continue
 			}
+			m.grabFish(conn, fish, float64(mouseX+m.termConfig.CellWidth/2), float64(mouseY+m.termConfig.CellHeight/2), now)
 			
+			m.clicks.Record(fish.Username)
+			if wait := m.cooldowns.Take(conn.Client, ActionPoke, now); wait > 0 {
+				m.notifyLocked(conn, "poke: "+FormatWait(wait), now)
+				return
+			}
 			fish.OnClick()
-			break
+			return
 		}
 	}
+	if clicked != nil {
+		// Someone else's fish pings its owner, so it has a cooldown too
+		if wait := m.cooldowns.Take(conn.Client, ActionPoke, now); wait > 0 {
+			m.notifyLocked(conn, "poke: "+FormatWait(wait), now)
+			return
+		}
+		m.clicks.Record(clicked.Username)
+		if owner, ok := m.connections[clicked.OwnerID]; ok {
+			m.ringLocked(owner, conn.Username+" poked your fish", now)
+		}
+		return
+	}
+
+	// Clicking open water drops a food pellet
+	if float64(mouseY) < tankHeight(m.termConfig) && len(m.pellets) < MaxPellets {
+		if wait := m.cooldowns.Take(conn.Client, ActionFood, now); wait > 0 {
+			m.notifyLocked(conn, "food: "+FormatWait(wait), now)
+			return
+		}
+		m.pellets = append(m.pellets, &Pellet{
+			X:       float64(mouseX + m.termConfig.CellWidth/2),
+			Y:       float64(mouseY),
+			Dropped: m.clock.at(now),
+		})
+		m.notify()
+	}
 }
 
-func (m *Manager) createPoofEffect(fish *Fish) {
-	// TODO: Implement poof effect
-	// For now, we'll just log it
+func (m *Manager) GetFishCount() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.fish)
 }
 
-func (m *Manager) Broadcast(data []byte) {
+// RecordLatency folds a measured round-trip time into the connection's
+// smoothed latency and returns the new estimate.
+func (m *Manager) RecordLatency(connID uint64, rtt time.Duration) time.Duration {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	
+	conn, exists := m.connections[connID]
+	if !exists {
+		return rtt
+	}
+	if conn.Latency == 0 {
+		conn.Latency = rtt
+	} else {
+		conn.Latency = (conn.Latency*4 + rtt) / 5
+	}
+	return conn.Latency
+}
+
+// GetLatency returns the smoothed round-trip time for a connection, or 0
+// if it has not been measured yet.
+func (m *Manager) GetLatency(connID uint64) time.Duration {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 	
-	for _, conn := range m.connections {
-		conn.Stream.Write(data)
+	if conn, exists := m.connections[connID]; exists {
+		return conn.Latency
 	}
+	return 0
 }
 
-func (m *Manager) GetFishCount() int {
+func (m *Manager) DebugMode() bool {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
-	return len(m.fish)
+	return m.debugMode
+}
+
+func (m *Manager) GetConnectionCount() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.connections)
 }
 
 func (m *Manager) GetAquarium() *Aquarium {
@@ -364,56 +913,13 @@ func (m *Manager) GetAquarium() *Aquarium {
 
 func (m *Manager) Stop() {
 	log.Printf("Stopping aquarium manager...")
-	
-	m.mu.Lock()
-	
-	// Signal stop and wait for animation to finish
-	if m.animationStop != nil {
-		log.Printf("Stopping animation loop...")
-		close(m.animationStop)
-		m.animationStop = nil
-		
-		// Release lock before waiting
-		m.mu.Unlock()
-		
-		// Wait for animation to stop with timeout
-		done := make(chan struct{})
-		go func() {
-			m.animationWg.Wait()
-			close(done)
-		}()
-		
-		select {
-		case <-done:
-			log.Printf("Animation loop stopped")
-		case <-time.After(2 * time.Second):
-			log.Printf("Animation loop stop timeout")
-		}
-		
-		// Reacquire lock for cleanup
-		m.mu.Lock()
-	}
-	
-	// Close all connections
-	log.Printf("Closing %d connections...", len(m.connections))
-	for _, conn := range m.connections {
-		conn.Stream.Close()
-	}
-	
-	// Clear state
-	m.fish = make(map[uint64]*Fish)
-	m.connections = make(map[uint64]*Connection)
-	m.termConfig = nil
-	m.fishCounter.Store(0)
-	m.connCounter.Store(0)
-	
-	m.mu.Unlock()
-	
+	m.stopOnce.Do(func() { close(m.quit) })
+	<-m.stopped
 	log.Printf("Aquarium manager stopped")
 }
 
 
-func (m *Manager) renderStatus(buf *UpdateBuffer, config *TerminalConfig, aquarium *Aquarium) {
+func (m *Manager) renderStatus(buf *UpdateBuffer, config *TerminalConfig, aquarium *Aquarium, names bool) {
 	// Status bar at the last row
 	statusRow := config.Rows
 	
@@ -424,53 +930,76 @@ func (m *Manager) renderStatus(buf *UpdateBuffer, config *TerminalConfig, aquari
 	
 	// Get current fish data for username positioning
 	m.mu.RLock()
-	fishData := make([]*Fish, 0, len(m.fish))
+	labels := make([]statusLabel, 0, len(m.fish))
 	for _, fish := range m.fish {
-		fishData = append(fishData, fish)
-	}
-	m.mu.RUnlock()
-	
-	// Render usernames under fish positions
-	for _, fish := range fishData {
-		// Calculate fish center position in terminal cells
-		fishCenterX := fish.PosX + ImagePixelWidth/2
-		fishCol := int(fishCenterX/float64(config.CellWidth)) + 1
-		
-		// Truncate username if needed and center it under the fish
-		username := fish.Username
-		if len(username) > 12 { // Limit username length to prevent overlap
-			username = username[:12]
-		}
-		
-		// Center username under fish
-		usernameStartCol := fishCol - len(username)/2
-		if usernameStartCol < 1 {
-			usernameStartCol = 1
+		if !fish.AwayUntil.IsZero() || fish.Username == "" || m.labelMode == LabelsFish || !names {
+			continue // Visiting another aquarium, unnamed fry, named in the tank, or names hidden
 		}
-		if usernameStartCol + len(username) - 1 > config.Columns {
-			usernameStartCol = config.Columns - len(username) + 1
-			if usernameStartCol < 1 {
-				usernameStartCol = 1
-				// Truncate further if terminal is very narrow
-				if len(username) > config.Columns {
-					username = username[:config.Columns]
-				}
-			}
-		}
-		
-		buf.AddColoredStatusText(statusRow, usernameStartCol, username, fish.Color)
+		labels = append(labels, newStatusLabel(fish, config))
 	}
+	label := m.population.Label
+	if m.storming(time.Now()) {
+		label = "storm"
+	}
+	if m.clock.speed != 1 {
+		label = strings.TrimSpace(label + " " + FormatSpeed(m.clock.speed))
+	}
+	if text := m.tickerText(time.Now()); text != "" && label != "" {
+		label = text + "  " + label
+	} else if text != "" {
+		label = text
+	}
+	page := m.statusPage
+	widgets := m.widgets
+	webURL := m.webURL
+	ctx := StatusContext{Fish: len(m.fish), Connections: len(m.connections), Columns: config.Columns, Now: time.Now()}
+	m.mu.RUnlock()
 	
 	// Calculate connected duration
 	duration := time.Since(aquarium.StartTime)
 	durationStr := formatDuration(duration)
+	if label != "" {
+		durationStr = label + "  " + durationStr
+	}
+	if text := renderWidgets(widgets, ctx); text != "" {
+		durationStr = text + "  " + durationStr
+	}
+	web := linkText(webURL)
+	if webURL != "" && utf8.RuneCountInString(web) <= config.Columns/maxWidgetShare {
+		durationStr = web + "  " + durationStr
+	} else {
+		web = ""
+	}
+	
+	// Lay names out under their fish, left of the duration. When they don't
+	// all fit, rotate through pages of them on each status update.
+	limit := config.Columns - utf8.RuneCountInString(durationStr) - 1
+	pages := pageLabels(labels, limit)
+	if len(pages) > 1 {
+		pages = pageLabels(labels, limit-len(moreHint(len(labels))))
+	}
+	var shown []statusLabel
+	if len(pages) > 0 {
+		shown = pages[page%len(pages)]
+	}
+	if hidden := len(labels) - len(shown); hidden > 0 {
+		durationStr = moreHint(hidden) + durationStr
+	}
+	for _, l := range shown {
+		buf.AddColoredStatusText(statusRow, l.col, l.name, l.color)
+		// Fullness meter right after the name so hungry fish stand out
+		buf.AddColoredStatusText(statusRow, l.col+utf8.RuneCountInString(l.name), l.meter, l.color)
+	}
 	
 	// Position duration text on the right side, ensuring it doesn't overlap usernames
-	statusCol := config.Columns - len(durationStr) + 1
+	statusCol := config.Columns - utf8.RuneCountInString(durationStr) + 1
 	if statusCol < 1 {
 		statusCol = 1
 	}
 	
+	if web != "" {
+		durationStr = strings.Replace(durationStr, web, Hyperlink(webURL, web), 1)
+	}
 	buf.AddStatusText(statusRow, statusCol, durationStr)
 }
 
@@ -0,0 +1,90 @@
+package aquarium
+
+import (
+	"testing"
+	"time"
+)
+
+// discardStream is a terminal that takes every frame and shows nothing.
+type discardStream struct{}
+
+func (discardStream) Write([]byte) error { return nil }
+func (discardStream) Close() error       { return nil }
+
+// newTestRoom returns an 80x24 room without an animation loop, so tests
+// step it themselves.
+func newTestRoom(t *testing.T) *Manager {
+	t.Helper()
+	m := NewManager()
+	m.SetTerminalConfig(&TerminalConfig{Columns: 80, Rows: 24, CellWidth: 8, CellHeight: 16})
+	t.Cleanup(m.Stop)
+	return m
+}
+
+// addTestFish connects a user with one fish, parked at x, y so clicks can
+// aim at it.
+func addTestFish(t *testing.T, m *Manager, username string, x, y float64) (uint64, *Fish) {
+	t.Helper()
+	connID := m.AddConnection(discardStream{}, ClientInfo{Username: username, RemoteAddr: username + ":22"})
+	ids := m.AddFish(connID, 1)
+	if len(ids) != 1 {
+		t.Fatalf("AddFish returned %v", ids)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	fish := m.fish[ids[0]]
+	fish.PosX, fish.PosY, fish.BobbingTime = x, y, 0
+	return connID, fish
+}
+
+// clickFish clicks the middle of a fish as connID.
+func clickFish(m *Manager, connID uint64, fish *Fish) {
+	m.mu.RLock()
+	col := int((fish.PosX+fish.Width()/2)/float64(m.termConfig.CellWidth)) + 1
+	row := int((fish.PosY+fish.Height()/2)/float64(m.termConfig.CellHeight)) + 1
+	m.mu.RUnlock()
+	m.HandleMouseClick(connID, 0, col, row)
+}
+
+func TestClickingAFishDropsNoFood(t *testing.T) {
+	m := newTestRoom(t)
+	poker, _ := addTestFish(t, m, "poker", 40, 80)
+	_, target := addTestFish(t, m, "target", 400, 160)
+
+	clickFish(m, poker, target)
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if len(m.pellets) != 0 {
+		t.Errorf("clicking someone's fish dropped %d pellets, want none", len(m.pellets))
+	}
+}
+
+func TestPokingSomeonesFishHasACooldown(t *testing.T) {
+	m := newTestRoom(t)
+	poker, _ := addTestFish(t, m, "poker", 40, 80)
+	owner, target := addTestFish(t, m, "target", 400, 160)
+	m.mu.Lock()
+	m.connections[owner].Client.Settings.Bell = true
+	m.mu.Unlock()
+
+	clickFish(m, poker, target)
+	m.mu.Lock()
+	rang := m.connections[owner].bell
+	m.connections[owner].bell = false
+	m.connections[owner].bellAt = time.Time{} // the bell's own limit is not under test
+	m.mu.Unlock()
+	if !rang {
+		t.Fatal("the first poke didn't ring the owner's bell")
+	}
+
+	clickFish(m, poker, target)
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.connections[owner].bell {
+		t.Error("a second poke right away rang the owner's bell again")
+	}
+	if notice := m.connections[poker].notice; notice != "poke: try again in 2s" {
+		t.Errorf("poker's notice = %q, want the poke cooldown", notice)
+	}
+}
@@ -0,0 +1,176 @@
+package aquarium
+
+import (
+	"log"
+	"math"
+	"math/rand"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// visitorGracePeriod bounds how long a departing visitor may keep swimming
+// while looking for a wall to leave through.
+const visitorGracePeriod = 30 * time.Second
+
+// MigrationFunc hands a fish to a peer aquarium for a visit of the given
+// duration. edge is the wall the fish left through (-1 left, 1 right). It
+// reports whether the peer accepted the fish.
+type MigrationFunc func(state FishState, edge int, duration time.Duration) bool
+
+// SetMigration enables fish migration. Whenever a local fish bounces off a
+// side wall it leaves for a peer with the given probability.
+func (m *Manager) SetMigration(fn MigrationFunc, chance float64, duration time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.migrate = fn
+	m.migrationChance = chance
+	m.migrationDuration = duration
+}
+
+// AddVisitor places a fish arriving from a peer aquarium into the tank. It
+// swims in from the wall opposite to the one it left through and heads back
+// home after duration.
+func (m *Manager) AddVisitor(from string, state FishState, edge int, duration time.Duration) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.termConfig == nil {
+		return false // Nobody is watching
+	}
+
+	width := float64(m.termConfig.Columns * m.termConfig.CellWidth)
+	height := float64(m.termConfig.Rows * m.termConfig.CellHeight)
+
+	// Labels and colors are written straight to terminals, never trust them
+	username := sanitizeLabel(state.Username) + "@" + sanitizeLabel(from)
+	color := userColors[0]
+	for _, c := range userColors {
+		if c == state.Color {
+			color = c
+		}
+	}
+
+	fishID := m.fishCounter.Add(1)
+	fish := NewFish(fishID, 0, m.termConfig, username, color)
+	fish.PosY = state.Y * height
+	if state.Size > 0 {
+		fish.Size = math.Min(state.Size, MaxFishSize)
+	}
+	fish.Depth = clampDepth(state.Depth)
+	fish.VelX = math.Abs(state.VelX * width)
+	fish.VelY = state.VelY * height
+	if edge < 0 {
+		// Left the peer through its left wall, so enter through our right wall
+		fish.PosX = width - fish.Width()
+		fish.VelX = -fish.VelX
+	} else {
+		fish.PosX = 0
+	}
+	fish.LeaveAt = time.Now().Add(duration)
+
+	m.fish[fishID] = fish
+	m.notify()
+	log.Printf("Visitor %s arrived", username)
+	return true
+}
+
+func sanitizeLabel(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// updateMigration handles fish travelling between aquariums after fish
+// moved this frame. It reports whether the fish should be hidden.
+func (m *Manager) updateMigration(fish *Fish, buf *UpdateBuffer, config *TerminalConfig) bool {
+	now := time.Now()
+
+	// Own fish visiting a peer
+	if !fish.AwayUntil.IsZero() {
+		if now.Before(fish.AwayUntil) {
+			return true
+		}
+		fish.AwayUntil = time.Time{}
+		if fish.AwayEdge > 0 {
+			fish.PosX = float64(config.Columns*config.CellWidth) - fish.Width()
+			fish.VelX = -math.Abs(fish.VelX)
+		} else {
+			fish.PosX = 0
+			fish.VelX = math.Abs(fish.VelX)
+		}
+		log.Printf("Fish %d returned home", fish.ID)
+		return false
+	}
+
+	// Visitors and grown fry leave through the next wall once their time is up
+	if !fish.LeaveAt.IsZero() {
+		if now.After(fish.LeaveAt) && (fish.EdgeHit != 0 || now.After(fish.LeaveAt.Add(visitorGracePeriod))) {
+			m.mu.Lock()
+			m.removeFishLocked(fish.ID)
+			m.mu.Unlock()
+			if fish.LastImageID != 0 {
+				buf.AddDeletePlacement(fish.LastImageID, fish.PlacementID)
+			}
+			return true
+		}
+		return false
+	}
+
+	if fish.EdgeHit == 0 || fish.OwnerID == 0 {
+		return false
+	}
+
+	m.mu.RLock()
+	migrate := m.migrate
+	chance := m.migrationChance
+	duration := m.migrationDuration
+	m.mu.RUnlock()
+
+	if migrate == nil || rand.Float64() >= chance {
+		return false
+	}
+
+	width := float64(config.Columns * config.CellWidth)
+	height := float64(config.Rows * config.CellHeight)
+	state := FishState{
+		ID:       fish.ID,
+		X:        fish.PosX / width,
+		Y:        fish.PosY / height,
+		VelX:     fish.VelX / width,
+		VelY:     fish.VelY / height,
+		Username: fish.Username,
+		Color:    fish.Color,
+		Size:     fish.Size,
+		Depth:    fish.Depth,
+	}
+	edge := fish.EdgeHit
+
+	fish.AwayUntil = now.Add(duration)
+	fish.AwayEdge = edge
+	if fish.LastImageID != 0 {
+		buf.AddDeletePlacement(fish.LastImageID, fish.PlacementID)
+		fish.LastImageID = 0
+	}
+	for _, bubble := range fish.Bubbles {
+		if bubble.PrevCol > 0 && bubble.PrevRow > 0 {
+			buf.AddClearCell(bubble.PrevRow, bubble.PrevCol)
+		}
+	}
+	fish.Bubbles = fish.Bubbles[:0]
+
+	go func() {
+		if !migrate(state, edge, duration) {
+			// Peer refused, swim back in on the next frame
+			m.mu.Lock()
+			m.refused = append(m.refused, fish)
+			m.notify()
+			m.mu.Unlock()
+		}
+	}()
+
+	return true
+}
@@ -0,0 +1,116 @@
+package aquarium
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The night light is on from nightStart until nightEnd, client local time.
+const (
+	nightStart = 22
+	nightEnd   = 7
+)
+
+// nightTint scales red, green and blue at night: warmer and dimmer, so a
+// terminal left open doesn't glow blue all night.
+var nightTint = [3]float64{0.7, 0.5, 0.3}
+
+// nightText is what text in the terminal's default color is drawn in at
+// night, a dim amber.
+var nightText = [3]int{190, 140, 90}
+
+// LateNight reports whether it is night where the client is, going by the
+// TZ it sent or else the server's time zone.
+func (c ClientInfo) LateNight(now time.Time) bool {
+	if c.Location != nil {
+		now = now.In(c.Location)
+	}
+	hour := now.Hour()
+	return hour >= nightStart || hour < nightEnd
+}
+
+// ParseTZ looks up a TZ value like Europe/Berlin or :Europe/Berlin.
+func ParseTZ(tz string) (*time.Location, error) {
+	tz = strings.TrimPrefix(tz, ":")
+	if tz == "" || strings.HasPrefix(tz, "/") {
+		return nil, fmt.Errorf("unknown time zone %q", tz)
+	}
+	return time.LoadLocation(tz)
+}
+
+// nightFilter tints the colors of SGR sequences for the night light. Kitty
+// graphics and everything else pass unchanged.
+func nightFilter(data []byte) []byte {
+	out := make([]byte, 0, len(data)+len(data)/8)
+	for len(data) > 0 {
+		t := nextToken(data)
+		data = data[len(t.raw):]
+		if t.kind == tokenCSI && t.final == 'm' {
+			out = append(out, "\x1b["...)
+			out = append(out, tintSGR(string(t.body))...)
+			out = append(out, 'm')
+			continue
+		}
+		out = append(out, t.raw...)
+	}
+	return out
+}
+
+// tintSGR rewrites the colors in SGR parameters as tinted truecolor. Resets
+// to the default foreground get the night text color, as the terminal's own
+// is usually a bright white.
+func tintSGR(params string) string {
+	fields := strings.Split(params, ";")
+	out := make([]string, 0, len(fields)+4)
+	tinted := func(fg bool, r, g, b int) {
+		code := "38"
+		if !fg {
+			code = "48"
+		}
+		out = append(out, code, "2",
+			strconv.Itoa(int(float64(r)*nightTint[0])),
+			strconv.Itoa(int(float64(g)*nightTint[1])),
+			strconv.Itoa(int(float64(b)*nightTint[2])))
+	}
+	defaultText := func() {
+		out = append(out, "38", "2", strconv.Itoa(nightText[0]), strconv.Itoa(nightText[1]), strconv.Itoa(nightText[2]))
+	}
+
+	for i := 0; i < len(fields); i++ {
+		n, err := strconv.Atoi(fields[i])
+		if fields[i] == "" {
+			n, err = 0, nil
+		}
+		switch {
+		case err != nil:
+			out = append(out, fields[i])
+		case n == 0:
+			out = append(out, fields[i])
+			defaultText()
+		case n == 39:
+			defaultText()
+		case n >= 30 && n <= 37, n >= 90 && n <= 97:
+			c := basicColors[n%10+(n/90)*8]
+			tinted(true, c[0], c[1], c[2])
+		case n >= 40 && n <= 47, n >= 100 && n <= 107:
+			c := basicColors[n%10+(n/100)*8]
+			tinted(false, c[0], c[1], c[2])
+		case (n == 38 || n == 48) && i+4 < len(fields) && fields[i+1] == "2":
+			r, _ := strconv.Atoi(fields[i+2])
+			g, _ := strconv.Atoi(fields[i+3])
+			b, _ := strconv.Atoi(fields[i+4])
+			tinted(n == 38, r, g, b)
+			i += 4
+		case (n == 38 || n == 48) && i+2 < len(fields) && fields[i+1] == "5":
+			index, _ := strconv.Atoi(fields[i+2])
+			r, g, b := rgb256(index)
+			tinted(n == 38, r, g, b)
+			i += 2
+		default:
+			out = append(out, fields[i])
+		}
+	}
+	return strings.Join(out, ";")
+}
@@ -0,0 +1,110 @@
+package aquarium
+
+import (
+	"time"
+)
+
+// outboxSize is how many writes may wait for a connection. A frame that
+// finds the outbox full is dropped and the client gets a full redraw once it
+// caught up, so a stalled client costs the others nothing.
+const outboxSize = 3
+
+// outboxDrainTimeout is how long a removed connection waits for the frame
+// being written to it. A client that stalls for longer is most likely gone.
+const outboxDrainTimeout = time.Second
+
+// outgoing is a write waiting in a connection's outbox.
+type outgoing struct {
+	data  []byte
+	frame bool // an animation frame rather than e.g. an upload
+}
+
+// startOutbox starts the goroutine writing the connection's frames to its
+// stream.
+func (c *Connection) startOutbox() {
+	c.outbox = make(chan outgoing, outboxSize)
+	c.outboxDone = make(chan struct{})
+	c.outboxDrained = make(chan struct{})
+	go c.drainOutbox()
+}
+
+// closeOutbox stops writing to the connection. Writes still waiting are
+// dropped, the client is leaving.
+func (c *Connection) closeOutbox() {
+	c.outboxOnce.Do(func() { close(c.outboxDone) })
+}
+
+// waitOutbox waits up to timeout for the write in progress once the outbox
+// was closed.
+func (c *Connection) waitOutbox(timeout time.Duration) {
+	select {
+	case <-c.outboxDrained:
+	case <-time.After(timeout):
+	}
+}
+
+// send queues data for the connection without waiting for the client. It
+// reports whether there was room; only the animation loop sends, so a send
+// after outboxFree reported room succeeds.
+func (c *Connection) send(data []byte, frame bool) bool {
+	select {
+	case c.outbox <- outgoing{data, frame}:
+		return true
+	default:
+		return false
+	}
+}
+
+// outboxFree returns how many more writes fit in the outbox.
+func (c *Connection) outboxFree() int {
+	return cap(c.outbox) - len(c.outbox)
+}
+
+// drainOutbox writes what is sent to the connection. Writes that piled up
+// while the client was slow go out together in one. A write that fails or
+// stalls counts as a dropped frame, the client most likely missed state
+// while it was blocked.
+func (c *Connection) drainOutbox() {
+	defer close(c.outboxDrained)
+	for {
+		var next outgoing
+		select {
+		case next = <-c.outbox:
+		case <-c.outboxDone:
+			return
+		}
+		// A closed outbox may still have had writes waiting, they are
+		// dropped
+		select {
+		case <-c.outboxDone:
+			return
+		default:
+		}
+		data, frames := next.data, 0
+		if next.frame {
+			frames++
+		}
+	coalesce:
+		for {
+			select {
+			case more := <-c.outbox:
+				data = append(data[:len(data):len(data)], more.data...)
+				if more.frame {
+					frames++
+				}
+			default:
+				break coalesce
+			}
+		}
+
+		start := time.Now()
+		err := c.Stream.Write(data)
+		if err == nil {
+			c.framesSent.Add(uint64(frames))
+			c.bytesSent.Add(uint64(len(data)))
+		}
+		if frames > 0 && (err != nil || time.Since(start) > slowFrameThreshold) {
+			c.frameDropped()
+		}
+	}
+}
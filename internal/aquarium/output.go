@@ -0,0 +1,245 @@
+package aquarium
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ColorDepth is how many colors a client's terminal can show.
+type ColorDepth int
+
+const (
+	TrueColor ColorDepth = iota
+	Colors256
+	Colors16
+)
+
+// ModePhoto is the ACQUA_MODE that keeps the UI hidden for a whole session,
+// e.g. for a screensaver or a wall display.
+const ModePhoto = "photo"
+
+// ColorDepth returns the colors the client's terminal supports according to
+// its answer to XTGETTCAP, COLORTERM and TERM. Terminals showing Kitty
+// graphics practically all do truecolor, even with TERM=xterm-256color, so
+// only a COLORTERM that says otherwise or a TERM of a basic terminal lowers
+// it, unless the terminal itself said it does truecolor.
+func (c ClientInfo) ColorDepth() ColorDepth {
+	if c.Caps.TrueColor {
+		return TrueColor
+	}
+	switch strings.ToLower(c.ColorTerm) {
+	case "truecolor", "24bit":
+		return TrueColor
+	case "":
+	default:
+		return Colors256
+	}
+
+	term := strings.ToLower(c.Term)
+	switch {
+	case term == "linux", term == "ansi", strings.HasPrefix(term, "vt"), strings.HasPrefix(term, "cons"),
+		strings.HasSuffix(term, "-16color"), strings.HasSuffix(term, "-8color"), strings.HasSuffix(term, "-color"):
+		return Colors16
+	}
+	return TrueColor
+}
+
+// UTF8 reports whether the client's locale shows UTF-8. Clients that don't
+// send LANG are assumed to.
+func (c ClientInfo) UTF8() bool {
+	if c.Lang == "" {
+		return true
+	}
+	lang := strings.ToLower(c.Lang)
+	return strings.Contains(lang, "utf-8") || strings.Contains(lang, "utf8")
+}
+
+// adaptedStream rewrites what is sent to a client whose terminal shows fewer
+// colors or no UTF-8.
+type adaptedStream struct {
+	ConnectionStream
+	colors ColorDepth
+	ascii  bool
+}
+
+// adaptStream wraps stream for the client's terminal, or returns it as is if
+// the terminal takes everything.
+func adaptStream(stream ConnectionStream, client ClientInfo) ConnectionStream {
+	colors, ascii := client.ColorDepth(), !client.UTF8()
+	if colors == TrueColor && !ascii {
+		return stream
+	}
+	return &adaptedStream{ConnectionStream: stream, colors: colors, ascii: ascii}
+}
+
+func (s *adaptedStream) Write(data []byte) error {
+	return s.ConnectionStream.Write(adaptOutput(data, s.colors, s.ascii))
+}
+
+// asciiGlyphs replace the non-ASCII glyphs the tank uses, one cell each.
+var asciiGlyphs = map[rune]byte{
+	'·': '.', '∘': 'o', '°': 'o', '•': 'o', '░': '.', '▒': ':', '▓': '#',
+	'ψ': 'Y', '¥': 'Y', '┃': '|', '│': '|', '╽': '|', '♣': '*', '▪': '=',
+	'♛': 'W', '▁': '_', '▂': '_', '▃': '-', '▄': '-', '▅': '=', '▆': '=',
+	'▇': '#', '█': '#', '┌': '+', '┐': '+', '└': '+', '┘': '+', '─': '-',
+	'×': 'x', '→': '>', '←': '<', '↑': '^', '↓': 'v', '↗': '/', '↙': '/',
+	'↖': '\\', '↘': '\\', '♥': 'v',
+}
+
+// adaptOutput downsamples SGR colors to the 256-color or 16-color palette
+// and replaces non-ASCII characters outside escape sequences.
+func adaptOutput(data []byte, colors ColorDepth, ascii bool) []byte {
+	out := make([]byte, 0, len(data))
+	for len(data) > 0 {
+		t := nextToken(data)
+		data = data[len(t.raw):]
+		switch {
+		case t.kind == tokenCSI && t.final == 'm' && colors != TrueColor:
+			out = append(out, "\x1b["...)
+			out = append(out, downsampleSGR(string(t.body), colors)...)
+			out = append(out, 'm')
+		case t.kind == tokenText && ascii && t.raw[0] >= utf8.RuneSelf:
+			r, _ := utf8.DecodeRune(t.raw)
+			if glyph, ok := asciiGlyphs[r]; ok {
+				out = append(out, glyph)
+			} else {
+				out = append(out, '?')
+			}
+		default:
+			out = append(out, t.raw...)
+		}
+	}
+	return out
+}
+
+// downsampleSGR replaces 38;2;r;g;b and 48;2;r;g;b in SGR parameters with
+// the nearest 256-color palette entry, and for 16 colors also 38;5;n and
+// 48;5;n with the nearest of the basic colors.
+func downsampleSGR(params string, colors ColorDepth) string {
+	fields := strings.Split(params, ";")
+	out := make([]string, 0, len(fields))
+	for i := 0; i < len(fields); i++ {
+		fg := fields[i] == "38"
+		if (!fg && fields[i] != "48") || i+1 == len(fields) {
+			out = append(out, fields[i])
+			continue
+		}
+
+		var r, g, b int
+		switch {
+		case fields[i+1] == "2" && i+4 < len(fields):
+			r, _ = strconv.Atoi(fields[i+2])
+			g, _ = strconv.Atoi(fields[i+3])
+			b, _ = strconv.Atoi(fields[i+4])
+			i += 4
+			if colors == Colors256 {
+				out = append(out, fields[i-4], "5", strconv.Itoa(nearest256(r, g, b)))
+				continue
+			}
+		case fields[i+1] == "5" && i+2 < len(fields) && colors == Colors16:
+			n, _ := strconv.Atoi(fields[i+2])
+			r, g, b = rgb256(n)
+			i += 2
+		default:
+			out = append(out, fields[i])
+			continue
+		}
+
+		code := nearest16(r, g, b)
+		base := 30
+		if !fg {
+			base = 40
+		}
+		if code >= 8 {
+			base += 60
+		}
+		out = append(out, strconv.Itoa(base+code%8))
+	}
+	return strings.Join(out, ";")
+}
+
+// cubeLevels are the channel values of the 6x6x6 color cube.
+var cubeLevels = [6]int{0, 95, 135, 175, 215, 255}
+
+// nearest256 returns the palette index of the cube color or gray closest to
+// r, g, b.
+func nearest256(r, g, b int) int {
+	level := func(v int) int {
+		best := 0
+		for i, l := range cubeLevels {
+			if sq(v-l) < sq(v-cubeLevels[best]) {
+				best = i
+			}
+		}
+		return best
+	}
+	ri, gi, bi := level(r), level(g), level(b)
+	cube := 16 + 36*ri + 6*gi + bi
+	cubeDist := sq(r-cubeLevels[ri]) + sq(g-cubeLevels[gi]) + sq(b-cubeLevels[bi])
+
+	// Grays run from 8 to 238 in steps of 10
+	gray := min(max((r+g+b)/3-8+5, 0)/10, 23)
+	v := 8 + 10*gray
+	if sq(r-v)+sq(g-v)+sq(b-v) < cubeDist {
+		return 232 + gray
+	}
+	return cube
+}
+
+// basicColors are the 16 basic colors as xterm shows them by default.
+var basicColors = [16][3]int{
+	{0, 0, 0}, {205, 0, 0}, {0, 205, 0}, {205, 205, 0}, {0, 0, 238}, {205, 0, 205}, {0, 205, 205}, {229, 229, 229},
+	{127, 127, 127}, {255, 0, 0}, {0, 255, 0}, {255, 255, 0}, {92, 92, 255}, {255, 0, 255}, {0, 255, 255}, {255, 255, 255},
+}
+
+// nearest16 returns the basic color for r, g, b. The basic colors are so
+// far apart that the nearest one loses the hue, most blue water would turn
+// gray, so colors keep the channels that stand out instead.
+func nearest16(r, g, b int) int {
+	hi, lo := max(r, g, b), min(r, g, b)
+	switch {
+	case hi < 40:
+		return 0
+	case hi-lo < hi/4: // gray
+		switch {
+		case hi < 100:
+			return 0
+		case hi < 170:
+			return 8
+		case hi < 230:
+			return 7
+		}
+		return 15
+	}
+	code := 0
+	for i, v := range [3]int{r, g, b} {
+		if v >= hi*3/5 {
+			code |= 1 << i
+		}
+	}
+	if hi > 200 {
+		code += 8
+	}
+	return code
+}
+
+// rgb256 returns the color of a 256-color palette entry.
+func rgb256(n int) (r, g, b int) {
+	switch {
+	case n < 0 || n > 255:
+		return 0, 0, 0
+	case n < 16:
+		c := basicColors[n]
+		return c[0], c[1], c[2]
+	case n < 232:
+		n -= 16
+		return cubeLevels[n/36], cubeLevels[n/6%6], cubeLevels[n%6]
+	}
+	v := 8 + 10*(n-232)
+	return v, v, v
+}
+
+func sq(v int) int {
+	return v * v
+}
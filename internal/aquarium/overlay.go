@@ -0,0 +1,296 @@
+package aquarium
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// overlay is the part of renderers that draw fish into the text on screen
+// rather than placing images over it, such as Sixel images or characters.
+// What they draw has no placement to move or delete: it stays until text is
+// written over it. The overlay keeps a copy of the text on screen, restores
+// the cells a fish leaves and draws again only the fish that moved or had
+// something drawn over them.
+type overlay struct {
+	step     int // pixel grid fish offsets are rounded to, 0 for whole cells
+	drawFish func(out []byte, f overlayFish) []byte
+
+	mu     sync.Mutex
+	screen TerminalConfig
+	cells  []shadowCell // text on screen, row by row
+	shown  map[placementKey]overlayFish
+}
+
+// shadowCell is the text of a screen cell and the SGR sequences it was
+// drawn with.
+type shadowCell struct {
+	sgr   string
+	glyph string
+}
+
+// overlayFish is a fish drawn with its top left corner in a cell, offset by
+// x and y pixels.
+type overlayFish struct {
+	image         int
+	placement     uint64
+	row, col      int
+	width, height int // of the scaled sprite in pixels
+	x, y          int
+	z             int
+	rows, cols    int // cells covered, clipped to the water
+}
+
+func (r *overlay) init(step int, drawFish func(out []byte, f overlayFish) []byte) {
+	r.step = step
+	r.drawFish = drawFish
+	r.shown = make(map[placementKey]overlayFish)
+}
+
+func (r *overlay) Resize(screen TerminalConfig) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if screen == r.screen {
+		return
+	}
+	r.screen = screen
+	r.cells = make([]shadowCell, max(screen.Columns*screen.Rows, 0))
+	clear(r.shown)
+}
+
+// cell returns the shadow of a screen cell, nil outside the screen.
+func (r *overlay) cell(row, col int) *shadowCell {
+	if row < 1 || col < 1 || row > r.screen.Rows || col > r.screen.Columns {
+		return nil
+	}
+	return &r.cells[(row-1)*r.screen.Columns+col-1]
+}
+
+// Render passes text through, remembering it, and replaces Kitty graphics
+// commands with restored cells and fish drawn after the text.
+func (r *overlay) Render(data []byte) []byte {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.screen.CellWidth < 1 || r.screen.CellHeight < 1 {
+		return data
+	}
+
+	out := make([]byte, 0, len(data))
+	touched := make(map[cell]bool)
+	placed := make(map[placementKey]overlayFish)
+	var deleted []placementKey
+	row, col, sgr := 1, 1, ""
+	for len(data) > 0 {
+		t := nextToken(data)
+		data = data[len(t.raw):]
+		switch t.kind {
+		case tokenCSI:
+			params := string(t.body)
+			switch t.final {
+			case 'H', 'f':
+				row, col = 1, 1
+				if rowParam, colParam, ok := strings.Cut(params, ";"); ok {
+					row, col = atoiOr(rowParam, 1), atoiOr(colParam, 1)
+				} else if params != "" {
+					row = atoiOr(params, 1)
+				}
+			case 'm':
+				if params == "" || params == "0" || strings.HasPrefix(params, "0;") {
+					sgr = ""
+				}
+				if params != "" && params != "0" {
+					sgr += string(t.raw)
+				}
+			}
+			out = append(out, t.raw...)
+
+		case tokenAPC:
+			deleted = r.graphics(t.body, row, col, placed, deleted)
+
+		case tokenControl:
+			if t.raw[0] == '\r' {
+				col = 1
+			}
+			out = append(out, t.raw...)
+
+		case tokenText:
+			if c := r.cell(row, col); c != nil {
+				*c = shadowCell{sgr, string(t.raw)}
+				touched[cell{Row: row, Col: col}] = true
+			}
+			out = append(out, t.raw...)
+			col++
+
+		case tokenPartial:
+			return append(out, t.raw...)
+
+		default:
+			out = append(out, t.raw...)
+		}
+	}
+	return r.draw(out, touched, placed, deleted)
+}
+
+// graphics takes note of a Kitty graphics command at the cursor: placements
+// go into placed, deleted fish are added to deleted, which is returned.
+// Uploads are dropped, the pixels go out with every image.
+func (r *overlay) graphics(command []byte, row, col int, placed map[placementKey]overlayFish, deleted []placementKey) []placementKey {
+	if len(command) == 0 || command[0] != 'G' {
+		return deleted
+	}
+	control, _, _ := bytes.Cut(command[1:], []byte{';'})
+	values := make(map[string]string)
+	for _, kv := range bytes.Split(control, []byte{','}) {
+		if k, v, ok := bytes.Cut(kv, []byte{'='}); ok {
+			values[string(k)] = string(v)
+		}
+	}
+	imageID := atoiOr(values["i"], 0)
+	placement := uint64(atoiOr(values["p"], 0))
+
+	switch values["a"] {
+	case "p":
+		f := overlayFish{
+			image:     imageID,
+			placement: placement,
+			row:       max(row, 1),
+			col:       max(col, 1),
+			width:     atoiOr(values["c"], 1) * r.screen.CellWidth,
+			height:    atoiOr(values["r"], 1) * r.screen.CellHeight,
+			z:         atoiOr(values["z"], 0),
+		}
+		if r.step > 0 {
+			f.x = atoiOr(values["X"], 0) / r.step * r.step
+			f.y = atoiOr(values["Y"], 0) / r.step * r.step
+		}
+		// Fish stay above the status row, Sixel images reaching it would
+		// scroll the screen
+		f.cols = min((f.x+f.width+r.screen.CellWidth-1)/r.screen.CellWidth, r.screen.Columns-f.col+1)
+		f.rows = min((f.y+f.height+r.screen.CellHeight-1)/r.screen.CellHeight, r.screen.Rows-f.row)
+		placed[placementKey{imageID, placement}] = f
+	case "d":
+		for key := range r.shown {
+			switch values["d"] {
+			case "a", "A":
+			case "i", "I":
+				if key.image != imageID || (values["p"] != "" && key.placement != placement) {
+					continue
+				}
+			default:
+				continue
+			}
+			deleted = append(deleted, key)
+		}
+	}
+	return deleted
+}
+
+// draw appends to the frame's text the cells fish left, restored, and the
+// fish that need to be drawn again.
+func (r *overlay) draw(out []byte, touched map[cell]bool, placed map[placementKey]overlayFish, deleted []placementKey) []byte {
+	restore := make(map[cell]bool)
+	leave := func(f overlayFish) {
+		for row := f.row; row < f.row+f.rows; row++ {
+			for col := f.col; col < f.col+f.cols; col++ {
+				if !touched[cell{Row: row, Col: col}] {
+					restore[cell{Row: row, Col: col}] = true
+				}
+			}
+		}
+	}
+	moved := make(map[placementKey]bool)
+	for _, key := range deleted {
+		leave(r.shown[key])
+		delete(r.shown, key)
+	}
+	for key, f := range placed {
+		if old, ok := r.shown[key]; !ok || old != f {
+			if ok {
+				leave(old)
+			}
+			r.shown[key] = f
+			moved[key] = true
+		}
+	}
+
+	// Cells written or restored wipe the fish over them
+	dirty := func(f overlayFish) bool {
+		for row := f.row; row < f.row+f.rows; row++ {
+			for col := f.col; col < f.col+f.cols; col++ {
+				if touched[cell{Row: row, Col: col}] || restore[cell{Row: row, Col: col}] {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	keys := make([]placementKey, 0, len(r.shown))
+	for key := range r.shown {
+		keys = append(keys, key)
+	}
+	slices.SortFunc(keys, func(a, b placementKey) int {
+		if r.shown[a].z != r.shown[b].z {
+			return r.shown[a].z - r.shown[b].z
+		}
+		return int(a.placement) - int(b.placement)
+	})
+	var redraw []overlayFish
+	for _, key := range keys {
+		f := r.shown[key]
+		again := moved[key] || dirty(f)
+		// Nearer fish overlapping a fish drawn again go on top of it
+		for _, below := range redraw {
+			again = again || overlaps(below, f)
+		}
+		if again && f.rows > 0 && f.cols > 0 {
+			redraw = append(redraw, f)
+		}
+	}
+
+	out = r.restore(out, restore)
+	for _, f := range redraw {
+		out = r.drawFish(out, f)
+	}
+	return out
+}
+
+// restore writes the remembered text of cells again.
+func (r *overlay) restore(out []byte, cells map[cell]bool) []byte {
+	if len(cells) == 0 {
+		return out
+	}
+	sorted := make([]cell, 0, len(cells))
+	for c := range cells {
+		if r.cell(c.Row, c.Col) != nil {
+			sorted = append(sorted, c)
+		}
+	}
+	slices.SortFunc(sorted, func(a, b cell) int {
+		if a.Row != b.Row {
+			return a.Row - b.Row
+		}
+		return a.Col - b.Col
+	})
+	next := cell{}
+	for _, c := range sorted {
+		if c != next {
+			out = fmt.Appendf(out, "\x1b[%d;%dH", c.Row, c.Col)
+		}
+		shadow := r.cell(c.Row, c.Col)
+		out = append(out, "\x1b[0m"...)
+		out = append(out, shadow.sgr...)
+		if shadow.glyph == "" {
+			out = append(out, ' ')
+		} else {
+			out = append(out, shadow.glyph...)
+		}
+		next = cell{Row: c.Row, Col: c.Col + 1}
+	}
+	return append(out, "\x1b[0m"...)
+}
+
+func overlaps(a, b overlayFish) bool {
+	return a.row < b.row+b.rows && b.row < a.row+a.rows && a.col < b.col+b.cols && b.col < a.col+a.cols
+}
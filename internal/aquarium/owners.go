@@ -0,0 +1,158 @@
+package aquarium
+
+import (
+	"errors"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/acuqa/ssh-aquarium/internal/store"
+)
+
+// OwnedFish is what is remembered about a user's fish between sessions.
+type OwnedFish = store.OwnedFish
+
+// Owners remembers every user's fish by SSH key fingerprint, so reconnecting
+// brings back the same fish instead of a new one. Users without a key can't
+// be recognized and get a new fish each time. It is shared by all rooms and
+// optionally persisted to a state directory.
+type Owners struct {
+	mu    sync.Mutex
+	fish  map[string]OwnedFish // by SSH key fingerprint
+	store store.Store
+	dirty bool
+}
+
+func NewOwners() *Owners {
+	return &Owners{fish: make(map[string]OwnedFish)}
+}
+
+// SetStore loads the fish from state and saves changes there.
+func (o *Owners) SetStore(state store.Store) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.store = state
+	fish, err := state.LoadFish()
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	o.fish = fish
+	return nil
+}
+
+// Get returns the fish of the user with the given key fingerprint.
+func (o *Owners) Get(fingerprint string) (OwnedFish, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	fish, ok := o.fish[fingerprint]
+	return fish, ok && fingerprint != ""
+}
+
+// Top returns up to n fish, those whose owners spent the most time in the
+// water first.
+func (o *Owners) Top(n int) []OwnedFish {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	top := make([]OwnedFish, 0, len(o.fish))
+	for _, fish := range o.fish {
+		if fish.Name != "" {
+			top = append(top, fish)
+		}
+	}
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].TimeSwum != top[j].TimeSwum {
+			return top[i].TimeSwum > top[j].TimeSwum
+		}
+		return top[i].Name < top[j].Name
+	})
+	return top[:min(n, len(top))]
+}
+
+// arrive counts a session of the user with the given key fingerprint.
+func (o *Owners) arrive(fingerprint string, now time.Time) {
+	if fingerprint == "" {
+		return
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	fish := o.fish[fingerprint]
+	if fish.FirstSeen.IsZero() {
+		fish.FirstSeen = now
+	}
+	fish.Sessions++
+	fish.LastSeen = now
+	o.fish[fingerprint] = fish
+	o.dirty = true
+}
+
+// leave remembers a connection's fish as it leaves a room.
+func (o *Owners) leave(conn *Connection, fish *Fish, now time.Time) {
+	fingerprint := conn.Client.Fingerprint
+	if fingerprint == "" {
+		return
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	owned := o.fish[fingerprint]
+	owned.Name = conn.Username
+	for i, color := range userColors {
+		if color == conn.Color {
+			owned.Color = FishColors[i]
+		}
+	}
+	owned.Size = fish.size()
+	owned.Eaten = fish.Eaten
+	owned.TimeSwum += now.Sub(conn.ConnectedAt).Round(time.Second)
+	owned.LastSeen = now
+	o.fish[fingerprint] = owned
+	o.dirty = true
+	o.saveLocked()
+}
+
+// Save writes unsaved changes to the state directory.
+func (o *Owners) Save() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.saveLocked()
+}
+
+func (o *Owners) saveLocked() {
+	if o.store == nil || !o.dirty {
+		return
+	}
+	if err := o.store.SaveFish(o.fish); err != nil {
+		log.Printf("Failed to save fish: %v", err)
+		return
+	}
+	o.dirty = false
+}
+
+// ownedColor returns the color the user's fish had before, if any.
+func (o *Owners) ownedColor(fingerprint string) (string, bool) {
+	fish, ok := o.Get(fingerprint)
+	if !ok {
+		return "", false
+	}
+	return userColor(fish.Color)
+}
+
+// restoreOwned makes a new fish look like the one its owner had before.
+func (o *Owners) restoreOwned(fish *Fish, fingerprint string) {
+	owned, ok := o.Get(fingerprint)
+	if !ok {
+		return
+	}
+	if owned.Size > 0 {
+		fish.Size = min(owned.Size, MaxFishSize)
+	}
+	fish.Eaten = owned.Eaten
+}
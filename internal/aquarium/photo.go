@@ -0,0 +1,42 @@
+package aquarium
+
+import "time"
+
+// PhotoModeDuration is how long photo mode hides the UI.
+const PhotoModeDuration = 10 * time.Second
+
+// StartPhotoMode hides the status bar for one connection so screenshots and
+// recordings are clean. The UI comes back on its own after
+// PhotoModeDuration.
+func (m *Manager) StartPhotoMode(connID uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	conn, exists := m.connections[connID]
+	if !exists || m.termConfig == nil {
+		return
+	}
+	conn.PhotoUntil = time.Now().Add(PhotoModeDuration)
+
+	// The next frame erases the status row, projected onto the terminal
+	// like the rest of it
+	conn.eraseStatus = true
+	m.notify()
+}
+
+// photoModeActive reports whether the connection's UI is hidden and ends
+// photo mode once it expired. Sessions started with ACQUA_MODE=photo stay in
+// it. Callers must hold m.mu.
+func (m *Manager) photoModeActive(conn *Connection, now time.Time) (active, ended bool) {
+	if conn.Client.Mode == ModePhoto {
+		return true, false
+	}
+	if conn.PhotoUntil.IsZero() {
+		return false, false
+	}
+	if now.Before(conn.PhotoUntil) {
+		return true, false
+	}
+	conn.PhotoUntil = time.Time{}
+	return false, true
+}
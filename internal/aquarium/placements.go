@@ -0,0 +1,84 @@
+package aquarium
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/acuqa/ssh-aquarium/internal/metrics"
+)
+
+// placementAudit is how often the fish placements each connection was sent
+// are checked against the fish in the tank.
+const placementAudit = 10 * time.Second
+
+// placementKey identifies a Kitty graphics placement of a fish.
+type placementKey struct {
+	image     int
+	placement uint64
+}
+
+// expectedPlacements returns the placements the rendered fish own, for an
+// audit frame, or nil if no audit is due. Callers must hold m.mu.
+func (m *Manager) expectedPlacements(rendered []*Fish, now time.Time) map[placementKey]bool {
+	if now.Sub(m.lastAudit) < placementAudit {
+		return nil
+	}
+	m.lastAudit = now
+	expected := make(map[placementKey]bool, len(rendered))
+	for _, fish := range rendered {
+		expected[placementKey{fish.LastImageID, fish.PlacementID}] = true
+	}
+	return expected
+}
+
+// placementDiff splits the frame's fish placements into those that changed
+// since the connection last got them, or that it never got, and those it
+// has already. Only the animation loop calls it.
+func (c *Connection) placementDiff(f *frame) (changed, same string) {
+	var changedOut, sameOut strings.Builder
+	deleted := make(map[placementKey]bool, len(f.deleted))
+	for _, key := range f.deleted {
+		deleted[key] = true
+	}
+	for _, p := range f.placements {
+		if sent, ok := c.placements[p.key]; ok && sent == p.command && !deleted[p.key] {
+			sameOut.WriteString(p.command)
+		} else {
+			changedOut.WriteString(p.command)
+		}
+	}
+	return changedOut.String(), sameOut.String()
+}
+
+// track records the placements a frame sends to the connection. A full
+// redraw deletes every placement first. Only the animation loop calls it.
+func (c *Connection) track(f *frame, redraw bool) {
+	if redraw || c.placements == nil {
+		c.placements = make(map[placementKey]string)
+	}
+	for _, key := range f.deleted {
+		delete(c.placements, key)
+	}
+	for _, p := range f.placements {
+		c.placements[p.key] = p.command
+	}
+}
+
+// orphans returns delete commands for the placements the connection was
+// sent that no fish owns anymore, such as fish that left through a path
+// which forgot to delete them, and forgets them.
+func (c *Connection) orphans(expected map[placementKey]bool) string {
+	var out strings.Builder
+	for key := range c.placements {
+		if expected[key] {
+			continue
+		}
+		fmt.Fprintf(&out, "\x1b_Ga=d,d=i,i=%d,p=%d,q=1\x1b\\", key.image, key.placement)
+		delete(c.placements, key)
+		metrics.OrphanedPlacements.Inc()
+		log.Printf("Connection %d: deleting orphaned placement %d of image %d", c.ID, key.placement, key.image)
+	}
+	return out.String()
+}
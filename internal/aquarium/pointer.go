@@ -0,0 +1,93 @@
+package aquarium
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	pointerLinger = 3 * time.Second // a dot fades after it last moved
+	pointerReach  = 250.0           // pixels from which fish notice a dot
+	pointerNear   = 20.0            // pixels around a dot fish don't get pulled in
+	pointerPull   = 1.5             // share of its heading a fish turns per second
+	pointerDot    = "\x1b[38;2;255;48;48m●"
+)
+
+// laserPointer is the dot of a spectator, a connection without a fish of
+// its own. Nearby fish swim after it for a moment, but it leaves nothing
+// behind: no food, clicks or pops.
+type laserPointer struct {
+	x, y  float64 // pixels
+	moved time.Time
+	drawn cell // where it was drawn last frame, zero if it wasn't
+}
+
+// movePointer points the spectator's dot at a cell of the tank. Callers
+// must hold m.mu.
+func (m *Manager) movePointer(conn *Connection, row, col int, now time.Time) {
+	x := float64((col-1)*m.termConfig.CellWidth + m.termConfig.CellWidth/2)
+	y := float64((row-1)*m.termConfig.CellHeight + m.termConfig.CellHeight/2)
+	if y >= tankHeight(m.termConfig) || col < 1 || col > m.termConfig.Columns {
+		return
+	}
+	if m.pointers == nil {
+		m.pointers = make(map[uint64]*laserPointer)
+	}
+	p, ok := m.pointers[conn.ID]
+	if !ok {
+		p = &laserPointer{}
+		m.pointers[conn.ID] = p
+	}
+	p.x, p.y, p.moved = x, y, now
+	m.notify()
+}
+
+// followPointers turns fish near a dot towards it, less so the longer it
+// has been still. Callers must hold m.mu.
+func (m *Manager) followPointers(fishData []*Fish, deltaTime float64, now time.Time) {
+	for _, p := range m.pointers {
+		interest := 1 - now.Sub(p.moved).Seconds()/pointerLinger.Seconds()
+		if interest <= 0 {
+			continue
+		}
+		for _, fish := range fishData {
+			if fish.Remote || !fish.AwayUntil.IsZero() || !fish.LeaveAt.IsZero() {
+				continue
+			}
+			dx := p.x - (fish.PosX + fish.Width()/2)
+			dy := p.y - (fish.PosY + fish.Height()/2)
+			d := math.Hypot(dx, dy)
+			speed := math.Hypot(fish.VelX, fish.VelY)
+			if d < pointerNear || d > pointerReach || speed == 0 {
+				continue
+			}
+			turn := math.Min(1, pointerPull*interest*deltaTime)
+			fish.VelX += (dx/d*speed - fish.VelX) * turn
+			climb := maxSchoolClimb * speed
+			fish.VelY = math.Max(-climb, math.Min(climb, fish.VelY+(dy/d*speed-fish.VelY)*turn))
+		}
+	}
+}
+
+// renderPointers draws the spectators' dots and clears those that moved,
+// faded or whose spectator left. Callers must hold m.mu.
+func (m *Manager) renderPointers(buf *UpdateBuffer, config *TerminalConfig, now time.Time) {
+	for connID, p := range m.pointers {
+		_, watching := m.connections[connID]
+		shown := watching && now.Sub(p.moved) < pointerLinger
+		at := cell{
+			Row: int(p.y)/config.CellHeight + 1,
+			Col: int(p.x)/config.CellWidth + 1,
+		}
+		if p.drawn != (cell{}) && (at != p.drawn || !shown) {
+			buf.AddClearCell(p.drawn.Row, p.drawn.Col)
+			p.drawn = cell{}
+		}
+		if !shown {
+			delete(m.pointers, connID)
+			continue
+		}
+		p.drawn = at
+		buf.Decorate(func() { buf.AddText(at.Row, at.Col, pointerDot) })
+	}
+}
@@ -0,0 +1,125 @@
+package aquarium
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+const (
+	poofDuration  = time.Second
+	poofShrink    = 0.6 // share of poofDuration the fish takes to shrink away
+	poofParticles = 10
+	poofMinSize   = 0.1
+)
+
+// poofGlyphs are the bubbles a leaving fish bursts into.
+var poofGlyphs = []string{"o", "°", "·", "*", "O"}
+
+// poof is a fish that left with its connection, shrinking into a burst of
+// bubbles. It is drawn for poofDuration after the fish was removed, then
+// its placement is deleted.
+type poof struct {
+	fish      *Fish
+	start     time.Time
+	size      float64 // the fish's size when it left
+	color     string
+	particles []poofParticle
+	cleared   bool // the fish's own bubbles were cleared
+}
+
+// poofParticle is a bubble of a poof flying outwards from where the fish
+// was, in pixels.
+type poofParticle struct {
+	x, y   float64
+	vx, vy float64 // pixels per second
+	glyph  string
+	drawn  cell // where it was drawn last frame, zero if it wasn't
+}
+
+// createPoofEffect starts the burst of a fish that was just removed.
+// Callers must hold m.mu.
+func (m *Manager) createPoofEffect(fish *Fish) {
+	if fish.LastImageID == 0 || !fish.AwayUntil.IsZero() {
+		return // never drawn, or drawn elsewhere
+	}
+	color := fish.Color
+	if color == "" {
+		color = "\x1b[38;5;153m"
+	}
+	p := poof{fish: fish, start: time.Now(), size: fish.size(), color: color}
+	cx := fish.PosX + fish.Width()/2
+	cy := fish.PosY + fish.bobbingOffset() + fish.Height()/2
+	for i := 0; i < poofParticles; i++ {
+		angle := 2 * math.Pi * (float64(i) + rand.Float64()) / poofParticles
+		speed := 60 + rand.Float64()*100
+		p.particles = append(p.particles, poofParticle{
+			x:     cx,
+			y:     cy,
+			vx:    math.Cos(angle) * speed,
+			vy:    math.Sin(angle)*speed - 40, // bubbles rise
+			glyph: poofGlyphs[rand.Intn(len(poofGlyphs))],
+		})
+	}
+	m.poofs = append(m.poofs, p)
+	m.notify()
+}
+
+// renderPoofs shrinks leaving fish, moves their bubbles outwards and
+// deletes what is over. Clearing goes out whatever the frame budget, the
+// bubbles are decoration. Callers must hold m.mu.
+func (m *Manager) renderPoofs(buf *UpdateBuffer, config *TerminalConfig, now time.Time) {
+	waterRows := config.Rows - config.FloorRows - 1
+	active := m.poofs[:0]
+	for _, p := range m.poofs {
+		fish := p.fish
+		if !p.cleared {
+			for _, bubble := range fish.Bubbles {
+				if bubble.PrevCol > 0 && bubble.PrevRow > 0 {
+					buf.AddClearCell(bubble.PrevRow, bubble.PrevCol)
+				}
+			}
+			fish.Bubbles = nil
+			p.cleared = true
+		}
+
+		elapsed := now.Sub(p.start).Seconds()
+		progress := elapsed / poofDuration.Seconds()
+		if fish.LastImageID != 0 {
+			if progress < poofShrink {
+				fish.Size = math.Max(poofMinSize, p.size*(1-progress/poofShrink))
+				fish.Render(buf, config)
+			} else {
+				buf.AddDeletePlacement(fish.LastImageID, fish.PlacementID)
+				fish.LastImageID = 0
+			}
+		}
+
+		var draw []poofParticle
+		for i := range p.particles {
+			particle := &p.particles[i]
+			at := cell{
+				Row: int((particle.y+particle.vy*elapsed)/float64(config.CellHeight)) + 1,
+				Col: int((particle.x+particle.vx*elapsed)/float64(config.CellWidth)) + 1,
+			}
+			if particle.drawn != (cell{}) && (at != particle.drawn || progress >= 1) {
+				buf.AddClearCell(particle.drawn.Row, particle.drawn.Col)
+				particle.drawn = cell{}
+			}
+			if progress < 1 && at.Row >= 1 && at.Row <= waterRows && at.Col >= 1 && at.Col <= config.Columns {
+				particle.drawn = at
+				draw = append(draw, *particle)
+			}
+		}
+		buf.Decorate(func() {
+			for _, particle := range draw {
+				buf.AddText(particle.drawn.Row, particle.drawn.Col, p.color+particle.glyph)
+			}
+		})
+
+		if progress < 1 {
+			active = append(active, p)
+		}
+	}
+	m.poofs = active
+}
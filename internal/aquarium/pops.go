@@ -0,0 +1,142 @@
+package aquarium
+
+import (
+	"errors"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/acuqa/ssh-aquarium/internal/store"
+)
+
+const (
+	popSaveInterval = 30 * time.Second
+	splashDuration  = 300 * time.Millisecond
+	splashGlyph     = "\x1b[38;5;195m*"
+)
+
+// PopStats counts the bubbles each user popped, for achievements. It is
+// shared by all rooms and optionally persisted to a state directory.
+type PopStats struct {
+	mu       sync.Mutex
+	counts   map[string]int
+	store    store.Store
+	dirty    bool
+	lastSave time.Time
+}
+
+func NewPopStats() *PopStats {
+	return &PopStats{counts: make(map[string]int)}
+}
+
+// SetStore loads the counts from state and saves future pops there.
+func (p *PopStats) SetStore(state store.Store) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.store = state
+	counts, err := state.LoadPops()
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	p.counts = counts
+	return nil
+}
+
+// Record counts a bubble popped by the named user and returns their total.
+func (p *PopStats) Record(name string) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.counts[name]++
+	p.dirty = true
+	if time.Since(p.lastSave) >= popSaveInterval {
+		p.saveLocked()
+	}
+	return p.counts[name]
+}
+
+// Count returns how many bubbles the named user popped.
+func (p *PopStats) Count(name string) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.counts[name]
+}
+
+// Snapshot returns a copy of all counts.
+func (p *PopStats) Snapshot() map[string]int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	counts := make(map[string]int, len(p.counts))
+	for name, count := range p.counts {
+		counts[name] = count
+	}
+	return counts
+}
+
+// Save writes unsaved counts to the state directory.
+func (p *PopStats) Save() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.saveLocked()
+}
+
+func (p *PopStats) saveLocked() {
+	if p.store == nil || !p.dirty {
+		return
+	}
+	if err := p.store.SavePops(p.counts); err != nil {
+		log.Printf("Failed to save pop counts: %v", err)
+		return
+	}
+	p.dirty = false
+	p.lastSave = time.Now()
+}
+
+// splash is the short-lived mark left by a popped bubble.
+type splash struct {
+	cell
+	until time.Time
+}
+
+// popBubble pops the bubble drawn at the clicked cell, if any. Popping the
+// bubbles of someone else's fish counts towards the user's pops, popping
+// your own fish's doesn't. Callers must hold m.mu.
+func (m *Manager) popBubble(connID uint64, row, col int) bool {
+	for _, fish := range m.fish {
+		for _, bubble := range fish.Bubbles {
+			if bubble.Popped || bubble.PrevRow != row || bubble.PrevCol != col {
+				continue
+			}
+
+			bubble.Popped = true
+			m.splashes = append(m.splashes, splash{cell{row, col}, time.Now().Add(splashDuration)})
+			if conn, ok := m.connections[connID]; ok && bubble.Owner != connID {
+				m.pops.Record(conn.Username)
+			}
+			m.notify()
+			return true
+		}
+	}
+	return false
+}
+
+// renderSplashes draws splashes and clears the ones that are over. Callers
+// must hold m.mu.
+func (m *Manager) renderSplashes(buf *UpdateBuffer, now time.Time) {
+	active := m.splashes[:0]
+	for _, s := range m.splashes {
+		if now.After(s.until) {
+			buf.AddClearCell(s.Row, s.Col)
+			continue
+		}
+		buf.AddText(s.Row, s.Col, splashGlyph)
+		active = append(active, s)
+	}
+	m.splashes = active
+}
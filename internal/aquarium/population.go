@@ -0,0 +1,76 @@
+package aquarium
+
+import (
+	"log"
+	"math"
+	"math/rand"
+	"time"
+)
+
+const (
+	RushHourUsers  = 10  // more users than this make the tank busy
+	CurrentPeriod  = 20  // seconds for the rush hour current to swing back and forth
+	npcSpawnPeriod = 2.0 // seconds between NPC fish arriving
+)
+
+// PopulationPolicy is how ambient behavior scales with the number of users
+// in a room.
+type PopulationPolicy struct {
+	Label   string  // shown in the status bar, empty for the normal tank
+	Pace    float64 // simulation speed multiplier
+	Current float64 // peak sideways current in cells per second
+	NPCFish int     // unowned fish keeping the tank lively
+}
+
+// populationPolicy is consulted every tick with the room's current
+// population.
+func populationPolicy(users int) PopulationPolicy {
+	switch {
+	case users > RushHourUsers:
+		return PopulationPolicy{Label: "rush hour", Pace: 1.4, Current: 2}
+	case users == 1:
+		// A lone visitor gets a slower, music-box tank with some company
+		return PopulationPolicy{Label: "calm", Pace: 0.6, NPCFish: 3}
+	default:
+		return PopulationPolicy{Pace: 1}
+	}
+}
+
+// current returns the sideways drift in pixels per second at now.
+func (p PopulationPolicy) current(now time.Time, config *TerminalConfig) float64 {
+	if p.Current == 0 {
+		return 0
+	}
+	phase := float64(now.UnixMilli()) / 1000 / CurrentPeriod * 2 * math.Pi
+	return p.Current * float64(config.CellWidth) * math.Sin(phase)
+}
+
+// updatePopulation adds or removes NPC fish to match the policy. Callers must
+// hold m.mu.
+func (m *Manager) updatePopulation(policy PopulationPolicy, config *TerminalConfig, now time.Time) {
+	if policy.Label != m.population.Label {
+		log.Printf("Population policy changed to %q", policy.Label)
+		m.aquarium.LastStatusUpdate = time.Time{} // show the new label right away
+	}
+	m.population = policy
+
+	npcs := make([]uint64, 0, policy.NPCFish)
+	for id, fish := range m.fish {
+		if fish.NPC {
+			npcs = append(npcs, id)
+		}
+	}
+
+	// Extra NPCs leave all at once, new ones trickle in
+	for len(npcs) > policy.NPCFish {
+		m.removeFishLocked(npcs[len(npcs)-1])
+		npcs = npcs[:len(npcs)-1]
+	}
+	if len(npcs) < policy.NPCFish && now.Sub(m.lastNPC).Seconds() >= npcSpawnPeriod {
+		fishID := m.fishCounter.Add(1)
+		fish := NewFish(fishID, 0, config, "", userColors[rand.Intn(len(userColors))])
+		fish.NPC = true
+		m.fish[fishID] = fish
+		m.lastNPC = now
+	}
+}
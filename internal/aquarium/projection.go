@@ -0,0 +1,297 @@
+package aquarium
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+)
+
+// Projection draws frames rendered for the tank's shared geometry, the
+// world, on a terminal of another size. The water is stretched over the
+// screen: every world cell covers the screen cells between its edges, so
+// whatever is drawn and later cleared lands on the same cells, and fish are
+// placed and scaled in pixels, keeping their shape. The status row stays at
+// the bottom and its text isn't stretched, only moved.
+type Projection struct {
+	World  TerminalConfig
+	Screen TerminalConfig
+}
+
+// NewProjection returns the projection from world to screen, or nil if the
+// two are the same size and frames can be sent as they are.
+func NewProjection(world, screen TerminalConfig) *Projection {
+	if world.Columns == screen.Columns && world.Rows == screen.Rows &&
+		world.CellWidth == screen.CellWidth && world.CellHeight == screen.CellHeight {
+		return nil
+	}
+	for _, v := range []int{world.Columns, world.Rows - 1, world.CellWidth, world.CellHeight,
+		screen.Columns, screen.Rows - 1, screen.CellWidth, screen.CellHeight} {
+		if v < 1 {
+			return nil
+		}
+	}
+	return &Projection{World: world, Screen: screen}
+}
+
+// span returns the cells of m covered by cell i of n when n cells are
+// stretched over m, none if from > to.
+func span(i, n, m int) (from, to int) {
+	return (i-1)*m/n + 1, min(i*m/n, m)
+}
+
+// rows returns the screen rows world row r covers.
+func (p *Projection) rows(r int) (from, to int) {
+	if r >= p.World.Rows {
+		return p.Screen.Rows, p.Screen.Rows
+	}
+	return span(r, p.World.Rows-1, p.Screen.Rows-1)
+}
+
+// cols returns the screen columns world column c covers.
+func (p *Projection) cols(c int) (from, to int) {
+	return span(c, p.World.Columns, p.Screen.Columns)
+}
+
+// WorldCell returns the world cell shown at a screen cell, e.g. for a
+// click.
+func (p *Projection) WorldCell(row, col int) (int, int) {
+	if row >= p.Screen.Rows {
+		row = p.World.Rows
+	} else {
+		row = (row-1)*(p.World.Rows-1)/(p.Screen.Rows-1) + 1
+	}
+	return row, (col-1)*p.World.Columns/p.Screen.Columns + 1
+}
+
+// scale returns how much larger the screen's water is than the world's in
+// pixels, across and down.
+func (p *Projection) scale() (x, y float64) {
+	x = float64(p.Screen.Columns*p.Screen.CellWidth) / float64(p.World.Columns*p.World.CellWidth)
+	y = float64((p.Screen.Rows-1)*p.Screen.CellHeight) / float64((p.World.Rows-1)*p.World.CellHeight)
+	return x, y
+}
+
+// run is text drawn from one cursor position, kept until the cursor moves
+// so it can be drawn on every screen row its world row covers.
+type run struct {
+	row, col int      // world cell of the first glyph
+	items    [][]byte // glyphs and the SGR sequences between them
+	glyph    []bool   // whether each item is a glyph
+	glyphs   int
+}
+
+// Apply rewrites a frame for the world into one for the screen. Like
+// Viewport.Apply it expects output to position the cursor before drawing.
+func (p *Projection) Apply(data []byte) []byte {
+	out := make([]byte, 0, len(data)+len(data)/4)
+	r := run{row: 1, col: 1}
+	flush := func() {
+		out = p.flush(out, &r)
+		r = run{row: r.row, col: r.col + r.glyphs}
+	}
+	for len(data) > 0 {
+		t := nextToken(data)
+		data = data[len(t.raw):]
+		switch t.kind {
+		case tokenCSI:
+			if t.final != 'H' && t.final != 'f' {
+				r.items = append(r.items, t.raw)
+				r.glyph = append(r.glyph, false)
+				continue
+			}
+			flush()
+			r.row, r.col = 1, 1
+			if row, col, ok := bytes.Cut(t.body, []byte{';'}); ok {
+				r.row, r.col = atoiOr(string(row), 1), atoiOr(string(col), 1)
+			} else if len(t.body) > 0 {
+				r.row = atoiOr(string(t.body), 1)
+			}
+
+		case tokenAPC:
+			flush()
+			out = p.graphics(out, t.raw, r.row, r.col)
+
+		case tokenOSC, tokenDCS, tokenEscape:
+			r.items = append(r.items, t.raw)
+			r.glyph = append(r.glyph, false)
+
+		case tokenControl:
+			flush()
+			out = append(out, t.raw...)
+			if t.raw[0] == '\r' {
+				r.col = 1
+			}
+
+		case tokenText:
+			r.items = append(r.items, t.raw)
+			r.glyph = append(r.glyph, true)
+			r.glyphs++
+
+		case tokenPartial:
+			flush()
+			return append(out, t.raw...)
+		}
+	}
+	flush()
+	return out
+}
+
+// flush draws a run of text. In the water every glyph fills the screen
+// cells its world cell covers. On the status row text keeps its width:
+// it starts under the same part of the screen, and text reaching the right
+// edge of the world reaches the right edge of the screen.
+func (p *Projection) flush(out []byte, r *run) []byte {
+	if r.glyphs == 0 {
+		for _, item := range r.items {
+			out = append(out, item...)
+		}
+		return out
+	}
+
+	if r.row >= p.World.Rows && r.glyphs > 1 {
+		col, _ := p.cols(r.col)
+		if r.col+r.glyphs-1 >= p.World.Columns {
+			col = p.Screen.Columns - r.glyphs + 1
+		}
+		out = fmt.Appendf(out, "\x1b[%d;%dH", p.Screen.Rows, max(col, 1))
+		for n, item := range r.items {
+			if r.glyph[n] {
+				visible := col >= 1 && col <= p.Screen.Columns
+				col++
+				if !visible {
+					continue
+				}
+			}
+			out = append(out, item...)
+		}
+		return out
+	}
+
+	from, to := p.rows(r.row)
+	start, _ := p.cols(r.col)
+	for row := max(from, 1); row <= to; row++ {
+		out = fmt.Appendf(out, "\x1b[%d;%dH", row, max(start, 1))
+		col := r.col
+		for n, item := range r.items {
+			if !r.glyph[n] {
+				out = append(out, item...)
+				continue
+			}
+			first, last := p.cols(col)
+			for c := max(first, 1); c <= last; c++ {
+				out = append(out, item...)
+			}
+			col++
+		}
+	}
+	return out
+}
+
+// graphics rewrites a Kitty graphics command for the screen. Placements
+// are moved to the same spot in pixels and scaled by the smaller of the two
+// scales, everything else is passed on.
+func (p *Projection) graphics(out, command []byte, row, col int) []byte {
+	body := command[2 : len(command)-2]
+	if len(body) == 0 || body[0] != 'G' {
+		return append(out, command...)
+	}
+	control, payload, hasPayload := bytes.Cut(body[1:], []byte{';'})
+	keys := bytes.Split(control, []byte{','})
+	values := make(map[string]string, len(keys))
+	for _, kv := range keys {
+		if k, v, ok := bytes.Cut(kv, []byte{'='}); ok {
+			values[string(k)] = string(v)
+		}
+	}
+	if values["a"] != "p" {
+		return append(out, command...)
+	}
+
+	sx, sy := p.scale()
+	x := float64((col-1)*p.World.CellWidth+atoiOr(values["X"], 0)) * sx
+	y := float64((row-1)*p.World.CellHeight+atoiOr(values["Y"], 0)) * sy
+	cellX, offsetX := divmod(int(math.Floor(x)), p.Screen.CellWidth)
+	cellY, offsetY := divmod(int(math.Floor(y)), p.Screen.CellHeight)
+	s := min(sx, sy)
+	width := float64(atoiOr(values["c"], 1)*p.World.CellWidth) * s
+	height := float64(atoiOr(values["r"], 1)*p.World.CellHeight) * s
+
+	rewritten := map[string]int{
+		"X": offsetX,
+		"Y": offsetY,
+		"c": max(1, int(math.Ceil(width/float64(p.Screen.CellWidth)))),
+		"r": max(1, int(math.Ceil(height/float64(p.Screen.CellHeight)))),
+	}
+	out = fmt.Appendf(out, "\x1b[%d;%dH\x1b_G", max(cellY+1, 1), max(cellX+1, 1))
+	for n, kv := range keys {
+		if n > 0 {
+			out = append(out, ',')
+		}
+		if k, _, ok := bytes.Cut(kv, []byte{'='}); ok {
+			if v, ok := rewritten[string(k)]; ok {
+				out = fmt.Appendf(out, "%s=%d", k, v)
+				delete(rewritten, string(k))
+				continue
+			}
+		}
+		out = append(out, kv...)
+	}
+	for _, k := range []string{"X", "Y", "c", "r"} {
+		if v, ok := rewritten[k]; ok {
+			out = fmt.Appendf(out, ",%s=%d", k, v)
+		}
+	}
+	if hasPayload {
+		out = append(append(out, ';'), payload...)
+	}
+	return append(out, "\x1b\\"...)
+}
+
+// divmod divides rounding down, so pixels left of the screen still get an
+// offset within their cell.
+func divmod(a, b int) (int, int) {
+	q, r := a/b, a%b
+	if r < 0 {
+		q, r = q-1, r+b
+	}
+	return q, r
+}
+
+// SetConnectionTerminal records the size of a connection's terminal, e.g.
+// when it joins or its split view opens. Frames are projected onto it if
+// it differs from the tank's geometry.
+func (m *Manager) SetConnectionTerminal(connID uint64, config *TerminalConfig) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	conn, exists := m.connections[connID]
+	if !exists {
+		return
+	}
+	conn.terminal = *config
+	m.projectLocked(conn)
+}
+
+// projectLocked sets up the projection of the tank onto the connection's
+// terminal. Callers must hold m.mu.
+func (m *Manager) projectLocked(conn *Connection) {
+	if m.termConfig == nil || conn.terminal.Columns == 0 {
+		conn.projection.Store(nil)
+		if m.termConfig != nil {
+			conn.renderer.Resize(*m.termConfig)
+		}
+		return
+	}
+	conn.projection.Store(NewProjection(*m.termConfig, conn.terminal))
+	conn.renderer.Resize(conn.terminal)
+}
+
+// project rewrites output rendered for the tank for the connection's
+// terminal and its graphics protocol.
+func (c *Connection) project(data string) []byte {
+	out := []byte(data)
+	if p := c.projection.Load(); p != nil {
+		out = p.Apply(out)
+	}
+	return c.renderer.Render(out)
+}
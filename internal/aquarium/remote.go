@@ -0,0 +1,186 @@
+package aquarium
+
+import (
+	"log"
+	"math"
+	"sort"
+	"time"
+)
+
+// FishState is the renderer-independent view of a fish that is shared with
+// other instances. Positions and velocities are normalized to the terminal
+// pixel size so nodes with different terminal geometry agree on placement.
+type FishState struct {
+	ID       uint64  `json:"id"`
+	X        float64 `json:"x"`
+	Y        float64 `json:"y"`
+	VelX     float64 `json:"vx"`
+	VelY     float64 `json:"vy"`
+	Username string  `json:"username"`
+	Color    string  `json:"color"`
+	Size     float64 `json:"size,omitempty"`
+	Depth    float64 `json:"depth,omitempty"`
+}
+
+// LocalFishStates returns the fish owned by connections on this instance
+// as of the last frame.
+func (m *Manager) LocalFishStates() []FishState {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.localStates // replaced whole each frame, never changed
+}
+
+// localFishStates copies the fish owned by connections on this instance
+// for peers. Only the animation loop calls it, as fish move outside m.mu.
+func localFishStates(fishData []*Fish, config *TerminalConfig) []FishState {
+	width := float64(config.Columns * config.CellWidth)
+	height := float64(config.Rows * config.CellHeight)
+
+	states := make([]FishState, 0, len(fishData))
+	for _, fish := range fishData {
+		// Skip mirrored fish, visitors and fish currently visiting a peer
+		if fish.OwnerID == 0 || !fish.AwayUntil.IsZero() {
+			continue
+		}
+		states = append(states, FishState{
+			ID:       fish.ID,
+			X:        fish.PosX / width,
+			Y:        fish.PosY / height,
+			VelX:     fish.VelX / width,
+			VelY:     fish.VelY / height,
+			Username: fish.Username,
+			Color:    fish.Color,
+			Size:     fish.Size,
+			Depth:    fish.Depth,
+		})
+	}
+	return states
+}
+
+// ApplyRemoteFish replaces the set of fish mirrored from another instance.
+// Fish missing from states are removed from the tank.
+func (m *Manager) ApplyRemoteFish(nodeID string, states []FishState) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Without a local aquarium there is nothing to render remote fish into
+	if m.termConfig == nil {
+		return
+	}
+
+	known := m.remoteFish[nodeID]
+	if known == nil {
+		known = make(map[uint64]uint64)
+		m.remoteFish[nodeID] = known
+		log.Printf("Cluster node %s joined the aquarium", nodeID)
+	}
+	m.remoteSeen[nodeID] = time.Now()
+
+	if len(states) > 0 {
+		m.notify()
+	}
+
+	seen := make(map[uint64]bool, len(states))
+	for _, state := range states {
+		seen[state.ID] = true
+
+		fishID, exists := known[state.ID]
+		fish := m.fish[fishID]
+		if !exists || fish == nil {
+			fishID = m.fishCounter.Add(1)
+			fish = NewFish(fishID, 0, m.termConfig, state.Username, state.Color)
+			fish.Remote = true
+			mirror(fish, state, m.termConfig)
+			m.fish[fishID] = fish
+			known[state.ID] = fishID
+			continue
+		}
+
+		// The animation loop moves and draws fish outside m.mu, so fish
+		// already swimming take the new state on the next frame
+		if m.mirrors == nil {
+			m.mirrors = make(map[*Fish]FishState)
+		}
+		m.mirrors[fish] = state
+	}
+
+	for remoteID, fishID := range known {
+		if !seen[remoteID] {
+			m.removeFishLocked(fishID)
+			delete(known, remoteID)
+		}
+	}
+}
+
+// mirror sets a fish to the state a peer published for it. Only the
+// animation loop calls it for fish already in the tank.
+func mirror(fish *Fish, state FishState, config *TerminalConfig) {
+	width := float64(config.Columns * config.CellWidth)
+	height := float64(config.Rows * config.CellHeight)
+	fish.PosX = state.X * width
+	fish.PosY = state.Y * height
+	fish.VelX = state.VelX * width
+	fish.VelY = state.VelY * height
+	fish.Username = state.Username
+	fish.Color = state.Color
+	if state.Size > 0 {
+		fish.Size = math.Min(state.Size, MaxFishSize)
+	}
+	fish.Depth = clampDepth(state.Depth)
+}
+
+// RemoteNodes returns the IDs of the cluster nodes currently mirrored,
+// sorted.
+func (m *Manager) RemoteNodes() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	nodes := make([]string, 0, len(m.remoteSeen))
+	for nodeID := range m.remoteSeen {
+		nodes = append(nodes, nodeID)
+	}
+	sort.Strings(nodes)
+	return nodes
+}
+
+// DropRemoteNode removes the fish mirrored from a node, e.g. once it handed
+// its tank over.
+func (m *Manager) DropRemoteNode(nodeID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.dropRemoteNodeLocked(nodeID)
+}
+
+func (m *Manager) dropRemoteNodeLocked(nodeID string) {
+	for _, fishID := range m.remoteFish[nodeID] {
+		m.removeFishLocked(fishID)
+	}
+	delete(m.remoteFish, nodeID)
+	delete(m.remoteSeen, nodeID)
+}
+
+// PruneRemoteNodes drops fish from instances that have not published
+// their state within maxAge.
+func (m *Manager) PruneRemoteNodes(maxAge time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for nodeID, lastSeen := range m.remoteSeen {
+		if time.Since(lastSeen) < maxAge {
+			continue
+		}
+		log.Printf("Cluster node %s timed out", nodeID)
+		m.dropRemoteNodeLocked(nodeID)
+	}
+}
+
+// removeFishLocked deletes a fish and queues removal of its placement for
+// the next frame. Callers must hold m.mu.
+func (m *Manager) removeFishLocked(fishID uint64) {
+	fish, ok := m.fish[fishID]
+	if !ok {
+		return
+	}
+	delete(m.fish, fishID)
+	m.removedFish = append(m.removedFish, fish)
+}
@@ -0,0 +1,77 @@
+package aquarium
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRemoteStateAppliesOnTheNextFrame(t *testing.T) {
+	m := newTestRoom(t)
+	addTestFish(t, m, "watcher", 40, 80)
+	state := FishState{ID: 7, X: 0.25, Y: 0.25, Username: "dory", Color: userColors[1]}
+	m.ApplyRemoteFish("peer", []FishState{state})
+
+	m.mu.RLock()
+	fish := m.fish[m.remoteFish["peer"][7]]
+	m.mu.RUnlock()
+	if fish == nil || fish.PosX != 160 {
+		t.Fatalf("new mirrored fish = %+v, want it at x 160", fish)
+	}
+
+	// Peers publish while the animation loop moves fish
+	m.mu.Lock()
+	m.lastUpdate = time.Now()
+	m.mu.Unlock()
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for range 20 {
+			m.updateAndBroadcast()
+		}
+	}()
+	for range 20 {
+		state.X = 0.5
+		m.ApplyRemoteFish("peer", []FishState{state})
+	}
+	wg.Wait()
+
+	m.updateAndBroadcast()
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if len(m.mirrors) != 0 {
+		t.Errorf("%d mirrored states left after a frame", len(m.mirrors))
+	}
+	if width := float64(80 * 8); fish.PosX < width/2-50 || fish.PosX > width/2+50 {
+		t.Errorf("mirrored fish at x %.0f, want near %.0f", fish.PosX, width/2)
+	}
+}
+
+func TestLocalFishStatesWhileFishMove(t *testing.T) {
+	m := newTestRoom(t)
+	_, fish := addTestFish(t, m, "nemo", 320, 160)
+	m.ApplyRemoteFish("peer", []FishState{{ID: 7, X: 0.25, Y: 0.25, Username: "dory", Color: userColors[1]}})
+
+	// Peers read the tank while the animation loop moves fish
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range 20 {
+			m.updateAndBroadcast()
+		}
+	}()
+	for reading := true; reading; {
+		select {
+		case <-done:
+			reading = false
+		default:
+			m.LocalFishStates()
+		}
+	}
+
+	states := m.LocalFishStates()
+	if len(states) != 1 || states[0].ID != fish.ID {
+		t.Fatalf("local fish states = %+v, want only nemo's fish", states)
+	}
+}
@@ -0,0 +1,45 @@
+package aquarium
+
+// Graphics protocols fish are drawn with.
+const (
+	GraphicsKitty = "kitty"
+	GraphicsSixel = "sixel"
+	GraphicsText  = "text"
+)
+
+// Renderer draws fish on a client's terminal with the graphics protocol it
+// understands. Frames are rendered once for everyone with Kitty graphics
+// commands, and each connection's renderer rewrites them for its terminal
+// after they were projected onto it.
+type Renderer interface {
+	// Name is the graphics protocol, one of the Graphics constants.
+	Name() string
+	// Resize tells the renderer the size of the terminal. It is called
+	// whenever the terminal or the tank changes size, which is followed by
+	// a full redraw.
+	Resize(screen TerminalConfig)
+	// Render rewrites frame output drawn with Kitty graphics.
+	Render(data []byte) []byte
+}
+
+// NewRenderer returns the renderer for a graphics protocol, Kitty graphics
+// for anything unknown.
+func NewRenderer(graphics string) Renderer {
+	switch graphics {
+	case GraphicsSixel:
+		return NewSixelRenderer()
+	case GraphicsText:
+		return NewTextRenderer()
+	}
+	return KittyRenderer{}
+}
+
+// KittyRenderer sends frames as they are. Fish images are uploaded to the
+// terminal once and placed by ID.
+type KittyRenderer struct{}
+
+func (KittyRenderer) Name() string { return GraphicsKitty }
+
+func (KittyRenderer) Resize(TerminalConfig) {}
+
+func (KittyRenderer) Render(data []byte) []byte { return data }
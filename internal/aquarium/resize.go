@@ -0,0 +1,76 @@
+package aquarium
+
+import "log"
+
+// ResizeConnection applies the new size of a connection's terminal. The
+// tank follows the terminal it is sized for: when that one changes, the
+// water and floor are laid out again for the new size, fish outside it
+// swim back in and everyone gets a full redraw, which also deletes fish
+// placed for the old size. Other terminals get the tank projected onto
+// their new size.
+func (m *Manager) ResizeConnection(connID uint64, config *TerminalConfig) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	conn, exists := m.connections[connID]
+	if !exists {
+		return
+	}
+	sizedFor := m.termConfig != nil && conn.terminal.Columns > 0 && conn.projection.Load() == nil
+	conn.terminal = *config
+	if !sizedFor {
+		m.projectLocked(conn)
+		conn.refresh()
+		m.notify()
+		return
+	}
+
+	log.Printf("Resizing tank to %dx%d chars, %dx%d pixels per cell", config.Columns, config.Rows, config.CellWidth, config.CellHeight)
+	tank := *config
+	tank.FloorRows = m.floor.Rows()
+	m.termConfig = &tank
+	m.water = nil
+	m.resized = true
+	for _, c := range m.connections {
+		m.projectLocked(c)
+		c.refresh()
+	}
+	m.notify()
+}
+
+// settleResize fits the tank's contents into its new size: fish and food
+// outside it are moved back in, bubbles outside it burst, and cells drawn
+// last frame are forgotten since the full redraw paints over them. It runs
+// on the animation loop, which owns them. Callers must hold m.mu.
+func (m *Manager) settleResize() {
+	width := float64(m.termConfig.Columns * m.termConfig.CellWidth)
+	height := tankHeight(m.termConfig)
+	for _, fish := range m.fish {
+		fish.PosX = max(0, min(fish.PosX, width-fish.Width()))
+		fish.PosY = max(0, min(fish.PosY, height-fish.Height()))
+		bubbles := fish.Bubbles[:0]
+		for _, bubble := range fish.Bubbles {
+			if bubble.X < width && bubble.Y < height {
+				bubble.PrevCol, bubble.PrevRow = 0, 0
+				bubbles = append(bubbles, bubble)
+			}
+		}
+		fish.Bubbles = bubbles
+		fish.BubblesToClear = fish.BubblesToClear[:0]
+	}
+	for _, pellet := range m.pellets {
+		pellet.X = max(0, min(pellet.X, width-1))
+		pellet.Y = max(0, min(pellet.Y, height-1))
+		pellet.PrevCol, pellet.PrevRow = 0, 0
+	}
+	m.crowns = nil
+	m.splashes = nil
+	m.poofs = nil
+	m.pointers = nil
+	m.drags = nil
+	m.confetti = nil
+	m.labelCells = nil
+	m.debugCells = nil
+	m.emoteCells = nil
+	m.chatCells = nil
+}
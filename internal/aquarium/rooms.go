@@ -0,0 +1,391 @@
+package aquarium
+
+import (
+	"errors"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/acuqa/ssh-aquarium/internal/store"
+)
+
+const snapshotRecord = "snapshots"
+
+// Registry holds the independent aquariums ("rooms") hosted by this server.
+// Each room is a separate Manager with its own fish and animation loop,
+// which runs only while someone watches; the supervisor shares the CPUs
+// between the loops.
+type Registry struct {
+	mu         sync.RWMutex
+	rooms      map[string]*Manager
+	supervisor *supervisor
+	order      []string
+	clicks     *ClickStats
+	pops       *PopStats
+	visitors   *Visitors
+	owners     *Owners
+	history    *History
+	settings   *SettingsStore
+	guestbook  *Guestbook
+	cooldowns  *Cooldowns
+	admins     map[string]bool       // SSH key fingerprints allowed to run admin commands
+	access     map[string]RoomAccess // rooms not open to everyone
+	store      store.Store
+	events     EventFunc // told about connects and milestones
+
+	layoutMu sync.Mutex // serializes changes to the saved layouts
+}
+
+// RoomInfo describes a room for listings.
+type RoomInfo struct {
+	Name       string `json:"name"`
+	Population int    `json:"population"`
+	Private    bool   `json:"private,omitempty"` // not open to everyone
+}
+
+func NewRegistry(names []string) *Registry {
+	r := &Registry{
+		rooms:     make(map[string]*Manager),
+		clicks:    NewClickStats(),
+		pops:      NewPopStats(),
+		visitors:  NewVisitors(),
+		owners:    NewOwners(),
+		history:   NewHistory(),
+		settings:  NewSettingsStore(),
+		guestbook: NewGuestbook(),
+		cooldowns: NewCooldowns(),
+	}
+	for _, name := range names {
+		if _, exists := r.rooms[name]; exists || name == "" {
+			continue
+		}
+		r.rooms[name] = NewManager()
+		r.order = append(r.order, name)
+	}
+	if len(r.order) == 0 {
+		r.rooms["lobby"] = NewManager()
+		r.order = append(r.order, "lobby")
+	}
+	for _, room := range r.rooms {
+		room.clicks = r.clicks
+		room.pops = r.pops
+		room.owners = r.owners
+		room.cooldowns = r.cooldowns
+	}
+	r.supervisor = newSupervisor(r.rooms)
+	return r
+}
+
+func (r *Registry) SetDebugMode(debug bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, room := range r.rooms {
+		room.SetDebugMode(debug)
+	}
+}
+
+func (r *Registry) SetTheme(theme Theme) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, room := range r.rooms {
+		room.SetTheme(theme)
+	}
+}
+
+func (r *Registry) SetFloor(floor Floor) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, room := range r.rooms {
+		room.SetFloor(floor)
+	}
+}
+
+func (r *Registry) SetBandwidthCap(bytesPerSecond int) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, room := range r.rooms {
+		room.SetBandwidthCap(bytesPerSecond)
+	}
+}
+
+func (r *Registry) SetLabelMode(mode LabelMode) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, room := range r.rooms {
+		room.SetLabelMode(mode)
+	}
+}
+
+func (r *Registry) SetStormInterval(interval time.Duration) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, room := range r.rooms {
+		room.SetStormInterval(interval)
+	}
+}
+
+// SetAdmins sets the SSH key fingerprints (SHA256:...) of admins. Usernames
+// can't be trusted since any password is accepted.
+func (r *Registry) SetAdmins(fingerprints []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.admins = make(map[string]bool, len(fingerprints))
+	for _, fp := range fingerprints {
+		if fp != "" {
+			r.admins[fp] = true
+		}
+	}
+	r.cooldowns.SetExempt(fingerprints)
+}
+
+// SetCooldowns changes how long users wait between actions that affect
+// everyone, in every room.
+func (r *Registry) SetCooldowns(durations map[Action]time.Duration) {
+	r.cooldowns.SetDurations(durations)
+}
+
+// IsAdmin reports whether the client authenticated with an admin key.
+func (r *Registry) IsAdmin(client ClientInfo) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return client.Fingerprint != "" && r.admins[client.Fingerprint]
+}
+
+// Default returns the room new connections join.
+func (r *Registry) Default() *Manager {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.rooms[r.order[0]]
+}
+
+// DefaultName returns the name of the room new connections join.
+func (r *Registry) DefaultName() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.order[0]
+}
+
+// Room returns the named room or nil if it does not exist.
+func (r *Registry) Room(name string) *Manager {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.rooms[name]
+}
+
+// Rooms lists all rooms in configuration order with their population.
+func (r *Registry) Rooms() []RoomInfo {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	infos := make([]RoomInfo, 0, len(r.order))
+	for _, name := range r.order {
+		_, private := r.access[name]
+		infos = append(infos, RoomInfo{
+			Name:       name,
+			Population: r.rooms[name].GetConnectionCount(),
+			Private:    private,
+		})
+	}
+	return infos
+}
+
+// GetFishCount returns the number of fish across all rooms.
+func (r *Registry) GetFishCount() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	total := 0
+	for _, room := range r.rooms {
+		total += room.GetFishCount()
+	}
+	return total
+}
+
+// Stats sums up the aquarium for the web API and the stats command.
+type Stats struct {
+	Fish     int            `json:"fish"`
+	Rooms    []RoomInfo     `json:"rooms"`
+	Clicks   ClickCounts    `json:"clicks"`
+	Pops     map[string]int `json:"pops"`
+	Visitors int            `json:"visitors"`
+}
+
+// Stats returns the fish count, the rooms' population, today's clicks,
+// all-time bubble pops and the number of unique visitors.
+func (r *Registry) Stats() Stats {
+	return Stats{
+		Fish:     r.GetFishCount(),
+		Rooms:    r.Rooms(),
+		Clicks:   r.clicks.Snapshot(),
+		Pops:     r.pops.Snapshot(),
+		Visitors: r.visitors.Count(),
+	}
+}
+
+// SetStore restores each room's floor layout from state, so tanks look the same
+// after a restart, and keeps click statistics there. Rooms seen for the first
+// time keep their random layout, which is saved for next time.
+func (r *Registry) SetStore(state store.Store) error {
+	if err := r.clicks.SetStore(state); err != nil {
+		log.Printf("Failed to load click statistics: %v", err)
+	}
+	if err := r.pops.SetStore(state); err != nil {
+		log.Printf("Failed to load pop counts: %v", err)
+	}
+	if err := r.visitors.SetStore(state); err != nil {
+		log.Printf("Failed to load visitors: %v", err)
+	}
+	if err := r.owners.SetStore(state); err != nil {
+		log.Printf("Failed to load users' fish: %v", err)
+	}
+	if err := r.history.SetStore(state); err != nil {
+		log.Printf("Failed to load session history: %v", err)
+	}
+	if err := r.settings.SetStore(state); err != nil {
+		log.Printf("Failed to load user settings: %v", err)
+	}
+	if err := r.guestbook.SetStore(state); err != nil {
+		log.Printf("Failed to load the guestbook: %v", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.store = state
+
+	seeds, err := state.LoadLayoutSeeds()
+	if errors.Is(err, os.ErrNotExist) {
+		seeds = make(map[string]int64)
+	} else if err != nil {
+		return err
+	}
+
+	changed := false
+	for _, name := range r.order {
+		if seed, ok := seeds[name]; ok {
+			r.rooms[name].SetLayoutSeed(seed)
+			continue
+		}
+		seeds[name] = r.rooms[name].LayoutSeed()
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+	return state.SaveLayoutSeeds(seeds)
+}
+
+// Snapshot captures every room, keyed by room name.
+func (r *Registry) Snapshot() map[string]Snapshot {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	snaps := make(map[string]Snapshot, len(r.rooms))
+	for name, room := range r.rooms {
+		snaps[name] = room.Snapshot()
+	}
+	return snaps
+}
+
+// Restore restores rooms from snapshots taken within maxAge. Snapshots of
+// rooms that no longer exist are ignored.
+func (r *Registry) Restore(snaps map[string]Snapshot, maxAge time.Duration) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for name, snap := range snaps {
+		room, ok := r.rooms[name]
+		if !ok || time.Since(snap.TakenAt) > maxAge {
+			continue
+		}
+		if err := room.Restore(snap); err != nil {
+			log.Printf("Failed to restore room %q: %v", name, err)
+		}
+	}
+}
+
+// SaveSnapshot stores a snapshot of every room in state so a restarted
+// process can pick up the tanks where this one left off.
+func (r *Registry) SaveSnapshot(state store.Store) error {
+	return state.Save(snapshotRecord, r.Snapshot())
+}
+
+// RestoreSnapshot restores the rooms saved by SaveSnapshot if they were saved
+// within maxAge.
+func (r *Registry) RestoreSnapshot(state store.Store, maxAge time.Duration) error {
+	var snaps map[string]Snapshot
+	if err := state.Load(snapshotRecord, &snaps); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	r.Restore(snaps, maxAge)
+	return nil
+}
+
+// Clicks returns the click statistics shared by all rooms.
+func (r *Registry) Clicks() *ClickStats {
+	return r.clicks
+}
+
+// Pops returns the bubble pop counts shared by all rooms.
+func (r *Registry) Pops() *PopStats {
+	return r.pops
+}
+
+// Visitors returns the unique visitors of all rooms.
+func (r *Registry) Visitors() *Visitors {
+	return r.visitors
+}
+
+// Owners returns the fish remembered for users with SSH keys.
+func (r *Registry) Owners() *Owners {
+	return r.owners
+}
+
+// History returns the sessions that ended most recently.
+func (r *Registry) History() *History {
+	return r.history
+}
+
+// Settings returns the users' remembered settings.
+func (r *Registry) Settings() *SettingsStore {
+	return r.settings
+}
+
+// Guestbook returns the messages visitors left.
+func (r *Registry) Guestbook() *Guestbook {
+	return r.guestbook
+}
+
+// Stop stops every room at once, so a room slow to finish its last frame
+// doesn't hold up the others.
+func (r *Registry) Stop() {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	r.supervisor.Stop()
+	var wg sync.WaitGroup
+	for _, name := range r.order {
+		log.Printf("Stopping room %q", name)
+		wg.Add(1)
+		go func(room *Manager) {
+			defer wg.Done()
+			room.Stop()
+		}(r.rooms[name])
+	}
+	wg.Wait()
+	r.Flush()
+}
+
+// Flush saves the statistics, visitors, users' fish and session history
+// that changed since they were last saved. Tanks are saved separately, with
+// SaveSnapshot.
+func (r *Registry) Flush() {
+	r.clicks.Save()
+	r.pops.Save()
+	r.visitors.Save()
+	r.owners.Save()
+	r.history.Save()
+}
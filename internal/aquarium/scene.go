@@ -0,0 +1,62 @@
+package aquarium
+
+import (
+	"sort"
+	"time"
+)
+
+// Scene is what a tank looks like at one moment, in pixels of the shared
+// terminal geometry, for drawing pictures of it outside a terminal.
+type Scene struct {
+	TakenAt    time.Time
+	Width      int // pixels, without the status row
+	Height     int
+	CellHeight int
+	Theme      Theme
+	Floor      Floor
+	Fish       []SceneFish // farthest first, in drawing order
+}
+
+// SceneFish is a fish in a Scene.
+type SceneFish struct {
+	X, Y          float64 // top left corner
+	Width, Height float64
+	Right         bool // facing right
+	Depth         float64
+}
+
+// Scene returns the tank as it is now. It reports false while nobody is
+// watching and the tank has no geometry.
+func (m *Manager) Scene() (Scene, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.termConfig == nil {
+		return Scene{}, false
+	}
+	scene := Scene{
+		TakenAt:    time.Now(),
+		Width:      m.termConfig.Columns * m.termConfig.CellWidth,
+		Height:     (m.termConfig.Rows - 1) * m.termConfig.CellHeight,
+		CellHeight: m.termConfig.CellHeight,
+		Theme:      m.theme,
+		Floor:      m.floor,
+	}
+	for _, fish := range m.fish {
+		if !fish.AwayUntil.IsZero() {
+			continue
+		}
+		scene.Fish = append(scene.Fish, SceneFish{
+			X:      fish.PosX,
+			Y:      fish.PosY + fish.bobbingOffset(),
+			Width:  fish.Width(),
+			Height: fish.Height(),
+			Right:  fish.VelX > 0,
+			Depth:  fish.Depth,
+		})
+	}
+	sort.Slice(scene.Fish, func(i, j int) bool {
+		return scene.Fish[i].Depth > scene.Fish[j].Depth
+	})
+	return scene, true
+}
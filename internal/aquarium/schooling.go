@@ -0,0 +1,160 @@
+package aquarium
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	// maxSchoolClimb is the largest share of its speed a schooling fish
+	// puts into swimming up or down, the sprites only face left and right.
+	maxSchoolClimb = 0.5
+	// schoolRecovery is the fraction of the difference to its cruising
+	// speed a schooling fish makes up per second.
+	schoolRecovery = 2.0
+)
+
+// Schooling weighs how fish of the same species swim together: separation
+// keeps them from crowding, alignment turns them the way their neighbors
+// swim and cohesion draws them to the middle of their school. Neighbors
+// are the fish within Radius pixels. All weights 0 turns schooling off.
+type Schooling struct {
+	Separation float64
+	Alignment  float64
+	Cohesion   float64
+	Radius     float64 // pixels between fish centers
+}
+
+// DefaultSchooling forms loose schools that still spread across the tank.
+var DefaultSchooling = Schooling{Separation: 1.5, Alignment: 2, Cohesion: 0.2, Radius: 200}
+
+// ParseSchooling parses schooling weights such as
+// "separation=1.5,alignment=2,cohesion=0.2,radius=200", or "off". Weights
+// left out keep their default.
+func ParseSchooling(spec string) (Schooling, error) {
+	s := DefaultSchooling
+	if strings.TrimSpace(spec) == "off" {
+		return Schooling{Radius: s.Radius}, nil
+	}
+	for _, part := range strings.Split(spec, ",") {
+		if part = strings.TrimSpace(part); part == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return Schooling{}, fmt.Errorf("expected name=value, got %q", part)
+		}
+		v, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil || v < 0 || math.IsInf(v, 0) {
+			return Schooling{}, fmt.Errorf("invalid %s %q", strings.TrimSpace(name), value)
+		}
+		switch strings.TrimSpace(name) {
+		case "separation":
+			s.Separation = v
+		case "alignment":
+			s.Alignment = v
+		case "cohesion":
+			s.Cohesion = v
+		case "radius":
+			s.Radius = v
+		default:
+			return Schooling{}, fmt.Errorf("unknown weight %q, expected separation, alignment, cohesion or radius", name)
+		}
+	}
+	return s, nil
+}
+
+func (s Schooling) off() bool {
+	return s.Separation == 0 && s.Alignment == 0 && s.Cohesion == 0 || s.Radius <= 0
+}
+
+// SetSchooling changes how fish swim together.
+func (m *Manager) SetSchooling(s Schooling) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.schooling = s
+}
+
+// SetSchooling changes how fish swim together in every room.
+func (r *Registry) SetSchooling(s Schooling) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, room := range r.rooms {
+		room.SetSchooling(s)
+	}
+}
+
+// updateSchooling turns fish towards their school. Fish keep the speed
+// they had when they first schooled, slowing down only to turn. Fry follow their parent instead, and
+// mirrored fish are steered by their own node. Callers must hold m.mu.
+func (m *Manager) updateSchooling(fishData []*Fish, deltaTime float64) {
+	s := m.schooling
+	if s.off() {
+		return
+	}
+	swimming := make([]*Fish, 0, len(fishData))
+	for _, fish := range fishData {
+		if fish.AwayUntil.IsZero() && fish.LeaveAt.IsZero() {
+			swimming = append(swimming, fish)
+		}
+	}
+
+	type steer struct{ x, y float64 }
+	steers := make([]steer, len(swimming))
+	for i, fish := range swimming {
+		if fish.ParentID != 0 || fish.Remote {
+			continue
+		}
+		cx, cy := fish.PosX+fish.Width()/2, fish.PosY+fish.Height()/2
+		speed := math.Hypot(fish.VelX, fish.VelY)
+
+		var n, sumX, sumY, velX, velY, sepX, sepY float64
+		for _, other := range swimming {
+			if other == fish || other.Species != fish.Species {
+				continue
+			}
+			dx := cx - (other.PosX + other.Width()/2)
+			dy := cy - (other.PosY + other.Height()/2)
+			d := math.Hypot(dx, dy)
+			if d >= s.Radius {
+				continue
+			}
+			n++
+			sumX, sumY = sumX+cx-dx, sumY+cy-dy
+			velX, velY = velX+other.VelX, velY+other.VelY
+			// Push away harder the closer they are, within half the radius
+			if d > 0 && d < s.Radius/2 {
+				push := (s.Radius/2 - d) / (s.Radius / 2)
+				sepX, sepY = sepX+dx/d*push*speed, sepY+dy/d*push*speed
+			}
+		}
+		if n == 0 {
+			continue
+		}
+		steers[i] = steer{
+			x: s.Separation*sepX + s.Alignment*(velX/n-fish.VelX) + s.Cohesion*(sumX/n-cx),
+			y: s.Separation*sepY + s.Alignment*(velY/n-fish.VelY) + s.Cohesion*(sumY/n-cy),
+		}
+	}
+
+	for i, fish := range swimming {
+		if steers[i] == (steer{}) {
+			continue
+		}
+		if fish.cruise == 0 {
+			fish.cruise = math.Hypot(fish.VelX, fish.VelY)
+		}
+		velX := fish.VelX + steers[i].x*deltaTime
+		velY := fish.VelY + steers[i].y*deltaTime
+		// Turning around slows a fish down, it picks up its speed again
+		// after
+		if v := math.Hypot(velX, velY); v > 0 {
+			speed := v + (fish.cruise-v)*math.Min(1, schoolRecovery*deltaTime)
+			velX, velY = velX/v*speed, velY/v*speed
+		}
+		climb := maxSchoolClimb * fish.cruise
+		fish.VelX, fish.VelY = velX, math.Max(-climb, math.Min(climb, velY))
+	}
+}
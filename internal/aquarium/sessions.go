@@ -0,0 +1,200 @@
+package aquarium
+
+import (
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode"
+)
+
+// ClientInfo describes who is behind a connection.
+type ClientInfo struct {
+	Username      string
+	Fingerprint   string // SHA256 fingerprint of the client's public key, empty for password logins
+	RemoteAddr    string
+	ClientVersion string         // SSH banner, e.g. SSH-2.0-OpenSSH_9.6
+	TermProgram   string         // TERM_PROGRAM sent by the client, e.g. WezTerm
+	ColorTerm     string         // COLORTERM sent by the client, e.g. truecolor
+	Term          string         // TERM from the client's pty request, e.g. xterm-256color
+	Lang          string         // LANG sent by the client, e.g. en_US.UTF-8
+	Mode          string         // ACQUA_MODE sent by the client, e.g. ModePhoto
+	Location      *time.Location // from TZ sent by the client, nil for the server's
+	Graphics      string         // protocol fish are drawn with, GraphicsKitty if empty
+	Caps          TerminalCaps   // what the terminal answered when probed
+	Hyperlinks    bool           // the terminal opens OSC 8 links
+	Settings      Settings
+	Transport     Transport
+	SessionBytes  *atomic.Uint64 // written to the client's terminal in any room, nil if not counted
+}
+
+// TerminalCaps is what a client's terminal answered when probed at the
+// start of the session. Terminals that didn't answer are only known by
+// what the client tells about itself.
+type TerminalCaps struct {
+	Probed     bool `json:"probed"`      // answered primary device attributes
+	Kitty      bool `json:"kitty"`       // accepted the Kitty graphics query
+	Sixel      bool `json:"sixel"`       // lists Sixel graphics in its device attributes
+	TrueColor  bool `json:"true_color"`  // XTGETTCAP knows RGB or Tc
+	SGRMouse   bool `json:"sgr_mouse"`   // knows mode 1006, SGR mouse reports
+	SyncOutput bool `json:"sync_output"` // knows mode 2026, synchronized updates
+}
+
+// Transport is what the SSH transport of a session negotiated.
+type Transport struct {
+	KeyExchange string `json:"key_exchange"`
+	HostKey     string `json:"host_key"`
+	Cipher      string `json:"cipher"` // for data sent to the client
+	MAC         string `json:"mac"`
+	Compression string `json:"compression"`
+}
+
+// SessionInfo is a snapshot of a connection for dashboards, commands and
+// metrics.
+type SessionInfo struct {
+	ID            uint64        `json:"id"`
+	Room          string        `json:"room,omitempty"`
+	Username      string        `json:"username"`
+	Fingerprint   string        `json:"fingerprint,omitempty"`
+	RemoteAddr    string        `json:"remote_addr"`
+	ClientVersion string        `json:"client_version"`
+	TermProgram   string        `json:"term_program,omitempty"`
+	Transport     Transport     `json:"transport"`
+	ConnectedAt   time.Time     `json:"connected_at"`
+	FramesSent    uint64        `json:"frames_sent"`
+	BytesSent     uint64        `json:"bytes_sent"`
+	SessionBytes  uint64        `json:"session_bytes"` // over the whole session, rooms and menus included
+	DroppedFrames uint64        `json:"dropped_frames"`
+	Latency       time.Duration `json:"latency_ns"`
+	FishIDs       []uint64      `json:"fish_ids"`
+}
+
+// Sessions returns information about every connection, ordered by ID.
+func (m *Manager) Sessions() []SessionInfo {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	sessions := make([]SessionInfo, 0, len(m.connections))
+	for _, conn := range m.connections {
+		sessions = append(sessions, conn.info())
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].ID < sessions[j].ID
+	})
+	return sessions
+}
+
+// Session returns information about a single connection.
+func (m *Manager) Session(connID uint64) (SessionInfo, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	conn, exists := m.connections[connID]
+	if !exists {
+		return SessionInfo{}, false
+	}
+	return conn.info(), true
+}
+
+// info snapshots the connection. Callers must hold the manager lock.
+func (c *Connection) info() SessionInfo {
+	var sessionBytes uint64
+	if c.Client.SessionBytes != nil {
+		sessionBytes = c.Client.SessionBytes.Load()
+	}
+	return SessionInfo{
+		ID:            c.ID,
+		Username:      c.Username,
+		Fingerprint:   c.Client.Fingerprint,
+		RemoteAddr:    c.Client.RemoteAddr,
+		ClientVersion: c.Client.ClientVersion,
+		TermProgram:   c.Client.TermProgram,
+		Transport:     c.Client.Transport,
+		ConnectedAt:   c.ConnectedAt,
+		FramesSent:    c.framesSent.Load(),
+		BytesSent:     c.bytesSent.Load(),
+		SessionBytes:  sessionBytes,
+		DroppedFrames: c.droppedFrames.Load(),
+		Latency:       c.Latency,
+		FishIDs:       append([]uint64(nil), c.FishIDs...),
+	}
+}
+
+// Sessions returns the sessions of all rooms.
+func (r *Registry) Sessions() []SessionInfo {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var sessions []SessionInfo
+	for _, name := range r.order {
+		for _, session := range r.rooms[name].Sessions() {
+			session.Room = name
+			sessions = append(sessions, session)
+		}
+	}
+	return sessions
+}
+
+// Watcher is someone watching the aquarium, as anyone may see them. Unlike
+// SessionInfo it leaves out where they connect from.
+type Watcher struct {
+	Name        string    `json:"name"`
+	Room        string    `json:"room"`
+	ConnectedAt time.Time `json:"connected_at"`
+}
+
+// Watchers returns who is watching each room, longest watching first.
+func (r *Registry) Watchers() []Watcher {
+	sessions := r.Sessions()
+	watchers := make([]Watcher, 0, len(sessions))
+	for _, session := range sessions {
+		watchers = append(watchers, Watcher{Name: session.Username, Room: session.Room, ConnectedAt: session.ConnectedAt})
+	}
+	sort.SliceStable(watchers, func(i, j int) bool {
+		return watchers[i].ConnectedAt.Before(watchers[j].ConnectedAt)
+	})
+	return watchers
+}
+
+// ClientSoftware returns the SSH client named in a version banner without
+// its version, e.g. "OpenSSH" for "SSH-2.0-OpenSSH_9.6p1 Ubuntu-3".
+func ClientSoftware(banner string) string {
+	software, _, _ := strings.Cut(strings.TrimPrefix(banner, "SSH-2.0-"), " ")
+	parts := strings.Split(software, "_")
+	for i, part := range parts {
+		if i > 0 && (part == "Release" || strings.IndexFunc(part, unicode.IsDigit) == 0) {
+			parts = parts[:i]
+			break
+		}
+	}
+	if software = strings.Join(parts, "_"); software == "" {
+		return "unknown"
+	}
+	return software
+}
+
+// ClientCount is how many sessions use an SSH client.
+type ClientCount struct {
+	Software string `json:"software"`
+	Sessions int    `json:"sessions"`
+}
+
+// ClientCounts counts the current sessions by SSH client, most used first.
+func (r *Registry) ClientCounts() []ClientCount {
+	counts := make(map[string]int)
+	for _, session := range r.Sessions() {
+		counts[ClientSoftware(session.ClientVersion)]++
+	}
+
+	list := make([]ClientCount, 0, len(counts))
+	for software, sessions := range counts {
+		list = append(list, ClientCount{Software: software, Sessions: sessions})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Sessions != list[j].Sessions {
+			return list[i].Sessions > list[j].Sessions
+		}
+		return list[i].Software < list[j].Software
+	})
+	return list
+}
@@ -0,0 +1,166 @@
+package aquarium
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/acuqa/ssh-aquarium/internal/store"
+)
+
+const maxFishName = 20
+
+// FishColors names the colors of owned fish, in the order of userColors.
+var FishColors = []string{"green", "cyan", "pink", "yellow", "purple", "orange", "blue", "lime"}
+
+// Settings are a user's preferences. They are remembered by SSH key
+// fingerprint, so they survive reconnects.
+type Settings store.Settings
+
+// SetFishName checks and sets the fish's name. An empty name goes back to
+// the SSH user name.
+func (s *Settings) SetFishName(name string) error {
+	name = strings.TrimSpace(sanitizeLabel(name))
+	if utf8.RuneCountInString(name) > maxFishName {
+		return fmt.Errorf("names can be at most %d characters", maxFishName)
+	}
+	s.FishName = name
+	return nil
+}
+
+// SetFishColor checks and sets the fish's color. An empty color goes back to
+// the one handed out on connecting.
+func (s *Settings) SetFishColor(color string) error {
+	if _, ok := userColor(color); !ok && color != "" {
+		return fmt.Errorf("unknown color %q, pick one of %s", color, strings.Join(FishColors, ", "))
+	}
+	s.FishColor = color
+	return nil
+}
+
+// SetTheme checks and sets the theme the user sees the water in. An empty
+// theme goes back to the room's.
+func (s *Settings) SetTheme(name string) error {
+	if _, ok := ThemeByName(name); !ok && name != "" {
+		names := make([]string, len(Themes))
+		for i, theme := range Themes {
+			names[i] = theme.Name
+		}
+		return fmt.Errorf("unknown theme %q, pick one of %s", name, strings.Join(names, ", "))
+	}
+	s.Theme = name
+	return nil
+}
+
+func userColor(name string) (string, bool) {
+	for i, color := range FishColors {
+		if color == name {
+			return userColors[i], true
+		}
+	}
+	return "", false
+}
+
+// SettingsStore keeps every user's settings, optionally in a state
+// directory.
+type SettingsStore struct {
+	mu      sync.Mutex
+	entries map[string]store.Settings // by SSH key fingerprint
+	store   store.Store
+}
+
+func NewSettingsStore() *SettingsStore {
+	return &SettingsStore{entries: make(map[string]store.Settings)}
+}
+
+// SetStore loads the settings from state and saves changes there.
+func (s *SettingsStore) SetStore(state store.Store) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.store = state
+	entries, err := state.LoadSettings()
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	s.entries = entries
+	return nil
+}
+
+// Get returns the settings of the user with the given key fingerprint.
+func (s *SettingsStore) Get(fingerprint string) Settings {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return Settings(s.entries[fingerprint])
+}
+
+// Set remembers the settings of the user with the given key fingerprint.
+// Users without a key can't be recognized and keep theirs for the session.
+func (s *SettingsStore) Set(fingerprint string, settings Settings) error {
+	if fingerprint == "" {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if settings == (Settings{}) {
+		delete(s.entries, fingerprint)
+	} else {
+		s.entries[fingerprint] = store.Settings(settings)
+	}
+	if s.store == nil {
+		return nil
+	}
+	return s.store.SaveSettings(s.entries)
+}
+
+// applySettings shows the connection's fish with its chosen name and color.
+// Callers must hold m.mu.
+func (m *Manager) applySettings(conn *Connection) {
+	conn.Username = conn.Client.Username
+	if conn.Client.Settings.FishName != "" {
+		conn.Username = conn.Client.Settings.FishName
+	}
+	if color, ok := userColor(conn.Client.Settings.FishColor); ok {
+		conn.Color = color
+	} else if conn.assignedColor != "" {
+		conn.Color = conn.assignedColor
+	}
+
+	for _, fishID := range conn.FishIDs {
+		if fish, ok := m.fish[fishID]; ok {
+			fish.Username = conn.Username
+			fish.Color = conn.Color
+		}
+	}
+}
+
+// SetSettings applies changed settings to a connection right away.
+func (m *Manager) SetSettings(connID uint64, settings Settings) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	conn, exists := m.connections[connID]
+	if !exists {
+		return
+	}
+	conn.Client.Settings = settings
+	m.applySettings(conn)
+
+	// Redraw the connection so labels and decoration it no longer wants
+	// disappear, and show the new name in the status row
+	conn.dirty.Store(true)
+	conn.lastRefresh = time.Time{}
+	if m.aquarium != nil {
+		m.aquarium.LastStatusUpdate = time.Time{}
+	}
+	m.notify()
+}
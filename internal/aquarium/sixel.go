@@ -0,0 +1,166 @@
+package aquarium
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"sync"
+)
+
+// sixelStep is the pixel grid fish are moved on with Sixel. Finer offsets
+// would redraw fish on every frame for movement nobody sees.
+const sixelStep = 4
+
+// SixelRenderer draws fish as Sixel images, for terminals without Kitty
+// graphics. The pixels go out with every fish drawn, nothing is uploaded.
+type SixelRenderer struct {
+	overlay
+}
+
+func NewSixelRenderer() *SixelRenderer {
+	r := &SixelRenderer{}
+	r.init(sixelStep, r.drawFish)
+	return r
+}
+
+func (r *SixelRenderer) Name() string { return GraphicsSixel }
+
+func (r *SixelRenderer) drawFish(out []byte, f overlayFish) []byte {
+	sixel := sixelImage(f, r.screen)
+	if sixel == nil {
+		return out
+	}
+	out = fmt.Appendf(out, "\x1b[%d;%dH", f.row, f.col)
+	return append(out, sixel...)
+}
+
+// sixelCacheSize bounds the encoded images kept. Every fish size, facing
+// and offset on the sixelStep grid is one.
+const sixelCacheSize = 1024
+
+// sixelKey is what an encoded image depends on.
+type sixelKey struct {
+	image         image.Image
+	width, height int
+	x, y          int
+	clipW, clipH  int
+}
+
+var (
+	sixelMu    sync.Mutex
+	sixelCache = make(map[sixelKey][]byte)
+)
+
+// sixelImage returns the Sixel image of a fish, encoded once for all
+// connections, or nil if its sprite isn't known.
+func sixelImage(f overlayFish, screen TerminalConfig) []byte {
+	sprite := SpriteImage(f.image)
+	if sprite == nil {
+		return nil
+	}
+	key := sixelKey{sprite, f.width, f.height, f.x, f.y, f.cols * screen.CellWidth, f.rows * screen.CellHeight}
+
+	sixelMu.Lock()
+	defer sixelMu.Unlock()
+	if sixel, ok := sixelCache[key]; ok {
+		return sixel
+	}
+	if len(sixelCache) >= sixelCacheSize {
+		clear(sixelCache)
+	}
+	sixel := encodeSixel(sprite, key)
+	sixelCache[key] = sixel
+	return sixel
+}
+
+// encodeSixel scales img to width by height pixels, moves it x and y
+// pixels right and down and encodes what fits in clipW by clipH pixels as a
+// Sixel image with a transparent background.
+func encodeSixel(img image.Image, key sixelKey) []byte {
+	w := min(key.x+key.width, key.clipW)
+	h := min(key.y+key.height, key.clipH)
+	if w <= 0 || h <= 0 {
+		return nil
+	}
+
+	// Colors are told apart less finely until they fit the 256 color
+	// registers, each gets the first of its pixels' colors
+	bounds := img.Bounds()
+	var pixels []int // color register per pixel, -1 for transparent
+	var palette [][3]uint32
+	for shift := uint(8); ; shift++ {
+		pixels = make([]int, w*h)
+		palette = palette[:0]
+		registers := make(map[[3]uint32]int)
+		for py := 0; py < h; py++ {
+			for px := 0; px < w; px++ {
+				pixels[py*w+px] = -1
+				sx, sy := px-key.x, py-key.y
+				if sx < 0 || sy < 0 {
+					continue
+				}
+				r, g, b, a := img.At(bounds.Min.X+sx*bounds.Dx()/key.width, bounds.Min.Y+sy*bounds.Dy()/key.height).RGBA()
+				if a < 0x8000 {
+					continue
+				}
+				n, ok := registers[[3]uint32{r >> shift, g >> shift, b >> shift}]
+				if !ok {
+					n = len(palette)
+					registers[[3]uint32{r >> shift, g >> shift, b >> shift}] = n
+					palette = append(palette, [3]uint32{r, g, b})
+				}
+				pixels[py*w+px] = n
+			}
+		}
+		if len(palette) <= 256 {
+			break
+		}
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "\x1bP0;1;0q\"1;1;%d;%d", w, h)
+	for n, c := range palette {
+		fmt.Fprintf(&out, "#%d;2;%d;%d;%d", n, c[0]*100/0xffff, c[1]*100/0xffff, c[2]*100/0xffff)
+	}
+	for band := 0; band < h; band += 6 {
+		for n := range palette {
+			line := make([]byte, w)
+			used := false
+			for px := 0; px < w; px++ {
+				bits := byte(0)
+				for dy := 0; dy < 6 && band+dy < h; dy++ {
+					if pixels[(band+dy)*w+px] == n {
+						bits |= 1 << dy
+					}
+				}
+				line[px] = '?' + bits
+				used = used || bits != 0
+			}
+			if !used {
+				continue
+			}
+			fmt.Fprintf(&out, "#%d", n)
+			writeSixelRuns(&out, bytes.TrimRight(line, "?"))
+			out.WriteByte('$')
+		}
+		out.WriteByte('-')
+	}
+	out.WriteString("\x1b\\")
+	return out.Bytes()
+}
+
+// writeSixelRuns writes sixel characters, repeats as runs.
+func writeSixelRuns(out *bytes.Buffer, line []byte) {
+	for i := 0; i < len(line); {
+		n := 1
+		for i+n < len(line) && line[i+n] == line[i] {
+			n++
+		}
+		if n > 3 {
+			fmt.Fprintf(out, "!%d%c", n, line[i])
+		} else {
+			out.Write(line[i : i+n])
+		}
+		i += n
+	}
+}
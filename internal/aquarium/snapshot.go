@@ -0,0 +1,259 @@
+package aquarium
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"time"
+)
+
+const (
+	// SnapshotVersion is bumped whenever Snapshot changes incompatibly.
+	SnapshotVersion = 1
+
+	// ParkedFishGrace is how long a restored fish waits for its owner to
+	// reconnect before it swims off.
+	ParkedFishGrace = 2 * time.Minute
+)
+
+// Snapshot is the full state of a tank, independent of terminal geometry,
+// for handing a live tank to another process.
+type Snapshot struct {
+	Version    int              `json:"version"`
+	TakenAt    time.Time        `json:"taken_at"`
+	StartTime  time.Time        `json:"start_time,omitempty"`
+	Founded    time.Time        `json:"founded,omitempty"`
+	Theme      string           `json:"theme"`
+	LayoutSeed int64            `json:"layout_seed"`
+	Fish       []FishSnapshot   `json:"fish"`
+	Pellets    []PelletSnapshot `json:"pellets,omitempty"`
+}
+
+// FishSnapshot is one fish in a Snapshot. Owned fish record who owns them
+// so the owner gets the fish back after reconnecting.
+type FishSnapshot struct {
+	FishState
+	Owner     string    `json:"owner,omitempty"`
+	Hunger    float64   `json:"hunger"`
+	Species   string    `json:"species"`
+	ParentID  uint64    `json:"parent_id,omitempty"`
+	NPC       bool      `json:"npc,omitempty"`
+	LeaveAt   time.Time `json:"leave_at,omitempty"`
+	AwayUntil time.Time `json:"away_until,omitempty"`
+	AwayEdge  int       `json:"away_edge,omitempty"`
+}
+
+// PelletSnapshot is a food pellet in a Snapshot.
+type PelletSnapshot struct {
+	X       float64   `json:"x"`
+	Y       float64   `json:"y"`
+	Dropped time.Time `json:"dropped"`
+}
+
+// ownerKey identifies a returning owner: by key fingerprint when available,
+// otherwise by username.
+func ownerKey(client ClientInfo) string {
+	if client.Fingerprint != "" {
+		return "key:" + client.Fingerprint
+	}
+	return "user:" + client.Username
+}
+
+// Snapshot captures the tank. Fish mirrored from cluster peers are left out,
+// their own node hands them over.
+func (m *Manager) Snapshot() Snapshot {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	snap := Snapshot{
+		Version:    SnapshotVersion,
+		TakenAt:    time.Now(),
+		Theme:      m.theme.Name,
+		LayoutSeed: m.layoutSeed,
+		Founded:    m.founded,
+	}
+	if m.aquarium != nil {
+		snap.StartTime = m.aquarium.StartTime
+	}
+	if m.termConfig == nil {
+		return snap
+	}
+
+	width := float64(m.termConfig.Columns * m.termConfig.CellWidth)
+	height := float64(m.termConfig.Rows * m.termConfig.CellHeight)
+
+	for _, fish := range m.fish {
+		if fish.Remote {
+			continue
+		}
+		fs := FishSnapshot{
+			FishState: FishState{
+				ID:       fish.ID,
+				X:        fish.PosX / width,
+				Y:        fish.PosY / height,
+				VelX:     fish.VelX / width,
+				VelY:     fish.VelY / height,
+				Username: fish.Username,
+				Color:    fish.Color,
+				Size:     fish.Size,
+				Depth:    fish.Depth,
+			},
+			Owner:     fish.ParkedFor,
+			Hunger:    fish.Hunger,
+			Species:   fish.Species,
+			ParentID:  fish.ParentID,
+			NPC:       fish.NPC,
+			LeaveAt:   fish.LeaveAt,
+			AwayUntil: fish.AwayUntil,
+			AwayEdge:  fish.AwayEdge,
+		}
+		if conn, ok := m.connections[fish.OwnerID]; ok {
+			fs.Owner = ownerKey(conn.Client)
+			fs.LeaveAt = time.Time{}
+		}
+		snap.Fish = append(snap.Fish, fs)
+	}
+
+	// Pellets age on the simulation clock, snapshots keep wall time
+	simNow := m.clock.at(snap.TakenAt)
+	for _, pellet := range m.pellets {
+		snap.Pellets = append(snap.Pellets, PelletSnapshot{
+			X:       pellet.X / width,
+			Y:       pellet.Y / height,
+			Dropped: snap.TakenAt.Add(pellet.Dropped.Sub(simNow)),
+		})
+	}
+	return snap
+}
+
+// Restore replaces the tank's look with the snapshot's and brings back its
+// fish and food. Owned fish are parked until their owner reconnects. When
+// nobody is watching yet, the fish are released once the first client
+// configured the tank.
+func (m *Manager) Restore(snap Snapshot) error {
+	if snap.Version != SnapshotVersion {
+		return fmt.Errorf("unsupported snapshot version %d", snap.Version)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if theme, ok := ThemeByName(snap.Theme); ok {
+		m.theme = theme
+	}
+	m.layoutSeed = snap.LayoutSeed
+	if !snap.Founded.IsZero() {
+		m.founded = snap.Founded
+	}
+	m.water = nil
+	m.repaint = true
+	if m.aquarium != nil && !snap.StartTime.IsZero() {
+		m.aquarium.StartTime = snap.StartTime
+	}
+	m.adoptLocked(snap)
+	return nil
+}
+
+// Adopt brings the snapshot's fish and food into the tank without changing
+// its look, e.g. when a cluster peer shuts down.
+func (m *Manager) Adopt(snap Snapshot) error {
+	if snap.Version != SnapshotVersion {
+		return fmt.Errorf("unsupported snapshot version %d", snap.Version)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.adoptLocked(snap)
+	return nil
+}
+
+// adoptLocked adds the snapshot's fish to the tank, or keeps them for later
+// without a terminal configuration. Callers must hold m.mu.
+func (m *Manager) adoptLocked(snap Snapshot) {
+	if m.termConfig == nil {
+		m.pending = append(m.pending, snap)
+		return
+	}
+
+	width := float64(m.termConfig.Columns * m.termConfig.CellWidth)
+	height := float64(m.termConfig.Rows * m.termConfig.CellHeight)
+	now := time.Now()
+
+	ids := make(map[uint64]uint64, len(snap.Fish))
+	restored := make([]*Fish, 0, len(snap.Fish))
+	for _, fs := range snap.Fish {
+		// Labels and colors are written straight to terminals, never trust them
+		color := userColors[0]
+		for _, c := range userColors {
+			if c == fs.Color {
+				color = c
+			}
+		}
+
+		fishID := m.fishCounter.Add(1)
+		fish := NewFish(fishID, 0, m.termConfig, sanitizeLabel(fs.Username), color)
+		fish.PosX = fs.X * width
+		fish.PosY = fs.Y * height
+		fish.VelX = fs.VelX * width
+		fish.VelY = fs.VelY * height
+		if fs.Size > 0 {
+			fish.Size = math.Min(fs.Size, MaxFishSize)
+		}
+		fish.Depth = clampDepth(fs.Depth)
+		fish.Hunger = math.Max(0, math.Min(1, fs.Hunger))
+		if fs.Species != "" {
+			fish.Species = fs.Species
+		}
+		fish.NPC = fs.NPC
+		fish.LeaveAt = fs.LeaveAt
+		fish.AwayUntil = fs.AwayUntil
+		fish.AwayEdge = fs.AwayEdge
+		fish.ParentID = fs.ParentID
+		if fs.Owner != "" {
+			fish.ParkedFor = fs.Owner
+			fish.LeaveAt = now.Add(ParkedFishGrace)
+		}
+
+		ids[fs.ID] = fishID
+		m.fish[fishID] = fish
+		restored = append(restored, fish)
+	}
+
+	// Fry keep following their parent under its new ID
+	for _, fish := range restored {
+		if fish.ParentID != 0 {
+			fish.ParentID = ids[fish.ParentID]
+		}
+	}
+
+	for _, ps := range snap.Pellets {
+		if len(m.pellets) >= MaxPellets {
+			break
+		}
+		dropped := m.clock.at(now).Add(ps.Dropped.Sub(now))
+		m.pellets = append(m.pellets, &Pellet{X: ps.X * width, Y: ps.Y * height, Dropped: dropped})
+	}
+
+	log.Printf("Restored %d fish and %d pellets from a snapshot taken %v ago",
+		len(restored), len(snap.Pellets), now.Sub(snap.TakenAt).Round(time.Second))
+	m.notify()
+}
+
+// reclaimParkedFish hands a restored fish back to its returning owner.
+// Callers must hold m.mu.
+func (m *Manager) reclaimParkedFish(conn *Connection) *Fish {
+	key := ownerKey(conn.Client)
+	for _, fish := range m.fish {
+		if fish.ParkedFor != key {
+			continue
+		}
+		fish.ParkedFor = ""
+		fish.LeaveAt = time.Time{}
+		fish.OwnerID = conn.ID
+		fish.Username = conn.Username
+		fish.Color = conn.Color
+		log.Printf("Connection %d reclaimed fish %d", conn.ID, fish.ID)
+		return fish
+	}
+	return nil
+}
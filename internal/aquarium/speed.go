@@ -0,0 +1,80 @@
+package aquarium
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limits for the simulation speed.
+const (
+	MinSpeed = 0.25
+	MaxSpeed = 4
+)
+
+// simClock is a tank's simulation time. It runs at the simulation speed, so
+// storms, food and fry growing up speed up and slow down with the fish.
+type simClock struct {
+	speed float64
+	wall  time.Time // wall time of the last speed change
+	sim   time.Time // simulation time at wall
+}
+
+func newSimClock() simClock {
+	now := time.Now()
+	return simClock{speed: 1, wall: now, sim: now}
+}
+
+// at returns the simulation time at wall time now.
+func (c simClock) at(now time.Time) time.Time {
+	return c.sim.Add(time.Duration(float64(now.Sub(c.wall)) * c.speed))
+}
+
+// ParseSpeed checks a simulation speed such as "2", "0.5" or "2x".
+func ParseSpeed(s string) (float64, error) {
+	speed, err := strconv.ParseFloat(strings.TrimSuffix(s, "x"), 64)
+	if err != nil || speed < MinSpeed || speed > MaxSpeed {
+		return 0, fmt.Errorf("speed must be between %gx and %gx", float64(MinSpeed), float64(MaxSpeed))
+	}
+	return speed, nil
+}
+
+// FormatSpeed shows a simulation speed, e.g. "0.25x".
+func FormatSpeed(speed float64) string {
+	return strconv.FormatFloat(speed, 'f', -1, 64) + "x"
+}
+
+// SetSpeed slows down or speeds up the tank's simulation.
+func (m *Manager) SetSpeed(speed float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	m.clock = simClock{speed: max(MinSpeed, min(speed, MaxSpeed)), wall: now, sim: m.clock.at(now)}
+	if m.aquarium != nil {
+		m.aquarium.LastStatusUpdate = time.Time{} // show the new speed right away
+	}
+	m.notify()
+}
+
+// Speed returns the tank's simulation speed, 1 for real time.
+func (m *Manager) Speed() float64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.clock.speed
+}
+
+// SetSpeed sets the simulation speed of every room.
+func (r *Registry) SetSpeed(speed float64) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, room := range r.rooms {
+		room.SetSpeed(speed)
+	}
+}
+
+// Speed returns the simulation speed of the default room.
+func (r *Registry) Speed() float64 {
+	return r.Room(r.DefaultName()).Speed()
+}
@@ -0,0 +1,62 @@
+package aquarium
+
+import (
+	"image"
+	"sync"
+	"sync/atomic"
+)
+
+// spriteGeneration counts sprite reloads. Every reload uploads the fish
+// images under fresh image IDs, so terminals never show a mix of old and
+// new art and deleting the old images can't take new placements with them.
+var spriteGeneration atomic.Int64
+
+// SpriteImageIDs returns the Kitty image IDs of the left- and right-facing
+// fish sprites.
+func SpriteImageIDs() (left, right int) {
+	return spriteImageIDs(spriteGeneration.Load())
+}
+
+// NextSpriteImageIDs returns the image IDs reloaded sprites are uploaded
+// under before AdvanceSprites moves fish to them.
+func NextSpriteImageIDs() (left, right int) {
+	return spriteImageIDs(spriteGeneration.Load() + 1)
+}
+
+// AdvanceSprites moves fish to the image IDs of NextSpriteImageIDs.
+func AdvanceSprites() {
+	spriteGeneration.Add(1)
+}
+
+// spriteFacesRight reports whether an image ID is a right-facing sprite.
+func spriteFacesRight(imageID int) bool {
+	return imageID%2 == 0
+}
+
+func spriteImageIDs(generation int64) (left, right int) {
+	base := int(generation%(1<<30)) * 2
+	return base + 1, base + 2
+}
+
+// spriteImages are the decoded fish images by image ID, for terminals that
+// are sent the pixels rather than an image to place.
+var spriteImages sync.Map // int -> image.Image
+
+// SetSpriteImage makes img the picture of imageID.
+func SetSpriteImage(imageID int, img image.Image) {
+	spriteImages.Store(imageID, img)
+}
+
+// SpriteImage returns the picture of imageID, or nil if it isn't known.
+func SpriteImage(imageID int) image.Image {
+	img, ok := spriteImages.Load(imageID)
+	if !ok {
+		return nil
+	}
+	return img.(image.Image)
+}
+
+// ForgetSpriteImage drops the picture of an image ID no fish uses anymore.
+func ForgetSpriteImage(imageID int) {
+	spriteImages.Delete(imageID)
+}
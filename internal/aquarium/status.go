@@ -0,0 +1,85 @@
+package aquarium
+
+import (
+	"fmt"
+	"sort"
+	"unicode/utf8"
+)
+
+// maxLabelName is how many characters of a name the status row shows.
+const maxLabelName = 12
+
+// statusLabel is a fish's name and fullness meter in the status row.
+type statusLabel struct {
+	name  string
+	meter string
+	color string
+	want  int // column that centers the label under its fish
+	col   int // column it was placed at
+}
+
+func (l statusLabel) width() int {
+	return utf8.RuneCountInString(l.name) + utf8.RuneCountInString(l.meter)
+}
+
+// newStatusLabel returns the label for a fish, centered under it.
+func newStatusLabel(fish *Fish, config *TerminalConfig) statusLabel {
+	name := fish.Username
+	if utf8.RuneCountInString(name) > maxLabelName {
+		name = string([]rune(name)[:maxLabelName])
+	}
+	center := int((fish.PosX+fish.Width()/2)/float64(config.CellWidth)) + 1
+	return statusLabel{
+		name:  name,
+		meter: fullnessMeter(fish.Hunger),
+		color: fish.Color,
+		want:  center - utf8.RuneCountInString(name)/2,
+	}
+}
+
+// pageLabels lays labels out between column 1 and limit without overlaps.
+// Each label goes as close to its fish as the labels left of it allow, and
+// labels that don't fit spill over to the next page.
+func pageLabels(labels []statusLabel, limit int) [][]statusLabel {
+	if limit < 1 {
+		return nil
+	}
+
+	remaining := make([]statusLabel, len(labels))
+	copy(remaining, labels)
+	sort.SliceStable(remaining, func(i, j int) bool {
+		if remaining[i].want != remaining[j].want {
+			return remaining[i].want < remaining[j].want
+		}
+		return remaining[i].name < remaining[j].name
+	})
+
+	var pages [][]statusLabel
+	for len(remaining) > 0 {
+		var page, rest []statusLabel
+		next := 1
+		for _, label := range remaining {
+			// Names too long for the whole row are cut down to fit
+			if label.width() > limit {
+				keep := max(0, limit-utf8.RuneCountInString(label.meter))
+				label.name = string([]rune(label.name)[:keep])
+			}
+			col := max(next, min(label.want, limit-label.width()+1))
+			if col+label.width()-1 > limit {
+				rest = append(rest, label)
+				continue
+			}
+			label.col = col
+			page = append(page, label)
+			next = col + label.width() + 1
+		}
+		pages = append(pages, page)
+		remaining = rest
+	}
+	return pages
+}
+
+// moreHint tells how many names are on other pages.
+func moreHint(hidden int) string {
+	return fmt.Sprintf("+%d more  ", hidden)
+}
@@ -0,0 +1,96 @@
+package aquarium
+
+import (
+	"log"
+	"math/rand"
+	"time"
+)
+
+const (
+	StormDuration        = time.Minute
+	DefaultStormInterval = 3 * time.Hour // average time between storms in a room
+
+	stormCurrent  = 6.0  // extra peak current in cells per second
+	stormBubbles  = 8.0  // bubble rate multiplier
+	stormBobbing  = 3.0  // bobbing amplitude multiplier
+	stormDarkness = 0.45 // fraction of the water's brightness left
+)
+
+// SetStormInterval sets the average time between storms, 0 disables them.
+func (m *Manager) SetStormInterval(interval time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.stormInterval = interval
+}
+
+// SetStorm starts or ends a storm right away, e.g. on an admin's request.
+func (m *Manager) SetStorm(on bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	if on {
+		m.startStormLocked(now)
+	} else if m.storming(now) {
+		m.stormUntil = m.clock.at(now)
+	}
+	m.notify()
+}
+
+// Storming reports whether a storm is raging in the room.
+func (m *Manager) Storming() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.storming(time.Now())
+}
+
+// storming reports whether a storm is raging at now. Storms run on the
+// simulation clock. Callers must hold m.mu.
+func (m *Manager) storming(now time.Time) bool {
+	return m.clock.at(now).Before(m.stormUntil)
+}
+
+// startStormLocked starts a storm or makes a raging one last longer.
+// Callers must hold m.mu.
+func (m *Manager) startStormLocked(now time.Time) {
+	if !m.storming(now) {
+		log.Printf("Storm rolling in")
+		m.announceLocked("a storm is rolling in", now)
+		m.emitLocked(Event{Name: EventStorm}, now)
+	}
+	m.stormUntil = m.clock.at(now).Add(StormDuration)
+}
+
+// updateWeather starts storms at random and announces when they pass. It
+// returns how stirred up the water is, from 0 for calm to 1 for a storm.
+// Callers must hold m.mu.
+func (m *Manager) updateWeather(now time.Time, deltaTime float64) float64 {
+	if !m.stormUntil.IsZero() && !m.storming(now) {
+		log.Printf("Storm passed")
+		m.stormUntil = time.Time{}
+		m.announceLocked("the storm has passed", now)
+	}
+	if m.stormUntil.IsZero() && m.stormInterval > 0 && rand.Float64() < deltaTime/m.stormInterval.Seconds() {
+		m.startStormLocked(now)
+	}
+	if m.storming(now) {
+		return 1
+	}
+	return 0
+}
+
+// stormy returns the policy with the storm's current added.
+func (p PopulationPolicy) stormy() PopulationPolicy {
+	p.Current += stormCurrent
+	return p
+}
+
+// stormy returns a darker version of the theme without light shafts.
+func (t Theme) stormy() Theme {
+	for c := range t.Surface {
+		t.Surface[c] = uint8(float64(t.Surface[c]) * stormDarkness)
+		t.Depth[c] = uint8(float64(t.Depth[c]) * stormDarkness)
+	}
+	t.LightShafts = false
+	return t
+}
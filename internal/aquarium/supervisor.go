@@ -0,0 +1,112 @@
+package aquarium
+
+import (
+	"log"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// superviseInterval is how often the room supervisor looks at how much
+	// time each room spends rendering.
+	superviseInterval = time.Second
+
+	// renderShare is the part of the CPUs all rooms together may take
+	// before the busiest ones are slowed down. The rest is left for SSH
+	// encryption and everything else.
+	renderShare = 0.5
+
+	// maxSlowdown is how far a room can be slowed down, 30 FPS becoming
+	// 7.5 FPS.
+	maxSlowdown = 4
+)
+
+// roomLoop is what the room supervisor knows about a room's animation loop.
+type roomLoop struct {
+	busy     atomic.Int64 // nanoseconds spent on frames since the supervisor last looked
+	slowdown atomic.Int32 // the loop ticks this many times slower, 0 or 1 for full speed
+}
+
+// took records the time a frame took.
+func (l *roomLoop) took(d time.Duration) {
+	l.busy.Add(int64(d))
+}
+
+// interval returns the time between frames for a loop normally ticking
+// every base.
+func (l *roomLoop) interval(base time.Duration) time.Duration {
+	return base * time.Duration(max(1, l.slowdown.Load()))
+}
+
+// supervisor shares the CPUs between the rooms. Every room renders on its
+// own animation loop, which only runs while someone watches. When the loops
+// together take more than their share, the rooms taking more than an equal
+// part are slowed down, so one huge room can't starve the others.
+type supervisor struct {
+	rooms map[string]*Manager
+	stop  chan struct{}
+	wg    sync.WaitGroup
+}
+
+func newSupervisor(rooms map[string]*Manager) *supervisor {
+	s := &supervisor{rooms: rooms, stop: make(chan struct{})}
+	s.wg.Add(1)
+	go s.run()
+	return s
+}
+
+func (s *supervisor) run() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(superviseInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.balance(superviseInterval * time.Duration(runtime.GOMAXPROCS(0)))
+		}
+	}
+}
+
+// balance slows down rooms taking more than their part of capacity, the
+// CPU time available since the last call, and speeds them up again once
+// there is time to spare.
+func (s *supervisor) balance(capacity time.Duration) {
+	busy := make(map[string]time.Duration, len(s.rooms))
+	var total time.Duration
+	for name, room := range s.rooms {
+		if d := time.Duration(room.loop.busy.Swap(0)); d > 0 {
+			busy[name] = d
+			total += d
+		}
+	}
+
+	budget := time.Duration(float64(capacity) * renderShare)
+	for name, room := range s.rooms {
+		slowdown := max(1, room.loop.slowdown.Load())
+		switch {
+		case total > budget && len(busy) > 1 && busy[name] > budget/time.Duration(len(busy)):
+			if slowdown < maxSlowdown {
+				room.loop.slowdown.Store(slowdown * 2)
+				log.Printf("Room %q took %v of %v rendering, slowing it down %dx", name, busy[name].Round(time.Millisecond), budget, slowdown*2)
+			}
+		case total < budget/2 && slowdown > 1:
+			// Speed up in steps, so a room doesn't bounce between the two
+			room.loop.slowdown.Store(slowdown / 2)
+			if slowdown/2 == 1 {
+				log.Printf("Room %q back to full speed", name)
+			} else {
+				log.Printf("Room %q slowed down %dx", name, slowdown/2)
+			}
+		}
+	}
+}
+
+func (s *supervisor) Stop() {
+	close(s.stop)
+	s.wg.Wait()
+}
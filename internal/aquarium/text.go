@@ -0,0 +1,66 @@
+package aquarium
+
+import (
+	"fmt"
+	"strings"
+)
+
+// textFish are fish drawn with characters, facing right, from the smallest.
+// The largest that fits the fish's width is used.
+var textFish = []string{"><>", "><'>", "><('>", "><(('>", "><((('>", "><(((('>"}
+
+// mirrored turns the characters of right-facing fish around.
+var mirrored = strings.NewReplacer("<", ">", ">", "<", "(", ")", ")", "(")
+
+// TextRenderer draws fish with characters, like asciiquarium, for terminals
+// that show no images at all. Everyone sees something, if only a sketch.
+type TextRenderer struct {
+	overlay
+}
+
+func NewTextRenderer() *TextRenderer {
+	r := &TextRenderer{}
+	r.init(0, r.drawFish)
+	return r
+}
+
+func (r *TextRenderer) Name() string { return GraphicsText }
+
+// drawFish writes the fish over the middle row of its cells, in the colors
+// of the water behind it.
+func (r *TextRenderer) drawFish(out []byte, f overlayFish) []byte {
+	art := textFish[0]
+	for _, fish := range textFish {
+		if len(fish) <= f.cols {
+			art = fish
+		}
+	}
+	if len(art) > f.cols {
+		return out
+	}
+	if !spriteFacesRight(f.image) {
+		art = reverse(mirrored.Replace(art))
+	}
+
+	row := f.row + (f.rows-1)/2
+	col := f.col + (f.cols-len(art))/2
+	color := userColors[int(f.placement)%len(userColors)]
+	out = fmt.Appendf(out, "\x1b[%d;%dH", row, col)
+	for i := 0; i < len(art); i++ {
+		out = append(out, "\x1b[0m"...)
+		if shadow := r.cell(row, col+i); shadow != nil {
+			out = append(out, shadow.sgr...)
+		}
+		out = append(out, color...)
+		out = append(out, art[i])
+	}
+	return append(out, "\x1b[0m"...)
+}
+
+func reverse(s string) string {
+	b := []byte(s)
+	for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+		b[i], b[j] = b[j], b[i]
+	}
+	return string(b)
+}
@@ -0,0 +1,227 @@
+package aquarium
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+const (
+	shaftInterval = 500 * time.Millisecond // how often light shafts move
+	shaftAlpha    = 0.18                   // light blended into the water at the surface
+)
+
+var shaftLight = [3]float64{255, 250, 215}
+
+// Theme controls how the tank itself is drawn.
+type Theme struct {
+	Name        string
+	Water       bool     // fill the tank with a vertical gradient
+	Surface     [3]uint8 // RGB near the surface
+	Depth       [3]uint8 // RGB at the bottom of the tank
+	LightShafts bool     // slowly drifting god rays from the surface
+}
+
+var Themes = []Theme{
+	{Name: "ocean", Water: true, Surface: [3]uint8{38, 102, 150}, Depth: [3]uint8{4, 18, 42}, LightShafts: true},
+	{Name: "lagoon", Water: true, Surface: [3]uint8{56, 160, 160}, Depth: [3]uint8{8, 48, 58}, LightShafts: true},
+	{Name: "abyss", Water: true, Surface: [3]uint8{18, 36, 72}, Depth: [3]uint8{0, 0, 8}},
+	{Name: "none"}, // Use the terminal's own background
+}
+
+// ThemeByName looks up a built-in theme.
+func ThemeByName(name string) (Theme, bool) {
+	for _, theme := range Themes {
+		if theme.Name == name {
+			return theme, true
+		}
+	}
+	return Theme{}, false
+}
+
+// Water is the tank background: a depth gradient optionally crossed by
+// light shafts. It is only touched by the animation loop.
+type Water struct {
+	theme      Theme
+	columns    int
+	rows       int
+	depth      int                // rows of water above the floor
+	floor      *floorLayout       // drawn below the water
+	coral      map[cell]floorTile // growing up from the floor
+	coralStage int
+	base       []string // background SGR per row
+	lit        []string // background SGR per row inside a light shaft
+	shafts     []lightShaft
+	lastDrift  time.Time
+}
+
+type lightShaft struct {
+	X     float64 // column at the surface
+	Width int
+	Slant float64 // columns per row
+	Speed float64 // columns per second
+}
+
+func newWater(theme Theme, floor Floor, columns, rows int, seed int64, coralStage int, now time.Time) *Water {
+	w := &Water{
+		theme:      theme,
+		columns:    columns,
+		rows:       rows,
+		depth:      max(0, rows-floor.Rows()),
+		coralStage: coralStage,
+		lastDrift:  now,
+	}
+	if columns > 0 {
+		w.floor = newFloorLayout(floor, columns, seed)
+	}
+	w.coral = layoutCoral(columns, w.depth, coralStage, seed)
+	rows = w.depth
+	if !theme.Water || rows <= 0 || columns <= 0 {
+		return w
+	}
+
+	w.base, w.lit = gradient(theme, rows)
+
+	if theme.LightShafts {
+		count := max(1, columns/25)
+		for i := 0; i < count; i++ {
+			w.shafts = append(w.shafts, lightShaft{
+				X:     float64(columns) * (float64(i) + rand.Float64()*0.5) / float64(count),
+				Width: 2 + rand.Intn(3),
+				Slant: 0.3 + rand.Float64()*0.4,
+				Speed: 0.3 + rand.Float64()*0.5,
+			})
+		}
+	}
+	return w
+}
+
+// gradient returns the background SGR sequences of each row of water, plain
+// and inside a light shaft.
+func gradient(theme Theme, rows int) (base, lit []string) {
+	base = make([]string, rows)
+	lit = make([]string, rows)
+	for i := 0; i < rows; i++ {
+		frac := 0.0
+		if rows > 1 {
+			frac = float64(i) / float64(rows-1)
+		}
+		var b, l [3]float64
+		for c := range b {
+			b[c] = float64(theme.Surface[c]) + (float64(theme.Depth[c])-float64(theme.Surface[c]))*frac
+			// Shafts fade out towards the bottom
+			alpha := shaftAlpha * (1 - frac)
+			l[c] = b[c] + (shaftLight[c]-b[c])*alpha
+		}
+		base[i] = fmt.Sprintf("\x1b[48;2;%d;%d;%dm", int(b[0]), int(b[1]), int(b[2]))
+		lit[i] = fmt.Sprintf("\x1b[48;2;%d;%d;%dm", int(l[0]), int(l[1]), int(l[2]))
+	}
+	return base, lit
+}
+
+// recolor returns a replacer that paints frames of this water as if it had
+// theme, for viewers who picked their own. Shafts stay where the room's
+// are, and disappear if theme has none. It is nil if nothing changes, also
+// when the room has no water to recolor.
+func (w *Water) recolor(theme Theme) *strings.Replacer {
+	if theme.Name == w.theme.Name || !w.theme.Water || len(w.base) == 0 {
+		return nil
+	}
+	base, lit := gradient(theme, len(w.base))
+	pairs := make([]string, 0, 4*len(w.base))
+	for i := range w.base {
+		to, toLit := base[i], lit[i]
+		if !theme.LightShafts {
+			toLit = to
+		}
+		if !theme.Water {
+			to, toLit = "\x1b[49m", "\x1b[49m"
+		}
+		pairs = append(pairs, w.base[i], to, w.lit[i], toLit)
+	}
+	return strings.NewReplacer(pairs...)
+}
+
+// recolor returns the replacer painting water in the connection's own theme,
+// nil if it sees the room's. Callers must hold m.mu.
+func (c *Connection) recolor(water *Water) *strings.Replacer {
+	name := c.Client.Settings.Theme
+	if water != c.recolorWater || name != c.recolorTheme {
+		c.recolorer = nil
+		if theme, ok := ThemeByName(name); ok {
+			c.recolorer = water.recolor(theme)
+		}
+		c.recolorWater, c.recolorTheme = water, name
+	}
+	return c.recolorer
+}
+
+// Background returns the SGR background sequence for a cell, or "" when the
+// cell uses the terminal's default background.
+func (w *Water) Background(row, col int) string {
+	if row > w.depth && row <= w.rows && w.floor != nil && row-w.depth <= len(w.floor.background) {
+		return w.floor.background[row-w.depth-1]
+	}
+	if row < 1 || row > len(w.base) {
+		return ""
+	}
+	if w.inShaft(w.shafts, row, col) {
+		return w.lit[row-1]
+	}
+	return w.base[row-1]
+}
+
+// Glyph returns what an empty cell shows: a floor tile, coral or a blank.
+func (w *Water) Glyph(row, col int) string {
+	tile := w.tile(row, col)
+	return tile.fg + tile.glyph
+}
+
+func (w *Water) tile(row, col int) floorTile {
+	if row > w.depth && row <= w.rows && w.floor != nil && row-w.depth <= len(w.floor.cells) && col >= 1 && col <= w.columns {
+		return w.floor.cells[row-w.depth-1][col-1]
+	}
+	if tile, ok := w.coral[cell{Row: row, Col: col}]; ok {
+		return tile
+	}
+	return floorTile{glyph: " "}
+}
+
+func (w *Water) inShaft(shafts []lightShaft, row, col int) bool {
+	for _, shaft := range shafts {
+		start := int(shaft.X + shaft.Slant*float64(row-1))
+		if col-1 >= start && col-1 < start+shaft.Width {
+			return true
+		}
+	}
+	return false
+}
+
+// drift moves the light shafts at a low rate and repaints only the cells
+// whose lighting changed.
+func (w *Water) drift(now time.Time, buf *UpdateBuffer) {
+	if len(w.shafts) == 0 || now.Sub(w.lastDrift) < shaftInterval {
+		return
+	}
+	elapsed := now.Sub(w.lastDrift).Seconds()
+	w.lastDrift = now
+
+	previous := append([]lightShaft(nil), w.shafts...)
+	for i := range w.shafts {
+		shaft := &w.shafts[i]
+		shaft.X += shaft.Speed * elapsed
+		// Re-enter from the left once the shaft has fully left the tank
+		if shaft.X > float64(w.columns) {
+			shaft.X -= float64(w.columns) + shaft.Slant*float64(w.depth) + float64(shaft.Width)
+		}
+	}
+
+	for row := 1; row <= w.depth; row++ {
+		for col := 1; col <= w.columns; col++ {
+			if w.inShaft(previous, row, col) != w.inShaft(w.shafts, row, col) {
+				buf.AddClearCell(row, col)
+			}
+		}
+	}
+}
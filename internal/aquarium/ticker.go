@@ -0,0 +1,38 @@
+package aquarium
+
+import "time"
+
+// TickerDuration is how long an announcement stays in the status bar.
+const TickerDuration = 10 * time.Second
+
+// tickerMessage is an announcement shown in the status bar.
+type tickerMessage struct {
+	text  string
+	until time.Time
+}
+
+// Announce shows text in the status bar of everyone in the room for a
+// while.
+func (m *Manager) Announce(text string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.announceLocked(text, time.Now())
+}
+
+// announceLocked queues an announcement. Callers must hold m.mu.
+func (m *Manager) announceLocked(text string, now time.Time) {
+	m.ticker = tickerMessage{text: sanitizeLabel(text), until: now.Add(TickerDuration)}
+	if m.aquarium != nil {
+		m.aquarium.LastStatusUpdate = time.Time{} // show it right away
+	}
+	m.notify()
+}
+
+// tickerText returns the current announcement, if any. Callers must hold
+// m.mu.
+func (m *Manager) tickerText(now time.Time) string {
+	if now.After(m.ticker.until) {
+		return ""
+	}
+	return m.ticker.text
+}
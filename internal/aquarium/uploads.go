@@ -0,0 +1,128 @@
+package aquarium
+
+import (
+	"bytes"
+	"sync"
+)
+
+// uploadSlice is how much of a queued upload goes out after each frame,
+// about 500 KB/s at 30 FPS. Frames come first, so a large upload never
+// holds up the animation for more than a slice.
+const uploadSlice = 16 * 1024
+
+// minUploadSlice is the least worth sending under a bandwidth cap, a Kitty
+// graphics chunk with its header. Queued data waits for budget rather than
+// arriving in pieces too small to be useful.
+const minUploadSlice = 4096 + 64
+
+// pendingUpload is data queued for a connection, such as reloaded sprites.
+type pendingUpload struct {
+	data []byte
+	sent *sync.WaitGroup // done once data went out or the connection left
+}
+
+// Upload queues data, made of complete escape sequences such as Kitty
+// graphics uploads, for every connection in every room. It is sent in
+// slices after the frames, so the animation keeps going while large images
+// trickle out. The returned channel is closed once everyone got it or left.
+func (r *Registry) Upload(data []byte) <-chan struct{} {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var sent sync.WaitGroup
+	for _, room := range r.rooms {
+		room.queueUpload(data, &sent)
+	}
+	done := make(chan struct{})
+	go func() {
+		sent.Wait()
+		close(done)
+	}()
+	return done
+}
+
+// queueUpload queues data for every connection in the room and wakes the
+// animation loop to send it.
+func (m *Manager) queueUpload(data []byte, sent *sync.WaitGroup) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, conn := range m.connections {
+		sent.Add(1)
+		conn.uploadMu.Lock()
+		conn.uploads = append(conn.uploads, pendingUpload{data, sent})
+		conn.uploadMu.Unlock()
+	}
+	m.notify()
+}
+
+// uploading reports whether the connection has queued data left.
+func (c *Connection) uploading() bool {
+	c.uploadMu.Lock()
+	defer c.uploadMu.Unlock()
+	return len(c.uploads) > 0
+}
+
+// nextUpload takes up to limit bytes of queued data, cut after the last
+// escape sequence that fits. A single sequence longer than limit is taken
+// whole.
+func (c *Connection) nextUpload(limit int) []byte {
+	c.uploadMu.Lock()
+	defer c.uploadMu.Unlock()
+
+	var out []byte
+	for len(c.uploads) > 0 {
+		upload := &c.uploads[0]
+		n := len(upload.data)
+		if len(out)+n > limit {
+			n = bytes.LastIndex(upload.data[:max(limit-len(out), 0)], []byte("\x1b\\")) + 2
+			if n < 2 {
+				if len(out) > 0 {
+					break
+				}
+				n = bytes.Index(upload.data, []byte("\x1b\\")) + 2
+				if n < 2 {
+					n = len(upload.data)
+				}
+			}
+		}
+		out = append(out, upload.data[:n]...)
+		upload.data = upload.data[n:]
+		if len(upload.data) > 0 {
+			break
+		}
+		upload.sent.Done()
+		c.uploads = c.uploads[1:]
+	}
+	return out
+}
+
+// dropUploads gives up on the queued data of a connection that left.
+func (c *Connection) dropUploads() {
+	c.uploadMu.Lock()
+	defer c.uploadMu.Unlock()
+	for _, upload := range c.uploads {
+		upload.sent.Done()
+	}
+	c.uploads = nil
+}
+
+// sendUpload queues the next slice of queued data after a frame, within
+// what is left of the connection's bandwidth budget and of its outbox.
+func (m *Manager) sendUpload(conn *Connection, connCap int) {
+	limit := uploadSlice
+	if connCap > 0 {
+		limit = min(limit, int(conn.budget))
+	}
+	if limit < minUploadSlice || conn.outboxFree() == 0 {
+		return
+	}
+	data := conn.nextUpload(limit)
+	if len(data) == 0 {
+		return
+	}
+	if connCap > 0 {
+		conn.budget -= float64(len(data))
+	}
+	conn.send(data, false)
+}
@@ -0,0 +1,145 @@
+package aquarium
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+)
+
+// Viewport confines a connection to a band of columns of its terminal, e.g.
+// one side of a split screen. Cursor positions are shifted into the band,
+// text and fish that would spill over its edge are cut, and Kitty image IDs
+// are shifted by ImageOffset so two tanks sharing a terminal never move or
+// delete each other's fish.
+type Viewport struct {
+	Col         int // first column of the band, from 1
+	Columns     int // width of the band
+	ImageOffset int // added to every image ID
+}
+
+// Apply rewrites terminal output written for a whole terminal into the
+// viewport. Output is expected to position the cursor before drawing, as
+// frames do.
+func (v *Viewport) Apply(data []byte) []byte {
+	out := make([]byte, 0, len(data))
+	row, col := 1, 1 // cursor, col relative to the viewport
+	for len(data) > 0 {
+		t := nextToken(data)
+		data = data[len(t.raw):]
+		switch t.kind {
+		case tokenCSI:
+			params := string(t.body)
+			switch t.final {
+			case 'H', 'f':
+				row, col = 1, 1
+				if r, c, ok := bytes.Cut(t.body, []byte{';'}); ok {
+					row, col = atoiOr(string(r), 1), atoiOr(string(c), 1)
+				} else if len(params) > 0 {
+					row = atoiOr(params, 1)
+				}
+				out = fmt.Appendf(out, "\x1b[%d;%dH", row, col+v.Col-1)
+			case 'K':
+				out = v.eraseInLine(out, row, col, atoiOr(params, 0))
+			case 'J':
+				// Clearing the screen would wipe the other tanks sharing it
+			default:
+				out = append(out, t.raw...)
+			}
+
+		case tokenAPC:
+			out = v.graphics(out, t.body, col)
+
+		case tokenControl:
+			if t.raw[0] == '\r' {
+				col = 1
+			}
+			out = append(out, t.raw...)
+
+		case tokenText:
+			if col >= 1 && col <= v.Columns {
+				out = append(out, t.raw...)
+			}
+			col++
+
+		default:
+			out = append(out, t.raw...)
+		}
+	}
+	return out
+}
+
+// eraseInLine erases the part of the row an EL sequence asks for, but only
+// within the viewport, and leaves the cursor where it was.
+func (v *Viewport) eraseInLine(out []byte, row, col, mode int) []byte {
+	from, to := col, v.Columns
+	switch mode {
+	case 1:
+		from, to = 1, col
+	case 2:
+		from = 1
+	}
+	from, to = max(from, 1), min(to, v.Columns)
+	if from > to {
+		return out
+	}
+	return fmt.Appendf(out, "\x1b[%d;%dH\x1b[%dX\x1b[%d;%dH", row, from+v.Col-1, to-from+1, row, col+v.Col-1)
+}
+
+// graphics rewrites a Kitty graphics command for the viewport: image IDs
+// are shifted, placements that don't fit are deleted instead, and deleting
+// everything only deletes the fish drawn in this viewport.
+func (v *Viewport) graphics(out, command []byte, col int) []byte {
+	if len(command) == 0 || command[0] != 'G' {
+		return append(append(append(out, "\x1b_"...), command...), "\x1b\\"...)
+	}
+	control, payload, hasPayload := bytes.Cut(command[1:], []byte{';'})
+
+	keys := bytes.Split(control, []byte{','})
+	value := func(key string) string {
+		for _, kv := range keys {
+			if k, val, ok := bytes.Cut(kv, []byte{'='}); ok && string(k) == key {
+				return string(val)
+			}
+		}
+		return ""
+	}
+
+	action := value("a")
+	switch {
+	case action == "p" && (col < 1 || col+atoiOr(value("c"), 1)-1 > v.Columns):
+		// Out of view, take the fish off screen until it swims back in
+		return fmt.Appendf(out, "\x1b_Ga=d,d=i,i=%d,p=%s,q=1\x1b\\", atoiOr(value("i"), 0)+v.ImageOffset, value("p"))
+	case action == "d" && (value("d") == "a" || value("d") == "A"):
+		what := "i"
+		if value("d") == "A" {
+			what = "I"
+		}
+		left, right := SpriteImageIDs()
+		return fmt.Appendf(out, "\x1b_Ga=d,d=%s,i=%d,q=1\x1b\\\x1b_Ga=d,d=%s,i=%d,q=1\x1b\\",
+			what, left+v.ImageOffset, what, right+v.ImageOffset)
+	}
+
+	out = append(out, "\x1b_G"...)
+	for n, kv := range keys {
+		if n > 0 {
+			out = append(out, ',')
+		}
+		if k, val, ok := bytes.Cut(kv, []byte{'='}); ok && string(k) == "i" {
+			out = fmt.Appendf(out, "i=%d", atoiOr(string(val), 0)+v.ImageOffset)
+			continue
+		}
+		out = append(out, kv...)
+	}
+	if hasPayload {
+		out = append(append(out, ';'), payload...)
+	}
+	return append(out, "\x1b\\"...)
+}
+
+func atoiOr(s string, fallback int) int {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return fallback
+	}
+	return n
+}
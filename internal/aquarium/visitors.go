@@ -0,0 +1,233 @@
+package aquarium
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/acuqa/ssh-aquarium/internal/store"
+)
+
+const (
+	visitorSaveInterval = 30 * time.Second
+
+	// confettiPieces is how many bits of confetti rise per 10 columns of
+	// water.
+	confettiPieces = 4
+)
+
+// confettiGlyphs are the bubbles and bits a celebration sends up.
+var confettiGlyphs = []string{
+	"\x1b[38;5;196mo", "\x1b[38;5;226m°", "\x1b[38;5;46m*", "\x1b[38;5;51mo",
+	"\x1b[38;5;201m•", "\x1b[38;5;208m°", "\x1b[38;5;231m*",
+}
+
+// Visitors counts the unique visitors of the aquarium. Visitors are told
+// apart by a hash of their SSH key's fingerprint or, without a key, of
+// their IP address, so neither is kept. It is shared by all rooms and
+// optionally persisted to a state directory.
+type Visitors struct {
+	mu       sync.Mutex
+	seen     map[string]bool
+	store    store.Store
+	dirty    bool
+	lastSave time.Time
+}
+
+func NewVisitors() *Visitors {
+	return &Visitors{seen: make(map[string]bool)}
+}
+
+// SetStore loads the visitors seen from state and saves future ones there.
+func (v *Visitors) SetStore(state store.Store) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.store = state
+	hashes, err := state.LoadVisitors()
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	for _, hash := range hashes {
+		v.seen[hash] = true
+	}
+	return nil
+}
+
+// Visit records a visit and returns the number of unique visitors so far
+// and whether the client is new.
+func (v *Visitors) Visit(client ClientInfo) (int, bool) {
+	hash := visitorHash(client)
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if hash == "" || v.seen[hash] {
+		return len(v.seen), false
+	}
+	v.seen[hash] = true
+	v.dirty = true
+	if time.Since(v.lastSave) >= visitorSaveInterval {
+		v.saveLocked()
+	}
+	return len(v.seen), true
+}
+
+// Count returns the number of unique visitors.
+func (v *Visitors) Count() int {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return len(v.seen)
+}
+
+// Save writes unsaved visitors to the state directory.
+func (v *Visitors) Save() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.saveLocked()
+}
+
+func (v *Visitors) saveLocked() {
+	if v.store == nil || !v.dirty {
+		return
+	}
+	hashes := make([]string, 0, len(v.seen))
+	for hash := range v.seen {
+		hashes = append(hashes, hash)
+	}
+	if err := v.store.SaveVisitors(hashes); err != nil {
+		log.Printf("Failed to save visitors: %v", err)
+		return
+	}
+	v.dirty = false
+	v.lastSave = time.Now()
+}
+
+// visitorHash identifies a visitor by their key or, without one, their IP
+// address. It is empty if there is neither.
+func visitorHash(client ClientInfo) string {
+	id := "key " + client.Fingerprint
+	if client.Fingerprint == "" {
+		host, _, err := net.SplitHostPort(client.RemoteAddr)
+		if err != nil {
+			host = client.RemoteAddr
+		}
+		if host == "" {
+			return ""
+		}
+		id = "ip " + host
+	}
+	sum := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(sum[:16])
+}
+
+// visitorMilestone reports whether the nth visitor is celebrated: the
+// 100th, the 1000th and every 1000th after that.
+func visitorMilestone(n int) bool {
+	return n == 100 || n > 0 && n%1000 == 0
+}
+
+// Welcome counts a visitor who started watching room and celebrates the
+// milestone ones in every room.
+func (r *Registry) Welcome(room string, client ClientInfo) {
+	n, first := r.visitors.Visit(client)
+	r.owners.arrive(client.Fingerprint, time.Now())
+	event := Event{
+		Name:        EventConnect,
+		Room:        room,
+		Username:    client.Username,
+		Fingerprint: client.Fingerprint,
+		RemoteAddr:  client.RemoteAddr,
+		Visitors:    n,
+	}
+	r.emit(event)
+	if !first || !visitorMilestone(n) {
+		return
+	}
+	log.Printf("Visitor #%d: %s", n, client.Username)
+	event.Name = EventMilestone
+	r.emit(event)
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, room := range r.rooms {
+		room.Celebrate(fmt.Sprintf("Visitor #%d! Welcome, %s!", n, client.Username))
+	}
+}
+
+// confetti is a bit of a celebration rising through the water.
+type confetti struct {
+	col   int
+	row   float64 // where it starts, below the water
+	speed float64 // rows per second
+	glyph string
+	start time.Time
+	drawn cell // where it was drawn last frame, zero if it wasn't
+}
+
+// Celebrate announces text in the status bar and sends confetti up through
+// the water with the next frame.
+func (m *Manager) Celebrate(text string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	m.announceLocked(text, now)
+	m.celebrateAt = now
+}
+
+// spawnConfetti sends up a celebration's confetti from below the water,
+// unless it is older than its announcement, e.g. because the tank wasn't
+// drawn since. Callers must hold m.mu.
+func (m *Manager) spawnConfetti(config *TerminalConfig, now time.Time) {
+	at := m.celebrateAt
+	m.celebrateAt = time.Time{}
+	if now.Sub(at) > TickerDuration {
+		return
+	}
+	waterRows := config.Rows - config.FloorRows - 1
+	for i := 0; i < max(1, config.Columns*confettiPieces/10); i++ {
+		m.confetti = append(m.confetti, confetti{
+			col:   rand.Intn(config.Columns) + 1,
+			row:   float64(waterRows) + 1 + rand.Float64()*float64(waterRows)/2,
+			speed: 4 + rand.Float64()*6,
+			glyph: confettiGlyphs[rand.Intn(len(confettiGlyphs))],
+			start: now,
+		})
+	}
+}
+
+// renderConfetti moves confetti up and draws it, clearing the cells it left
+// and the bits that reached the surface. Callers must hold m.mu.
+func (m *Manager) renderConfetti(buf *UpdateBuffer, config *TerminalConfig, now time.Time) {
+	if !m.celebrateAt.IsZero() {
+		m.spawnConfetti(config, now)
+	}
+	waterRows := config.Rows - config.FloorRows - 1
+	active := m.confetti[:0]
+	for _, c := range m.confetti {
+		at := cell{int(c.row - c.speed*now.Sub(c.start).Seconds()), c.col}
+		if at != c.drawn && c.drawn != (cell{}) {
+			buf.AddClearCell(c.drawn.Row, c.drawn.Col)
+			c.drawn = cell{}
+		}
+		if at.Row < 1 {
+			continue
+		}
+		if at.Row <= waterRows {
+			buf.AddText(at.Row, at.Col, c.glyph)
+			c.drawn = at
+		}
+		active = append(active, c)
+	}
+	m.confetti = active
+}
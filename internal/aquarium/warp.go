@@ -0,0 +1,76 @@
+package aquarium
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+)
+
+// errNoFish is returned for a fish that isn't in the tank.
+var errNoFish = errors.New("no such fish")
+
+// fishWarp moves a fish on the next frame, to x and y as fractions of the
+// room the fish has to swim in.
+type fishWarp struct {
+	fish *Fish
+	x, y float64
+}
+
+// WarpFish moves a fish, e.g. one a geometry bug stranded outside the tank,
+// to x and y given as fractions of the tank's width and height. The fish's
+// placement is deleted and placed anew, so every client converges whatever
+// it drew before.
+func (m *Manager) WarpFish(id uint64, x, y float64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fish, ok := m.fish[id]
+	switch {
+	case !ok:
+		return errNoFish
+	case fish.Remote:
+		return fmt.Errorf("fish %d is mirrored from another node, warp it there", id)
+	case !fish.AwayUntil.IsZero():
+		return fmt.Errorf("fish %d is visiting another aquarium", id)
+	}
+	m.warps = append(m.warps, fishWarp{fish: fish, x: x, y: y})
+	m.notify()
+	return nil
+}
+
+// WarpFish moves a fish of any room, see Manager.WarpFish, and returns the
+// room it is in.
+func (r *Registry) WarpFish(id uint64, x, y float64) (string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, name := range r.order {
+		err := r.rooms[name].WarpFish(id, x, y)
+		if !errors.Is(err, errNoFish) {
+			return name, err
+		}
+	}
+	return "", fmt.Errorf("no fish %d", id)
+}
+
+// apply moves the fish and replaces its placement. Bubbles it blew where it
+// was stranded are cleared. Only the animation loop calls it.
+func (w fishWarp) apply(buf *UpdateBuffer, config *TerminalConfig) {
+	fish := w.fish
+	width := float64(config.Columns * config.CellWidth)
+	fish.PosX = math.Max(0, w.x*(width-fish.Width()))
+	fish.PosY = math.Max(0, w.y*(tankHeight(config)-fish.Height()))
+	fish.EdgeHit = 0
+	if fish.LastImageID != 0 {
+		buf.AddDeletePlacement(fish.LastImageID, fish.PlacementID)
+		fish.LastImageID = 0
+	}
+	for _, bubble := range fish.Bubbles {
+		if bubble.PrevCol > 0 && bubble.PrevRow > 0 {
+			buf.AddClearCell(bubble.PrevRow, bubble.PrevCol)
+		}
+	}
+	fish.Bubbles = fish.Bubbles[:0]
+	log.Printf("Fish %d warped to %.0f,%.0f", fish.ID, fish.PosX, fish.PosY)
+}
@@ -0,0 +1,85 @@
+package aquarium
+
+import (
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// StatusWidget adds something to the status row next to the built-in tank
+// state and duration, e.g. the weather, a build status or a visitor counter.
+// Widgets are asked again every time the status row is redrawn, every few
+// seconds, and should answer quickly.
+type StatusWidget interface {
+	// Measure returns how many columns the widget wants, 0 to leave it out.
+	Measure(ctx StatusContext) int
+	// Render returns the widget's text. Text wider than width is cut and
+	// control characters are removed.
+	Render(ctx StatusContext, width int) string
+}
+
+// StatusContext is what widgets know about the tank they are drawn in.
+type StatusContext struct {
+	Fish        int
+	Connections int
+	Columns     int // width of the status row
+	Now         time.Time
+}
+
+// StatusWidgetFunc is a StatusWidget as wide as the text the function
+// returns.
+type StatusWidgetFunc func(ctx StatusContext) string
+
+func (f StatusWidgetFunc) Measure(ctx StatusContext) int {
+	return utf8.RuneCountInString(sanitizeLabel(f(ctx)))
+}
+
+func (f StatusWidgetFunc) Render(ctx StatusContext, width int) string {
+	return f(ctx)
+}
+
+// maxWidgetShare is the fraction of the status row widgets may take, the
+// rest is left for names.
+const maxWidgetShare = 3
+
+// AddStatusWidget shows w in the status row. Widgets appear left to right in
+// the order they were added, left of the built-in ones.
+func (m *Manager) AddStatusWidget(w StatusWidget) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.widgets = append(m.widgets, w)
+	if m.aquarium != nil {
+		m.aquarium.LastStatusUpdate = time.Time{}
+	}
+	m.notify()
+}
+
+// AddStatusWidget shows w in the status row of every room.
+func (r *Registry) AddStatusWidget(w StatusWidget) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, room := range r.rooms {
+		room.AddStatusWidget(w)
+	}
+}
+
+// renderWidgets returns the widgets' text, two spaces apart. Widgets that
+// don't fit into a third of the row are left out. Callers must not hold
+// m.mu, widgets run outside the lock.
+func renderWidgets(widgets []StatusWidget, ctx StatusContext) string {
+	space := ctx.Columns / maxWidgetShare
+	var parts []string
+	for _, w := range widgets {
+		width := w.Measure(ctx)
+		if width <= 0 || width > space {
+			continue
+		}
+		text := sanitizeLabel(w.Render(ctx, width))
+		if utf8.RuneCountInString(text) > width {
+			text = string([]rune(text)[:width])
+		}
+		parts = append(parts, text)
+		space -= width + 2
+	}
+	return strings.Join(parts, "  ")
+}
@@ -0,0 +1,88 @@
+// Package assets holds the images the aquarium ships with, embedded in the
+// binary so it runs from any directory. A directory set with SetDir
+// overrides them file by file.
+package assets
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"image/png"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+//go:embed fish.png fish-right.png
+var embedded embed.FS
+
+// dir overrides the embedded files, empty for none. It is set once at
+// startup.
+var dir string
+
+// SetDir makes the files in path override the embedded ones. Every image in
+// it that would be used must be a valid PNG, so a broken one stops the
+// server at startup rather than leaving terminals without fish.
+func SetDir(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", path)
+	}
+
+	names, err := fs.Glob(embedded, "*.png")
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		data, err := os.ReadFile(filepath.Join(path, name))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue // the embedded one is used
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := png.Decode(bytes.NewReader(data)); err != nil {
+			return fmt.Errorf("%s is not a valid PNG: %w", filepath.Join(path, name), err)
+		}
+	}
+	dir = path
+	return nil
+}
+
+// Read returns the first of names found in the assets directory, else the
+// first one embedded. Later names are stand-ins for earlier ones, e.g. the
+// left-facing fish for a right-facing one that wasn't drawn.
+func Read(names ...string) ([]byte, error) {
+	if dir != "" {
+		for _, name := range names {
+			data, err := os.ReadFile(filepath.Join(dir, name))
+			if err == nil {
+				return data, nil
+			}
+			if !errors.Is(err, fs.ErrNotExist) {
+				return nil, err
+			}
+		}
+	}
+	var err error
+	for _, name := range names {
+		var data []byte
+		if data, err = embedded.ReadFile(name); err == nil {
+			return data, nil
+		}
+	}
+	return nil, err
+}
+
+// Path returns where a file overriding the named asset would be, for
+// watching it, or "" without an assets directory.
+func Path(name string) string {
+	if dir == "" {
+		return ""
+	}
+	return filepath.Join(dir, name)
+}
@@ -0,0 +1,242 @@
+package cluster
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/acuqa/ssh-aquarium/internal/aquarium"
+)
+
+const (
+	publishInterval = 100 * time.Millisecond
+	nodeTimeout     = 3 * time.Second
+	retryInterval   = 2 * time.Second
+)
+
+// Node replicates the fish of this instance to other instances through
+// Redis pub/sub and mirrors the fish they publish into the local tank.
+type Node struct {
+	id       string
+	addr     string
+	channel  string
+	aquarium *aquarium.Manager
+	stop     chan struct{}
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+	sub      *redisConn
+}
+
+type message struct {
+	Node string               `json:"node"`
+	Fish []aquarium.FishState `json:"fish"`
+
+	// A node shutting down hands its tank to one peer
+	Handoff *aquarium.Snapshot `json:"handoff,omitempty"`
+	To      string             `json:"to,omitempty"`
+}
+
+func New(id, addr, channel string, aquarium *aquarium.Manager) *Node {
+	return &Node{
+		id:       id,
+		addr:     addr,
+		channel:  channel,
+		aquarium: aquarium,
+		stop:     make(chan struct{}),
+	}
+}
+
+func (n *Node) Start() {
+	log.Printf("Cluster node %s replicating via %s (channel %q)", n.id, n.addr, n.channel)
+
+	n.wg.Add(2)
+	go n.publishLoop()
+	go n.subscribeLoop()
+}
+
+func (n *Node) Stop() {
+	close(n.stop)
+
+	// Unblock the subscriber, which is waiting on a read
+	n.mu.Lock()
+	if n.sub != nil {
+		n.sub.Close()
+	}
+	n.mu.Unlock()
+
+	n.wg.Wait()
+}
+
+func (n *Node) publishLoop() {
+	defer n.wg.Done()
+
+	ticker := time.NewTicker(publishInterval)
+	defer ticker.Stop()
+
+	var conn *redisConn
+	defer func() {
+		if conn != nil {
+			conn.Close()
+		}
+	}()
+
+	var lastAttempt time.Time
+	for {
+		select {
+		case <-n.stop:
+			n.handoff(conn)
+			return
+		case <-ticker.C:
+		}
+
+		n.aquarium.PruneRemoteNodes(nodeTimeout)
+
+		if conn == nil {
+			if time.Since(lastAttempt) < retryInterval {
+				continue
+			}
+			lastAttempt = time.Now()
+
+			var err error
+			if conn, err = dialRedis(n.addr); err != nil {
+				log.Printf("Cluster publisher connect failed: %v", err)
+				conn = nil
+				continue
+			}
+		}
+
+		// Publish even when empty so peers notice departed fish
+		payload, err := json.Marshal(message{Node: n.id, Fish: n.aquarium.LocalFishStates()})
+		if err != nil {
+			log.Printf("Cluster encode error: %v", err)
+			continue
+		}
+
+		if _, err := conn.do("PUBLISH", n.channel, string(payload)); err != nil {
+			log.Printf("Cluster publish failed: %v", err)
+			conn.Close()
+			conn = nil
+		}
+	}
+}
+
+// handoff passes the local tank to the first live peer so its fish keep
+// swimming, and wait there for their owners, after this node is gone.
+func (n *Node) handoff(conn *redisConn) {
+	peers := n.aquarium.RemoteNodes()
+	if len(peers) == 0 {
+		return
+	}
+
+	snap := n.aquarium.Snapshot()
+	if len(snap.Fish) == 0 {
+		return
+	}
+	payload, err := json.Marshal(message{Node: n.id, Handoff: &snap, To: peers[0]})
+	if err != nil {
+		log.Printf("Cluster encode error: %v", err)
+		return
+	}
+
+	if conn == nil {
+		if conn, err = dialRedis(n.addr); err != nil {
+			log.Printf("Cluster handoff failed: %v", err)
+			return
+		}
+		defer conn.Close()
+	}
+	if _, err := conn.do("PUBLISH", n.channel, string(payload)); err != nil {
+		log.Printf("Cluster handoff failed: %v", err)
+		return
+	}
+	log.Printf("Handed %d fish over to cluster node %s", len(snap.Fish), peers[0])
+}
+
+func (n *Node) subscribeLoop() {
+	defer n.wg.Done()
+
+	for {
+		if err := n.subscribe(); err != nil {
+			log.Printf("Cluster subscriber error: %v", err)
+		}
+
+		select {
+		case <-n.stop:
+			return
+		case <-time.After(retryInterval):
+		}
+	}
+}
+
+func (n *Node) subscribe() error {
+	conn, err := dialRedis(n.addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	n.mu.Lock()
+	select {
+	case <-n.stop:
+		n.mu.Unlock()
+		return nil
+	default:
+	}
+	n.sub = conn
+	n.mu.Unlock()
+
+	defer func() {
+		n.mu.Lock()
+		n.sub = nil
+		n.mu.Unlock()
+	}()
+
+	if err := conn.send("SUBSCRIBE", n.channel); err != nil {
+		return err
+	}
+
+	for {
+		reply, err := conn.receive()
+		if err != nil {
+			select {
+			case <-n.stop:
+				return nil
+			default:
+				return err
+			}
+		}
+
+		// Pushed messages look like ["message", channel, payload]
+		items, ok := reply.([]interface{})
+		if !ok || len(items) != 3 || items[0] != "message" {
+			continue
+		}
+		payload, ok := items[2].(string)
+		if !ok {
+			continue
+		}
+
+		var msg message
+		if err := json.Unmarshal([]byte(payload), &msg); err != nil {
+			log.Printf("Cluster decode error: %v", err)
+			continue
+		}
+		if msg.Node == n.id {
+			continue
+		}
+
+		if msg.Handoff != nil {
+			if msg.To == n.id {
+				log.Printf("Cluster node %s handed its tank over", msg.Node)
+				n.aquarium.DropRemoteNode(msg.Node)
+				if err := n.aquarium.Adopt(*msg.Handoff); err != nil {
+					log.Printf("Cluster handoff rejected: %v", err)
+				}
+			}
+			continue
+		}
+
+		n.aquarium.ApplyRemoteFish(msg.Node, msg.Fish)
+	}
+}
@@ -0,0 +1,210 @@
+package connection
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/acuqa/ssh-aquarium/internal/aquarium"
+)
+
+const (
+	// passphraseDelay holds up the prompt after a wrong passphrase, so
+	// guessing takes a while.
+	passphraseDelay = time.Second
+
+	passphraseWidth = 38
+	maxPassphrase   = 64
+)
+
+// passphrasePrompt asks for the passphrase of a room before switching to it.
+type passphrasePrompt struct {
+	room  string
+	typed []rune
+	wrong bool // the last passphrase typed was wrong
+	stop  chan struct{}
+}
+
+// mayEnter reports whether this user can switch to the named room without
+// being asked anything.
+func (h *Handler) mayEnter(name string) bool {
+	h.mu.Lock()
+	client, unlocked := h.client, h.unlocked[name]
+	h.mu.Unlock()
+
+	switch h.rooms.Access(name, client) {
+	case aquarium.AccessOpen:
+		return true
+	case aquarium.AccessPassphrase:
+		return unlocked
+	}
+	return false
+}
+
+// enterRoom switches to a room picked in the room menu, asking for its
+// passphrase first if it has one. Rooms the user can't enter leave the menu
+// open with a note.
+func (h *Handler) enterRoom(name string) {
+	if h.mayEnter(name) {
+		h.closeRoomMenu()
+		h.switchRoom(name)
+		return
+	}
+
+	h.mu.Lock()
+	client, connID := h.client, h.connID
+	h.mu.Unlock()
+	if h.rooms.Access(name, client) == aquarium.AccessDenied {
+		log.Printf("Connection %d: room %q is not open to '%s'", connID, name, client.Username)
+		h.mu.Lock()
+		h.menuNote = name + " is private"
+		h.mu.Unlock()
+		h.renderRoomMenu()
+		return
+	}
+
+	h.closeRoomMenu()
+	h.openPassphrasePrompt(name)
+}
+
+// handlePassphrase takes all input while the passphrase prompt is open. It
+// reports whether the input was consumed.
+func (h *Handler) handlePassphrase(data []byte) bool {
+	h.mu.Lock()
+	prompt := h.passphrase
+	h.mu.Unlock()
+	if prompt == nil {
+		return false
+	}
+
+	for len(data) > 0 {
+		key, size := nextKey(data)
+		data = data[size:]
+
+		h.mu.Lock()
+		switch {
+		case key == keyEscape:
+			h.mu.Unlock()
+			h.closePassphrasePrompt()
+			return true
+		case key == '\r' || key == '\n':
+			typed := string(prompt.typed)
+			prompt.typed = nil
+			h.mu.Unlock()
+			h.submitPassphrase(prompt, typed)
+			return true
+		case key == 0x7f || key == 0x08:
+			if len(prompt.typed) > 0 {
+				prompt.typed = prompt.typed[:len(prompt.typed)-1]
+			}
+		case key >= ' ' && key < 0x7f && len(prompt.typed) < maxPassphrase:
+			prompt.typed = append(prompt.typed, rune(key))
+		}
+		h.mu.Unlock()
+	}
+	h.renderPassphrasePrompt()
+	return true
+}
+
+// submitPassphrase switches to the prompt's room if typed is its passphrase.
+func (h *Handler) submitPassphrase(prompt *passphrasePrompt, typed string) {
+	h.mu.Lock()
+	connID, username := h.connID, h.client.Username
+	h.mu.Unlock()
+
+	if !h.rooms.CheckPassphrase(prompt.room, typed) {
+		log.Printf("Connection %d: wrong passphrase for room %q from '%s'", connID, prompt.room, username)
+		time.Sleep(passphraseDelay)
+		h.mu.Lock()
+		prompt.wrong = true
+		h.mu.Unlock()
+		h.renderPassphrasePrompt()
+		return
+	}
+
+	h.mu.Lock()
+	if h.unlocked == nil {
+		h.unlocked = make(map[string]bool)
+	}
+	h.unlocked[prompt.room] = true
+	h.mu.Unlock()
+	h.closePassphrasePrompt()
+	h.switchRoom(prompt.room)
+}
+
+func (h *Handler) openPassphrasePrompt(room string) {
+	prompt := &passphrasePrompt{room: room, stop: make(chan struct{})}
+	h.mu.Lock()
+	h.passphrase = prompt
+	h.mu.Unlock()
+
+	h.renderPassphrasePrompt()
+
+	// Redraw periodically so fish frames don't leave the prompt half
+	// erased
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-prompt.stop:
+				return
+			case <-ticker.C:
+				h.renderPassphrasePrompt()
+			}
+		}
+	}()
+}
+
+func (h *Handler) closePassphrasePrompt() {
+	h.mu.Lock()
+	prompt := h.passphrase
+	h.passphrase = nil
+	h.mu.Unlock()
+
+	if prompt == nil {
+		return
+	}
+	close(prompt.stop)
+	h.clearMenuBox(h.passphraseBounds())
+}
+
+func (h *Handler) passphraseBounds() (top, left, width, height int) {
+	h.mu.Lock()
+	columns, rows := h.termColumns, h.termRows
+	h.mu.Unlock()
+
+	width = passphraseWidth
+	height = 5
+	top = max((rows-height)/2, 1)
+	left = max((columns-width)/2, 1)
+	return top, left, width, height
+}
+
+func (h *Handler) renderPassphrasePrompt() {
+	h.mu.Lock()
+	prompt := h.passphrase
+	if prompt == nil {
+		h.mu.Unlock()
+		return
+	}
+	room, typed, wrong := prompt.room, len(prompt.typed), prompt.wrong
+	h.mu.Unlock()
+
+	// Only stars are shown, and no more than fit
+	stars := strings.Repeat("*", min(typed, passphraseWidth-5))
+	status := "enter join   esc cancel"
+	if wrong {
+		status = "wrong passphrase, try again"
+	}
+	lines := []string{
+		fmt.Sprintf("Passphrase for %s", room),
+		"> " + stars + "_",
+		"",
+		status,
+		"",
+	}
+	top, left, width, _ := h.passphraseBounds()
+	h.write([]byte(menuBox(top, left, width, lines)))
+}
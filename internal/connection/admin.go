@@ -0,0 +1,34 @@
+package connection
+
+import "log"
+
+// handleAdminKey handles keys only admins may use. It reports whether the
+// key was consumed.
+func (h *Handler) handleAdminKey(key byte) bool {
+	if !h.rooms.IsAdmin(h.client) {
+		return false
+	}
+
+	room, connID := h.focused()
+	switch key {
+	case 'w', 'W':
+		// Toggle a storm in the focused room
+		storm := !room.Storming()
+		log.Printf("Connection %d: admin %s turned the storm %s", connID, h.username, onOff(storm))
+		room.SetStorm(storm)
+		return true
+	case 'd', 'D':
+		// Toggle the fish AI debug overlay for this connection
+		on := room.ToggleDebugOverlay(connID)
+		log.Printf("Connection %d: admin %s turned the debug overlay %s", connID, h.username, onOff(on))
+		return true
+	}
+	return false
+}
+
+func onOff(on bool) string {
+	if on {
+		return "on"
+	}
+	return "off"
+}
@@ -0,0 +1,283 @@
+package connection
+
+import (
+	"errors"
+	"log"
+	"net"
+	"os"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/acuqa/ssh-aquarium/internal/aquarium"
+	"github.com/acuqa/ssh-aquarium/internal/store"
+)
+
+const (
+	capabilityRecord       = "capabilities"
+	capabilityTTL          = 30 * 24 * time.Hour
+	maxCapabilityEntries   = 10000
+	capabilitySaveInterval = 30 * time.Second
+
+	// cellSizeInterval is how often terminals that report their size in
+	// pixels are asked again, in case the window moved to a monitor with
+	// another DPI without being resized.
+	cellSizeInterval = 20 * time.Second
+)
+
+// Capabilities is what terminal detection found out about a client.
+type Capabilities struct {
+	CellWidth    int       `json:"cell_width"`
+	CellHeight   int       `json:"cell_height"`
+	PixelReports bool      `json:"pixel_reports"` // terminal answers CSI 14t
+	Seen         time.Time `json:"seen"`
+
+	// Probe is what the terminal answered when probed, nil for entries
+	// from before terminals were probed
+	Probe *aquarium.TerminalCaps `json:"probe,omitempty"`
+}
+
+// CapabilityCache remembers detected terminal capabilities so returning
+// users skip the detection timeout.
+type CapabilityCache struct {
+	mu       sync.Mutex
+	entries  map[string]Capabilities
+	store    store.Store
+	dirty    bool
+	lastSave time.Time
+}
+
+func NewCapabilityCache() *CapabilityCache {
+	return &CapabilityCache{
+		entries: make(map[string]Capabilities),
+	}
+}
+
+// capabilityKey identifies a returning client's terminal: by key
+// fingerprint when the client authenticated with a key, otherwise by its
+// SSH banner and address.
+func capabilityKey(client aquarium.ClientInfo, termType string) string {
+	if client.Fingerprint != "" {
+		return client.Fingerprint + " " + termType
+	}
+	host, _, err := net.SplitHostPort(client.RemoteAddr)
+	if err != nil {
+		host = client.RemoteAddr
+	}
+	return client.ClientVersion + " " + host + " " + termType
+}
+
+// SetStore loads remembered capabilities from state and saves new ones there.
+func (c *CapabilityCache) SetStore(state store.Store) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.store = state
+	entries := make(map[string]Capabilities)
+	if err := state.Load(capabilityRecord, &entries); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	for key, caps := range entries {
+		if time.Since(caps.Seen) < capabilityTTL {
+			c.entries[key] = caps
+		}
+	}
+	return nil
+}
+
+// Lookup returns the capabilities remembered for key.
+func (c *CapabilityCache) Lookup(key string) (Capabilities, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	caps, ok := c.entries[key]
+	if !ok || time.Since(caps.Seen) >= capabilityTTL {
+		return Capabilities{}, false
+	}
+	return caps, true
+}
+
+// Remember stores freshly detected capabilities for key.
+func (c *CapabilityCache) Remember(key string, caps Capabilities) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	caps.Seen = time.Now()
+	c.entries[key] = caps
+	c.dirty = true
+
+	// Forget the least recently seen terminal once the cache is full
+	if len(c.entries) > maxCapabilityEntries {
+		oldest := key
+		for k, e := range c.entries {
+			if e.Seen.Before(c.entries[oldest].Seen) {
+				oldest = k
+			}
+		}
+		delete(c.entries, oldest)
+	}
+
+	if time.Since(c.lastSave) >= capabilitySaveInterval {
+		c.saveLocked()
+	}
+}
+
+// Save writes unsaved entries to the state directory.
+func (c *CapabilityCache) Save() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.saveLocked()
+}
+
+func (c *CapabilityCache) saveLocked() {
+	if c.store == nil || !c.dirty {
+		return
+	}
+	if err := c.store.Save(capabilityRecord, c.entries); err != nil {
+		log.Printf("Failed to save terminal capabilities: %v", err)
+		return
+	}
+	c.dirty = false
+	c.lastSave = time.Now()
+}
+
+// pixelReport matches the reply to CSI 14t: ESC[4;height;widtht
+var pixelReport = regexp.MustCompile(`\x1b\[4;(\d+);(\d+)t`)
+
+// Cell sizes no font has. Terminals that count their padding in the window
+// size or report zeros produce them, and the tank's geometry is derived
+// from the cell size.
+const (
+	minCellSize = 4
+	maxCellSize = 128
+)
+
+// saneCellSize reports whether a cell size derived from a CSI 14t reply
+// can be trusted.
+func saneCellSize(width, height int) bool {
+	return width >= minCellSize && height >= minCellSize && width <= maxCellSize && height <= maxCellSize
+}
+
+// useCachedCapabilities applies remembered capabilities for this terminal.
+// It still asks for the window size so a changed font is picked up by
+// handlePixelReports.
+func (h *Handler) useCachedCapabilities() bool {
+	if h.caps == nil {
+		return false
+	}
+	h.mu.Lock()
+	key := capabilityKey(h.client, h.termType)
+	username := h.username
+	h.mu.Unlock()
+
+	caps, ok := h.caps.Lookup(key)
+	if !ok || caps.Probe == nil {
+		return false
+	}
+
+	h.mu.Lock()
+	h.client.Caps = *caps.Probe
+	if caps.PixelReports && saneCellSize(caps.CellWidth, caps.CellHeight) {
+		h.cellWidth = caps.CellWidth
+		h.cellHeight = caps.CellHeight
+	}
+	h.mu.Unlock()
+	log.Printf("User '%s': using cached terminal capabilities, cell size %dx%d", username, h.cellWidth, h.cellHeight)
+
+	h.write([]byte("\x1b[14t"))
+	return true
+}
+
+// rememberCapabilities caches the detection result for this terminal.
+func (h *Handler) rememberCapabilities(pixelReports bool) {
+	if h.caps == nil {
+		return
+	}
+	h.mu.Lock()
+	key := capabilityKey(h.client, h.termType)
+	probe := h.client.Caps
+	caps := Capabilities{PixelReports: pixelReports, Probe: &probe}
+	if pixelReports {
+		caps.CellWidth = h.cellWidth
+		caps.CellHeight = h.cellHeight
+	}
+	h.mu.Unlock()
+	h.caps.Remember(key, caps)
+}
+
+// handlePixelReports applies window size replies that arrive after a
+// cached start or a resize, updates the cache from them and returns the
+// remaining input.
+func (h *Handler) handlePixelReports(data []byte) []byte {
+	matches := pixelReport.FindSubmatch(data)
+	if matches == nil {
+		return data
+	}
+
+	pixelHeight, _ := strconv.Atoi(string(matches[1]))
+	pixelWidth, _ := strconv.Atoi(string(matches[2]))
+
+	h.mu.Lock()
+	columns, rows := h.termColumns, h.termRows
+	key := capabilityKey(h.client, h.termType)
+	probe := h.client.Caps
+	h.mu.Unlock()
+
+	if columns > 0 && rows > 0 {
+		width, height := pixelWidth/columns, pixelHeight/rows
+		if !saneCellSize(width, height) {
+			log.Printf("Connection %d: ignoring window size %dx%d, it gives %dx%d pixel cells", h.connID, pixelWidth, pixelHeight, width, height)
+			return pixelReport.ReplaceAll(data, nil)
+		}
+		if h.caps != nil {
+			h.caps.Remember(key, Capabilities{
+				CellWidth:    width,
+				CellHeight:   height,
+				PixelReports: true,
+				Probe:        &probe,
+			})
+		}
+
+		// A new font, zoom level or DPI changes the cell size, fish are
+		// placed in pixels and need it
+		h.mu.Lock()
+		changed := h.cellWidth != width || h.cellHeight != height
+		h.cellWidth, h.cellHeight = width, height
+		h.pixelReports = true
+		h.mu.Unlock()
+		if changed {
+			log.Printf("Connection %d: cell size changed to %dx%d pixels", h.connID, width, height)
+			h.closeSplit()
+			h.applyTerminalSize()
+		}
+	}
+
+	return pixelReport.ReplaceAll(data, nil)
+}
+
+// recheckCellSize asks terminals that report their size in pixels for it
+// every cellSizeInterval. Moving a window between monitors can change its
+// cell size without a window change; handlePixelReports rescales the tank
+// if it did.
+func (h *Handler) recheckCellSize() {
+	ticker := time.NewTicker(cellSizeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-h.done:
+			return
+		case <-ticker.C:
+			h.mu.Lock()
+			pixelReports := h.pixelReports
+			h.mu.Unlock()
+			if pixelReports {
+				h.write([]byte("\x1b[14t"))
+			}
+		}
+	}
+}
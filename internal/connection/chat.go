@@ -0,0 +1,131 @@
+package connection
+
+import (
+	"time"
+
+	"github.com/acuqa/ssh-aquarium/internal/aquarium"
+)
+
+// chatWidth fits a whole message with the prompt in front of it.
+const chatWidth = aquarium.MaxChatMessage + 6
+
+// chatLine is a message being typed, shown in a bubble above the user's fish
+// once Enter is pressed.
+type chatLine struct {
+	typed []rune
+	stop  chan struct{}
+}
+
+// openChat starts typing a message, unless a menu is open.
+func (h *Handler) openChat() {
+	line := &chatLine{stop: make(chan struct{})}
+	h.mu.Lock()
+	if h.chat != nil || h.menuStop != nil || h.guestbookStop != nil {
+		h.mu.Unlock()
+		return
+	}
+	h.chat = line
+	h.mu.Unlock()
+
+	h.renderChat()
+
+	// Redraw periodically so fish frames don't leave the line half erased
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-line.stop:
+				return
+			case <-ticker.C:
+				h.renderChat()
+			}
+		}
+	}()
+}
+
+// handleChat takes all input while a message is being typed. It reports
+// whether the input was consumed.
+func (h *Handler) handleChat(data []byte) bool {
+	h.mu.Lock()
+	line := h.chat
+	h.mu.Unlock()
+	if line == nil {
+		return false
+	}
+
+	for len(data) > 0 {
+		key, size := nextKey(data)
+		data = data[size:]
+
+		h.mu.Lock()
+		switch {
+		case key == keyEscape:
+			h.mu.Unlock()
+			h.closeChat()
+			return true
+		case key == '\r' || key == '\n':
+			message := string(line.typed)
+			h.mu.Unlock()
+			h.closeChat()
+			room, connID := h.focused()
+			room.Say(connID, message)
+			return true
+		case key == 0x7f || key == 0x08:
+			if len(line.typed) > 0 {
+				line.typed = line.typed[:len(line.typed)-1]
+			}
+		case key >= ' ' && key < 0x7f && len(line.typed) < aquarium.MaxChatMessage:
+			line.typed = append(line.typed, rune(key))
+		}
+		h.mu.Unlock()
+	}
+	h.renderChat()
+	return true
+}
+
+func (h *Handler) closeChat() {
+	h.mu.Lock()
+	line := h.chat
+	h.chat = nil
+	h.mu.Unlock()
+
+	if line == nil {
+		return
+	}
+	close(line.stop)
+	h.clearMenuBox(h.chatBounds())
+}
+
+// chatBounds puts the line near the bottom, out of the way of most fish.
+func (h *Handler) chatBounds() (top, left, width, height int) {
+	h.mu.Lock()
+	columns, rows := h.termColumns, h.termRows
+	h.mu.Unlock()
+
+	width = min(chatWidth, columns)
+	height = 2
+	top = max(rows-height-1, 1)
+	left = max((columns-width)/2, 1)
+	return top, left, width, height
+}
+
+func (h *Handler) renderChat() {
+	h.mu.Lock()
+	line := h.chat
+	if line == nil {
+		h.mu.Unlock()
+		return
+	}
+	typed := []rune(string(line.typed))
+	h.mu.Unlock()
+
+	// Narrow terminals see the end of the message, where the cursor is
+	top, left, width, _ := h.chatBounds()
+	typed = typed[max(len(typed)-(width-5), 0):]
+	lines := []string{
+		"> " + string(typed) + "_",
+		"enter say   esc cancel",
+	}
+	h.write([]byte(menuBox(top, left, width, lines)))
+}
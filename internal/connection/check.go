@@ -0,0 +1,195 @@
+package connection
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/acuqa/ssh-aquarium/internal/aquarium"
+)
+
+// checkTimeout is how long the self-test waits for the terminal's replies.
+const checkTimeout = 2 * time.Second
+
+// checkQueries asks for the window size in pixels, whether a tiny Kitty
+// graphics image would be accepted, and whether mouse clicks, SGR mouse
+// reports and synchronized output can be switched on. The cursor position
+// comes last: every terminal answers it, and in order, so its reply ends
+// the wait and gives the round trip time.
+const checkQueries = "\x1b[14t" +
+	"\x1b_Gi=31,s=1,v=1,a=q,t=d,f=24;AAAA\x1b\\" +
+	"\x1b[?1000$p\x1b[?1006$p\x1b[?2026$p" +
+	"\x1b[6n"
+
+var (
+	kittyReply = regexp.MustCompile(`\x1b_Gi=31;([^\x1b]*)\x1b\\`)
+	modeReply  = regexp.MustCompile(`\x1b\[\?(\d+);(\d)\$y`)
+)
+
+// errNoTerminal is returned by Check for sessions without a pty.
+var errNoTerminal = errors.New("needs a terminal, run it with ssh -t")
+
+// Check runs the self-test of `ssh -t host check`: it asks the terminal what
+// it supports and reports what it found, for "why don't I see fish". It runs
+// instead of the aquarium and before the input handling, so it reads the
+// replies itself.
+func (h *Handler) Check() error {
+	h.mu.Lock()
+	client, termType, columns, rows := h.client, h.termType, h.termColumns, h.termRows
+	h.mu.Unlock()
+	if termType == "" {
+		return errNoTerminal
+	}
+
+	printf := func(format string, args ...any) {
+		h.channel.Write([]byte(strings.ReplaceAll(fmt.Sprintf(format, args...), "\n", "\r\n")))
+	}
+	printf("Checking your terminal...\n\n")
+
+	start := time.Now()
+	h.channel.Write([]byte(checkQueries))
+	replies, answered := h.readReplies(cursorReport, checkTimeout)
+	rtt := time.Since(start)
+	log.Printf("Check for '%s': replies %q", client.Username, replies)
+
+	name := "unknown"
+	if t := h.terminal(); t != nil {
+		name = t.name
+	}
+	program := client.TermProgram
+	if program == "" {
+		program = "-"
+	}
+	printf("%-14s %s (TERM=%s, TERM_PROGRAM=%s)\n", "terminal", name, termType, program)
+	printf("%-14s %dx%d characters\n", "size", columns, rows)
+
+	cells := "unknown, your terminal didn't report its size in pixels; fish use 8x16 pixel cells"
+	if m := pixelReport.FindStringSubmatch(replies); m != nil {
+		height, _ := strconv.Atoi(m[1])
+		width, _ := strconv.Atoi(m[2])
+		cells = fmt.Sprintf("reported a %dx%d pixel window that doesn't fit %dx%d characters; fish use 8x16 pixel cells", width, height, columns, rows)
+		if columns > 0 && rows > 0 && saneCellSize(width/columns, height/rows) {
+			cells = fmt.Sprintf("%dx%d pixels", width/columns, height/rows)
+		}
+	}
+	printf("%-14s %s\n", "cell size", cells)
+
+	graphics := "no, fish won't show; try ACQUA_GRAPHICS=sixel or text"
+	switch m := kittyReply.FindStringSubmatch(replies); {
+	case m != nil && m[1] == "OK":
+		graphics = "yes"
+	case m != nil:
+		graphics = fmt.Sprintf("refused (%s), fish won't show", m[1])
+	case h.graphics() == aquarium.GraphicsSixel:
+		graphics = fmt.Sprintf("no, %s doesn't support them; fish are drawn with Sixel instead", name)
+	case !h.showsGraphics():
+		graphics = fmt.Sprintf("no, %s doesn't support them; fish are drawn with text instead", name)
+	}
+	printf("%-14s %s\n", "kitty graphics", graphics)
+
+	modes := make(map[string]string)
+	for _, m := range modeReply.FindAllStringSubmatch(replies, -1) {
+		modes[m[1]] = m[2]
+	}
+	printf("%-14s clicks %s, SGR reports %s\n", "mouse", modeSupport(modes["1000"]), modeSupport(modes["1006"]))
+	printf("%-14s %s\n", "sync output", modeSupport(modes["2026"]))
+
+	colors := map[aquarium.ColorDepth]string{
+		aquarium.TrueColor: "truecolor",
+		aquarium.Colors256: "256 colors",
+		aquarium.Colors16:  "16 colors",
+	}[client.ColorDepth()]
+	printf("%-14s %s, UTF-8 %s\n", "colors", colors, yesNo(client.UTF8()))
+
+	links := "no, addresses are shown instead; send ACQUA_HYPERLINKS=on if your terminal opens OSC 8 links"
+	if h.hyperlinks() {
+		links = "yes"
+	}
+	printf("%-14s %s\n", "hyperlinks", links)
+
+	latency := "no reply, your terminal doesn't answer queries"
+	if answered {
+		latency = rtt.Round(100 * time.Microsecond).String()
+	}
+	printf("%-14s %s\n", "latency", latency)
+
+	printf("\n")
+	switch {
+	case graphics != "yes":
+		printf("Fish need the Kitty graphics protocol, try kitty, WezTerm, Konsole or Ghostty.\n")
+	case !answered:
+		printf("Your terminal didn't answer in %v, the aquarium may look off.\n", checkTimeout)
+	default:
+		printf("Everything looks good, fish should show.\n")
+	}
+	return nil
+}
+
+// readReplies reads what the terminal sends back until a reply matching end
+// arrives or timeout passes. It reports whether that reply arrived. Once it
+// did, nothing more is read, so input that follows is left for the input
+// handling.
+func (h *Handler) readReplies(end *regexp.Regexp, timeout time.Duration) (string, bool) {
+	input := make(chan []byte)
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		defer close(input)
+		var read []byte
+		buf := make([]byte, 256)
+		for !end.Match(read) {
+			n, err := h.channel.Read(buf)
+			if n > 0 {
+				read = append(read, buf[:n]...)
+				select {
+				case input <- append([]byte(nil), buf[:n]...):
+				case <-stop:
+					return
+				}
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	var replies strings.Builder
+	expired := time.After(timeout)
+	for {
+		select {
+		case data, ok := <-input:
+			if !ok {
+				return replies.String(), end.MatchString(replies.String())
+			}
+			replies.Write(data)
+			if end.MatchString(replies.String()) {
+				return replies.String(), true
+			}
+		case <-expired:
+			return replies.String(), false
+		}
+	}
+}
+
+// modeSupport describes a DECRPM reply: 0 or no reply is an unknown mode,
+// 1 and 2 are set and reset, 3 and 4 permanently so.
+func modeSupport(state string) string {
+	switch state {
+	case "1", "2", "3":
+		return "yes"
+	case "4":
+		return "no"
+	}
+	return "unknown"
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
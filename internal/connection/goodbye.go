@@ -0,0 +1,166 @@
+package connection
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+	"unicode"
+
+	"github.com/acuqa/ssh-aquarium/internal/aquarium"
+	"github.com/acuqa/ssh-aquarium/internal/qrcode"
+)
+
+// plainGoodbye is printed when there is no goodbye screen.
+const plainGoodbye = "\r\nAquarium session ended.\r\n"
+
+// DefaultGoodbye is the goodbye screen unless one is configured.
+const DefaultGoodbye = `Aquarium session ended after {{.Duration}} in {{.Room}}.
+{{- if .Pops}} You popped {{.Pops}} bubbles.{{end}}
+{{- if .SessionBytes}} This session used {{size .SessionBytes}}.{{end}}
+{{if .WebURL}}
+Watch the fish on the web: {{.WebURL}}
+{{qr .WebURL}}{{end}}`
+
+// Goodbye is printed on the terminal once the aquarium is gone, a
+// text/template executed with GoodbyeData. Besides the usual functions it
+// has qr, which draws a text as a QR code, e.g. {{qr .WebURL}}, and size,
+// which shortens a number of bytes, e.g. {{size .SessionBytes}}.
+type Goodbye struct {
+	tmpl   *template.Template
+	webURL string
+}
+
+// GoodbyeData is what a goodbye screen can show.
+type GoodbyeData struct {
+	Username     string
+	Room         string
+	Duration     time.Duration // how long the session lasted, to the second
+	Pops         int           // bubbles the user popped, all time
+	FramesSent   uint64        // by the room the session ended in
+	BytesSent    uint64        // by the room the session ended in
+	SessionBytes uint64        // written to the terminal over the whole session
+	Visitors     int           // unique visitors of the aquarium
+	WebURL       string        // the aquarium's web page, empty if not configured
+}
+
+// NewGoodbye parses a goodbye screen. webURL is shown as .WebURL.
+func NewGoodbye(text, webURL string) (*Goodbye, error) {
+	tmpl, err := template.New("goodbye").Funcs(template.FuncMap{"qr": drawQR, "size": formatSize}).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	return &Goodbye{tmpl: tmpl, webURL: webURL}, nil
+}
+
+// LoadGoodbye reads a goodbye screen from a file.
+func LoadGoodbye(path, webURL string) (*Goodbye, error) {
+	text, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewGoodbye(string(text), webURL)
+}
+
+// render executes the goodbye screen with lines ending in CRLF, for the
+// terminal's restored screen. QR codes are left out on terminals without
+// UTF-8. A failing template gives the plain message.
+func (g *Goodbye) render(data GoodbyeData, utf8 bool) string {
+	data.WebURL = g.webURL
+	tmpl := g.tmpl
+	if !utf8 {
+		tmpl = template.Must(g.tmpl.Clone()).Funcs(template.FuncMap{
+			"qr": func(string) string { return "" },
+		})
+	}
+	var out strings.Builder
+	if err := tmpl.Execute(&out, data); err != nil {
+		log.Printf("Failed to render goodbye screen: %v", err)
+		return plainGoodbye
+	}
+	text := strings.TrimRight(out.String(), "\n")
+	return "\r\n" + strings.ReplaceAll(text, "\n", "\r\n") + "\r\n"
+}
+
+// goodbyeText renders the goodbye screen for the session, before it leaves
+// room.
+func (h *Handler) goodbyeText(room *aquarium.Manager, connID uint64) string {
+	if h.goodbye == nil {
+		return plainGoodbye
+	}
+	h.mu.Lock()
+	data := GoodbyeData{
+		Username:     goodbyeName(h.username),
+		Room:         h.room,
+		Duration:     time.Since(h.started).Round(time.Second),
+		Pops:         h.rooms.Pops().Count(h.username),
+		Visitors:     h.rooms.Visitors().Count(),
+		SessionBytes: h.client.SessionBytes.Load(),
+	}
+	utf8 := h.client.UTF8()
+	h.mu.Unlock()
+	if info, ok := room.Session(connID); ok {
+		data.FramesSent, data.BytesSent = info.FramesSent, info.BytesSent
+	}
+	return h.goodbye.render(data, utf8)
+}
+
+// formatSize shortens a number of bytes, in powers of 1000 like the data
+// plans of mobile carriers.
+func formatSize(bytes uint64) string {
+	switch {
+	case bytes >= 1e9:
+		return fmt.Sprintf("%.1f GB", float64(bytes)/1e9)
+	case bytes >= 1e6:
+		return fmt.Sprintf("%.1f MB", float64(bytes)/1e6)
+	case bytes >= 1e3:
+		return fmt.Sprintf("%.1f kB", float64(bytes)/1e3)
+	}
+	return fmt.Sprintf("%d bytes", bytes)
+}
+
+// drawQR draws text as a QR code with a quiet zone, two modules per
+// character cell, black on white whatever the terminal's colors.
+func drawQR(text string) (string, error) {
+	code, err := qrcode.Encode(text)
+	if err != nil {
+		return "", err
+	}
+	const quiet = 2
+	size := code.Size() + 2*quiet
+	dark := func(x, y int) bool {
+		x, y = x-quiet, y-quiet
+		return x >= 0 && y >= 0 && x < code.Size() && y < code.Size() && code.Modules[y][x]
+	}
+
+	var out strings.Builder
+	for y := 0; y < size; y += 2 {
+		for x := 0; x < size; x++ {
+			// The upper half block takes the foreground color, the lower
+			// half the background
+			fg, bg := 97, 107
+			if dark(x, y) {
+				fg = 30
+			}
+			if dark(x, y+1) {
+				bg = 40
+			}
+			fmt.Fprintf(&out, "\x1b[%d;%dm▀", fg, bg)
+		}
+		out.WriteString("\x1b[0m\n")
+	}
+	return out.String(), nil
+}
+
+// goodbyeName strips control characters from a username, which is shown
+// as it is on the restored screen.
+func goodbyeName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, name)
+}
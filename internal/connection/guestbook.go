@@ -0,0 +1,143 @@
+package connection
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const guestbookWidth = 60
+
+// handleGuestbookKey handles the 'g' guestbook overlay. It reports whether
+// the key was consumed.
+func (h *Handler) handleGuestbookKey(key byte) bool {
+	h.mu.Lock()
+	open := h.guestbookStop != nil
+	h.mu.Unlock()
+
+	switch {
+	case !open && (key == 'g' || key == 'G'):
+		h.closeRoomMenu()
+		h.closeSettingsMenu()
+		h.openGuestbook()
+		return true
+	case open && (key == 'g' || key == 'G' || key == 0x1b):
+		h.closeGuestbook()
+		return true
+	}
+	return false
+}
+
+func (h *Handler) openGuestbook() {
+	stop := make(chan struct{})
+	h.mu.Lock()
+	h.guestbookStop = stop
+	h.mu.Unlock()
+
+	h.renderGuestbook()
+
+	// Redraw periodically so new entries show up and fish frames don't
+	// leave the overlay half erased
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				h.renderGuestbook()
+			}
+		}
+	}()
+}
+
+func (h *Handler) closeGuestbook() {
+	h.mu.Lock()
+	stop := h.guestbookStop
+	h.guestbookStop = nil
+	h.mu.Unlock()
+
+	if stop == nil {
+		return
+	}
+	close(stop)
+	h.clearMenuBox(h.guestbookBounds())
+}
+
+func (h *Handler) guestbookBounds() (top, left, width, height int) {
+	h.mu.Lock()
+	columns, rows := h.termColumns, h.termRows
+	h.mu.Unlock()
+
+	width = min(guestbookWidth, columns)
+	height = max(min(rows-4, 20), 6)
+	top = max((rows-height)/2, 1)
+	left = max((columns-width)/2, 1)
+	return top, left, width, height
+}
+
+func (h *Handler) renderGuestbook() {
+	top, left, width, height := h.guestbookBounds()
+
+	// Newest first, each message wrapped under its signer's name
+	lines := []string{"Guestbook", ""}
+	footer := []string{"ssh ... sign <message>   g/esc close", ""}
+	if h.webURL != "" {
+		web := strings.TrimSuffix(h.webURL, "/") + "/#guestbook"
+		footer = append([]string{h.link(web, "Read and sign it on the web")}, footer...)
+	}
+	room := height - len(lines) - len(footer) - 1
+	entries := h.rooms.Guestbook().Entries()
+	for _, entry := range entries {
+		wrapped := wrapText(entry.Message, width-4)
+		if len(wrapped)+1 > room {
+			break
+		}
+		lines = append(lines, fmt.Sprintf("%s, %s", entry.Name, entry.SignedAt.Format("Jan 2")))
+		for _, line := range wrapped {
+			lines = append(lines, "  "+line)
+		}
+		room -= len(wrapped) + 1
+	}
+	if len(entries) == 0 {
+		lines = append(lines, "Nobody signed yet.")
+	}
+	for len(lines) < height-len(footer) {
+		lines = append(lines, "")
+	}
+	lines = append(lines, footer...)
+
+	h.write([]byte(menuBox(top, left, width, lines)))
+}
+
+// wrapText breaks text into lines of at most width runes, between words
+// where possible.
+func wrapText(text string, width int) []string {
+	var lines []string
+	line := []rune{}
+	for _, word := range strings.Fields(text) {
+		runes := []rune(word)
+		for len(runes) > width {
+			if len(line) > 0 {
+				lines = append(lines, string(line))
+				line = line[:0]
+			}
+			lines = append(lines, string(runes[:width]))
+			runes = runes[width:]
+		}
+		switch {
+		case len(line) == 0:
+			line = append(line, runes...)
+		case len(line)+1+len(runes) <= width:
+			line = append(append(line, ' '), runes...)
+		default:
+			lines = append(lines, string(line))
+			line = append(line[:0:0], runes...)
+		}
+	}
+	if len(line) > 0 {
+		lines = append(lines, string(line))
+	}
+	return lines
+}
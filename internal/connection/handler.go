@@ -1,24 +1,32 @@
 package connection
 
 import (
-	"encoding/base64"
 	"fmt"
 	"io"
 	"log"
-	"os"
-	"regexp"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/acuqa/ssh-aquarium/internal/aquarium"
+	"github.com/acuqa/ssh-aquarium/internal/metrics"
 	"golang.org/x/crypto/ssh"
 )
 
 type Handler struct {
 	channel     ssh.Channel
+	rooms       *aquarium.Registry
+	room        string
 	aquarium    *aquarium.Manager
+	stream      *streamWrapper
 	connID      uint64
 	username    string
+	client      aquarium.ClientInfo
+	caps        *CapabilityCache
+	goodbye     *Goodbye // printed once the session ended, nil for the plain message
+	webURL      string   // the aquarium's web page, linked from overlays
+	linkChoice  string   // ACQUA_HYPERLINKS, on or off, empty to go by the terminal
 	termType    string
 	termColumns int
 	termRows    int
@@ -26,33 +34,99 @@ type Handler struct {
 	cellHeight  int
 	mu          sync.Mutex
 	running     bool
+	started     time.Time // when the session started
 	done        chan struct{}
+	uploaded    bool
+	pingSent    time.Time // pending latency probe
+	pixelReports bool     // the terminal answered a query for its size in pixels
+	menuStop    chan struct{} // non-nil while the room menu is open
+	menuNote    string        // shown in the room menu instead of its keys
+	passphrase  *passphrasePrompt // non-nil while asking for a room's passphrase
+	unlocked    map[string]bool   // rooms whose passphrase was typed this session
+	chat        *chatLine         // non-nil while typing a chat message
+	settingsMenu *settingsMenu // non-nil while the settings menu is open
+	split       *splitView    // non-nil while a second room is shown alongside
+	guestbookStop chan struct{} // non-nil while the guestbook is open
+	termVars    map[string]bool // environment variables naming the terminal, e.g. KONSOLE_VERSION
+	writeMu     sync.Mutex    // keeps frames of rooms sharing the terminal apart
 }
 
 type streamWrapper struct {
 	channel ssh.Channel
+	mu      *sync.Mutex                       // shared by streams to the same terminal
+	view    atomic.Pointer[aquarium.Viewport] // set while sharing the terminal in a split view
 }
 
 func (s *streamWrapper) Write(data []byte) error {
+	if view := s.view.Load(); view != nil {
+		data = view.Apply(data)
+	}
+	s.mu.Lock()
 	_, err := s.channel.Write(data)
+	s.mu.Unlock()
+	if err != nil {
+		metrics.WriteErrors.Inc()
+	}
 	return err
 }
 
+// write sends data to the terminal outside of any room's frames, e.g. a
+// menu. Frames are written under the same lock, so the two never mix.
+func (h *Handler) write(data []byte) {
+	h.writeMu.Lock()
+	defer h.writeMu.Unlock()
+	h.channel.Write(data)
+}
+
 func (s *streamWrapper) Close() error {
 	return s.channel.Close()
 }
 
-func New(channel ssh.Channel, aquarium *aquarium.Manager, username string) *Handler {
-	return &Handler{
+// countingChannel counts the bytes written to the terminal, for the
+// session's bandwidth report.
+type countingChannel struct {
+	ssh.Channel
+	sent *atomic.Uint64
+}
+
+func (c countingChannel) Write(data []byte) (int, error) {
+	n, err := c.Channel.Write(data)
+	c.sent.Add(uint64(n))
+	return n, err
+}
+
+func New(channel ssh.Channel, rooms *aquarium.Registry, client aquarium.ClientInfo, caps *CapabilityCache) *Handler {
+	// Everything this session writes is counted, whichever room it is in
+	client.SessionBytes = new(atomic.Uint64)
+	channel = countingChannel{Channel: channel, sent: client.SessionBytes}
+	h := &Handler{
 		channel:     channel,
-		aquarium:    aquarium,
-		username:    username,
+		rooms:       rooms,
+		caps:        caps,
+		room:        rooms.DefaultName(),
+		aquarium:    rooms.Default(),
+		username:    client.Username,
+		client:      client,
 		termColumns: 80,
 		termRows:    24,
 		cellWidth:   8,  // default
 		cellHeight:  16, // default
 		done:        make(chan struct{}),
 	}
+	h.loadSettings()
+	return h
+}
+
+// SetGoodbye sets the screen printed when the session ends. It must be
+// called before Start.
+func (h *Handler) SetGoodbye(goodbye *Goodbye) {
+	h.goodbye = goodbye
+}
+
+// SetWebURL sets the aquarium's web page, linked from overlays. It must be
+// called before Start.
+func (h *Handler) SetWebURL(address string) {
+	h.webURL = address
 }
 
 func (h *Handler) ID() uint64 {
@@ -64,18 +138,54 @@ func (h *Handler) SetTerminal(termType string, columns, rows uint32) {
 	defer h.mu.Unlock()
 	
 	h.termType = termType
+	h.client.Term = termType
 	h.termColumns = int(columns)
 	h.termRows = int(rows)
 }
 
 func (h *Handler) Resize(columns, rows uint32) {
 	h.mu.Lock()
-	defer h.mu.Unlock()
-	
+	resized := h.termColumns != int(columns) || h.termRows != int(rows)
 	h.termColumns = int(columns)
 	h.termRows = int(rows)
+	running := h.running
+	h.mu.Unlock()
+	
+	if !running {
+		return
+	}
+	
+	// Resizing wipes or reflows the screen, redraw everything for the new
+	// size right away with the cell size we know. A split view is laid out
+	// for the old size, go back to a single tank.
+	if resized {
+		h.closeSplit()
+		h.applyTerminalSize()
+	}
 	
-	// TODO: Update aquarium terminal config
+	// The font may have changed with the window, or only the pixels per
+	// cell when it moved to a monitor with another DPI; ask for its size
+	// in pixels again, handlePixelReports applies a new cell size
+	if t := h.terminal(); t == nil || !t.quirks.noPixelReports {
+		h.write([]byte("\x1b[14t"))
+	}
+}
+
+// applyTerminalSize tells the room this terminal's current size.
+func (h *Handler) applyTerminalSize() {
+	h.mu.Lock()
+	room, connID := h.aquarium, h.connID
+	config := &aquarium.TerminalConfig{
+		Columns:    h.termColumns,
+		Rows:       h.termRows,
+		CellWidth:  h.cellWidth,
+		CellHeight: h.cellHeight,
+	}
+	h.mu.Unlock()
+	
+	log.Printf("Connection %d: terminal is now %dx%d chars, %dx%d pixels per cell",
+		connID, config.Columns, config.Rows, config.CellWidth, config.CellHeight)
+	room.ResizeConnection(connID, config)
 }
 
 func (h *Handler) Start() {
@@ -85,22 +195,39 @@ func (h *Handler) Start() {
 		return
 	}
 	h.running = true
+	h.started = time.Now()
 	h.mu.Unlock()
 	
+	// Setup terminal
+	h.setupTerminal()
+	h.showSplash("detecting terminal")
+	
+	// Detect terminal cell size and capabilities (must be done before input
+	// handling, which would take the replies)
+	h.detectTerminal()
+	
 	// Add connection to aquarium
-	stream := &streamWrapper{channel: h.channel}
-	h.connID = h.aquarium.AddConnection(stream, h.username)
+	graphics, hyperlinks := h.graphics(), h.hyperlinks()
+	h.mu.Lock()
+	h.client.Graphics = graphics
+	h.client.Hyperlinks = hyperlinks
+	h.mu.Unlock()
+	h.stream = &streamWrapper{channel: h.channel, mu: &h.writeMu}
+	h.connID = h.aquarium.AddConnection(h.stream, h.client)
 	
 	log.Printf("Connection %d: Starting session", h.connID)
+	h.rooms.Welcome(h.room, h.client)
 	
-	// Setup terminal
-	h.setupTerminal()
+	if t := h.terminal(); t != nil {
+		log.Printf("Connection %d: terminal is %s", h.connID, t.name)
+	}
 	
-	// Detect terminal cell size and init (must be done before input handling)
-	h.detectTerminalAndInit()
+	h.initializeAquarium()
 	
 	// Handle input
 	go h.handleInput()
+	go h.measureLatency()
+	go h.recheckCellSize()
 }
 
 func (h *Handler) Close() {
@@ -113,113 +240,133 @@ func (h *Handler) Close() {
 	h.mu.Unlock()
 	
 	close(h.done)
+	h.closeRoomMenu()
+	h.closeSettingsMenu()
+	h.closeGuestbook()
+	h.closePassphrasePrompt()
+	h.closeChat()
+	h.closeSplit()
 	
-	// Remove connection from aquarium
-	h.aquarium.RemoveConnection(h.connID)
+	// Remove connection from aquarium, with its numbers for the goodbye
+	h.mu.Lock()
+	room, connID, roomName := h.aquarium, h.connID, h.room
+	h.mu.Unlock()
+	goodbye := h.goodbyeText(room, connID)
+	if info, ok := room.Session(connID); ok {
+		h.rooms.History().Record(roomName, info, time.Now())
+	}
+	room.RemoveConnection(connID)
 	
-	// Cleanup terminal
-	h.cleanupTerminal()
+	// Cleanup terminal before anything else so the restore sequences are
+	// flushed while the client is still reading
+	h.cleanupTerminal(goodbye)
 	
-	// Send exit status and close channel to properly terminate SSH session
+	// Clients expect exit-status, then EOF, then close. Closing without
+	// EOF makes some of them drop buffered output and garble the prompt.
 	h.channel.SendRequest("exit-status", false, []byte{0, 0, 0, 0}) // Exit code 0
+	h.channel.CloseWrite()
 	h.channel.Close()
 }
 
 func (h *Handler) setupTerminal() {
+	// Switch to the alternate screen so the user's scrollback survives
+	h.write([]byte("\x1b[?1049h"))
 	// Hide cursor
-	h.channel.Write([]byte("\x1b[?25l"))
+	h.write([]byte("\x1b[?25l"))
 	// Enable mouse click reporting
-	h.channel.Write([]byte("\x1b[?1000h"))
+	h.write([]byte("\x1b[?1000h"))
 	// Enable mouse drag reporting
-	h.channel.Write([]byte("\x1b[?1002h"))
+	h.write([]byte("\x1b[?1002h"))
+	// Ask for SGR mouse reports, which reach past column 223
+	h.write([]byte("\x1b[?1006h"))
 	// Clear screen
-	h.channel.Write([]byte("\x1b[2J"))
+	h.write([]byte("\x1b[2J"))
 }
 
-func (h *Handler) cleanupTerminal() {
-	// Disable mouse reporting
-	h.channel.Write([]byte("\x1b[?1000l"))
-	h.channel.Write([]byte("\x1b[?1002l"))
-	// Show cursor
-	h.channel.Write([]byte("\x1b[?25h"))
-	// Clear screen
-	h.channel.Write([]byte("\x1b[2J"))
-	// Final message
-	h.channel.Write([]byte("\r\nAquarium session ended.\r\n"))
+func (h *Handler) cleanupTerminal(goodbye string) {
+	// Build a single write so nothing can interleave with the restore
+	restore := "" +
+		// Delete all images and placements
+		"\x1b_Ga=d,d=A,q=1\x1b\\" +
+		// Disable mouse reporting
+		"\x1b[?1006l\x1b[?1002l\x1b[?1000l" +
+		// Reset colors, clear and leave the alternate screen
+		"\x1b[0m\x1b[2J\x1b[?1049l" +
+		// Show cursor
+		"\x1b[?25h" +
+		// Final message on the restored screen
+		goodbye
+	h.write([]byte(restore))
 }
 
-func (h *Handler) detectTerminalAndInit() {
-	log.Printf("Starting terminal detection for connection %d (cols=%d, rows=%d)", h.connID, h.termColumns, h.termRows)
-	
-	// Query terminal size in pixels
-	h.channel.Write([]byte("\x1b[14t"))
+// detectTerminal probes the terminal for its cell size and what it
+// supports, before the session joins a room, so its fish are drawn with
+// what it answered.
+func (h *Handler) detectTerminal() {
+	// Returning terminals skip detection and its timeout
+	if h.useCachedCapabilities() {
+		return
+	}
 	
-	// Try to read response with timeout
-	responseChan := make(chan []int, 1)
-	go func() {
-		dims := h.readTerminalResponse()
-		responseChan <- dims
-	}()
+	h.mu.Lock()
+	username, columns, rows := h.username, h.termColumns, h.termRows
+	h.mu.Unlock()
+	log.Printf("Starting terminal detection for '%s' (cols=%d, rows=%d)", username, columns, rows)
 	
-	select {
-	case dims := <-responseChan:
-		if len(dims) == 2 {
-			pixelWidth := dims[0]
-			pixelHeight := dims[1]
-			
-			h.mu.Lock()
-			if h.termColumns > 0 && h.termRows > 0 {
-				h.cellWidth = pixelWidth / h.termColumns
-				h.cellHeight = pixelHeight / h.termRows
-			}
-			h.mu.Unlock()
-			
-			log.Printf("Terminal detection successful:")
-			log.Printf("  Terminal: %dx%d characters", h.termColumns, h.termRows)
-			log.Printf("  Window: %dx%d pixels", pixelWidth, pixelHeight)
-			log.Printf("  Cell size: %dx%d pixels", h.cellWidth, h.cellHeight)
-		}
-	case <-time.After(2 * time.Second):
+	// Terminals known to stay silent aren't asked for their size
+	queries := probeQueries
+	if t := h.terminal(); t != nil && t.quirks.noPixelReports {
+		log.Printf("User '%s': %s doesn't report its size in pixels, using default cell size %dx%d",
+			username, t.name, h.cellWidth, h.cellHeight)
+	} else {
+		queries = "\x1b[14t" + queries
+	}
+	h.write([]byte(queries))
+	replies, answered := h.readReplies(deviceAttributes, probeTimeout)
+	if !answered {
 		log.Printf("Terminal detection timeout, using default cell size: %dx%d", h.cellWidth, h.cellHeight)
 	}
 	
-	// Initialize aquarium
-	h.initializeAquarium()
-}
-
-func (h *Handler) readTerminalResponse() []int {
-	buf := make([]byte, 1024)
-	responseBuffer := ""
+	caps := parseProbe(replies)
+	h.mu.Lock()
+	h.client.Caps = caps
+	h.mu.Unlock()
+	log.Printf("User '%s': terminal probe answered=%v kitty=%v sixel=%v truecolor=%v sgr_mouse=%v sync_output=%v",
+		username, caps.Probed, caps.Kitty, caps.Sixel, caps.TrueColor, caps.SGRMouse, caps.SyncOutput)
 	
-	for {
-		n, err := h.channel.Read(buf)
-		if err != nil {
-			if err != io.EOF {
-				log.Printf("Terminal response read error: %v", err)
-			}
-			return nil
-		}
-		
-		responseBuffer += string(buf[:n])
-		log.Printf("Terminal response buffer: %q", responseBuffer)
-		
-		// Look for terminal size response: ESC[4;height;widtht
-		re := regexp.MustCompile(`\x1b\[4;(\d+);(\d+)t`)
-		if matches := re.FindStringSubmatch(responseBuffer); matches != nil {
-			pixelHeight := 0
-			pixelWidth := 0
-			fmt.Sscanf(matches[1], "%d", &pixelHeight)
-			fmt.Sscanf(matches[2], "%d", &pixelWidth)
-			
-			log.Printf("Detected terminal size: %dx%d pixels", pixelWidth, pixelHeight)
-			return []int{pixelWidth, pixelHeight}
-		}
-		
-		// Prevent buffer from growing too large
-		if len(responseBuffer) > 100 {
-			return nil
-		}
+	m := pixelReport.FindStringSubmatch(replies)
+	if m == nil {
+		h.rememberCapabilities(false)
+		return
 	}
+	pixelHeight, _ := strconv.Atoi(m[1])
+	pixelWidth, _ := strconv.Atoi(m[2])
+	
+	h.mu.Lock()
+	cellWidth, cellHeight := 0, 0
+	if columns > 0 && rows > 0 {
+		cellWidth, cellHeight = pixelWidth/columns, pixelHeight/rows
+	}
+	sane := saneCellSize(cellWidth, cellHeight)
+	if sane {
+		h.cellWidth, h.cellHeight = cellWidth, cellHeight
+		h.pixelReports = true
+	}
+	h.mu.Unlock()
+	
+	// Zeros, or a window measured with its padding, would give the tank
+	// garbage geometry. Try again next session.
+	if !sane {
+		log.Printf("User '%s': terminal reported a %dx%d pixel window for %dx%d characters (%dx%d pixel cells), using default cell size %dx%d",
+			username, pixelWidth, pixelHeight, columns, rows, cellWidth, cellHeight, h.cellWidth, h.cellHeight)
+		return
+	}
+	
+	log.Printf("Terminal detection successful:")
+	log.Printf("  Terminal: %dx%d characters", columns, rows)
+	log.Printf("  Window: %dx%d pixels", pixelWidth, pixelHeight)
+	log.Printf("  Cell size: %dx%d pixels", cellWidth, cellHeight)
+	h.rememberCapabilities(true)
 }
 
 func (h *Handler) initializeAquarium() {
@@ -243,9 +390,32 @@ func (h *Handler) initializeAquarium() {
 	} else {
 		log.Printf("Additional connection - using existing aquarium config")
 	}
+	// Terminals of another size see the tank stretched onto theirs
+	h.aquarium.SetConnectionTerminal(h.connID, config)
+	
+	// Upload fish images once per terminal, they survive room switches.
+	// Terminals without Kitty graphics can't show them anyway: those
+	// showing Sixel are sent the pixels with every fish drawn, the others
+	// see fish drawn with characters.
+	if !h.uploaded {
+		switch h.client.Graphics {
+		case aquarium.GraphicsSixel:
+			log.Printf("Connection %d: drawing fish with Sixel", h.connID)
+			if err := LoadSpriteImages(); err != nil {
+				log.Printf("Warning: %v", err)
+			}
+		case aquarium.GraphicsText:
+			log.Printf("Connection %d: terminal shows no images, drawing fish with text", h.connID)
+		default:
+			h.uploadImages()
+		}
+		h.uploaded = true
+	}
 	
-	// Upload fish images
-	h.uploadImages()
+	// Paint the whole scene for the new client with the next frame, the
+	// others keep their tank as it is
+	h.clearSplash()
+	h.aquarium.Refresh(h.connID)
 	
 	// Add fish for this connection
 	fishAdded := h.aquarium.AddFish(h.connID, 1)
@@ -254,43 +424,20 @@ func (h *Handler) initializeAquarium() {
 }
 
 func (h *Handler) uploadImages() {
-	// Upload left-facing fish
-	if data, err := os.ReadFile("fish.png"); err == nil {
-		h.uploadImage(data, 1)
-	} else {
-		log.Printf("Warning: Could not load fish.png: %v", err)
-	}
-	
-	// Upload right-facing fish (or use left if not available)
-	if data, err := os.ReadFile("fish-right.png"); err == nil {
-		h.uploadImage(data, 2)
-	} else if data, err := os.ReadFile("fish.png"); err == nil {
-		h.uploadImage(data, 2)
-	}
-	
-}
-
-func (h *Handler) uploadImage(data []byte, imageID int) {
-	base64Data := base64.StdEncoding.EncodeToString(data)
-	chunkSize := 4096
-	
-	for i := 0; i < len(base64Data); i += chunkSize {
-		chunk := base64Data[i:min(i+chunkSize, len(base64Data))]
-		isFirst := i == 0
-		hasMore := i+chunkSize < len(base64Data)
-		
-		var command string
-		if isFirst {
-			command = fmt.Sprintf("a=t,f=100,i=%d,m=%d,q=1", imageID, btoi(hasMore))
-		} else {
-			command = fmt.Sprintf("m=%d", btoi(hasMore))
-		}
-		
-		h.channel.Write([]byte(fmt.Sprintf("\x1b_G%s;%s\x1b\\", command, chunk)))
-	}
+	UploadSprites(h.channel, func(done, total int) {
+		h.showSplash(fmt.Sprintf("%d/%d sprites", done+1, total))
+	})
 }
 
 func (h *Handler) handleInput() {
+	// A panic on odd input ends this session, not the server, and the
+	// session is closed like any other so it leaves its room
+	defer func() {
+		if v := recover(); v != nil {
+			metrics.Recovered("input handling", v)
+		}
+		h.Close()
+	}()
 	buf := make([]byte, 256)
 	
 	for {
@@ -315,6 +462,13 @@ func (h *Handler) handleInput() {
 }
 
 func (h *Handler) processInput(data []byte) {
+	// Latency probe and size replies can arrive mixed with other input
+	data = h.handleCursorReports(data)
+	data = h.handlePixelReports(data)
+	if len(data) == 0 {
+		return
+	}
+	
 	// Handle Ctrl+C
 	if len(data) == 1 && data[0] == 0x03 {
 		log.Printf("Connection %d: Ctrl+C detected, closing", h.connID)
@@ -329,6 +483,18 @@ func (h *Handler) processInput(data []byte) {
 		return
 	}
 	
+	// The passphrase prompt, a chat message being typed and the settings
+	// menu take all other keys while open
+	if h.handlePassphrase(data) {
+		return
+	}
+	if h.handleChat(data) {
+		return
+	}
+	if h.handleSettingsMenu(data) {
+		return
+	}
+	
 	// Handle 'q' to quit
 	if len(data) == 1 && (data[0] == 'q' || data[0] == 'Q') {
 		log.Printf("Connection %d: 'q' detected, closing", h.connID)
@@ -336,13 +502,67 @@ func (h *Handler) processInput(data []byte) {
 		return
 	}
 	
-	// Handle mouse events (ESC[M...)
-	if len(data) >= 6 && data[0] == 0x1b && data[1] == '[' && data[2] == 'M' {
-		button := int(data[3]) - 32
-		col := int(data[4]) - 32
-		row := int(data[5]) - 32
-		
-		h.aquarium.HandleMouseClick(h.connID, button, col, row)
+	// Room menu keys
+	if len(data) == 1 && h.handleRoomKey(data[0]) {
+		return
+	}
+	
+	// Guestbook keys
+	if len(data) == 1 && h.handleGuestbookKey(data[0]) {
+		return
+	}
+	
+	// Admin keys
+	if len(data) == 1 && h.handleAdminKey(data[0]) {
+		return
+	}
+	
+	// Settings keys
+	if len(data) == 1 && h.handleSettingsKey(data[0]) {
+		return
+	}
+	
+	// Handle 's' to show the next room alongside on wide terminals
+	if len(data) == 1 && (data[0] == 's' || data[0] == 'S') {
+		h.toggleSplit()
+		return
+	}
+	
+	// Handle 'p' for photo mode
+	if len(data) == 1 && (data[0] == 'p' || data[0] == 'P') {
+		room, connID := h.focused()
+		room.StartPhotoMode(connID)
+		return
+	}
+	
+	// Handle 'f' to feed the fish
+	if len(data) == 1 && (data[0] == 'f' || data[0] == 'F') {
+		room, connID := h.focused()
+		room.Feed(connID)
+		return
+	}
+	
+	// Handle '1' to '3' for emotes above the user's fish
+	if len(data) == 1 && data[0] >= '1' && int(data[0]-'1') < len(aquarium.Emotes) {
+		room, connID := h.focused()
+		room.ShowEmote(connID, aquarium.Emotes[data[0]-'1'])
+		return
+	}
+	
+	// Handle Enter to type a message shown above the user's fish
+	if len(data) == 1 && (data[0] == '\r' || data[0] == '\n') {
+		h.openChat()
+		return
+	}
+	
+	// Handle mouse events, a drag can report several in one read
+	for len(data) > 0 {
+		event, size := parseMouse(data)
+		if size == 0 {
+			break
+		}
+		h.handleClick(event.button, event.col, event.row)
+		data = data[size:]
 	}
 }
 
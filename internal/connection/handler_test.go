@@ -0,0 +1,69 @@
+package connection
+
+import (
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/acuqa/ssh-aquarium/internal/aquarium"
+	"golang.org/x/crypto/ssh"
+)
+
+// panickyChannel answers terminal detection, then panics on the next read.
+type panickyChannel struct {
+	mu     sync.Mutex
+	reads  int
+	closed chan struct{}
+}
+
+var _ ssh.Channel = (*panickyChannel)(nil)
+
+func (c *panickyChannel) Read(p []byte) (int, error) {
+	c.mu.Lock()
+	c.reads++
+	first := c.reads == 1
+	c.mu.Unlock()
+	if !first {
+		panic("odd input")
+	}
+	return copy(p, "\x1b[4;384;640t\x1b[?62;4c"), nil
+}
+
+func (c *panickyChannel) Write(data []byte) (int, error) { return len(data), nil }
+
+func (c *panickyChannel) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	select {
+	case <-c.closed:
+	default:
+		close(c.closed)
+	}
+	return nil
+}
+
+func (c *panickyChannel) CloseWrite() error { return nil }
+
+func (c *panickyChannel) SendRequest(string, bool, []byte) (bool, error) { return false, nil }
+
+func (c *panickyChannel) Stderr() io.ReadWriter { return nil }
+
+func TestPanicInInputHandlingLeavesRoom(t *testing.T) {
+	rooms := aquarium.NewRegistry([]string{"lobby"})
+	defer rooms.Stop()
+
+	ch := &panickyChannel{closed: make(chan struct{})}
+	h := New(ch, rooms, aquarium.ClientInfo{Username: "nemo"}, nil)
+	h.SetTerminal("xterm-kitty", 80, 24)
+	h.Start()
+
+	select {
+	case <-ch.closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("session still open after input handling panicked")
+	}
+	if n := rooms.Default().GetConnectionCount(); n != 0 {
+		t.Errorf("room has %d connections after input handling panicked, want 0", n)
+	}
+}
@@ -0,0 +1,56 @@
+package connection
+
+import (
+	"log"
+	"regexp"
+	"time"
+)
+
+// latencyInterval is how often the round-trip time to the client is probed.
+const latencyInterval = 5 * time.Second
+
+// cursorReport matches the reply to a DSR cursor position request.
+var cursorReport = regexp.MustCompile(`\x1b\[\d+;\d+R`)
+
+// measureLatency periodically sends a cursor position request. The reply
+// is picked up by processInput and timed against the request.
+func (h *Handler) measureLatency() {
+	ticker := time.NewTicker(latencyInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-h.done:
+			return
+		case <-ticker.C:
+			h.mu.Lock()
+			h.pingSent = time.Now()
+			h.mu.Unlock()
+			h.write([]byte("\x1b[6n"))
+		}
+	}
+}
+
+// handleCursorReports records the round-trip time for every cursor
+// position report in data and returns the remaining input.
+func (h *Handler) handleCursorReports(data []byte) []byte {
+	if !cursorReport.Match(data) {
+		return data
+	}
+
+	h.mu.Lock()
+	sent := h.pingSent
+	h.pingSent = time.Time{}
+	room, connID := h.aquarium, h.connID
+	h.mu.Unlock()
+
+	if !sent.IsZero() {
+		rtt := time.Since(sent)
+		latency := room.RecordLatency(connID, rtt)
+		if room.DebugMode() {
+			log.Printf("Connection %d: round trip %v (smoothed %v)", connID, rtt, latency)
+		}
+	}
+
+	return cursorReport.ReplaceAll(data, nil)
+}
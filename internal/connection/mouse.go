@@ -0,0 +1,63 @@
+package connection
+
+import (
+	"regexp"
+	"strconv"
+
+	"github.com/acuqa/ssh-aquarium/internal/aquarium"
+)
+
+const (
+	// mouseRelease is the button X10 reports for a release. SGR reports
+	// say which button was released, they are mapped to it.
+	mouseRelease = 3
+
+	// mouseDrag is added to the button of a mouse event reported while it
+	// moves with the button held.
+	mouseDrag = 32
+)
+
+// sgrMouse matches an SGR (mode 1006) mouse report: button, column and row
+// spelled out, ending in M for a press or drag and m for a release.
+var sgrMouse = regexp.MustCompile(`^\x1b\[<(\d{1,5});(\d{1,5});(\d{1,5})([Mm])`)
+
+// mouseEvent is a click, drag or release reported by the terminal.
+type mouseEvent struct {
+	button, col, row int
+}
+
+// parseMouse splits the mouse report at the start of data off the input,
+// returning its size or 0 if data doesn't start with a whole one. Terminals
+// that know SGR reports send them once asked; the others keep to X10,
+// which adds 32 to each number in a single byte and so can't report past
+// column 223.
+func parseMouse(data []byte) (event mouseEvent, size int) {
+	if len(data) >= 6 && data[0] == 0x1b && data[1] == '[' && data[2] == 'M' {
+		return mouseEvent{button: int(data[3]) - 32, col: int(data[4]) - 32, row: int(data[5]) - 32}, 6
+	}
+	m := sgrMouse.FindSubmatch(data)
+	if m == nil {
+		return mouseEvent{}, 0
+	}
+	// At most five digits, these can't fail
+	button, _ := strconv.Atoi(string(m[1]))
+	col, _ := strconv.Atoi(string(m[2]))
+	row, _ := strconv.Atoi(string(m[3]))
+	if m[4][0] == 'm' {
+		button = button&^3 | mouseRelease
+	}
+	return mouseEvent{button: button, col: col, row: row}, len(m[0])
+}
+
+// sendMouse passes a mouse event on to a room: moves with the left button
+// held and releases as drags, anything else as a click.
+func sendMouse(room *aquarium.Manager, connID uint64, button, col, row int) {
+	switch {
+	case button == mouseDrag:
+		room.HandleMouseDrag(connID, col, row, false)
+	case button&^mouseDrag == mouseRelease:
+		room.HandleMouseDrag(connID, col, row, true)
+	default:
+		room.HandleMouseClick(connID, button, col, row)
+	}
+}
@@ -0,0 +1,62 @@
+package connection
+
+import (
+	"encoding/hex"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/acuqa/ssh-aquarium/internal/aquarium"
+)
+
+// probeTimeout is how long terminal detection waits for replies.
+const probeTimeout = 2 * time.Second
+
+// probeQueries asks whether a tiny Kitty graphics image would be accepted,
+// whether SGR mouse reports and synchronized output can be switched on, and
+// with XTGETTCAP whether the terminal does truecolor. Primary device attributes come last: every
+// terminal answers them, and in order, so their reply ends the wait, and it
+// lists Sixel graphics among the features.
+const probeQueries = "\x1b_Gi=31,s=1,v=1,a=q,t=d,f=24;AAAA\x1b\\" +
+	"\x1b[?1006$p\x1b[?2026$p" +
+	"\x1bP+q524742\x1b\\\x1bP+q5463\x1b\\" + // RGB, Tc
+	"\x1b[c"
+
+var (
+	deviceAttributes = regexp.MustCompile(`\x1b\[\?([\d;]*)c`)
+	capabilityReply  = regexp.MustCompile(`\x1bP1\+r([0-9A-Fa-f]+)`)
+)
+
+// sixelFeature is the feature number of Sixel graphics in primary device
+// attributes.
+const sixelFeature = "4"
+
+// parseProbe reads what the terminal answered to probeQueries.
+func parseProbe(replies string) aquarium.TerminalCaps {
+	var caps aquarium.TerminalCaps
+	if m := deviceAttributes.FindStringSubmatch(replies); m != nil {
+		caps.Probed = true
+		for _, feature := range strings.Split(m[1], ";") {
+			caps.Sixel = caps.Sixel || feature == sixelFeature
+		}
+	}
+	if m := kittyReply.FindStringSubmatch(replies); m != nil {
+		caps.Kitty = m[1] == "OK"
+	}
+	for _, m := range modeReply.FindAllStringSubmatch(replies, -1) {
+		switch m[1] {
+		case "1006":
+			caps.SGRMouse = modeSupport(m[2]) == "yes"
+		case "2026":
+			caps.SyncOutput = modeSupport(m[2]) == "yes"
+		}
+	}
+	for _, m := range capabilityReply.FindAllStringSubmatch(replies, -1) {
+		name, _ := hex.DecodeString(m[1])
+		switch string(name) {
+		case "RGB", "Tc":
+			caps.TrueColor = true
+		}
+	}
+	return caps
+}
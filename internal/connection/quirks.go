@@ -0,0 +1,211 @@
+package connection
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/acuqa/ssh-aquarium/internal/aquarium"
+)
+
+// quirks are known rendering problems of a terminal. They are picked from
+// what the client tells about itself before probing, since probing can't
+// detect a terminal that stays silent except by waiting for it.
+type quirks struct {
+	noPixelReports  bool // doesn't answer CSI 14t, so don't wait for it
+	noKittyGraphics bool // ignores Kitty graphics, so don't upload the sprites
+	sixel           bool // shows Sixel images, used for fish without Kitty graphics
+	hyperlinks      bool // opens OSC 8 links on click
+}
+
+// terminalProfile is a terminal emulator, or the SSH client it is known by,
+// with its quirks.
+type terminalProfile struct {
+	name   string
+	quirks quirks
+	match  func(client aquarium.ClientInfo, vars map[string]bool) bool
+}
+
+// terminalProfiles are checked in order; the first that matches is used.
+// Terminals are recognized by TERM_PROGRAM, TERM or variables only they set,
+// before the SSH client they run, since the terminal knows better.
+var terminalProfiles = []terminalProfile{
+	{"kitty", quirks{hyperlinks: true}, func(c aquarium.ClientInfo, vars map[string]bool) bool {
+		return c.Term == "xterm-kitty" || c.TermProgram == "kitty" || vars["KITTY_WINDOW_ID"]
+	}},
+	{"WezTerm", quirks{hyperlinks: true}, func(c aquarium.ClientInfo, vars map[string]bool) bool {
+		return c.TermProgram == "WezTerm" || c.Term == "wezterm"
+	}},
+	{"iTerm2", quirks{noKittyGraphics: true, sixel: true, hyperlinks: true}, func(c aquarium.ClientInfo, vars map[string]bool) bool {
+		return c.TermProgram == "iTerm.app" || vars["ITERM_SESSION_ID"]
+	}},
+	{"foot", quirks{noKittyGraphics: true, sixel: true, hyperlinks: true}, func(c aquarium.ClientInfo, vars map[string]bool) bool {
+		return c.Term == "foot" || strings.HasPrefix(c.Term, "foot-")
+	}},
+	{"Konsole", quirks{hyperlinks: true}, func(c aquarium.ClientInfo, vars map[string]bool) bool {
+		return vars["KONSOLE_VERSION"]
+	}},
+	{"Windows Terminal", quirks{noKittyGraphics: true, sixel: true, hyperlinks: true}, func(c aquarium.ClientInfo, vars map[string]bool) bool {
+		return vars["WT_SESSION"]
+	}},
+	{"xterm", quirks{noKittyGraphics: true, sixel: true}, func(c aquarium.ClientInfo, vars map[string]bool) bool {
+		return vars["XTERM_VERSION"]
+	}},
+	{"mlterm", quirks{noKittyGraphics: true, sixel: true}, func(c aquarium.ClientInfo, vars map[string]bool) bool {
+		return c.Term == "mlterm" || vars["MLTERM"]
+	}},
+	{"Terminal.app", quirks{noKittyGraphics: true}, func(c aquarium.ClientInfo, vars map[string]bool) bool {
+		return c.TermProgram == "Apple_Terminal"
+	}},
+	{"GNOME Terminal", quirks{noKittyGraphics: true, hyperlinks: true}, func(c aquarium.ClientInfo, vars map[string]bool) bool {
+		return vars["VTE_VERSION"] // and other terminals built on VTE
+	}},
+	{"Linux console", quirks{noPixelReports: true, noKittyGraphics: true}, func(c aquarium.ClientInfo, vars map[string]bool) bool {
+		return c.Term == "linux"
+	}},
+	{"VS Code", quirks{noPixelReports: true, hyperlinks: true}, func(c aquarium.ClientInfo, vars map[string]bool) bool {
+		return c.TermProgram == "vscode" // window reports are off by default
+	}},
+	{"Windows console", quirks{noPixelReports: true}, func(c aquarium.ClientInfo, vars map[string]bool) bool {
+		return aquarium.ClientSoftware(c.ClientVersion) == "OpenSSH_for_Windows" // console host ignores window reports
+	}},
+}
+
+// terminalVars are environment variables that only name a terminal. Their
+// values don't matter.
+var terminalVars = map[string]bool{
+	"KITTY_WINDOW_ID":  true,
+	"ITERM_SESSION_ID": true,
+	"KONSOLE_VERSION":  true,
+	"WT_SESSION":       true,
+	"XTERM_VERSION":    true,
+	"MLTERM":           true,
+	"VTE_VERSION":      true,
+}
+
+// terminal returns the profile of the client's terminal, or nil if it is
+// unknown.
+func (h *Handler) terminal() *terminalProfile {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i := range terminalProfiles {
+		if terminalProfiles[i].match(h.client, h.termVars) {
+			return &terminalProfiles[i]
+		}
+	}
+	return nil
+}
+
+// showsGraphics reports whether the client's terminal may show Kitty
+// graphics, i.e. isn't known not to.
+func (h *Handler) showsGraphics() bool {
+	t := h.terminal()
+	return t == nil || !t.quirks.noKittyGraphics
+}
+
+// graphics returns the protocol fish are drawn with on the client's
+// terminal: the one the client asked for with ACQUA_GRAPHICS, else what the
+// terminal answered when probed, Kitty graphics or Sixel. Terminals that
+// didn't answer get Kitty graphics unless they are known not to show them,
+// then Sixel or text.
+func (h *Handler) graphics() string {
+	h.mu.Lock()
+	chosen, caps := h.client.Graphics, h.client.Caps
+	h.mu.Unlock()
+	if chosen != "" {
+		return chosen
+	}
+
+	t := h.terminal()
+	if caps.Probed {
+		switch {
+		case caps.Kitty:
+			return aquarium.GraphicsKitty
+		case caps.Sixel, t != nil && t.quirks.sixel:
+			return aquarium.GraphicsSixel
+		}
+		return aquarium.GraphicsText
+	}
+	switch {
+	case t == nil || !t.quirks.noKittyGraphics:
+		return aquarium.GraphicsKitty
+	case t.quirks.sixel:
+		return aquarium.GraphicsSixel
+	}
+	return aquarium.GraphicsText
+}
+
+// hyperlinks reports whether the client's terminal opens OSC 8 links: what
+// the client asked for with ACQUA_HYPERLINKS, else what its profile says.
+func (h *Handler) hyperlinks() bool {
+	h.mu.Lock()
+	choice := h.linkChoice
+	h.mu.Unlock()
+	if choice != "" {
+		return choice == "on"
+	}
+	t := h.terminal()
+	return t != nil && t.quirks.hyperlinks
+}
+
+// maxEnvValue limits the environment values a client can send.
+const maxEnvValue = 64
+
+// SetEnv takes note of an environment variable sent by the client, before
+// the session starts. It reports whether the variable is used.
+func (h *Handler) SetEnv(name, value string) bool {
+	value = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, value)
+	if len(value) > maxEnvValue {
+		value = value[:maxEnvValue]
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if terminalVars[name] {
+		if h.termVars == nil {
+			h.termVars = make(map[string]bool)
+		}
+		h.termVars[name] = true // picks quirks
+		return true
+	}
+
+	switch name {
+	case "TERM_PROGRAM":
+		h.client.TermProgram = value // picks quirks
+	case "COLORTERM":
+		h.client.ColorTerm = value // color depth
+	case "LANG":
+		h.client.Lang = value // whether glyphs outside ASCII show up
+	case "TZ":
+		location, err := aquarium.ParseTZ(value)
+		if err != nil {
+			return false
+		}
+		h.client.Location = location // when the night light comes on
+	case "ACQUA_GRAPHICS":
+		switch value {
+		case aquarium.GraphicsKitty, aquarium.GraphicsSixel, aquarium.GraphicsText:
+		default:
+			return false
+		}
+		h.client.Graphics = value // overrides what the terminal profile says
+	case "ACQUA_HYPERLINKS":
+		if value != "on" && value != "off" {
+			return false
+		}
+		h.linkChoice = value // overrides what the terminal profile says
+	case "ACQUA_MODE":
+		if value != aquarium.ModePhoto && value != "default" {
+			return false
+		}
+		h.client.Mode = value
+	default:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,193 @@
+package connection
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/acuqa/ssh-aquarium/internal/aquarium"
+)
+
+const maxMenuRooms = 9
+
+// handleRoomKey handles the 'r' room menu. It reports whether the key was
+// consumed.
+func (h *Handler) handleRoomKey(key byte) bool {
+	h.mu.Lock()
+	open := h.menuStop != nil
+	h.mu.Unlock()
+
+	if !open {
+		if key == 'r' || key == 'R' {
+			h.closeSettingsMenu()
+			h.closeGuestbook()
+			h.openRoomMenu()
+			return true
+		}
+		return false
+	}
+
+	switch {
+	case key == 'r' || key == 'R' || key == 0x1b:
+		h.closeRoomMenu()
+	case key >= '1' && key <= '9':
+		rooms := h.rooms.Rooms()
+		index := int(key - '1')
+		if index < len(rooms) && index < maxMenuRooms {
+			h.enterRoom(rooms[index].Name)
+		}
+	}
+	return true
+}
+
+func (h *Handler) openRoomMenu() {
+	stop := make(chan struct{})
+	h.mu.Lock()
+	h.menuStop = stop
+	h.menuNote = ""
+	h.mu.Unlock()
+
+	h.renderRoomMenu()
+
+	// Redraw periodically so population counts stay current and fish
+	// frames don't leave the menu half erased
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				h.renderRoomMenu()
+			}
+		}
+	}()
+}
+
+func (h *Handler) closeRoomMenu() {
+	h.mu.Lock()
+	stop := h.menuStop
+	h.menuStop = nil
+	h.mu.Unlock()
+
+	if stop == nil {
+		return
+	}
+	close(stop)
+	h.clearMenuBox(h.menuBounds())
+}
+
+// clearMenuBox blanks a menu's area, the animation repaints fish on the next
+// frame.
+func (h *Handler) clearMenuBox(top, left, width, height int) {
+	for row := top; row < top+height; row++ {
+		h.write([]byte(fmt.Sprintf("\x1b[%d;%dH%*s", row, left, width, "")))
+	}
+}
+
+// menuBox draws lines of text as a box at the given position.
+func menuBox(top, left, width int, lines []string) string {
+	var out strings.Builder
+	for i, text := range lines {
+		if visible := aquarium.StripHyperlinks(text); visible != text {
+			// Links are padded by their text, and must fit
+			pad := max(width-2-utf8.RuneCountInString(visible), 0)
+			fmt.Fprintf(&out, "\x1b[%d;%dH\x1b[48;5;236m\x1b[97m %s%s \x1b[0m", top+i, left, text, strings.Repeat(" ", pad))
+			continue
+		}
+		fmt.Fprintf(&out, "\x1b[%d;%dH\x1b[48;5;236m\x1b[97m %-*.*s \x1b[0m", top+i, left, width-2, width-2, text)
+	}
+	return out.String()
+}
+
+// link makes text a link to target on terminals that open OSC 8 links.
+// Elsewhere the target itself is shown, so it can be copied.
+func (h *Handler) link(target, text string) string {
+	h.mu.Lock()
+	hyperlinks := h.client.Hyperlinks
+	h.mu.Unlock()
+	if !hyperlinks {
+		return target
+	}
+	return aquarium.Hyperlink(target, text)
+}
+
+func (h *Handler) menuBounds() (top, left, width, height int) {
+	rooms := h.rooms.Rooms()
+	if len(rooms) > maxMenuRooms {
+		rooms = rooms[:maxMenuRooms]
+	}
+
+	h.mu.Lock()
+	columns, rows := h.termColumns, h.termRows
+	h.mu.Unlock()
+
+	width = 46
+	height = len(rooms) + 4
+	top = max((rows-height)/2, 1)
+	left = max((columns-width)/2, 1)
+	return top, left, width, height
+}
+
+func (h *Handler) renderRoomMenu() {
+	rooms := h.rooms.Rooms()
+	if len(rooms) > maxMenuRooms {
+		rooms = rooms[:maxMenuRooms]
+	}
+
+	h.mu.Lock()
+	current, note := h.room, h.menuNote
+	h.mu.Unlock()
+
+	lines := []string{"Rooms"}
+	for i, room := range rooms {
+		marker := " "
+		if room.Name == current {
+			marker = "*"
+		}
+		private := ""
+		if room.Private {
+			private = "private"
+		}
+		lines = append(lines, fmt.Sprintf("%d %s %-18.18s %3d online %s", i+1, marker, room.Name, room.Population, private))
+	}
+	if note == "" {
+		note = "1-9 switch   r/esc close"
+	}
+	lines = append(lines, "", note, "")
+
+	top, left, width, _ := h.menuBounds()
+	h.write([]byte(menuBox(top, left, width, lines)))
+}
+
+// switchRoom moves this connection into another room without reconnecting.
+func (h *Handler) switchRoom(name string) {
+	next := h.rooms.Room(name)
+
+	h.mu.Lock()
+	if next == nil || name == h.room {
+		h.mu.Unlock()
+		return
+	}
+	previous, connID := h.aquarium, h.connID
+	h.mu.Unlock()
+
+	log.Printf("Connection %d: switching to room %q", connID, name)
+	h.closeSplit()
+	previous.RemoveConnection(connID)
+
+	// The old room's last frame is out by now. Delete all placements but
+	// keep the uploaded images, then clear text.
+	h.write([]byte("\x1b_Ga=d,d=a,q=1\x1b\\\x1b[2J"))
+
+	h.mu.Lock()
+	h.room = name
+	h.aquarium = next
+	h.connID = next.AddConnection(h.stream, h.client)
+	h.mu.Unlock()
+
+	h.initializeAquarium()
+}
@@ -0,0 +1,351 @@
+package connection
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/acuqa/ssh-aquarium/internal/aquarium"
+)
+
+// loadSettings picks up the settings a returning user chose before.
+func (h *Handler) loadSettings() {
+	if h.client.Fingerprint != "" {
+		h.client.Settings = h.rooms.Settings().Get(h.client.Fingerprint)
+	}
+}
+
+// changeSettings applies a change to the user's settings right away and
+// remembers it for their next session.
+func (h *Handler) changeSettings(change func(*aquarium.Settings)) {
+	h.mu.Lock()
+	change(&h.client.Settings)
+	settings, fingerprint := h.client.Settings, h.client.Fingerprint
+	room, connID := h.aquarium, h.connID
+	split := h.split
+	h.mu.Unlock()
+
+	room.SetSettings(connID, settings)
+	if split != nil {
+		split.aquarium.SetSettings(split.connID, settings)
+	}
+	if err := h.rooms.Settings().Set(fingerprint, settings); err != nil {
+		log.Printf("Connection %d: failed to save settings: %v", connID, err)
+	}
+}
+
+// handleSettingsKey handles keys that toggle settings. It reports whether
+// the key was consumed.
+func (h *Handler) handleSettingsKey(key byte) bool {
+	switch key {
+	case 'm', 'M':
+		h.changeSettings(func(s *aquarium.Settings) { s.ReducedMotion = !s.ReducedMotion })
+	case 'l', 'L':
+		h.changeSettings(func(s *aquarium.Settings) { s.HideLabels = !s.HideLabels })
+	case 'n', 'N':
+		h.changeSettings(func(s *aquarium.Settings) { s.NightLight = !s.NightLight })
+	case 'b', 'B':
+		h.changeSettings(func(s *aquarium.Settings) { s.Bell = !s.Bell })
+	case 'c', 'C':
+		// Cycle through the fish colors
+		h.changeSettings(func(s *aquarium.Settings) {
+			next := (slices.Index(aquarium.FishColors, s.FishColor) + 1) % len(aquarium.FishColors)
+			s.SetFishColor(aquarium.FishColors[next])
+		})
+	default:
+		return false
+	}
+	return true
+}
+
+// settingsMenu is the state of the 'o' settings overlay.
+type settingsMenu struct {
+	stop    chan struct{}
+	cursor  int
+	editing bool   // typing a new fish name
+	name    []rune // the name typed so far
+}
+
+const (
+	settingMotion = iota
+	settingLabels
+	settingNight
+	settingBell
+	settingColor
+	settingTheme
+	settingName
+	settingCount
+)
+
+const settingsMenuWidth = 40
+
+// handleSettingsMenu handles the 'o' settings menu, which takes all input
+// while it is open. It reports whether the input was consumed.
+func (h *Handler) handleSettingsMenu(data []byte) bool {
+	h.mu.Lock()
+	menu := h.settingsMenu
+	h.mu.Unlock()
+
+	if menu == nil {
+		if len(data) == 1 && (data[0] == 'o' || data[0] == 'O') {
+			h.closeRoomMenu()
+			h.closeGuestbook()
+			h.openSettingsMenu()
+			return true
+		}
+		return false
+	}
+
+	for len(data) > 0 {
+		key, size := nextKey(data)
+		data = data[size:]
+		if !h.settingsKey(menu, key) {
+			h.closeSettingsMenu()
+			return true
+		}
+	}
+	h.renderSettingsMenu()
+	return true
+}
+
+// Keys that arrive as escape sequences
+const (
+	keyUp = -(iota + 1)
+	keyDown
+	keyRight
+	keyLeft
+	keyEscape
+	keyOther
+)
+
+// nextKey splits the first key off the input.
+func nextKey(data []byte) (key, size int) {
+	if data[0] != 0x1b {
+		return int(data[0]), 1
+	}
+	if len(data) == 1 || data[1] != '[' {
+		return keyEscape, 1
+	}
+	if _, size := parseMouse(data); size > 0 {
+		return keyOther, size
+	}
+	if len(data) >= 3 {
+		switch data[2] {
+		case 'A':
+			return keyUp, 3
+		case 'B':
+			return keyDown, 3
+		case 'C':
+			return keyRight, 3
+		case 'D':
+			return keyLeft, 3
+		}
+	}
+	return keyOther, len(data)
+}
+
+// settingsKey applies one key to the open menu. It reports whether the menu
+// stays open.
+func (h *Handler) settingsKey(menu *settingsMenu, key int) bool {
+	h.mu.Lock()
+	if menu.editing {
+		save := false
+		switch {
+		case key == '\r' || key == '\n':
+			menu.editing, save = false, true
+		case key == keyEscape:
+			menu.editing = false
+		case key == 0x7f || key == 0x08:
+			if len(menu.name) > 0 {
+				menu.name = menu.name[:len(menu.name)-1]
+			}
+		case key >= ' ' && key < 0x7f && len(menu.name) < maxMenuName:
+			menu.name = append(menu.name, rune(key))
+		}
+		name := string(menu.name)
+		h.mu.Unlock()
+
+		if save {
+			h.changeSettings(func(s *aquarium.Settings) { s.SetFishName(name) })
+		}
+		return true
+	}
+	cursor := menu.cursor
+	h.mu.Unlock()
+
+	change := 0
+	switch key {
+	case 'o', 'O', 'q', 'Q', keyEscape:
+		return false
+	case keyUp, 'k':
+		cursor = (cursor + settingCount - 1) % settingCount
+	case keyDown, 'j':
+		cursor = (cursor + 1) % settingCount
+	case keyLeft, 'h':
+		change = -1
+	case keyRight, 'l', ' ', '\r', '\n':
+		change = 1
+	}
+
+	h.mu.Lock()
+	menu.cursor = cursor
+	if change != 0 && cursor == settingName {
+		menu.editing = true
+		menu.name = []rune(h.client.Settings.FishName)
+		change = 0
+	}
+	h.mu.Unlock()
+
+	switch {
+	case change == 0:
+	case cursor == settingMotion:
+		h.changeSettings(func(s *aquarium.Settings) { s.ReducedMotion = !s.ReducedMotion })
+	case cursor == settingLabels:
+		h.changeSettings(func(s *aquarium.Settings) { s.HideLabels = !s.HideLabels })
+	case cursor == settingNight:
+		h.changeSettings(func(s *aquarium.Settings) { s.NightLight = !s.NightLight })
+	case cursor == settingBell:
+		h.changeSettings(func(s *aquarium.Settings) { s.Bell = !s.Bell })
+	case cursor == settingColor:
+		h.changeSettings(func(s *aquarium.Settings) {
+			count := len(aquarium.FishColors)
+			next := (slices.Index(aquarium.FishColors, s.FishColor) + change + count) % count
+			s.SetFishColor(aquarium.FishColors[next])
+		})
+	case cursor == settingTheme:
+		// Cycle through the room's theme and every other
+		h.changeSettings(func(s *aquarium.Settings) {
+			count := len(aquarium.Themes) + 1
+			next := (themeIndex(s.Theme) + change + count) % count
+			if next == 0 {
+				s.SetTheme("")
+			} else {
+				s.SetTheme(aquarium.Themes[next-1].Name)
+			}
+		})
+	}
+	return true
+}
+
+// themeIndex is the position of a theme in the menu's cycle, 0 being the
+// room's own.
+func themeIndex(name string) int {
+	for i, theme := range aquarium.Themes {
+		if theme.Name == name {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// maxMenuName limits names typed in the menu to what fits in it.
+const maxMenuName = 20
+
+func (h *Handler) openSettingsMenu() {
+	menu := &settingsMenu{stop: make(chan struct{})}
+	h.mu.Lock()
+	h.settingsMenu = menu
+	h.mu.Unlock()
+
+	h.renderSettingsMenu()
+
+	// Redraw periodically so fish frames don't leave the menu half erased
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-menu.stop:
+				return
+			case <-ticker.C:
+				h.renderSettingsMenu()
+			}
+		}
+	}()
+}
+
+func (h *Handler) closeSettingsMenu() {
+	h.mu.Lock()
+	menu := h.settingsMenu
+	h.settingsMenu = nil
+	h.mu.Unlock()
+
+	if menu == nil {
+		return
+	}
+	close(menu.stop)
+	h.clearMenuBox(h.settingsMenuBounds())
+}
+
+func (h *Handler) settingsMenuBounds() (top, left, width, height int) {
+	h.mu.Lock()
+	columns, rows := h.termColumns, h.termRows
+	h.mu.Unlock()
+
+	width = settingsMenuWidth
+	height = settingCount + 4
+	top = max((rows-height)/2, 1)
+	left = max((columns-width)/2, 1)
+	return top, left, width, height
+}
+
+func (h *Handler) renderSettingsMenu() {
+	h.mu.Lock()
+	menu := h.settingsMenu
+	if menu == nil {
+		h.mu.Unlock()
+		return
+	}
+	settings, cursor, editing, typed := h.client.Settings, menu.cursor, menu.editing, string(menu.name)
+	username := h.client.Username
+	h.mu.Unlock()
+
+	motion := "full"
+	if settings.ReducedMotion {
+		motion = "reduced"
+	}
+	color := settings.FishColor
+	if color == "" {
+		color = "-"
+	}
+	theme := settings.Theme
+	if theme == "" {
+		theme = "room"
+	}
+	name := settings.FishName
+	if name == "" {
+		name = username
+	}
+	if editing {
+		name = typed + "_"
+	}
+
+	values := [settingCount][2]string{
+		settingMotion: {"Motion", motion},
+		settingLabels: {"Labels", onOff(!settings.HideLabels)},
+		settingNight:  {"Night", onOff(settings.NightLight)},
+		settingBell:   {"Bell", onOff(settings.Bell)},
+		settingColor:  {"Color", "< " + color + " >"},
+		settingTheme:  {"Theme", "< " + theme + " >"},
+		settingName:   {"Name", name},
+	}
+	lines := []string{"Settings"}
+	for i, value := range values {
+		marker := " "
+		if i == cursor {
+			marker = ">"
+		}
+		lines = append(lines, fmt.Sprintf("%s %-8s %s", marker, value[0], value[1]))
+	}
+	lines = append(lines, "")
+	if editing {
+		lines = append(lines, "type a name   enter save   esc cancel")
+	} else {
+		lines = append(lines, "arrows change   o/esc close")
+	}
+	lines = append(lines, "")
+
+	top, left, width, _ := h.settingsMenuBounds()
+	h.write([]byte(menuBox(top, left, width, lines)))
+}
@@ -0,0 +1,37 @@
+package connection
+
+import (
+	"fmt"
+	"unicode/utf8"
+)
+
+// showSplash shows a loading line in the middle of the screen while the
+// terminal is detected and sprites upload, so the session doesn't start
+// with a blank screen.
+func (h *Handler) showSplash(step string) {
+	h.mu.Lock()
+	room, columns, rows := h.room, h.termColumns, h.termRows
+	ellipsis := "…"
+	if !h.client.UTF8() {
+		ellipsis = "..."
+	}
+	h.mu.Unlock()
+
+	text := fmt.Sprintf("loading %s%s %s", room, ellipsis, step)
+	if n := utf8.RuneCountInString(text); n > columns {
+		text = string([]rune(text)[:max(columns, 0)])
+	}
+	col := max(1, (columns-utf8.RuneCountInString(text))/2+1)
+	row := max(1, rows/2)
+
+	h.write([]byte(fmt.Sprintf("\x1b[%d;1H\x1b[2K\x1b[%d;%dH\x1b[90m%s\x1b[0m", row, row, col, text)))
+}
+
+// clearSplash removes the loading line before the first frame is drawn.
+func (h *Handler) clearSplash() {
+	h.mu.Lock()
+	rows := h.termRows
+	h.mu.Unlock()
+
+	h.write([]byte(fmt.Sprintf("\x1b[%d;1H\x1b[2K", max(1, rows/2))))
+}
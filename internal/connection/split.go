@@ -0,0 +1,273 @@
+package connection
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/acuqa/ssh-aquarium/internal/aquarium"
+)
+
+const (
+	// minSplitColumns is the narrowest terminal that fits two tanks side
+	// by side.
+	minSplitColumns = 160
+
+	// splitImageOffset keeps the image IDs of the right tank clear of the
+	// left one's.
+	splitImageOffset = 1 << 20
+)
+
+// splitView shows a second room on the right of a wide terminal, next to the
+// handler's own room on the left.
+type splitView struct {
+	room       string
+	aquarium   *aquarium.Manager
+	connID     uint64         // this terminal's connection to the right room
+	stream     *streamWrapper // draws on the right side
+	left       aquarium.Viewport
+	right      aquarium.Viewport
+	focusRight bool // keys and clicks go to the right room
+	stop       chan struct{}
+}
+
+// toggleSplit shows the next room alongside the current one, or goes back
+// to a single tank.
+func (h *Handler) toggleSplit() {
+	h.mu.Lock()
+	open := h.split != nil
+	h.mu.Unlock()
+
+	if open {
+		h.closeSplit()
+		return
+	}
+	h.openSplit()
+}
+
+func (h *Handler) openSplit() {
+	h.mu.Lock()
+	columns, rows := h.termColumns, h.termRows
+	current, connID := h.room, h.connID
+	config := &aquarium.TerminalConfig{
+		Rows:       rows,
+		CellWidth:  h.cellWidth,
+		CellHeight: h.cellHeight,
+	}
+	h.mu.Unlock()
+
+	if columns < minSplitColumns {
+		log.Printf("Connection %d: %d columns are too narrow to split, need %d", connID, columns, minSplitColumns)
+		return
+	}
+
+	// The right side shows the room after this one, skipping those this
+	// user can't just walk into
+	rooms := h.rooms.Rooms()
+	name := ""
+	for i, room := range rooms {
+		if room.Name != current {
+			continue
+		}
+		for j := 1; j < len(rooms) && name == ""; j++ {
+			if next := rooms[(i+j)%len(rooms)].Name; h.mayEnter(next) {
+				name = next
+			}
+		}
+	}
+	next := h.rooms.Room(name)
+	if next == nil || name == current {
+		return
+	}
+
+	split := &splitView{room: name, aquarium: next, stop: make(chan struct{})}
+	split.left = aquarium.Viewport{Col: 1, Columns: (columns - 1) / 2}
+	split.right = aquarium.Viewport{
+		Col:         split.left.Columns + 2,
+		Columns:     columns - split.left.Columns - 1,
+		ImageOffset: splitImageOffset,
+	}
+	config.Columns = split.right.Columns
+	left := *config
+	left.Columns = split.left.Columns
+
+	log.Printf("Connection %d: showing room %q alongside %q", connID, name, current)
+
+	// Clear the screen and move this room's tank to the left
+	h.write([]byte("\x1b_Ga=d,d=a,q=1\x1b\\\x1b[2J"))
+	h.stream.view.Store(&split.left)
+	h.mu.Lock()
+	room := h.aquarium
+	h.split = split
+	h.mu.Unlock()
+	room.SetConnectionTerminal(connID, &left)
+	room.Refresh(connID)
+	room.RepaintBackground()
+
+	// The right tank gets its own copy of the fish images. Spectators don't
+	// bring a fish into it.
+	split.stream = &streamWrapper{channel: h.channel, mu: &h.writeMu}
+	split.stream.view.Store(&split.right)
+	var upload bytes.Buffer
+	reloadMu.Lock()
+	if h.client.Graphics == aquarium.GraphicsKitty {
+		UploadSprites(&upload, nil)
+		split.stream.Write(upload.Bytes())
+	}
+	split.connID = next.AddConnection(split.stream, h.client)
+	reloadMu.Unlock()
+	if next.GetTerminalConfig() == nil {
+		next.SetTerminalConfig(config)
+		next.StartAnimation()
+	}
+	next.SetConnectionTerminal(split.connID, config)
+	next.RepaintBackground()
+
+	// The divider is drawn over by menus, keep redrawing it
+	h.renderDivider()
+	go func() {
+		ticker := time.NewTicker(2 * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-split.stop:
+				return
+			case <-ticker.C:
+				h.renderDivider()
+			}
+		}
+	}()
+}
+
+// closeSplit leaves the right room and gives the terminal back to the
+// handler's own room.
+func (h *Handler) closeSplit() {
+	h.mu.Lock()
+	split := h.split
+	h.split = nil
+	room, connID := h.aquarium, h.connID
+	config := &aquarium.TerminalConfig{
+		Columns:    h.termColumns,
+		Rows:       h.termRows,
+		CellWidth:  h.cellWidth,
+		CellHeight: h.cellHeight,
+	}
+	h.mu.Unlock()
+
+	if split == nil {
+		return
+	}
+	close(split.stop)
+	split.aquarium.RemoveConnection(split.connID)
+
+	// Delete the right tank's images, then let the left one fill the screen
+	split.stream.Write([]byte("\x1b_Ga=d,d=A,q=1\x1b\\"))
+	h.write([]byte("\x1b[2J"))
+	h.stream.view.Store(nil)
+	room.SetConnectionTerminal(connID, config)
+	room.Refresh(connID)
+	room.RepaintBackground()
+}
+
+// renderDivider draws the glass between the two tanks, with an arrow
+// pointing at the side that has focus.
+func (h *Handler) renderDivider() {
+	h.mu.Lock()
+	split := h.split
+	rows := h.termRows
+	focusRight := split != nil && split.focusRight
+	h.mu.Unlock()
+
+	if split == nil {
+		return
+	}
+	glass, left, right := "┃", "◀", "▶"
+	if !h.client.UTF8() {
+		glass, left, right = "|", "<", ">"
+	}
+	arrow := left
+	if focusRight {
+		arrow = right
+	}
+	col := split.left.Columns + 1
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "\x1b[1;%dH\x1b[0m\x1b[97m%s\x1b[37m", col, arrow)
+	for row := 2; row <= rows; row++ {
+		fmt.Fprintf(&out, "\x1b[%d;%dH%s", row, col, glass)
+	}
+	out.WriteString("\x1b[0m")
+	h.write([]byte(out.String()))
+}
+
+// focused returns the room and connection that keys and clicks go to: the
+// focused side of a split view, or the handler's own room.
+func (h *Handler) focused() (*aquarium.Manager, uint64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.split != nil && h.split.focusRight {
+		return h.split.aquarium, h.split.connID
+	}
+	return h.aquarium, h.connID
+}
+
+// handleClick routes a mouse click. In a split view, clicking the side
+// without focus focuses it, clicks on the focused side go to its room with columns
+// counted from the side's left edge.
+func (h *Handler) handleClick(button, col, row int) {
+	h.mu.Lock()
+	split := h.split
+	focusRight := split != nil && split.focusRight
+	h.mu.Unlock()
+
+	if split == nil {
+		room, connID := h.focused()
+		sendMouse(room, connID, button, col, row)
+		return
+	}
+
+	// Drags and releases stay with the focused side, wherever the pointer
+	// went, so a fish dragged onto the glass is still let go
+	if button != 0 {
+		room, connID := h.focused()
+		view := split.left
+		if focusRight {
+			view = split.right
+		}
+		sendMouse(room, connID, button, col-view.Col+1, row)
+		return
+	}
+
+	var right bool
+	switch {
+	case col <= split.left.Columns:
+		right = false
+	case col >= split.right.Col:
+		right = true
+	default:
+		return // the glass
+	}
+
+	h.mu.Lock()
+	focused := split.focusRight == right
+	if !focused && button == 0 {
+		split.focusRight = right
+	}
+	h.mu.Unlock()
+	if !focused {
+		if button == 0 {
+			h.renderDivider()
+		}
+		return
+	}
+
+	room, connID := h.focused()
+	view := split.left
+	if right {
+		view = split.right
+	}
+	sendMouse(room, connID, button, col-view.Col+1, row)
+}
@@ -0,0 +1,207 @@
+package connection
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/acuqa/ssh-aquarium/internal/aquarium"
+	"github.com/acuqa/ssh-aquarium/internal/assets"
+)
+
+// sprites are the fish images uploaded to every terminal, read from the
+// assets directory or the ones embedded. A missing file falls back to the
+// next one in files.
+var sprites = []struct {
+	right bool
+	files []string
+}{
+	{false, []string{"fish.png"}},                  // left-facing
+	{true, []string{"fish-right.png", "fish.png"}}, // right-facing, or left if not available
+}
+
+// reloadMu serializes sprite reloads.
+var reloadMu sync.Mutex
+
+// uploadTimeout bounds how long a reload waits for slow terminals to
+// receive the new sprites before fish switch to them.
+const uploadTimeout = 10 * time.Second
+
+// spriteImageID picks the left- or right-facing one of two image IDs.
+func spriteImageID(right bool, leftID, rightID int) int {
+	if right {
+		return rightID
+	}
+	return leftID
+}
+
+// readSprite reads the first available file of sprite i.
+func readSprite(i int) ([]byte, error) {
+	return assets.Read(sprites[i].files...)
+}
+
+// SpriteImages decodes the fish images, for pictures of the tank drawn
+// outside a terminal.
+func SpriteImages() (left, right image.Image, err error) {
+	images := make([]image.Image, len(sprites))
+	for i, sprite := range sprites {
+		data, err := readSprite(i)
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not load %s: %w", sprite.files[0], err)
+		}
+		if images[i], err = png.Decode(bytes.NewReader(data)); err != nil {
+			return nil, nil, fmt.Errorf("could not decode %s: %w", sprite.files[0], err)
+		}
+	}
+	return images[0], images[1], nil
+}
+
+// LoadSpriteImages decodes the fish images for terminals that are sent
+// their pixels, unless that was done before.
+func LoadSpriteImages() error {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	leftID, rightID := aquarium.SpriteImageIDs()
+	if aquarium.SpriteImage(leftID) != nil {
+		return nil
+	}
+	left, right, err := SpriteImages()
+	if err != nil {
+		return err
+	}
+	aquarium.SetSpriteImage(leftID, left)
+	aquarium.SetSpriteImage(rightID, right)
+	return nil
+}
+
+// UploadSprites sends every fish image to w as a Kitty graphics upload.
+// progress, if set, is called before each sprite.
+func UploadSprites(w io.Writer, progress func(done, total int)) {
+	left, right := aquarium.SpriteImageIDs()
+	for i, sprite := range sprites {
+		if progress != nil {
+			progress(i, len(sprites))
+		}
+
+		data, err := readSprite(i)
+		if err != nil {
+			log.Printf("Warning: Could not load %s: %v", sprite.files[0], err)
+			continue
+		}
+		uploadImage(w, data, spriteImageID(sprite.right, left, right))
+	}
+}
+
+// ReloadSprites reads the fish images again and uploads them to every
+// connected terminal under fresh image IDs, then deletes the old images.
+// Fish switch to the new art once the upload went out. If a sprite can't be
+// read, everyone keeps the old art.
+func ReloadSprites(rooms *aquarium.Registry) error {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	left, right := aquarium.NextSpriteImageIDs()
+	var upload bytes.Buffer
+	images := make([]image.Image, len(sprites))
+	for i, sprite := range sprites {
+		data, err := readSprite(i)
+		if err != nil {
+			return fmt.Errorf("could not load %s: %w", sprite.files[0], err)
+		}
+		if images[i], err = png.Decode(bytes.NewReader(data)); err != nil {
+			return fmt.Errorf("could not decode %s: %w", sprite.files[0], err)
+		}
+		uploadImage(&upload, data, spriteImageID(sprite.right, left, right))
+	}
+
+	// The images go out between frames, fish keep the old art until every
+	// terminal has the new one
+	oldLeft, oldRight := aquarium.SpriteImageIDs()
+	select {
+	case <-rooms.Upload(upload.Bytes()):
+	case <-time.After(uploadTimeout):
+		log.Printf("Not every terminal got the new sprites within %v, switching anyway", uploadTimeout)
+	}
+	for i, sprite := range sprites {
+		aquarium.SetSpriteImage(spriteImageID(sprite.right, left, right), images[i])
+	}
+	aquarium.AdvanceSprites()
+	aquarium.ForgetSpriteImage(oldLeft)
+	aquarium.ForgetSpriteImage(oldRight)
+	rooms.Upload([]byte(fmt.Sprintf("\x1b_Ga=d,d=I,i=%d,q=1\x1b\\\x1b_Ga=d,d=I,i=%d,q=1\x1b\\", oldLeft, oldRight)))
+	log.Printf("Reloaded fish sprites as images %d and %d", left, right)
+	return nil
+}
+
+// WatchSprites reloads the fish images whenever one of their files in the
+// assets directory changes, checking every interval until stop is closed.
+// Embedded sprites never change.
+func WatchSprites(rooms *aquarium.Registry, interval time.Duration, stop <-chan struct{}) {
+	modified := func() map[string]time.Time {
+		times := make(map[string]time.Time)
+		for _, sprite := range sprites {
+			for _, file := range sprite.files {
+				path := assets.Path(file)
+				if path == "" {
+					continue
+				}
+				if info, err := os.Stat(path); err == nil {
+					times[file] = info.ModTime()
+				}
+			}
+		}
+		return times
+	}
+
+	last := modified()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		current := modified()
+		changed := len(current) != len(last)
+		for file, t := range current {
+			changed = changed || !t.Equal(last[file])
+		}
+		if !changed {
+			continue
+		}
+		last = current
+		if err := ReloadSprites(rooms); err != nil {
+			log.Printf("Failed to reload sprites: %v", err)
+		}
+	}
+}
+
+func uploadImage(w io.Writer, data []byte, imageID int) {
+	base64Data := base64.StdEncoding.EncodeToString(data)
+	chunkSize := 4096
+
+	for i := 0; i < len(base64Data); i += chunkSize {
+		chunk := base64Data[i:min(i+chunkSize, len(base64Data))]
+		isFirst := i == 0
+		hasMore := i+chunkSize < len(base64Data)
+
+		var command string
+		if isFirst {
+			command = fmt.Sprintf("a=t,f=100,i=%d,m=%d,q=1", imageID, btoi(hasMore))
+		} else {
+			command = fmt.Sprintf("m=%d", btoi(hasMore))
+		}
+
+		w.Write([]byte(fmt.Sprintf("\x1b_G%s;%s\x1b\\", command, chunk)))
+	}
+}
@@ -0,0 +1,250 @@
+// Package directory lets public aquariums find each other. Instances that
+// opt in announce themselves to a central directory, which any instance can
+// host, and list the aquariums it knows.
+package directory
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// Path is the web server route a directory is served at
+	Path = "/directory"
+
+	// AnnounceInterval is how often instances announce themselves
+	AnnounceInterval = 5 * time.Minute
+
+	entryTTL      = 3 * AnnounceInterval
+	listCacheTime = time.Minute
+	maxEntries    = 1000
+	maxNameLength = 40
+	maxBodySize   = 4 * 1024
+)
+
+// Entry is an aquarium listed in the directory.
+type Entry struct {
+	Name       string    `json:"name"`
+	Address    string    `json:"address"` // SSH host, optionally with :port
+	Population int       `json:"population"`
+	SeenAt     time.Time `json:"seen_at,omitempty"`
+}
+
+// Lister lists known aquariums, from a remote directory or a local one.
+type Lister interface {
+	List() ([]Entry, error)
+}
+
+func (e *Entry) validate() error {
+	e.Name = strings.TrimSpace(e.Name)
+	if e.Name == "" || utf8.RuneCountInString(e.Name) > maxNameLength {
+		return fmt.Errorf("name must be 1 to %d characters", maxNameLength)
+	}
+	if strings.IndexFunc(e.Name+e.Address, unicode.IsControl) >= 0 {
+		return errors.New("control characters are not allowed")
+	}
+
+	host := e.Address
+	if h, _, err := net.SplitHostPort(e.Address); err == nil {
+		host = h
+	}
+	if host == "" || strings.ContainsAny(host, " /@") {
+		return fmt.Errorf("invalid address %q", e.Address)
+	}
+	e.Population = max(0, e.Population)
+	return nil
+}
+
+// Directory keeps the aquariums that announced themselves recently. POST
+// announces an Entry, GET lists them.
+type Directory struct {
+	mu      sync.Mutex
+	entries map[string]Entry // by address
+}
+
+func New() *Directory {
+	return &Directory{entries: make(map[string]Entry)}
+}
+
+// List returns the aquariums heard from within the last few announce
+// intervals, the busiest first.
+func (d *Directory) List() ([]Entry, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.expireLocked(time.Now())
+	entries := make([]Entry, 0, len(d.entries))
+	for _, entry := range d.entries {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Population != entries[j].Population {
+			return entries[i].Population > entries[j].Population
+		}
+		return entries[i].Name < entries[j].Name
+	})
+	return entries, nil
+}
+
+func (d *Directory) expireLocked(now time.Time) {
+	for address, entry := range d.entries {
+		if now.Sub(entry.SeenAt) > entryTTL {
+			delete(d.entries, address)
+		}
+	}
+}
+
+func (d *Directory) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		entries, _ := d.List()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(entries)
+
+	case http.MethodPost:
+		var entry Entry
+		if err := json.NewDecoder(io.LimitReader(r.Body, maxBodySize)).Decode(&entry); err != nil {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		if err := entry.validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		entry.SeenAt = time.Now()
+
+		d.mu.Lock()
+		d.expireLocked(entry.SeenAt)
+		key := strings.ToLower(entry.Address)
+		_, known := d.entries[key]
+		if !known && len(d.entries) >= maxEntries {
+			d.mu.Unlock()
+			http.Error(w, "directory is full", http.StatusServiceUnavailable)
+			return
+		}
+		d.entries[key] = entry
+		d.mu.Unlock()
+
+		if !known {
+			log.Printf("Directory: %q announced itself at %s", entry.Name, entry.Address)
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// Client talks to a directory hosted by another instance.
+type Client struct {
+	url    string
+	client *http.Client
+	stop   chan struct{}
+	wg     sync.WaitGroup
+
+	mu       sync.Mutex
+	cached   []Entry
+	cachedAt time.Time
+}
+
+// NewClient returns a client for the directory at url, e.g.
+// https://acqua.fly.dev/directory.
+func NewClient(url string) *Client {
+	return &Client{
+		url:    url,
+		client: &http.Client{Timeout: 5 * time.Second},
+		stop:   make(chan struct{}),
+	}
+}
+
+// List returns the aquariums the directory knows, cached for a minute.
+func (c *Client) List() ([]Entry, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.cached != nil && time.Since(c.cachedAt) < listCacheTime {
+		return c.cached, nil
+	}
+
+	resp, err := c.client.Get(c.url)
+	if err != nil {
+		return nil, fmt.Errorf("could not reach directory: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("directory answered %s", resp.Status)
+	}
+
+	var listed []Entry
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxEntries*maxBodySize)).Decode(&listed); err != nil {
+		return nil, fmt.Errorf("invalid directory listing: %w", err)
+	}
+
+	// Entries end up in terminals, only keep what this side would accept
+	entries := make([]Entry, 0, len(listed))
+	for _, entry := range listed {
+		if entry.validate() == nil {
+			entries = append(entries, entry)
+		}
+	}
+	c.cached, c.cachedAt = entries, time.Now()
+	return entries, nil
+}
+
+// Announce registers this instance with the directory now and every
+// AnnounceInterval until Stop, describing it with self.
+func (c *Client) Announce(self func() Entry) {
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+
+		ticker := time.NewTicker(AnnounceInterval)
+		defer ticker.Stop()
+		for {
+			if err := c.announce(self()); err != nil {
+				log.Printf("Directory: %v", err)
+			}
+			select {
+			case <-c.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (c *Client) announce(entry Entry) error {
+	body, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	resp, err := c.client.Post(c.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("could not announce: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("announcement declined (%s)", resp.Status)
+	}
+	return nil
+}
+
+// Stop ends announcing.
+func (c *Client) Stop() {
+	close(c.stop)
+	c.wg.Wait()
+}
@@ -0,0 +1,136 @@
+// Package doorbell lets whoever runs an aquarium know when someone drops by,
+// by running a command, e.g. one that shows a desktop notification, or by
+// calling a webhook.
+package doorbell
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultInterval is the least time between two rings. Visitors in
+	// between are counted in the next ring.
+	DefaultInterval = time.Minute
+
+	// ringTimeout bounds how long a command started by Run or a webhook
+	// may take.
+	ringTimeout = 10 * time.Second
+)
+
+// Visitor is someone who started a session.
+type Visitor struct {
+	Username    string    `json:"username"`
+	Fingerprint string    `json:"fingerprint,omitempty"` // SHA256 key fingerprint, empty for password logins
+	RemoteAddr  string    `json:"remote_addr"`
+	Missed      int       `json:"missed"` // visitors since the last ring who did not ring
+	At          time.Time `json:"at"`
+}
+
+// Bell rings for visitors, at most once per interval.
+type Bell struct {
+	command  string // run with sh -c
+	webhook  string // POSTed a Visitor as JSON
+	interval time.Duration
+	client   *http.Client
+
+	mu     sync.Mutex
+	last   time.Time
+	missed int
+}
+
+// New returns a bell that runs command and POSTs to webhook, either of which
+// may be empty, at most once per interval.
+func New(command, webhook string, interval time.Duration) *Bell {
+	return &Bell{
+		command:  command,
+		webhook:  webhook,
+		interval: interval,
+		client:   &http.Client{Timeout: ringTimeout},
+	}
+}
+
+// Ring announces a visitor in the background. Within the interval of the
+// last ring the visitor is only counted, and the next ring says how many
+// were missed.
+func (b *Bell) Ring(visitor Visitor) {
+	b.mu.Lock()
+	now := time.Now()
+	if !b.last.IsZero() && now.Sub(b.last) < b.interval {
+		b.missed++
+		b.mu.Unlock()
+		return
+	}
+	b.last = now
+	visitor.Missed, b.missed = b.missed, 0
+	visitor.At = now
+	b.mu.Unlock()
+
+	go func() {
+		if b.command != "" {
+			if err := b.run(visitor); err != nil {
+				log.Printf("Doorbell: command failed: %v", err)
+			}
+		}
+		if b.webhook != "" {
+			if err := b.post(visitor); err != nil {
+				log.Printf("Doorbell: webhook failed: %v", err)
+			}
+		}
+	}()
+}
+
+// run runs the command with the visitor in ACQUA_* environment variables.
+func (b *Bell) run(visitor Visitor) error {
+	return Run(b.command, nil,
+		"ACQUA_VISITOR="+visitor.Username,
+		"ACQUA_FINGERPRINT="+visitor.Fingerprint,
+		"ACQUA_REMOTE_ADDR="+visitor.RemoteAddr,
+		"ACQUA_MISSED="+strconv.Itoa(visitor.Missed),
+	)
+}
+
+// Run runs command with sh -c, reading stdin, which may be nil, and with env
+// added to the server's environment. Usernames are chosen by visitors, so
+// they go in env or stdin and are never put on the command line. The output
+// is only returned with an error.
+func Run(command string, stdin io.Reader, env ...string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), ringTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Stdin = stdin
+	cmd.Env = append(os.Environ(), env...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%w: %s", err, bytes.TrimSpace(out))
+	}
+	return nil
+}
+
+func (b *Bell) post(visitor Visitor) error {
+	body, err := json.Marshal(visitor)
+	if err != nil {
+		return err
+	}
+	resp, err := b.client.Post(b.webhook, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook answered %s", resp.Status)
+	}
+	return nil
+}
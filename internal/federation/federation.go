@@ -0,0 +1,285 @@
+package federation
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	mathrand "math/rand"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/acuqa/ssh-aquarium/internal/aquarium"
+)
+
+const (
+	// VisitPath is the web server route peers deliver fish to
+	VisitPath = "/federation/visit"
+
+	signatureHeader = "X-Acqua-Signature"
+	maxClockSkew    = 30 * time.Second
+	maxVisit        = 5 * time.Minute
+	maxBodySize     = 64 * 1024
+)
+
+// Peer is another aquarium this instance exchanges fish with.
+type Peer struct {
+	Name string
+	URL  string // base URL of the peer's web server
+	Key  ed25519.PublicKey
+}
+
+type visit struct {
+	From      string             `json:"from"`
+	To        string             `json:"to"`
+	Timestamp int64              `json:"timestamp"`
+	Nonce     string             `json:"nonce"`
+	Edge      int                `json:"edge"`
+	Duration  int64              `json:"duration_ms"`
+	Fish      aquarium.FishState `json:"fish"`
+}
+
+// Federation sends fish to peer aquariums and accepts signed visits from them.
+type Federation struct {
+	name     string
+	key      ed25519.PrivateKey
+	peers    map[string]Peer
+	aquarium *aquarium.Manager
+	client   *http.Client
+	mu       sync.Mutex
+	nonces   map[string]time.Time
+}
+
+func New(name string, key ed25519.PrivateKey, peers []Peer, aquarium *aquarium.Manager) *Federation {
+	byName := make(map[string]Peer, len(peers))
+	for _, peer := range peers {
+		byName[peer.Name] = peer
+	}
+
+	return &Federation{
+		name:     name,
+		key:      key,
+		peers:    byName,
+		aquarium: aquarium,
+		client:   &http.Client{Timeout: 5 * time.Second},
+		nonces:   make(map[string]time.Time),
+	}
+}
+
+// PublicKey returns the key peers need to list for this instance.
+func (f *Federation) PublicKey() string {
+	return base64.StdEncoding.EncodeToString(f.key.Public().(ed25519.PublicKey))
+}
+
+// Migrate sends a fish to a random peer. It is used as the aquarium's
+// MigrationFunc.
+func (f *Federation) Migrate(state aquarium.FishState, edge int, duration time.Duration) bool {
+	if len(f.peers) == 0 {
+		return false
+	}
+
+	names := make([]string, 0, len(f.peers))
+	for name := range f.peers {
+		names = append(names, name)
+	}
+	peer := f.peers[names[mathrand.Intn(len(names))]]
+
+	nonce := make([]byte, 16)
+	rand.Read(nonce)
+
+	body, err := json.Marshal(visit{
+		From:      f.name,
+		To:        peer.Name,
+		Timestamp: time.Now().Unix(),
+		Nonce:     hex.EncodeToString(nonce),
+		Edge:      edge,
+		Duration:  duration.Milliseconds(),
+		Fish:      state,
+	})
+	if err != nil {
+		log.Printf("Federation encode error: %v", err)
+		return false
+	}
+
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(peer.URL, "/")+VisitPath, bytes.NewReader(body))
+	if err != nil {
+		log.Printf("Federation request error: %v", err)
+		return false
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(signatureHeader, base64.StdEncoding.EncodeToString(ed25519.Sign(f.key, body)))
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		log.Printf("Federation: could not reach %s: %v", peer.Name, err)
+		return false
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode != http.StatusAccepted {
+		log.Printf("Federation: %s declined fish %d (%s)", peer.Name, state.ID, resp.Status)
+		return false
+	}
+
+	log.Printf("Fish %d (%s) swam off to %s", state.ID, state.Username, peer.Name)
+	return true
+}
+
+// ServeHTTP accepts fish sent by peers.
+func (f *Federation) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBodySize))
+	if err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	var v visit
+	if err := json.Unmarshal(body, &v); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	if err := f.verify(&v, body, r.Header.Get(signatureHeader)); err != nil {
+		log.Printf("Federation: rejected visit from %q: %v", v.From, err)
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	duration := time.Duration(v.Duration) * time.Millisecond
+	if duration <= 0 || duration > maxVisit {
+		duration = maxVisit
+	}
+
+	if !f.aquarium.AddVisitor(v.From, v.Fish, v.Edge, duration) {
+		http.Error(w, "aquarium is empty", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (f *Federation) verify(v *visit, body []byte, signature string) error {
+	peer, ok := f.peers[v.From]
+	if !ok {
+		return errors.New("unknown peer")
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil || !ed25519.Verify(peer.Key, body, sig) {
+		return errors.New("invalid signature")
+	}
+
+	if v.To != f.name {
+		return fmt.Errorf("addressed to %q", v.To)
+	}
+
+	sent := time.Unix(v.Timestamp, 0)
+	if time.Since(sent).Abs() > maxClockSkew {
+		return errors.New("stale timestamp")
+	}
+
+	// Reject replays of the same signed message
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for nonce, seen := range f.nonces {
+		if time.Since(seen) > 2*maxClockSkew {
+			delete(f.nonces, nonce)
+		}
+	}
+	if _, seen := f.nonces[v.Nonce]; seen {
+		return errors.New("replayed message")
+	}
+	f.nonces[v.Nonce] = time.Now()
+
+	return nil
+}
+
+// LoadOrCreateKey reads an Ed25519 private key in PEM format, generating
+// and saving a new one if the file does not exist.
+func LoadOrCreateKey(path string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+		data = pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+		if err := os.WriteFile(path, data, 0600); err != nil {
+			return nil, fmt.Errorf("failed to save federation key: %w", err)
+		}
+		log.Printf("Generated new federation key at %s", path)
+		return key, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load federation key: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("federation key is not PEM encoded")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse federation key: %w", err)
+	}
+	key, ok := parsed.(ed25519.PrivateKey)
+	if !ok {
+		return nil, errors.New("federation key is not an Ed25519 key")
+	}
+	return key, nil
+}
+
+// LoadPeers reads the opt-in peer list. Each non-empty line has the form
+// "name url base64-public-key"; lines starting with # are ignored.
+func LoadPeers(path string) ([]Peer, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open peer list: %w", err)
+	}
+	defer file.Close()
+
+	var peers []Peer
+	scanner := bufio.NewScanner(file)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("%s:%d: expected \"name url key\"", path, lineNo)
+		}
+		key, err := base64.StdEncoding.DecodeString(fields[2])
+		if err != nil || len(key) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("%s:%d: invalid public key", path, lineNo)
+		}
+
+		peers = append(peers, Peer{Name: fields[0], URL: fields[1], Key: ed25519.PublicKey(key)})
+	}
+	return peers, scanner.Err()
+}
@@ -0,0 +1,83 @@
+package fuzz
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// channel is an SSH channel that reads from a scripted input and throws
+// away what the server writes.
+type channel struct {
+	mu      sync.Mutex
+	reads   Input
+	pace    time.Duration // pause before each read
+	written int64
+	closed  bool
+	done    chan struct{} // closed once the handler closes the channel
+}
+
+var _ ssh.Channel = (*channel)(nil)
+
+func newChannel(reads Input, pace time.Duration) *channel {
+	return &channel{reads: reads, pace: pace, done: make(chan struct{})}
+}
+
+// Read returns the next read of the input, then EOF as if the client
+// disconnected.
+func (c *channel) Read(p []byte) (int, error) {
+	if c.pace > 0 {
+		select {
+		case <-time.After(c.pace):
+		case <-c.done:
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed || len(c.reads) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, c.reads[0])
+	if n < len(c.reads[0]) {
+		c.reads[0] = c.reads[0][n:]
+	} else {
+		c.reads = c.reads[1:]
+	}
+	return n, nil
+}
+
+func (c *channel) Write(data []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return 0, io.EOF
+	}
+	c.written += int64(len(data))
+	return len(data), nil
+}
+
+func (c *channel) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.closed {
+		c.closed = true
+		close(c.done)
+	}
+	return nil
+}
+
+func (c *channel) CloseWrite() error { return nil }
+
+func (c *channel) SendRequest(name string, wantReply bool, payload []byte) (bool, error) {
+	return false, nil
+}
+
+func (c *channel) Stderr() io.ReadWriter { return discard{} }
+
+// discard is an empty stderr.
+type discard struct{}
+
+func (discard) Read([]byte) (int, error)    { return 0, io.EOF }
+func (discard) Write(p []byte) (int, error) { return len(p), nil }
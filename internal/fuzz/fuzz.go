@@ -0,0 +1,192 @@
+package fuzz
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/acuqa/ssh-aquarium/internal/aquarium"
+	"github.com/acuqa/ssh-aquarium/internal/connection"
+	"github.com/acuqa/ssh-aquarium/internal/metrics"
+)
+
+// adminFingerprint is the key every other session logs in with, so admin
+// keys get fuzzed too.
+const adminFingerprint = "SHA256:fuzz-admin"
+
+// pixelReply answers terminal detection right away, which would otherwise
+// wait two seconds for a reply.
+var pixelReply = []byte("\x1b[4;384;640t")
+
+// sizes are the terminal sizes sessions pick from, including ones too
+// small for the menus and wide enough for a split view.
+var sizes = [][2]uint32{{80, 24}, {200, 50}, {20, 6}, {1, 1}, {320, 90}}
+
+// Options configure a fuzzing run.
+type Options struct {
+	Iterations int           // sessions to replay
+	Seed       int64         // for the mutations, so a run can be repeated
+	Corpus     []Input       // replayed as is first, then mutated along with Seeds
+	Pace       time.Duration // pause before each read, so frames are drawn in between
+	Timeout    time.Duration // a session taking longer hangs
+	MaxHeap    uint64        // heap in use, after garbage collection, a run may grow to
+	Crashers   string        // directory failing inputs are saved to, empty to not save them
+}
+
+// Failure is an input that made the handler misbehave.
+type Failure struct {
+	Iteration int
+	Reason    string
+	Input     Input
+	Path      string // where the input was saved, if it was
+}
+
+// Result sums up a run.
+type Result struct {
+	Sessions   int
+	Bytes      int // input replayed
+	Written    int64
+	Failures   []Failure
+	Heap       uint64 // heap in use at the end, after garbage collection
+	Goroutines int    // left running at the end, beyond those of the tank
+}
+
+// Run replays each input of the corpus, then mutated inputs, against
+// handlers sharing one set of rooms, the way sessions share a server. A
+// session fails when the handler panics, hangs, or the heap grows beyond
+// MaxHeap.
+//
+// Panics in goroutines that don't recover take the process down. The
+// input being replayed is kept in Crashers/current.input, so it can be
+// replayed after such a crash.
+func Run(opts Options) (Result, error) {
+	var result Result
+	if opts.Crashers != "" {
+		if err := os.MkdirAll(opts.Crashers, 0o755); err != nil {
+			return result, err
+		}
+	}
+
+	rooms := aquarium.NewRegistry([]string{"lobby", "reef"})
+	rooms.SetAdmins([]string{adminFingerprint})
+	defer rooms.Stop()
+
+	rng := rand.New(rand.NewSource(opts.Seed))
+	pool := append(append([]Input(nil), opts.Corpus...), Seeds...)
+	baseline := -1
+
+	for i := 0; i < opts.Iterations; i++ {
+		input := pool[i%len(pool)]
+		if i >= len(opts.Corpus) {
+			input = mutate(rng, pool[rng.Intn(len(pool))], pool)
+		}
+		if opts.Crashers != "" {
+			if err := saveInput(filepath.Join(opts.Crashers, "current.input"), input); err != nil {
+				return result, err
+			}
+		}
+
+		written, reason := replay(rooms, i, input, sizes[rng.Intn(len(sizes))], opts)
+		result.Sessions++
+		result.Bytes += input.size()
+		result.Written += written
+
+		// The first session starts the tank's own goroutines
+		if baseline < 0 && reason == "" {
+			baseline = settledGoroutines()
+		}
+		if reason == "" && (i%100 == 99 || i == opts.Iterations-1) {
+			if heap := heapInUse(); opts.MaxHeap > 0 && heap > opts.MaxHeap {
+				reason = fmt.Sprintf("heap grew to %d bytes", heap)
+			}
+		}
+		if reason == "" {
+			continue
+		}
+
+		failure := Failure{Iteration: i, Reason: reason, Input: input}
+		if opts.Crashers != "" {
+			failure.Path = filepath.Join(opts.Crashers, fmt.Sprintf("crash-%d-%d.input", opts.Seed, i))
+			if err := saveInput(failure.Path, input); err != nil {
+				return result, err
+			}
+		}
+		log.Printf("Fuzz session %d failed: %s", i, reason)
+		result.Failures = append(result.Failures, failure)
+	}
+
+	if opts.Crashers != "" {
+		os.Remove(filepath.Join(opts.Crashers, "current.input"))
+	}
+	result.Heap = heapInUse()
+	if baseline >= 0 {
+		result.Goroutines = max(settledGoroutines()-baseline, 0)
+	}
+	return result, nil
+}
+
+// replay runs one session. It returns what the handler wrote and why the
+// session failed, or "" if it didn't.
+func replay(rooms *aquarium.Registry, i int, input Input, size [2]uint32, opts Options) (int64, string) {
+	client := aquarium.ClientInfo{
+		Username:      fmt.Sprintf("fuzz%d", i),
+		RemoteAddr:    fmt.Sprintf("192.0.2.%d:2222", i%254+1),
+		ClientVersion: "SSH-2.0-fuzz",
+	}
+	if i%2 == 1 {
+		client.Fingerprint = adminFingerprint
+	}
+
+	ch := newChannel(append(Input{pixelReply}, input.clone()...), opts.Pace)
+	h := connection.New(ch, rooms, client, nil)
+	h.SetTerminal("xterm-kitty", size[0], size[1])
+
+	panics := metrics.PanicsRecovered.Value()
+	go h.Start()
+
+	var reason string
+	select {
+	case <-ch.done:
+	case <-time.After(opts.Timeout):
+		reason = fmt.Sprintf("session still running after %v", opts.Timeout)
+		go h.Close() // may be stuck too
+	}
+	if metrics.PanicsRecovered.Value() != panics {
+		reason = "handler panicked"
+	}
+
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	return ch.written, reason
+}
+
+func saveInput(path string, input Input) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := input.WriteTo(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// heapInUse returns the live heap after a garbage collection.
+func heapInUse() uint64 {
+	runtime.GC()
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	return stats.HeapInuse
+}
+
+// settledGoroutines counts goroutines once those of closed sessions had a
+// moment to return.
+func settledGoroutines() int {
+	time.Sleep(100 * time.Millisecond)
+	return runtime.NumGoroutine()
+}
@@ -0,0 +1,77 @@
+// Package fuzz replays captured and mutated client input against the
+// connection handler, to find input a hostile client could crash the
+// server with or make it use unbounded memory.
+package fuzz
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Input is what a client sends, split the way the server reads it. The
+// handler looks at each read on its own, so where the reads split matters
+// as much as the bytes.
+type Input [][]byte
+
+// ParseInput reads an input written as one Go quoted string per read:
+//
+//	# comments and blank lines are ignored
+//	"o"
+//	"\x1b[B\x1b[B"
+//	"\x1b[M *%"
+func ParseInput(r io.Reader) (Input, error) {
+	var input Input
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		chunk, err := strconv.Unquote(text)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: expected a quoted string, got %s", line, text)
+		}
+		input = append(input, []byte(chunk))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return input, nil
+}
+
+// WriteTo writes the input in the format ParseInput reads.
+func (in Input) WriteTo(w io.Writer) (int64, error) {
+	var written int64
+	for _, chunk := range in {
+		n, err := fmt.Fprintln(w, strconv.Quote(string(chunk)))
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// size is the number of bytes in the input.
+func (in Input) size() int {
+	n := 0
+	for _, chunk := range in {
+		n += len(chunk)
+	}
+	return n
+}
+
+// clone copies the input so mutating it leaves the original alone.
+func (in Input) clone() Input {
+	out := make(Input, len(in))
+	for i, chunk := range in {
+		out[i] = append([]byte(nil), chunk...)
+	}
+	return out
+}
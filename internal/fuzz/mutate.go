@@ -0,0 +1,99 @@
+package fuzz
+
+import "math/rand"
+
+// Seeds are sessions of well-formed input that reach every key and overlay.
+// None of them quit, mutations take care of that now and then.
+var Seeds = []Input{
+	// Clicks on the water, the corners and past the edge, and a drag
+	{[]byte("\x1b[M *%"), []byte("\x1b[M#*%"), []byte("\x1b[M !!"), []byte("\x1b[M \xff\xff"), []byte("\x1b[M@+%\x1b[M@,%\x1b[M#,%")},
+	// Settings menu: move, toggle, rename the fish
+	{[]byte("o"), []byte("\x1b[B"), []byte("\r"), []byte("\x1b[B\x1b[B\x1b[B"), []byte("\r"), []byte("Nemo"), []byte("\x7f\x7f"), []byte("\r"), []byte("\x1b")},
+	// Room menu and switching rooms
+	{[]byte("r"), []byte("2"), []byte("r"), []byte("\x1b"), []byte("r"), []byte("1")},
+	// Guestbook, split view, photo mode, settings keys and emotes
+	{[]byte("g"), []byte("g"), []byte("s"), []byte("\x1b[M 0%"), []byte("\x1b[M \xa0%"), []byte("s"), []byte("p"), []byte("m"), []byte("l"), []byte("c"), []byte("1"), []byte("3")},
+	// Chat: type, correct and send a message, then start one and cancel it
+	{[]byte("\r"), []byte("hi there"), []byte("\x7f"), []byte("E"), []byte("\r"), []byte("\r"), []byte("oops"), []byte("\x1b")},
+	// Admin keys, only admins get them
+	{[]byte("d"), []byte("w"), []byte("\x1b[M *%"), []byte("w"), []byte("d")},
+	// SGR mouse reports past X10's reach: a click, a drag and its release
+	{[]byte("\x1b[<0;300;12M"), []byte("\x1b[<32;301;12M\x1b[<32;302;13M"), []byte("\x1b[<0;302;13m")},
+	// Terminal replies mixed with other input
+	{[]byte("\x1b[4;768;1280t"), []byte("\x1b[12;40R"), []byte("\x1b[4;1;1t\x1b[M *%"), []byte("\x1b[12;40Ro")},
+	// A paste
+	{[]byte("hello fish, how are you today?\r")},
+}
+
+// tokens are fragments that steer mutations towards the parsers.
+var tokens = [][]byte{
+	[]byte("\x1b"), []byte("\x1b["), []byte("\x1b[M"), []byte("\x1b[<"), []byte("\x1b[4;"),
+	[]byte("\x1b[1;1R"), []byte("\x1b[4;99999999999999999999;0t"), []byte(";"), []byte("t"), []byte("R"),
+	[]byte("\x1bO"), []byte("\x1b[A"), []byte("\x1b[B"), []byte("\r"), []byte("\x7f"), []byte("\xff\xfe"),
+	[]byte("\xe2\x94"), []byte("\x00"),
+}
+
+// maxInputSize keeps mutated inputs from growing without end.
+const maxInputSize = 64 * 1024
+
+// mutate returns a copy of in with a few random changes: to the bytes, and
+// to where the reads split.
+func mutate(rng *rand.Rand, in Input, corpus []Input) Input {
+	out := in.clone()
+	for n := 1 + rng.Intn(4); n > 0; n-- {
+		if len(out) == 0 {
+			out = append(out, []byte{})
+		}
+		i := rng.Intn(len(out))
+		chunk := out[i]
+
+		switch rng.Intn(9) {
+		case 0: // flip a bit
+			if len(chunk) > 0 {
+				chunk[rng.Intn(len(chunk))] ^= 1 << rng.Intn(8)
+			}
+		case 1: // replace a byte
+			if len(chunk) > 0 {
+				chunk[rng.Intn(len(chunk))] = byte(rng.Intn(256))
+			}
+		case 2: // insert a token
+			at := rng.Intn(len(chunk) + 1)
+			token := tokens[rng.Intn(len(tokens))]
+			out[i] = append(chunk[:at:at], append(append([]byte(nil), token...), chunk[at:]...)...)
+		case 3: // cut bytes
+			if len(chunk) > 0 {
+				at := rng.Intn(len(chunk))
+				end := at + 1 + rng.Intn(len(chunk)-at)
+				out[i] = append(chunk[:at:at], chunk[end:]...)
+			}
+		case 4: // split a read in two
+			if len(chunk) > 1 {
+				at := 1 + rng.Intn(len(chunk)-1)
+				out = append(out[:i+1], append(Input{chunk[at:]}, out[i+1:]...)...)
+				out[i] = chunk[:at:at]
+			}
+		case 5: // join two reads
+			if i+1 < len(out) {
+				out[i] = append(chunk, out[i+1]...)
+				out = append(out[:i+1], out[i+2:]...)
+			}
+		case 6: // repeat a read
+			repeats := 1 + rng.Intn(16)
+			for ; repeats > 0; repeats-- {
+				out = append(out[:i+1], append(Input{append([]byte(nil), chunk...)}, out[i+1:]...)...)
+			}
+		case 7: // drop a read
+			out = append(out[:i], out[i+1:]...)
+		case 8: // splice in reads from another input
+			if other := corpus[rng.Intn(len(corpus))]; len(other) > 0 {
+				from := rng.Intn(len(other))
+				to := from + 1 + rng.Intn(len(other)-from)
+				out = append(out[:i], append(Input(other[from:to]).clone(), out[i:]...)...)
+			}
+		}
+	}
+	for out.size() > maxInputSize && len(out) > 1 {
+		out = out[:len(out)/2]
+	}
+	return out
+}
@@ -0,0 +1,120 @@
+// Package hooks runs external commands on events in the aquarium, e.g. one
+// that blinks a light when someone visits. Each command gets the event as
+// JSON on stdin.
+package hooks
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/acuqa/ssh-aquarium/internal/aquarium"
+	"github.com/acuqa/ssh-aquarium/internal/doorbell"
+)
+
+// maxRunning is how many commands may run at once. Events beyond that are
+// dropped rather than piling up processes.
+const maxRunning = 8
+
+// events maps the names used in hook files to aquarium events.
+var events = map[string]string{
+	"on_connect":   aquarium.EventConnect,
+	"on_milestone": aquarium.EventMilestone,
+	"on_storm":     aquarium.EventStorm,
+}
+
+// Hook is one line of a hook file.
+type Hook struct {
+	Event   string // aquarium event, e.g. connect
+	Command string // run with sh -c
+	Line    int
+}
+
+// Hooks runs commands on events.
+type Hooks struct {
+	hooks   []Hook
+	running chan struct{} // a token per running command
+}
+
+// Load reads a hook file. Each line holds an event and the shell command
+// run on it:
+//
+//	# event       command
+//	on_connect    curl -s -X POST http://lights.local/blink
+//	on_milestone  jq -r .visitors | xargs notify-send "Visitor milestone"
+//	on_storm      mosquitto_pub -t aquarium/storm -s
+func Load(path string) (*Hooks, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open hooks: %w", err)
+	}
+	defer file.Close()
+
+	var hooks []Hook
+	scanner := bufio.NewScanner(file)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		name, command := line, ""
+		if i := strings.IndexAny(line, " \t"); i >= 0 {
+			name, command = line[:i], line[i+1:]
+		}
+		event, ok := events[name]
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: unknown event %q, expected on_connect, on_milestone or on_storm", path, lineNo, name)
+		}
+		command = strings.TrimSpace(command)
+		if command == "" {
+			return nil, fmt.Errorf("%s:%d: %s needs a command", path, lineNo, name)
+		}
+		hooks = append(hooks, Hook{Event: event, Command: command, Line: lineNo})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read hooks: %w", err)
+	}
+	return New(hooks), nil
+}
+
+func New(hooks []Hook) *Hooks {
+	return &Hooks{hooks: hooks, running: make(chan struct{}, maxRunning)}
+}
+
+// Fire runs the commands hooked to event in the background. It never
+// blocks, so it can be the aquarium's EventFunc.
+func (h *Hooks) Fire(event aquarium.Event) {
+	for _, hook := range h.hooks {
+		if hook.Event != event.Name {
+			continue
+		}
+		select {
+		case h.running <- struct{}{}:
+		default:
+			log.Printf("Hooks: too many commands running, skipping line %d for %s", hook.Line, event.Name)
+			continue
+		}
+		go func(hook Hook) {
+			defer func() { <-h.running }()
+			if err := run(hook, event); err != nil {
+				log.Printf("Hooks: on_%s command on line %d failed: %v", event.Name, hook.Line, err)
+			}
+		}(hook)
+	}
+}
+
+// run runs a hook's command with the event as JSON on stdin.
+func run(hook Hook, event aquarium.Event) error {
+	input, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return doorbell.Run(hook.Command, bytes.NewReader(input), "ACQUA_EVENT="+event.Name)
+}
@@ -0,0 +1,263 @@
+// Package loadtest opens many SSH sessions against a running aquarium, each
+// answering terminal queries like a real terminal and clicking into the
+// water now and then, and measures how frames arrive. It is for checking
+// what an instance can take before announcing it publicly.
+package loadtest
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	mathrand "math/rand"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Options configure a load test.
+type Options struct {
+	Addr     string        // host:port of the aquarium
+	Sessions int           // sessions open at once
+	Duration time.Duration // how long each session stays
+	Ramp     time.Duration // time over which the sessions connect, so handshakes don't pile up
+	Columns  int
+	Rows     int
+	Input    time.Duration // average pause between clicks, 0 for no input
+}
+
+// Result is what the sessions saw.
+type Result struct {
+	Connected  int
+	Failed     int
+	Errors     map[string]int // failures by error
+	Frames     uint64
+	Bytes      uint64
+	Clicks     uint64
+	FirstFrame Percentiles // from dialing to the first frame with fish in it
+	FrameGap   Percentiles // between frames, 33ms at 30 FPS
+	Click      Percentiles // from a click to the next frame
+}
+
+// frameSplit is how far apart reads must be to count as separate frames.
+// Large frames arrive in more than one read.
+const frameSplit = 2 * time.Millisecond
+
+// session is what one session measured.
+type session struct {
+	firstFrame time.Duration
+	gaps       []time.Duration
+	clicks     []time.Duration
+	sent       uint64 // clicks
+	frames     uint64
+	bytes      uint64
+}
+
+// Run runs the load test and waits for every session to end.
+func Run(opts Options) (*Result, error) {
+	if opts.Sessions < 1 || opts.Columns < 1 || opts.Rows < 2 {
+		return nil, errors.New("need at least one session and a terminal of at least 1x2 characters")
+	}
+
+	result := &Result{Errors: make(map[string]int)}
+	var (
+		mu          sync.Mutex
+		wg          sync.WaitGroup
+		firstFrames []time.Duration
+		gaps        []time.Duration
+		clicks      []time.Duration
+	)
+	for i := 0; i < opts.Sessions; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			s, err := runSession(opts, i)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				result.Failed++
+				result.Errors[err.Error()]++
+				return
+			}
+			result.Connected++
+			result.Frames += s.frames
+			result.Bytes += s.bytes
+			result.Clicks += s.sent
+			if s.frames > 0 {
+				firstFrames = append(firstFrames, s.firstFrame)
+			}
+			gaps = append(gaps, s.gaps...)
+			clicks = append(clicks, s.clicks...)
+		}(i)
+
+		if opts.Sessions > 1 {
+			time.Sleep(opts.Ramp / time.Duration(opts.Sessions-1))
+		}
+	}
+	wg.Wait()
+
+	result.FirstFrame = percentiles(firstFrames)
+	result.FrameGap = percentiles(gaps)
+	result.Click = percentiles(clicks)
+	return result, nil
+}
+
+// runSession connects as a new user with a fresh key, stays for
+// opts.Duration and returns what it measured.
+func runSession(opts Options, i int) (*session, error) {
+	start := time.Now()
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		return nil, err
+	}
+	client, err := ssh.Dial("tcp", opts.Addr, &ssh.ClientConfig{
+		User:            fmt.Sprintf("loadtest-%d", i),
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(), // only ever pointed at our own instances
+		Timeout:         30 * time.Second,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("dial: %w", err)
+	}
+	defer client.Close()
+
+	sess, err := client.NewSession()
+	if err != nil {
+		return nil, fmt.Errorf("session: %w", err)
+	}
+	defer sess.Close()
+	stdin, err := sess.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := sess.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := sess.RequestPty("xterm-kitty", opts.Rows, opts.Columns, ssh.TerminalModes{}); err != nil {
+		return nil, fmt.Errorf("pty: %w", err)
+	}
+	if err := sess.Shell(); err != nil {
+		return nil, fmt.Errorf("shell: %w", err)
+	}
+
+	t := &terminal{opts: opts, stdin: stdin, start: start, s: &session{}}
+	done := make(chan error, 1)
+	go func() { done <- t.read(stdout) }()
+
+	end := time.After(opts.Duration)
+	var click <-chan time.Time
+	if opts.Input > 0 {
+		click = time.After(jitter(opts.Input))
+	}
+	for {
+		select {
+		case err := <-done:
+			if err == nil {
+				err = errors.New("session ended early")
+			}
+			return nil, err
+		case <-end:
+			return t.result(), nil
+		case <-click:
+			t.click()
+			click = time.After(jitter(opts.Input))
+		}
+	}
+}
+
+// terminal answers the aquarium like a terminal would and times frames.
+type terminal struct {
+	opts  Options
+	stdin io.Writer
+	start time.Time
+
+	mu        sync.Mutex
+	s         *session
+	lastRead  time.Time
+	lastFrame time.Time
+	clickedAt time.Time // pending click waiting for a frame
+}
+
+// read consumes output until the session ends.
+func (t *terminal) read(stdout io.Reader) error {
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := stdout.Read(buf)
+		if n > 0 {
+			t.handle(buf[:n], time.Now())
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (t *terminal) handle(data []byte, now time.Time) {
+	// Window size in pixels, from 8x16 pixel cells, and the cursor
+	// position the server measures its round trip time with
+	if bytes.Contains(data, []byte("\x1b[14t")) {
+		fmt.Fprintf(t.stdin, "\x1b[4;%d;%dt", t.opts.Rows*16, t.opts.Columns*8)
+	}
+	if bytes.Contains(data, []byte("\x1b[6n")) {
+		t.stdin.Write([]byte("\x1b[1;1R"))
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.s.bytes += uint64(len(data))
+
+	continued := now.Sub(t.lastRead) < frameSplit
+	t.lastRead = now
+	if continued || !bytes.Contains(data, []byte("a=p,")) {
+		return // not a new frame with fish in it
+	}
+	if t.s.frames == 0 {
+		t.s.firstFrame = now.Sub(t.start)
+	} else {
+		t.s.gaps = append(t.s.gaps, now.Sub(t.lastFrame))
+	}
+	if !t.clickedAt.IsZero() {
+		t.s.clicks = append(t.s.clicks, now.Sub(t.clickedAt))
+		t.clickedAt = time.Time{}
+	}
+	t.s.frames++
+	t.lastFrame = now
+}
+
+// click sends a left click somewhere in the water.
+func (t *terminal) click() {
+	col := 1 + mathrand.Intn(min(t.opts.Columns, 223))
+	row := 1 + mathrand.Intn(min(t.opts.Rows-1, 223))
+
+	t.mu.Lock()
+	t.s.sent++
+	if t.clickedAt.IsZero() {
+		t.clickedAt = time.Now()
+	}
+	t.mu.Unlock()
+	t.stdin.Write([]byte{0x1b, '[', 'M', 32, byte(32 + col), byte(32 + row)})
+}
+
+func (t *terminal) result() *session {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.s
+}
+
+// jitter returns a duration around d, so sessions don't act in lockstep.
+func jitter(d time.Duration) time.Duration {
+	return d/2 + time.Duration(mathrand.Int63n(int64(d)))
+}
@@ -0,0 +1,40 @@
+package loadtest
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+// Percentiles summarize durations.
+type Percentiles struct {
+	Count         int
+	P50, P90, P99 time.Duration
+	Max           time.Duration
+}
+
+func percentiles(samples []time.Duration) Percentiles {
+	if len(samples) == 0 {
+		return Percentiles{}
+	}
+	slices.Sort(samples)
+	at := func(p float64) time.Duration {
+		return samples[min(len(samples)-1, int(p*float64(len(samples))))]
+	}
+	return Percentiles{
+		Count: len(samples),
+		P50:   at(0.5),
+		P90:   at(0.9),
+		P99:   at(0.99),
+		Max:   samples[len(samples)-1],
+	}
+}
+
+func (p Percentiles) String() string {
+	if p.Count == 0 {
+		return "no samples"
+	}
+	round := func(d time.Duration) time.Duration { return d.Round(100 * time.Microsecond) }
+	return fmt.Sprintf("p50 %v, p90 %v, p99 %v, max %v (%d samples)",
+		round(p.P50), round(p.P90), round(p.P99), round(p.Max), p.Count)
+}
@@ -0,0 +1,67 @@
+// Package memory tunes the garbage collector for small machines, where the
+// frames rendered for every connection otherwise trigger collections many
+// times a second.
+package memory
+
+import (
+	"fmt"
+	"math"
+	"runtime/debug"
+	"strconv"
+	"strings"
+)
+
+// Tuning overrides the garbage collector's defaults. Zero values leave the
+// defaults, including GOGC and GOMEMLIMIT from the environment, alone.
+type Tuning struct {
+	GCPercent   int   // heap growth in percent that triggers a collection, negative turns collections off until MemoryLimit is reached
+	MemoryLimit int64 // soft limit in bytes for all memory of the process
+	Ballast     int64 // bytes allocated once and never used, so the heap grows further between collections
+}
+
+// ballast keeps the ballast alive. It is never written to, so the OS
+// doesn't back it with memory.
+var ballast []byte
+
+// Apply applies the tuning to the running process.
+func Apply(t Tuning) {
+	if t.GCPercent != 0 {
+		debug.SetGCPercent(t.GCPercent)
+	}
+	if t.MemoryLimit > 0 {
+		debug.SetMemoryLimit(t.MemoryLimit)
+	}
+	if t.Ballast > 0 {
+		ballast = make([]byte, t.Ballast)
+	}
+}
+
+var units = []struct {
+	suffix string
+	bytes  int64
+}{
+	{"KiB", 1 << 10}, {"MiB", 1 << 20}, {"GiB", 1 << 30},
+	{"KB", 1e3}, {"MB", 1e6}, {"GB", 1e9},
+	{"B", 1},
+}
+
+// ParseSize parses a size such as "512MiB", "64MB" or "1048576", the way
+// GOMEMLIMIT is written. The empty string is 0.
+func ParseSize(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	number, unit := s, int64(1)
+	for _, u := range units {
+		if strings.HasSuffix(s, u.suffix) {
+			number, unit = strings.TrimSpace(strings.TrimSuffix(s, u.suffix)), u.bytes
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(number, 64)
+	if err != nil || math.IsNaN(n) || n < 0 || n*float64(unit) > math.MaxInt64 {
+		return 0, fmt.Errorf("invalid size %q, expected e.g. 512MiB", s)
+	}
+	return int64(n * float64(unit)), nil
+}
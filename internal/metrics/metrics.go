@@ -0,0 +1,130 @@
+// Package metrics counts errors so operators can alert on their rates, and
+// reports how the process allocates memory. The counters are served in the
+// Prometheus text format.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Counters for errors that are otherwise only logged.
+var (
+	HandshakeFailures = NewCounter("acqua_handshake_failures_total", "SSH handshakes that failed or timed out.")
+	HandshakesDropped = NewCounter("acqua_handshakes_dropped_total", "Connections dropped because too many handshakes were in flight.")
+	WriteErrors       = NewCounter("acqua_channel_write_errors_total", "Writes to SSH channels that failed.")
+	FrameOverruns     = NewCounter("acqua_frame_overruns_total", "Frames that took longer than the frame time budget to render and send.")
+	PanicsRecovered   = NewCounter("acqua_panics_recovered_total", "Panics recovered in connection goroutines.")
+
+	OrphanedPlacements = NewCounter("acqua_orphaned_placements_total", "Fish placements deleted by the periodic audit because no fish owned them anymore.")
+)
+
+// Frames counts frames rendered in all rooms. Divided by the rate of
+// acqua_go_alloc_bytes_total it gives the bytes allocated per frame.
+var Frames = NewCounter("acqua_frames_total", "Frames rendered in all rooms.")
+
+var (
+	mu       sync.Mutex
+	counters []*Counter
+)
+
+// Counter is a monotonically increasing count.
+type Counter struct {
+	name  string
+	help  string
+	value atomic.Uint64
+}
+
+// NewCounter creates a counter and registers it for Write.
+func NewCounter(name, help string) *Counter {
+	c := &Counter{name: name, help: help}
+	mu.Lock()
+	defer mu.Unlock()
+	counters = append(counters, c)
+	return c
+}
+
+// Inc adds one to the counter.
+func (c *Counter) Inc() {
+	c.value.Add(1)
+}
+
+// Value returns the current count.
+func (c *Counter) Value() uint64 {
+	return c.value.Load()
+}
+
+// Write writes every counter in the Prometheus text format.
+func Write(w io.Writer) error {
+	mu.Lock()
+	defer mu.Unlock()
+	for _, c := range counters {
+		if err := writeMetric(w, c.name, "counter", c.help, []Sample{{Value: float64(c.Value())}}); err != nil {
+			return err
+		}
+	}
+	return writeRuntime(w)
+}
+
+// Sample is one value of a gauge. Samples of the same gauge are told apart
+// by a label, e.g. room="lobby".
+type Sample struct {
+	Label      string // empty for a gauge with a single value
+	LabelValue string
+	Value      float64
+}
+
+// WriteGauge writes a gauge in the Prometheus text format.
+func WriteGauge(w io.Writer, name, help string, samples ...Sample) error {
+	return writeMetric(w, name, "gauge", help, samples)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func writeMetric(w io.Writer, name, kind, help string, samples []Sample) error {
+	if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind); err != nil {
+		return err
+	}
+	for _, sample := range samples {
+		labels := ""
+		if sample.Label != "" {
+			labels = fmt.Sprintf(`{%s="%s"}`, sample.Label, labelEscaper.Replace(sample.LabelValue))
+		}
+		if _, err := fmt.Fprintf(w, "%s%s %s\n", name, labels, strconv.FormatFloat(sample.Value, 'g', -1, 64)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Handler serves the counters to Prometheus.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		if err := Write(w); err != nil {
+			log.Printf("Failed to write metrics: %v", err)
+		}
+	})
+}
+
+// Recover stops a panic in the calling goroutine, logs it and counts it.
+// It must be deferred directly, e.g. defer metrics.Recover("session").
+func Recover(where string) {
+	if v := recover(); v != nil {
+		Recovered(where, v)
+	}
+}
+
+// Recovered logs and counts a panic a deferred function recovered itself,
+// for ones that have more to do afterwards.
+func Recovered(where string, v any) {
+	PanicsRecovered.Inc()
+	log.Printf("Recovered from panic in %s: %v\n%s", where, v, debug.Stack())
+}
@@ -0,0 +1,35 @@
+package metrics
+
+import (
+	"io"
+	"runtime"
+	"runtime/debug"
+)
+
+// writeRuntime writes how the process allocates and collects memory. Most
+// allocations come from rendering frames, so the allocation rate follows
+// the number of rooms and connections.
+func writeRuntime(w io.Writer) error {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	limit := debug.SetMemoryLimit(-1)
+
+	for _, metric := range []struct {
+		name, kind, help string
+		value            float64
+	}{
+		{"acqua_go_alloc_bytes_total", "counter", "Bytes allocated on the heap.", float64(stats.TotalAlloc)},
+		{"acqua_go_allocs_total", "counter", "Heap objects allocated.", float64(stats.Mallocs)},
+		{"acqua_go_gc_cycles_total", "counter", "Completed garbage collection cycles.", float64(stats.NumGC)},
+		{"acqua_go_gc_pause_seconds_total", "counter", "Time the program was stopped for garbage collection.", float64(stats.PauseTotalNs) / 1e9},
+		{"acqua_go_heap_bytes", "gauge", "Bytes of allocated heap objects, including the ballast.", float64(stats.HeapAlloc)},
+		{"acqua_go_heap_goal_bytes", "gauge", "Heap size at which the next garbage collection starts.", float64(stats.NextGC)},
+		{"acqua_go_sys_bytes", "gauge", "Bytes of memory obtained from the OS.", float64(stats.Sys)},
+		{"acqua_go_memory_limit_bytes", "gauge", "Soft memory limit (GOMEMLIMIT or -memory-limit).", float64(limit)},
+	} {
+		if err := writeMetric(w, metric.name, metric.kind, metric.help, []Sample{{Value: metric.value}}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
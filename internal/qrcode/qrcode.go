@@ -0,0 +1,336 @@
+// Package qrcode encodes short texts, such as URLs, as QR codes. It only
+// does what terminals need: byte mode, the lowest error correction level
+// and versions 1 to 5, which take up to 106 bytes in a single block.
+package qrcode
+
+import (
+	"errors"
+	"math"
+)
+
+// ErrTooLong is returned for texts that don't fit a version 5 code.
+var ErrTooLong = errors.New("qrcode: text too long")
+
+// versions lists the data and error correction codewords of versions 1 to
+// 5 at error correction level L, all a single block.
+var versions = []struct{ data, ecc int }{
+	{19, 7}, {34, 10}, {55, 15}, {80, 20}, {108, 26},
+}
+
+// Code is a QR code, Modules[y][x] is true for dark modules. It has no
+// quiet zone.
+type Code struct {
+	Modules [][]bool
+}
+
+// Size returns the number of modules on each side.
+func (c *Code) Size() int {
+	return len(c.Modules)
+}
+
+// Encode returns the smallest QR code holding text.
+func Encode(text string) (*Code, error) {
+	for n, v := range versions {
+		if len(text) <= (v.data*8-12)/8 {
+			return encode([]byte(text), n+1), nil
+		}
+	}
+	return nil, ErrTooLong
+}
+
+func encode(text []byte, version int) *Code {
+	v := versions[version-1]
+
+	// Byte mode, the length and the text, then a terminator and padding
+	var bits bitBuffer
+	bits.append(0b0100, 4)
+	bits.append(len(text), 8)
+	for _, b := range text {
+		bits.append(int(b), 8)
+	}
+	bits.append(0, min(4, v.data*8-len(bits)))
+	bits.append(0, (8-len(bits)%8)%8)
+	for pad := 0xec; len(bits) < v.data*8; pad ^= 0xec ^ 0x11 {
+		bits.append(pad, 8)
+	}
+	codewords := bits.bytes()
+	codewords = append(codewords, reedSolomon(codewords, v.ecc)...)
+
+	q := newMatrix(version)
+	q.drawCodewords(codewords)
+
+	// Scanners read any mask, the one with the lowest penalty reads best
+	best, bestPenalty := 0, math.MaxInt
+	for mask := 0; mask < 8; mask++ {
+		q.applyMask(mask)
+		q.drawFormat(mask)
+		if p := q.penalty(); p < bestPenalty {
+			best, bestPenalty = mask, p
+		}
+		q.applyMask(mask) // undo
+	}
+	q.applyMask(best)
+	q.drawFormat(best)
+	return &Code{Modules: q.modules}
+}
+
+// bitBuffer collects bits, most significant first.
+type bitBuffer []bool
+
+func (b *bitBuffer) append(value, n int) {
+	for i := n - 1; i >= 0; i-- {
+		*b = append(*b, value>>i&1 == 1)
+	}
+}
+
+func (b bitBuffer) bytes() []byte {
+	out := make([]byte, len(b)/8)
+	for i, bit := range b {
+		if bit {
+			out[i/8] |= 0x80 >> (i % 8)
+		}
+	}
+	return out
+}
+
+// matrix is a QR code being drawn. Function modules are the finder,
+// timing and alignment patterns and the format information, data goes
+// around them.
+type matrix struct {
+	modules  [][]bool
+	function [][]bool
+}
+
+func newMatrix(version int) *matrix {
+	size := 17 + 4*version
+	q := &matrix{modules: make([][]bool, size), function: make([][]bool, size)}
+	for y := range q.modules {
+		q.modules[y] = make([]bool, size)
+		q.function[y] = make([]bool, size)
+	}
+
+	for i := 0; i < size; i++ {
+		q.set(6, i, i%2 == 0)
+		q.set(i, 6, i%2 == 0)
+	}
+	for _, c := range [][2]int{{3, 3}, {size - 4, 3}, {3, size - 4}} {
+		for dy := -4; dy <= 4; dy++ {
+			for dx := -4; dx <= 4; dx++ {
+				x, y := c[0]+dx, c[1]+dy
+				if x < 0 || y < 0 || x >= size || y >= size {
+					continue
+				}
+				dist := max(abs(dx), abs(dy))
+				q.set(x, y, dist != 2 && dist != 4)
+			}
+		}
+	}
+	if version > 1 {
+		center := size - 7
+		for dy := -2; dy <= 2; dy++ {
+			for dx := -2; dx <= 2; dx++ {
+				q.set(center+dx, center+dy, max(abs(dx), abs(dy)) != 1)
+			}
+		}
+	}
+	q.drawFormat(0) // reserves the format modules
+	return q
+}
+
+// set draws a function module.
+func (q *matrix) set(x, y int, dark bool) {
+	q.modules[y][x] = dark
+	q.function[y][x] = true
+}
+
+// drawFormat draws the error correction level and mask, twice, with the
+// always dark module next to the second copy.
+func (q *matrix) drawFormat(mask int) {
+	data := 1<<3 | mask // level L
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = rem<<1 ^ (rem>>9)*0x537
+	}
+	bits := (data<<10 | rem) ^ 0x5412
+	bit := func(i int) bool { return bits>>i&1 == 1 }
+
+	size := len(q.modules)
+	for i := 0; i <= 5; i++ {
+		q.set(8, i, bit(i))
+	}
+	q.set(8, 7, bit(6))
+	q.set(8, 8, bit(7))
+	q.set(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		q.set(14-i, 8, bit(i))
+	}
+	for i := 0; i < 8; i++ {
+		q.set(size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		q.set(8, size-15+i, bit(i))
+	}
+	q.set(8, size-8, true)
+}
+
+// drawCodewords fills the data modules in two-module-wide columns, zigzag
+// from the bottom right, skipping the vertical timing pattern.
+func (q *matrix) drawCodewords(codewords []byte) {
+	size := len(q.modules)
+	i := 0
+	for right := size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		upward := (right+1)&2 == 0
+		for vert := 0; vert < size; vert++ {
+			y := vert
+			if upward {
+				y = size - 1 - vert
+			}
+			for j := 0; j < 2; j++ {
+				x := right - j
+				if q.function[y][x] || i >= len(codewords)*8 {
+					continue
+				}
+				q.modules[y][x] = codewords[i/8]>>(7-i%8)&1 == 1
+				i++
+			}
+		}
+	}
+}
+
+// applyMask flips the data modules the mask pattern selects. Applying it
+// again undoes it.
+func (q *matrix) applyMask(mask int) {
+	for y, row := range q.modules {
+		for x := range row {
+			var flip bool
+			switch mask {
+			case 0:
+				flip = (x+y)%2 == 0
+			case 1:
+				flip = y%2 == 0
+			case 2:
+				flip = x%3 == 0
+			case 3:
+				flip = (x+y)%3 == 0
+			case 4:
+				flip = (x/3+y/2)%2 == 0
+			case 5:
+				flip = x*y%2+x*y%3 == 0
+			case 6:
+				flip = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				flip = ((x+y)%2+x*y%3)%2 == 0
+			}
+			if flip && !q.function[y][x] {
+				row[x] = !row[x]
+			}
+		}
+	}
+}
+
+// penalty scores what makes a code hard to read: long runs and blocks of
+// one color, patterns looking like finders and an unbalanced share of dark
+// modules.
+func (q *matrix) penalty() int {
+	size := len(q.modules)
+	at := func(x, y int, transposed bool) bool {
+		if transposed {
+			return q.modules[x][y]
+		}
+		return q.modules[y][x]
+	}
+
+	penalty := 0
+	for _, transposed := range []bool{false, true} {
+		for y := 0; y < size; y++ {
+			run := 1
+			for x := 1; x <= size; x++ {
+				if x < size && at(x, y, transposed) == at(x-1, y, transposed) {
+					run++
+					continue
+				}
+				if run >= 5 {
+					penalty += 3 + run - 5
+				}
+				run = 1
+			}
+			for x := 0; x+11 <= size; x++ {
+				var pattern int
+				for i := 0; i < 11; i++ {
+					pattern <<= 1
+					if at(x+i, y, transposed) {
+						pattern |= 1
+					}
+				}
+				if pattern == 0b10111010000 || pattern == 0b00001011101 {
+					penalty += 40
+				}
+			}
+		}
+	}
+
+	dark := 0
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			if q.modules[y][x] {
+				dark++
+			}
+			if x+1 < size && y+1 < size {
+				c := q.modules[y][x]
+				if c == q.modules[y][x+1] && c == q.modules[y+1][x] && c == q.modules[y+1][x+1] {
+					penalty += 3
+				}
+			}
+		}
+	}
+	total := size * size
+	k := (abs(dark*20-total*10)+total-1)/total - 1
+	return penalty + max(k, 0)*10
+}
+
+// reedSolomon returns the n error correction codewords of data.
+func reedSolomon(data []byte, n int) []byte {
+	divisor := make([]byte, n)
+	divisor[n-1] = 1
+	root := byte(1)
+	for i := 0; i < n; i++ {
+		for j := range divisor {
+			divisor[j] = gfMul(divisor[j], root)
+			if j+1 < n {
+				divisor[j] ^= divisor[j+1]
+			}
+		}
+		root = gfMul(root, 2)
+	}
+
+	rem := make([]byte, n)
+	for _, b := range data {
+		factor := b ^ rem[0]
+		copy(rem, rem[1:])
+		rem[n-1] = 0
+		for i := range rem {
+			rem[i] ^= gfMul(divisor[i], factor)
+		}
+	}
+	return rem
+}
+
+// gfMul multiplies in GF(2^8) modulo x^8 + x^4 + x^3 + x^2 + 1.
+func gfMul(x, y byte) byte {
+	var z int
+	for i := 7; i >= 0; i-- {
+		z = z<<1 ^ (z>>7)*0x11d
+		z ^= int(y>>i&1) * int(x)
+	}
+	return byte(z)
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
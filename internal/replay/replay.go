@@ -0,0 +1,214 @@
+package replay
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/acuqa/ssh-aquarium/internal/aquarium"
+	"github.com/acuqa/ssh-aquarium/internal/connection"
+)
+
+// Recorder receives everything sent to the replay's viewer.
+type Recorder interface {
+	Record(at time.Duration, data []byte) error
+	Close() error
+}
+
+// NewRecorder returns a recorder for format "raw" (the plain terminal
+// stream, viewable with cat in a Kitty-compatible terminal) or "cast"
+// (asciicast v2).
+func NewRecorder(format string, w io.Writer, columns, rows int) (Recorder, error) {
+	switch format {
+	case "raw":
+		return &rawRecorder{w: w}, nil
+	case "cast":
+		header, err := json.Marshal(map[string]interface{}{
+			"version":   2,
+			"width":     columns,
+			"height":    rows,
+			"timestamp": time.Now().Unix(),
+			"env":       map[string]string{"TERM": "xterm-kitty"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if _, err := fmt.Fprintf(w, "%s\n", header); err != nil {
+			return nil, err
+		}
+		return &castRecorder{w: w}, nil
+	default:
+		return nil, fmt.Errorf("unknown output format %q", format)
+	}
+}
+
+type rawRecorder struct {
+	w io.Writer
+}
+
+func (r *rawRecorder) Record(at time.Duration, data []byte) error {
+	_, err := r.w.Write(data)
+	return err
+}
+
+func (r *rawRecorder) Close() error { return nil }
+
+type castRecorder struct {
+	w io.Writer
+}
+
+func (r *castRecorder) Record(at time.Duration, data []byte) error {
+	event, err := json.Marshal([]interface{}{at.Seconds(), "o", string(data)})
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(r.w, "%s\n", event)
+	return err
+}
+
+func (r *castRecorder) Close() error { return nil }
+
+// camera is the replay's viewer connection. It records what it is sent.
+type camera struct {
+	mu    sync.Mutex
+	rec   Recorder
+	start time.Time
+	err   error
+}
+
+func (c *camera) Write(data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err == nil {
+		c.err = c.rec.Record(time.Since(c.start), data)
+	}
+	return c.err
+}
+
+func (c *camera) Close() error { return nil }
+
+// writer adapts the camera for io.Writer users such as sprite uploads.
+type writer struct{ *camera }
+
+func (w writer) Write(data []byte) (int, error) {
+	if err := w.camera.Write(data); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+// virtualClient stands in for a scripted user. Nobody watches its output.
+type virtualClient struct{}
+
+func (virtualClient) Write([]byte) error { return nil }
+func (virtualClient) Close() error       { return nil }
+
+// Run plays the script into room in real time and records the viewer's
+// screen.
+func Run(script *Script, room *aquarium.Manager, rec Recorder) error {
+	cam := &camera{rec: rec, start: time.Now()}
+
+	// Set up the viewer like a real terminal
+	cam.Write([]byte("\x1b[?1049h\x1b[?25l\x1b[2J"))
+	connection.UploadSprites(writer{cam}, nil)
+
+	camID := room.AddConnection(cam, aquarium.ClientInfo{Username: "replay"})
+	room.SetTerminalConfig(&aquarium.TerminalConfig{
+		Columns:    script.Columns,
+		Rows:       script.Rows,
+		CellWidth:  script.CellWidth,
+		CellHeight: script.CellHeight,
+	})
+	room.StartAnimation()
+	room.RepaintBackground()
+
+	clients := make(map[string]uint64)
+	defer func() {
+		for _, id := range clients {
+			room.RemoveConnection(id)
+		}
+		room.RemoveConnection(camID)
+	}()
+
+	for _, ev := range script.Events {
+		time.Sleep(time.Until(cam.start.Add(ev.At)))
+
+		switch ev.Action {
+		case "join":
+			if _, exists := clients[ev.Args[0]]; exists {
+				return fmt.Errorf("line %d: %s already joined", ev.Line, ev.Args[0])
+			}
+			id := room.AddConnection(virtualClient{}, aquarium.ClientInfo{Username: ev.Args[0]})
+			room.AddFish(id, 1)
+			clients[ev.Args[0]] = id
+
+		case "leave":
+			id, ok := clients[ev.Args[0]]
+			if !ok {
+				return fmt.Errorf("line %d: %s has not joined", ev.Line, ev.Args[0])
+			}
+			room.RemoveConnection(id)
+			delete(clients, ev.Args[0])
+
+		case "click":
+			id, ok := clients[ev.Args[0]]
+			if !ok {
+				return fmt.Errorf("line %d: %s has not joined", ev.Line, ev.Args[0])
+			}
+			col, row, err := parseCell(ev.Args[1], ev.Args[2])
+			if err != nil {
+				return fmt.Errorf("line %d: %w", ev.Line, err)
+			}
+			// Terminals report the release right after, letting go of a
+			// fish the click picked up
+			room.HandleMouseClick(id, 0, col, row)
+			room.HandleMouseDrag(id, col, row, true)
+
+		case "feed":
+			col, row, err := parseCell(ev.Args[0], ev.Args[1])
+			if err != nil {
+				return fmt.Errorf("line %d: %w", ev.Line, err)
+			}
+			room.DropFood(float64((col-1)*script.CellWidth+script.CellWidth/2), float64((row-1)*script.CellHeight))
+
+		case "theme":
+			theme, ok := aquarium.ThemeByName(ev.Args[0])
+			if !ok {
+				return fmt.Errorf("line %d: unknown theme %q", ev.Line, ev.Args[0])
+			}
+			room.SetTheme(theme)
+
+		case "end":
+			log.Printf("Replay finished after %v", ev.At)
+			return cam.finish()
+		}
+	}
+	return cam.finish()
+}
+
+// finish restores the viewer's terminal and reports recording errors.
+func (c *camera) finish() error {
+	c.Write([]byte("\x1b_Ga=d,d=A,q=1\x1b\\\x1b[0m\x1b[2J\x1b[?1049l\x1b[?25h"))
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return c.err
+	}
+	return c.rec.Close()
+}
+
+func parseCell(colArg, rowArg string) (int, int, error) {
+	col, err := strconv.Atoi(colArg)
+	if err != nil || col < 1 {
+		return 0, 0, fmt.Errorf("invalid column %q", colArg)
+	}
+	row, err := strconv.Atoi(rowArg)
+	if err != nil || row < 1 {
+		return 0, 0, fmt.Errorf("invalid row %q", rowArg)
+	}
+	return col, row, nil
+}
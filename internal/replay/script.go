@@ -0,0 +1,123 @@
+// Package replay plays scripted sessions into an aquarium without real SSH
+// clients and records what a viewer would have seen.
+package replay
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Script is a timed sequence of events. The format is line based:
+//
+//	# comments and blank lines are ignored
+//	size 100x30 10x20        # columns x rows, cell width x height in pixels
+//	0s    join alice         # alice connects and gets a fish
+//	2s    click alice 20 5   # alice clicks column 20, row 5
+//	3s    feed 40 2          # food dropped at column 40, row 2
+//	5s    theme lagoon
+//	8s    leave alice
+//	12s   end                # stop recording
+//
+// Event times are offsets from the start and must not go backwards.
+type Script struct {
+	Columns    int
+	Rows       int
+	CellWidth  int
+	CellHeight int
+	Events     []Event
+}
+
+// Event is one scripted action.
+type Event struct {
+	At     time.Duration
+	Action string
+	Args   []string
+	Line   int
+}
+
+// actions maps each action to its number of arguments.
+var actions = map[string]int{
+	"join":  1,
+	"leave": 1,
+	"click": 3,
+	"feed":  2,
+	"theme": 1,
+	"end":   0,
+}
+
+// Parse reads a script.
+func Parse(r io.Reader) (*Script, error) {
+	script := &Script{Columns: 80, Rows: 24, CellWidth: 8, CellHeight: 16}
+
+	scanner := bufio.NewScanner(r)
+	line := 0
+	var last time.Duration
+	for scanner.Scan() {
+		line++
+		text, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+
+		if fields[0] == "size" {
+			if len(fields) != 3 {
+				return nil, fmt.Errorf("line %d: size needs columnsxrows and cell widthxheight", line)
+			}
+			var err error
+			if script.Columns, script.Rows, err = parsePair(fields[1]); err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			if script.CellWidth, script.CellHeight, err = parsePair(fields[2]); err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			continue
+		}
+
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("line %d: expected a time and an action", line)
+		}
+		at, err := time.ParseDuration(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if at < last {
+			return nil, fmt.Errorf("line %d: event at %v is before the previous one at %v", line, at, last)
+		}
+		last = at
+
+		action, args := fields[1], fields[2:]
+		want, ok := actions[action]
+		if !ok {
+			return nil, fmt.Errorf("line %d: unknown action %q", line, action)
+		}
+		if len(args) != want {
+			return nil, fmt.Errorf("line %d: %s takes %d arguments, got %d", line, action, want, len(args))
+		}
+		script.Events = append(script.Events, Event{At: at, Action: action, Args: args, Line: line})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return script, nil
+}
+
+func parsePair(s string) (int, int, error) {
+	a, b, ok := strings.Cut(s, "x")
+	if !ok {
+		return 0, 0, fmt.Errorf("expected AxB, got %q", s)
+	}
+	x, err := strconv.Atoi(a)
+	if err != nil || x <= 0 {
+		return 0, 0, fmt.Errorf("invalid size %q", s)
+	}
+	y, err := strconv.Atoi(b)
+	if err != nil || y <= 0 {
+		return 0, 0, fmt.Errorf("invalid size %q", s)
+	}
+	return x, y, nil
+}
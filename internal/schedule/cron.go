@@ -0,0 +1,151 @@
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Spec is a cron expression: minute, hour, day of month, month and day of
+// week, matched against local time.
+type Spec struct {
+	minute, hour, day, month, weekday uint64 // a bit for each value that matches
+	anyDay, anyWeekday                bool
+}
+
+// cronFields are the fields of a cron expression with their ranges and the
+// names they accept.
+var cronFields = []struct {
+	name     string
+	min, max int
+	names    []string // for the values from min on
+}{
+	{"minute", 0, 59, nil},
+	{"hour", 0, 23, nil},
+	{"day of month", 1, 31, nil},
+	{"month", 1, 12, []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}},
+	{"day of week", 0, 7, []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}},
+}
+
+// macros are the shorthands cron accepts instead of five fields.
+var macros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// ParseSpec parses five cron fields such as "0 18 * * *" or "*/15 9-17 *
+// * mon-fri", or a macro such as "@hourly". Like cron, a day matches when
+// either the day of month or the day of week does, unless one of them is *.
+func ParseSpec(s string) (Spec, error) {
+	if macro, ok := macros[strings.TrimSpace(s)]; ok {
+		s = macro
+	}
+	fields := strings.Fields(s)
+	if len(fields) != len(cronFields) {
+		return Spec{}, fmt.Errorf("expected %d fields or a macro such as @hourly, got %q", len(cronFields), s)
+	}
+
+	var bits [5]uint64
+	for i, field := range fields {
+		set, err := parseField(field, i)
+		if err != nil {
+			return Spec{}, fmt.Errorf("%s: %w", cronFields[i].name, err)
+		}
+		bits[i] = set
+	}
+
+	// Sunday is 0 or 7
+	weekday := bits[4]
+	if weekday&(1<<7) != 0 {
+		weekday = weekday&^(1<<7) | 1
+	}
+	return Spec{
+		minute:     bits[0],
+		hour:       bits[1],
+		day:        bits[2],
+		month:      bits[3],
+		weekday:    weekday,
+		anyDay:     fields[2] == "*",
+		anyWeekday: fields[4] == "*",
+	}, nil
+}
+
+// parseField parses a list of values, ranges and steps such as "1,5-9,*/2"
+// into a bit set.
+func parseField(field string, index int) (uint64, error) {
+	def := cronFields[index]
+	var set uint64
+	for _, part := range strings.Split(field, ",") {
+		rng, stepText, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepText)
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("invalid step %q", stepText)
+			}
+			step = n
+		}
+
+		first, last := def.min, def.max
+		if rng != "*" {
+			lo, hi, isRange := strings.Cut(rng, "-")
+			var err error
+			if first, err = parseValue(lo, index); err != nil {
+				return 0, err
+			}
+			switch {
+			case isRange:
+				if last, err = parseValue(hi, index); err != nil {
+					return 0, err
+				}
+			case !hasStep:
+				last = first // a single value, "5/10" runs from 5 to the end
+			}
+			if last < first {
+				return 0, fmt.Errorf("range %q runs backwards", rng)
+			}
+		}
+		for v := first; v <= last; v += step {
+			set |= 1 << v
+		}
+	}
+	return set, nil
+}
+
+func parseValue(s string, index int) (int, error) {
+	def := cronFields[index]
+	for i, name := range def.names {
+		if strings.EqualFold(s, name) {
+			return def.min + i, nil
+		}
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < def.min || v > def.max {
+		return 0, fmt.Errorf("%q is not between %d and %d", s, def.min, def.max)
+	}
+	return v, nil
+}
+
+// Match reports whether the spec matches the minute t falls in.
+func (s Spec) Match(t time.Time) bool {
+	if s.minute&(1<<t.Minute()) == 0 || s.hour&(1<<t.Hour()) == 0 || s.month&(1<<int(t.Month())) == 0 {
+		return false
+	}
+	day := s.day&(1<<t.Day()) != 0
+	weekday := s.weekday&(1<<int(t.Weekday())) != 0
+	switch {
+	case s.anyDay && s.anyWeekday:
+		return true
+	case s.anyDay:
+		return weekday
+	case s.anyWeekday:
+		return day
+	}
+	return day || weekday
+}
@@ -0,0 +1,161 @@
+// Package schedule runs events in the rooms at times given as cron
+// expressions, e.g. a feeding frenzy every evening.
+package schedule
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/acuqa/ssh-aquarium/internal/aquarium"
+)
+
+// Events that can be scheduled, with what they do in a room.
+var events = map[string]func(room *aquarium.Manager, text string){
+	"frenzy":   func(room *aquarium.Manager, text string) { room.FeedingFrenzy() },
+	"storm":    func(room *aquarium.Manager, text string) { room.SetStorm(true) },
+	"announce": func(room *aquarium.Manager, text string) { room.Announce(text) },
+}
+
+// Entry is one line of a schedule.
+type Entry struct {
+	Spec  Spec
+	Room  string // * for all rooms
+	Event string
+	Text  string // what announce shows
+	Line  int
+}
+
+// Load reads a schedule file. Each line holds a cron expression, a room (or
+// * for all rooms), an event and, for announce, the text to show:
+//
+//	# minute hour day month weekday  room  event
+//	0 18 * * *                       *     frenzy
+//	@hourly                          reef  storm
+//	30 9 * * mon-fri                 lobby announce good morning, fish!
+func Load(path string) ([]Entry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open schedule: %w", err)
+	}
+	defer file.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(file)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		specFields := len(cronFields)
+		if strings.HasPrefix(fields[0], "@") {
+			specFields = 1
+		}
+		if len(fields) < specFields+2 {
+			return nil, fmt.Errorf("%s:%d: expected \"schedule room event\"", path, lineNo)
+		}
+		spec, err := ParseSpec(strings.Join(fields[:specFields], " "))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, lineNo, err)
+		}
+
+		entry := Entry{
+			Spec:  spec,
+			Room:  fields[specFields],
+			Event: fields[specFields+1],
+			Text:  strings.Join(fields[specFields+2:], " "),
+			Line:  lineNo,
+		}
+		if _, ok := events[entry.Event]; !ok {
+			return nil, fmt.Errorf("%s:%d: unknown event %q, expected frenzy, storm or announce", path, lineNo, entry.Event)
+		}
+		if entry.Event == "announce" && entry.Text == "" {
+			return nil, fmt.Errorf("%s:%d: announce needs a text", path, lineNo)
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read schedule: %w", err)
+	}
+	return entries, nil
+}
+
+// Scheduler runs scheduled events at the start of each minute they match.
+type Scheduler struct {
+	rooms   *aquarium.Registry
+	entries []Entry
+	stop    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// New checks that every entry's room exists.
+func New(rooms *aquarium.Registry, entries []Entry) (*Scheduler, error) {
+	for _, entry := range entries {
+		if entry.Room != "*" && rooms.Room(entry.Room) == nil {
+			return nil, fmt.Errorf("line %d: unknown room %q", entry.Line, entry.Room)
+		}
+	}
+	return &Scheduler{rooms: rooms, entries: entries, stop: make(chan struct{})}, nil
+}
+
+func (s *Scheduler) Start() {
+	s.wg.Add(1)
+	go s.run()
+}
+
+func (s *Scheduler) Stop() {
+	close(s.stop)
+	s.wg.Wait()
+}
+
+func (s *Scheduler) run() {
+	defer s.wg.Done()
+
+	next := time.Now().Truncate(time.Minute).Add(time.Minute)
+	for {
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-s.stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		for _, entry := range s.entries {
+			if entry.Spec.Match(next) {
+				s.fire(entry)
+			}
+		}
+
+		// After a suspend or a clock change, go on from now instead of
+		// running everything that was missed
+		next = next.Add(time.Minute)
+		if now := time.Now(); now.Sub(next) > time.Minute {
+			next = now.Truncate(time.Minute).Add(time.Minute)
+		}
+	}
+}
+
+func (s *Scheduler) fire(entry Entry) {
+	names := []string{entry.Room}
+	if entry.Room == "*" {
+		names = names[:0]
+		for _, room := range s.rooms.Rooms() {
+			names = append(names, room.Name)
+		}
+	}
+	for _, name := range names {
+		if room := s.rooms.Room(name); room != nil {
+			log.Printf("Schedule: %s in room %q (line %d)", entry.Event, name, entry.Line)
+			events[entry.Event](room, entry.Text)
+		}
+	}
+}
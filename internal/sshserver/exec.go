@@ -0,0 +1,547 @@
+package sshserver
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/acuqa/ssh-aquarium/internal/aquarium"
+	"github.com/acuqa/ssh-aquarium/internal/connection"
+	"golang.org/x/crypto/ssh"
+)
+
+// errUsage makes a command print its usage.
+var errUsage = errors.New("usage")
+
+// command is run by an exec request, e.g. `ssh -p 1234 host layout list`.
+type command struct {
+	name  string
+	usage string
+	help  string
+	admin bool // only for clients authenticated with an admin key
+	run   func(s *Server, client aquarium.ClientInfo, args []string, out io.Writer) error
+}
+
+var commands []command
+
+func init() {
+	commands = []command{
+		{name: "help", help: "list commands", run: runHelp},
+		{name: "list", usage: "list", help: "list public aquariums", run: runList},
+		{name: "stats", usage: "stats " + formatUsage, help: "show fish, rooms, clicks and bubble pops", run: runStats},
+		{name: "who", usage: "who " + formatUsage, help: "list who is watching", run: runWho},
+		{name: "settings", usage: "settings", help: "show your settings", run: runSettings},
+		{name: "fish", usage: "fish", help: "show your fish, remembered by SSH key", run: runFish},
+		{name: "set", usage: "set name <name> | color <color> | motion full|reduced | labels on|off | night on|off | bell on|off | theme <theme>|room", help: "change your settings", run: runSet},
+		{name: "sign", usage: "sign <message>", help: "leave a message in the guestbook", run: runSign},
+		{name: "guestbook", usage: "guestbook", help: "read the guestbook", run: runGuestbook},
+		{name: "check", usage: "check", help: "test what your terminal supports, with ssh -t", run: runCheck},
+		{name: "sessions", usage: "sessions", help: "list connected sessions and their clients", admin: true, run: runSessions},
+		{name: "history", usage: "history [count]", help: "list the sessions that ended most recently", admin: true, run: runHistory},
+		{name: "theme", usage: "theme <name> [room]", help: "switch a room's theme", admin: true, run: runTheme},
+		{name: "speed", usage: "speed [0.25-4]", help: "show or change the simulation speed of all rooms", admin: true, run: runSpeed},
+		{name: "npc", usage: "npc <count> [room]", help: "keep unowned fish in a room", admin: true, run: runNPC},
+		{name: "warp", usage: "warp [<fish> [<x%> <y%>]]", help: "list fish or move one, e.g. when it is stranded off-screen", admin: true, run: runWarp},
+		{name: "moderate", usage: "moderate [approve <id> | remove <id>]", help: "list, approve or remove guestbook messages", admin: true, run: runModerate},
+		{name: "layout", usage: "layout list | save <name> [room] | load <name> [room] | delete <name> | export [room] | import <design> [room]", help: "manage saved tank layouts and shared designs", admin: true, run: runLayout},
+	}
+}
+
+// handleExec runs an exec request's command and reports its exit status.
+func (s *Server) handleExec(channel ssh.Channel, line string, client aquarium.ClientInfo) {
+	log.Printf("User '%s' ran %q", client.Username, line)
+
+	status := s.runCommand(channel, channel.Stderr(), line, client)
+
+	channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{status}))
+	channel.CloseWrite()
+}
+
+// handleCheck runs the terminal self-test on the session's terminal and
+// reports its exit status.
+func (s *Server) handleCheck(channel ssh.Channel, conn *connection.Handler, client aquarium.ClientInfo) {
+	log.Printf("User '%s' ran %q", client.Username, "check")
+
+	status := uint32(0)
+	if err := conn.Check(); err != nil {
+		fmt.Fprintf(channel.Stderr(), "check: %v\n", err)
+		status = 1
+	}
+
+	channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{status}))
+	channel.CloseWrite()
+}
+
+func (s *Server) runCommand(out, errOut io.Writer, line string, client aquarium.ClientInfo) uint32 {
+	args := strings.Fields(line)
+	if len(args) == 0 {
+		args = []string{"help"}
+	}
+
+	for _, cmd := range commands {
+		if cmd.name != args[0] {
+			continue
+		}
+		if cmd.admin && !s.rooms.IsAdmin(client) {
+			fmt.Fprintf(errOut, "%s: permission denied\n", cmd.name)
+			return 1
+		}
+
+		err := cmd.run(s, client, args[1:], out)
+		switch {
+		case errors.Is(err, errUsage):
+			fmt.Fprintf(errOut, "usage: %s\n", cmd.usage)
+			return 2
+		case err != nil:
+			fmt.Fprintf(errOut, "%s: %v\n", cmd.name, err)
+			return 1
+		}
+		return 0
+	}
+
+	fmt.Fprintf(errOut, "unknown command %q, try help\n", args[0])
+	return 127
+}
+
+// roomArg returns the room named by the optional argument at index i, or the
+// default room.
+func (s *Server) roomArg(args []string, i int) (string, *aquarium.Manager, error) {
+	name := s.rooms.DefaultName()
+	if len(args) > i {
+		name = args[i]
+	}
+	room := s.rooms.Room(name)
+	if room == nil {
+		return "", nil, fmt.Errorf("unknown room %q", name)
+	}
+	return name, room, nil
+}
+
+func runHelp(s *Server, client aquarium.ClientInfo, args []string, out io.Writer) error {
+	admin := s.rooms.IsAdmin(client)
+	for _, cmd := range commands {
+		if cmd.admin && !admin {
+			continue
+		}
+		usage := cmd.usage
+		if usage == "" {
+			usage = cmd.name
+		}
+		fmt.Fprintf(out, "%-60s %s\n", usage, cmd.help)
+	}
+	return nil
+}
+
+func runList(s *Server, client aquarium.ClientInfo, args []string, out io.Writer) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+	if s.directory == nil {
+		return errors.New("this aquarium is not connected to a directory")
+	}
+	entries, err := s.directory.List()
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		fmt.Fprintln(out, "no public aquariums right now")
+	}
+	for _, entry := range entries {
+		fmt.Fprintf(out, "%-24s %-32s %d watching\n", entry.Name, entry.Address, entry.Population)
+	}
+	return nil
+}
+
+func runCheck(s *Server, client aquarium.ClientInfo, args []string, out io.Writer) error {
+	// A plain check runs on the session's terminal, see handleCheck
+	return errUsage
+}
+
+func runSettings(s *Server, client aquarium.ClientInfo, args []string, out io.Writer) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+	settings := s.rooms.Settings().Get(client.Fingerprint)
+	name, color := settings.FishName, settings.FishColor
+	if name == "" {
+		name = client.Username + " (SSH user name)"
+	}
+	if color == "" {
+		color = "handed out on connecting"
+	}
+	motion := "full"
+	if settings.ReducedMotion {
+		motion = "reduced"
+	}
+	theme := settings.Theme
+	if theme == "" {
+		theme = "the room's"
+	}
+	fmt.Fprintf(out, "name    %s\ncolor   %s\nmotion  %s\nlabels  %s\nnight   %s\nbell    %s\ntheme   %s\n", name, color, motion, onOff(!settings.HideLabels), onOff(settings.NightLight), onOff(settings.Bell), theme)
+	if client.Fingerprint == "" {
+		fmt.Fprintln(out, "\nlog in with an SSH key to keep settings between sessions")
+	}
+	return nil
+}
+
+func runFish(s *Server, client aquarium.ClientInfo, args []string, out io.Writer) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+	if client.Fingerprint == "" {
+		return errors.New("fish are remembered by SSH key, log in with one")
+	}
+	fish, ok := s.rooms.Owners().Get(client.Fingerprint)
+	if !ok || fish.Name == "" {
+		fmt.Fprintln(out, "no fish yet, start a session to get one")
+		return nil
+	}
+	fmt.Fprintf(out, "name      %s\ncolor     %s\nsize      %.2f\neaten     %d pellets\nsessions  %d, %v in the water\nsince     %s\n",
+		fish.Name, fish.Color, fish.Size, fish.Eaten, fish.Sessions, fish.TimeSwum, fish.FirstSeen.Format("2006-01-02"))
+	fmt.Fprintf(out, "identity  %s\n", client.Fingerprint)
+	return nil
+}
+
+func runSet(s *Server, client aquarium.ClientInfo, args []string, out io.Writer) error {
+	if len(args) < 1 {
+		return errUsage
+	}
+	if client.Fingerprint == "" {
+		return errors.New("settings are remembered by SSH key, log in with one")
+	}
+
+	settings := s.rooms.Settings().Get(client.Fingerprint)
+	value := strings.Join(args[1:], " ")
+	switch {
+	case args[0] == "name":
+		if err := settings.SetFishName(value); err != nil {
+			return err
+		}
+	case args[0] == "color" && len(args) <= 2:
+		if err := settings.SetFishColor(value); err != nil {
+			return err
+		}
+	case args[0] == "motion" && (value == "full" || value == "reduced"):
+		settings.ReducedMotion = value == "reduced"
+	case args[0] == "labels" && (value == "on" || value == "off"):
+		settings.HideLabels = value == "off"
+	case args[0] == "night" && (value == "on" || value == "off"):
+		settings.NightLight = value == "on"
+	case args[0] == "bell" && (value == "on" || value == "off"):
+		settings.Bell = value == "on"
+	case args[0] == "theme" && len(args) == 2:
+		if value == "room" {
+			value = ""
+		}
+		if err := settings.SetTheme(value); err != nil {
+			return err
+		}
+	default:
+		return errUsage
+	}
+
+	if err := s.rooms.Settings().Set(client.Fingerprint, settings); err != nil {
+		return err
+	}
+	fmt.Fprintln(out, "saved, applies from your next session")
+	return nil
+}
+
+func onOff(on bool) string {
+	if on {
+		return "on"
+	}
+	return "off"
+}
+
+func runSign(s *Server, client aquarium.ClientInfo, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	name := s.rooms.Settings().Get(client.Fingerprint).FishName
+	if name == "" {
+		name = client.Username
+	}
+	admin := s.rooms.IsAdmin(client)
+	entry, err := s.rooms.Guestbook().Sign(name, strings.Join(args, " "), admin)
+	if err != nil {
+		return err
+	}
+	log.Printf("User '%s' signed the guestbook as entry %d", client.Username, entry.ID)
+	if admin {
+		fmt.Fprintln(out, "thanks for signing!")
+	} else {
+		fmt.Fprintln(out, "thanks for signing! your message shows up once an admin approved it")
+	}
+	return nil
+}
+
+func runGuestbook(s *Server, client aquarium.ClientInfo, args []string, out io.Writer) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+	entries := s.rooms.Guestbook().Entries()
+	if len(entries) == 0 {
+		fmt.Fprintln(out, "nobody signed the guestbook yet, be the first with: sign <message>")
+	}
+	for _, entry := range entries {
+		fmt.Fprintf(out, "%s  %-20s %s\n", entry.SignedAt.Format("2006-01-02"), entry.Name, entry.Message)
+	}
+	return nil
+}
+
+func runModerate(s *Server, client aquarium.ClientInfo, args []string, out io.Writer) error {
+	guestbook := s.rooms.Guestbook()
+	if len(args) == 0 {
+		pending := guestbook.Pending()
+		if len(pending) == 0 {
+			fmt.Fprintln(out, "no messages waiting for approval")
+		}
+		for _, entry := range pending {
+			fmt.Fprintf(out, "%-6d %s  %-20s %s\n", entry.ID, entry.SignedAt.Format("2006-01-02 15:04"), entry.Name, entry.Message)
+		}
+		return nil
+	}
+	if len(args) != 2 {
+		return errUsage
+	}
+	id, err := strconv.ParseUint(args[1], 10, 64)
+	if err != nil {
+		return errUsage
+	}
+
+	switch args[0] {
+	case "approve":
+		err = guestbook.Approve(id)
+	case "remove":
+		err = guestbook.Remove(id)
+	default:
+		return errUsage
+	}
+	if err != nil {
+		return err
+	}
+	log.Printf("User '%s' moderated guestbook entry %d: %s", client.Username, id, args[0])
+	fmt.Fprintf(out, "entry %d: %sd\n", id, args[0])
+	return nil
+}
+
+func runSessions(s *Server, client aquarium.ClientInfo, args []string, out io.Writer) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+	for _, session := range s.rooms.Sessions() {
+		terminal := session.TermProgram
+		if terminal == "" {
+			terminal = "-"
+		}
+		fmt.Fprintf(out, "%-6d %-10s %-16s %-40s %-16s %-30s %-6s %-10s %d bytes\n", session.ID, session.Room, session.Username,
+			session.ClientVersion, terminal, session.Transport.Cipher, session.Transport.Compression,
+			time.Since(session.ConnectedAt).Round(time.Second), session.SessionBytes)
+	}
+	fmt.Fprintln(out)
+	for _, count := range s.rooms.ClientCounts() {
+		fmt.Fprintf(out, "%-24s %d\n", count.Software, count.Sessions)
+	}
+	return nil
+}
+
+func runHistory(s *Server, client aquarium.ClientInfo, args []string, out io.Writer) error {
+	count := 20
+	switch len(args) {
+	case 0:
+	case 1:
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 1 {
+			return errUsage
+		}
+		count = n
+	default:
+		return errUsage
+	}
+	for _, session := range s.rooms.History().Recent(count) {
+		terminal := session.TermProgram
+		if terminal == "" {
+			terminal = "-"
+		}
+		// Sessions recorded before they were counted whole have the
+		// bytes of their last room only
+		sent := session.SessionBytes
+		if sent == 0 {
+			sent = session.BytesSent
+		}
+		fmt.Fprintf(out, "%-16s %-10s %-16s %-16s %-10v %d frames, %d bytes\n", session.Started.Format("2006-01-02 15:04"),
+			session.Room, session.Username, terminal, session.Duration, session.FramesSent, sent)
+	}
+	return nil
+}
+
+func runTheme(s *Server, client aquarium.ClientInfo, args []string, out io.Writer) error {
+	if len(args) < 1 || len(args) > 2 {
+		return errUsage
+	}
+	theme, ok := aquarium.ThemeByName(args[0])
+	if !ok {
+		return fmt.Errorf("unknown theme %q", args[0])
+	}
+	name, room, err := s.roomArg(args, 1)
+	if err != nil {
+		return err
+	}
+	room.SetTheme(theme)
+	fmt.Fprintf(out, "%s now uses the %s theme\n", name, theme.Name)
+	return nil
+}
+
+func runSpeed(s *Server, client aquarium.ClientInfo, args []string, out io.Writer) error {
+	if len(args) > 1 {
+		return errUsage
+	}
+	if len(args) == 1 {
+		speed, err := aquarium.ParseSpeed(args[0])
+		if err != nil {
+			return err
+		}
+		s.rooms.SetSpeed(speed)
+		log.Printf("User '%s' set the simulation speed to %s", client.Username, aquarium.FormatSpeed(speed))
+	}
+	fmt.Fprintf(out, "simulation runs at %s\n", aquarium.FormatSpeed(s.rooms.Speed()))
+	return nil
+}
+
+func runNPC(s *Server, client aquarium.ClientInfo, args []string, out io.Writer) error {
+	if len(args) < 1 || len(args) > 2 {
+		return errUsage
+	}
+	count, err := strconv.Atoi(args[0])
+	if err != nil || count < 0 || count > aquarium.MaxNPCFish {
+		return fmt.Errorf("count must be between 0 and %d", aquarium.MaxNPCFish)
+	}
+	name, room, err := s.roomArg(args, 1)
+	if err != nil {
+		return err
+	}
+	room.SetNPCFish(count)
+	fmt.Fprintf(out, "%s keeps at least %d unowned fish\n", name, count)
+	return nil
+}
+
+func runWarp(s *Server, client aquarium.ClientInfo, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		for _, fish := range s.rooms.FishInfo() {
+			name := fish.Username
+			if name == "" {
+				name = "-"
+			}
+			fmt.Fprintf(out, "%-6d %-10s %-16s %s\n", fish.ID, fish.Room, name, fish.Species)
+		}
+		return nil
+	}
+	if len(args) != 1 && len(args) != 3 {
+		return errUsage
+	}
+	id, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil {
+		return errUsage
+	}
+	// The middle of the tank unless told otherwise
+	x, y := 50.0, 50.0
+	if len(args) == 3 {
+		x, err = strconv.ParseFloat(strings.TrimSuffix(args[1], "%"), 64)
+		if err != nil || x < 0 || x > 100 {
+			return errors.New("x must be between 0 and 100 percent")
+		}
+		y, err = strconv.ParseFloat(strings.TrimSuffix(args[2], "%"), 64)
+		if err != nil || y < 0 || y > 100 {
+			return errors.New("y must be between 0 and 100 percent")
+		}
+	}
+	room, err := s.rooms.WarpFish(id, x/100, y/100)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "fish %d in %s warps to %g%%, %g%%\n", id, room, x, y)
+	return nil
+}
+
+func runLayout(s *Server, client aquarium.ClientInfo, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+
+	switch {
+	case args[0] == "list" && len(args) == 1:
+		slots, err := s.rooms.Layouts()
+		if err != nil {
+			return err
+		}
+		names := make([]string, 0, len(slots))
+		for name := range slots {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			l := slots[name]
+			fmt.Fprintf(out, "%-16s theme=%s floor=%s npc=%d\n", name, l.Theme, l.Floor, l.NPCFish)
+		}
+		return nil
+
+	case args[0] == "save" && (len(args) == 2 || len(args) == 3):
+		room, _, err := s.roomArg(args, 2)
+		if err != nil {
+			return err
+		}
+		if err := s.rooms.SaveLayout(args[1], room); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "saved %s as %q\n", room, args[1])
+		return nil
+
+	case args[0] == "load" && (len(args) == 2 || len(args) == 3):
+		room, _, err := s.roomArg(args, 2)
+		if err != nil {
+			return err
+		}
+		if err := s.rooms.LoadLayout(args[1], room); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "%s now uses %q\n", room, args[1])
+		return nil
+
+	case args[0] == "delete" && len(args) == 2:
+		if err := s.rooms.DeleteLayout(args[1]); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "deleted %q\n", args[1])
+		return nil
+
+	case args[0] == "export" && len(args) <= 2:
+		_, m, err := s.roomArg(args, 1)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(out, m.Layout().Design())
+		return nil
+
+	case args[0] == "import" && (len(args) == 2 || len(args) == 3):
+		room, m, err := s.roomArg(args, 2)
+		if err != nil {
+			return err
+		}
+		layout, err := aquarium.ParseDesign(args[1])
+		if err != nil {
+			return err
+		}
+		if err := m.ApplyLayout(layout); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "%s now uses the design\n", room)
+		return nil
+	}
+	return errUsage
+}
@@ -0,0 +1,160 @@
+package sshserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/acuqa/ssh-aquarium/internal/aquarium"
+	"github.com/acuqa/ssh-aquarium/internal/metrics"
+)
+
+// outputFormat is how a query command prints its result: as a table for
+// people, or for scripts as JSON, the same as the web API, or in the
+// Prometheus text format, the same as /metrics.
+type outputFormat int
+
+const (
+	formatTable outputFormat = iota
+	formatJSON
+	formatProm
+)
+
+// formatUsage is appended to the usage of query commands.
+const formatUsage = "[--table | --json | --prom]"
+
+// formatFlag takes the output format flag out of args.
+func formatFlag(args []string) (outputFormat, []string, error) {
+	format := formatTable
+	rest := make([]string, 0, len(args))
+	seen := false
+	for _, arg := range args {
+		var f outputFormat
+		switch arg {
+		case "--table":
+			f = formatTable
+		case "--json":
+			f = formatJSON
+		case "--prom":
+			f = formatProm
+		default:
+			rest = append(rest, arg)
+			continue
+		}
+		if seen {
+			return 0, nil, errUsage
+		}
+		format, seen = f, true
+	}
+	return format, rest, nil
+}
+
+// writeJSON encodes v as the web API does.
+func writeJSON(out io.Writer, v any) error {
+	return json.NewEncoder(out).Encode(v)
+}
+
+func runStats(s *Server, client aquarium.ClientInfo, args []string, out io.Writer) error {
+	format, args, err := formatFlag(args)
+	if err != nil || len(args) != 0 {
+		return errUsage
+	}
+	stats := s.rooms.Stats()
+
+	switch format {
+	case formatJSON:
+		return writeJSON(out, stats)
+
+	case formatProm:
+		rooms := make([]metrics.Sample, 0, len(stats.Rooms))
+		for _, room := range stats.Rooms {
+			rooms = append(rooms, metrics.Sample{Label: "room", LabelValue: room.Name, Value: float64(room.Population)})
+		}
+		clicks := make([]metrics.Sample, 0, len(stats.Clicks.Counts))
+		for _, name := range sortedKeys(stats.Clicks.Counts) {
+			clicks = append(clicks, metrics.Sample{Label: "fish", LabelValue: name, Value: float64(stats.Clicks.Counts[name])})
+		}
+		pops := make([]metrics.Sample, 0, len(stats.Pops))
+		for _, name := range sortedKeys(stats.Pops) {
+			pops = append(pops, metrics.Sample{Label: "user", LabelValue: name, Value: float64(stats.Pops[name])})
+		}
+		for _, gauge := range []struct {
+			name, help string
+			samples    []metrics.Sample
+		}{
+			{"acqua_fish", "Fish in all rooms.", []metrics.Sample{{Value: float64(stats.Fish)}}},
+			{"acqua_room_watchers", "Connections watching each room.", rooms},
+			{"acqua_fish_clicks_today", "Clicks on each fish today (UTC).", clicks},
+			{"acqua_bubble_pops", "Bubbles each user popped, all time.", pops},
+			{"acqua_unique_visitors", "Unique visitors, all time.", []metrics.Sample{{Value: float64(stats.Visitors)}}},
+		} {
+			if err := metrics.WriteGauge(out, gauge.name, gauge.help, gauge.samples...); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	fmt.Fprintf(out, "fish     %d\n", stats.Fish)
+	fmt.Fprintf(out, "visitors %d\n\n", stats.Visitors)
+	for _, room := range stats.Rooms {
+		fmt.Fprintf(out, "%-24s %d watching\n", room.Name, room.Population)
+	}
+	if len(stats.Clicks.Counts) > 0 {
+		fmt.Fprintf(out, "\nclicks on %s\n", stats.Clicks.Day)
+		for _, name := range sortedKeys(stats.Clicks.Counts) {
+			fmt.Fprintf(out, "%-24s %d\n", name, stats.Clicks.Counts[name])
+		}
+	}
+	if len(stats.Pops) > 0 {
+		fmt.Fprintln(out, "\nbubbles popped")
+		for _, name := range sortedKeys(stats.Pops) {
+			fmt.Fprintf(out, "%-24s %d\n", name, stats.Pops[name])
+		}
+	}
+	return nil
+}
+
+func runWho(s *Server, client aquarium.ClientInfo, args []string, out io.Writer) error {
+	format, args, err := formatFlag(args)
+	if err != nil || len(args) != 0 {
+		return errUsage
+	}
+	watchers := s.rooms.Watchers()
+
+	switch format {
+	case formatJSON:
+		return writeJSON(out, watchers)
+
+	case formatProm:
+		counts := make(map[string]int)
+		for _, watcher := range watchers {
+			counts[watcher.Room]++
+		}
+		samples := make([]metrics.Sample, 0, len(counts))
+		for _, room := range sortedKeys(counts) {
+			samples = append(samples, metrics.Sample{Label: "room", LabelValue: room, Value: float64(counts[room])})
+		}
+		return metrics.WriteGauge(out, "acqua_room_watchers", "Connections watching each room.", samples...)
+	}
+
+	if len(watchers) == 0 {
+		fmt.Fprintln(out, "nobody is watching")
+	}
+	for _, watcher := range watchers {
+		fmt.Fprintf(out, "%-20s %-16s %s\n", watcher.Name, watcher.Room, time.Since(watcher.ConnectedAt).Round(time.Second))
+	}
+	return nil
+}
+
+// sortedKeys returns the keys of m in order, so output is stable.
+func sortedKeys(m map[string]int) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
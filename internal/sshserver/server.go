@@ -5,25 +5,56 @@ import (
 	"log"
 	"net"
 	"os"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/acuqa/ssh-aquarium/internal/aquarium"
 	"github.com/acuqa/ssh-aquarium/internal/connection"
+	"github.com/acuqa/ssh-aquarium/internal/directory"
+	"github.com/acuqa/ssh-aquarium/internal/doorbell"
+	"github.com/acuqa/ssh-aquarium/internal/metrics"
 	"golang.org/x/crypto/ssh"
 )
 
+// fingerprintExtension carries the client's key fingerprint from
+// authentication to the session.
+const fingerprintExtension = "pubkey-fp"
+
+// Limits protects the server from clients that connect and then stall.
+type Limits struct {
+	HandshakeTimeout time.Duration // to finish the SSH handshake and authentication
+	StartTimeout     time.Duration // after the handshake, to ask for a shell or a command
+	MaxHandshakes    int           // handshakes in flight at once, further connections are dropped
+}
+
+// DefaultLimits are generous for people on slow links.
+var DefaultLimits = Limits{
+	HandshakeTimeout: 30 * time.Second,
+	StartTimeout:     30 * time.Second,
+	MaxHandshakes:    64,
+}
+
 type Server struct {
 	port        int
 	hostKeyPath string
 	config      *ssh.ServerConfig
 	listener    net.Listener
-	aquarium    *aquarium.Manager
+	rooms       *aquarium.Registry
+	caps        *connection.CapabilityCache
+	directory   directory.Lister
+	doorbell    *doorbell.Bell
+	goodbye     *connection.Goodbye
+	webURL      string
+	limits      Limits
+	handshakes  chan struct{} // one token per handshake in flight
 	mu          sync.Mutex
 	running     bool
 	wg          sync.WaitGroup
 }
 
-func New(port int, hostKeyPath string, aquarium *aquarium.Manager) (*Server, error) {
+func New(port int, hostKeyPath string, rooms *aquarium.Registry) (*Server, error) {
 	// Load host key
 	privateBytes, err := os.ReadFile(hostKeyPath)
 	if err != nil {
@@ -45,7 +76,9 @@ func New(port int, hostKeyPath string, aquarium *aquarium.Manager) (*Server, err
 		// Also allow any public key
 		PublicKeyCallback: func(c ssh.ConnMetadata, pubKey ssh.PublicKey) (*ssh.Permissions, error) {
 			log.Printf("User %s connected with public key", c.User())
-			return &ssh.Permissions{}, nil
+			return &ssh.Permissions{
+				Extensions: map[string]string{fingerprintExtension: ssh.FingerprintSHA256(pubKey)},
+			}, nil
 		},
 	}
 	config.AddHostKey(private)
@@ -54,10 +87,40 @@ func New(port int, hostKeyPath string, aquarium *aquarium.Manager) (*Server, err
 		port:        port,
 		hostKeyPath: hostKeyPath,
 		config:      config,
-		aquarium:    aquarium,
+		rooms:       rooms,
+		caps:        connection.NewCapabilityCache(),
+		limits:      DefaultLimits,
 	}, nil
 }
 
+// SetLimits changes the handshake limits. It must be called before Start.
+func (s *Server) SetLimits(limits Limits) {
+	s.limits = limits
+}
+
+// Capabilities returns the cache of detected terminal capabilities.
+func (s *Server) Capabilities() *connection.CapabilityCache {
+	return s.caps
+}
+
+// SetDirectory lets the list command show the public aquariums dir knows.
+// It must be called before Start.
+func (s *Server) SetDirectory(dir directory.Lister) {
+	s.directory = dir
+}
+
+// SetGoodbye sets the screen printed when an aquarium session ends. It
+// must be called before Start.
+func (s *Server) SetGoodbye(goodbye *connection.Goodbye) {
+	s.goodbye = goodbye
+}
+
+// SetDoorbell rings bell whenever someone other than an admin starts
+// watching. It must be called before Start.
+func (s *Server) SetDoorbell(bell *doorbell.Bell) {
+	s.doorbell = bell
+}
+
 func (s *Server) Start() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -74,6 +137,7 @@ func (s *Server) Start() error {
 
 	s.listener = listener
 	s.running = true
+	s.handshakes = make(chan struct{}, max(1, s.limits.MaxHandshakes))
 
 	// Start accept loop
 	s.wg.Add(1)
@@ -84,9 +148,8 @@ func (s *Server) Start() error {
 
 func (s *Server) Stop() {
 	s.mu.Lock()
-	defer s.mu.Unlock()
-
 	if !s.running {
+		s.mu.Unlock()
 		return
 	}
 
@@ -94,8 +157,11 @@ func (s *Server) Stop() {
 	if s.listener != nil {
 		s.listener.Close()
 	}
+	s.mu.Unlock()
 
+	// The accept loop takes the lock to see it should exit, wait without it
 	s.wg.Wait()
+	s.caps.Save()
 }
 
 func (s *Server) acceptLoop() {
@@ -115,29 +181,74 @@ func (s *Server) acceptLoop() {
 			continue
 		}
 
-		// Handle connection in goroutine
-		go s.handleConnection(conn)
+		// Handle connection in goroutine, unless too many connections are
+		// still busy with their handshake
+		select {
+		case s.handshakes <- struct{}{}:
+			go s.handleConnection(conn)
+		default:
+			metrics.HandshakesDropped.Inc()
+			log.Printf("Dropping connection from %s: %d handshakes in flight", conn.RemoteAddr(), cap(s.handshakes))
+			conn.Close()
+		}
 	}
 }
 
 func (s *Server) handleConnection(netConn net.Conn) {
 	defer netConn.Close()
+	defer metrics.Recover("connection")
 
-	// Perform SSH handshake
+	// Perform SSH handshake, clients that stall in it are cut off
+	if s.limits.HandshakeTimeout > 0 {
+		netConn.SetDeadline(time.Now().Add(s.limits.HandshakeTimeout))
+	}
 	sshConn, chans, reqs, err := ssh.NewServerConn(netConn, s.config)
+	<-s.handshakes
 	if err != nil {
-		log.Printf("Failed to handshake: %v", err)
+		metrics.HandshakeFailures.Inc()
+		log.Printf("Failed to handshake with %s: %v", netConn.RemoteAddr(), err)
 		return
 	}
 	defer sshConn.Close()
+	netConn.SetDeadline(time.Time{})
 
-	// Get username from connection
-	username := sshConn.User()
+	// Get client identity from connection
+	client := aquarium.ClientInfo{
+		Username:      sshConn.User(),
+		RemoteAddr:    sshConn.RemoteAddr().String(),
+		ClientVersion: string(sshConn.ClientVersion()),
+	}
+	if sshConn.Permissions != nil {
+		client.Fingerprint = sshConn.Permissions.Extensions[fingerprintExtension]
+	}
+	if conn, ok := sshConn.Conn.(ssh.AlgorithmsConnMetadata); ok {
+		algorithms := conn.Algorithms()
+		client.Transport = aquarium.Transport{
+			KeyExchange: algorithms.KeyExchange,
+			HostKey:     algorithms.HostKey,
+			Cipher:      algorithms.Write.Cipher,
+			MAC:         algorithms.Write.MAC,
+			Compression: "none", // the only compression x/crypto/ssh offers
+		}
+	}
+	log.Printf("User '%s' connected from %s using %q", client.Username, client.RemoteAddr, client.ClientVersion)
 
 	// Discard global requests
 	go ssh.DiscardRequests(reqs)
 
+	// Connections that never ask for a shell or a command are reaped
+	started := func() {}
+	if s.limits.StartTimeout > 0 {
+		timer := time.AfterFunc(s.limits.StartTimeout, func() {
+			log.Printf("User '%s' did not start a session within %v, disconnecting", client.Username, s.limits.StartTimeout)
+			sshConn.Close()
+		})
+		defer timer.Stop()
+		started = func() { timer.Stop() }
+	}
+
 	// Handle channels
+	var watching atomic.Bool
 	for newChannel := range chans {
 		if newChannel.ChannelType() != "session" {
 			newChannel.Reject(ssh.UnknownChannelType, "unknown channel type")
@@ -151,18 +262,32 @@ func (s *Server) handleConnection(netConn net.Conn) {
 		}
 
 		// Handle session in goroutine
-		go s.handleSession(channel, requests, username)
+		go s.handleSession(channel, requests, client, started, &watching)
 	}
 }
 
-func (s *Server) handleSession(channel ssh.Channel, requests <-chan *ssh.Request, username string) {
+// SetWebURL sets the aquarium's web page, linked from overlays. It must be
+// called before Start.
+func (s *Server) SetWebURL(address string) {
+	s.webURL = address
+}
+
+// handleSession serves a session channel. started is called once the client
+// asked for a shell or a command. watching is shared by the connection's
+// channels: commands can run next to the aquarium, e.g. over a multiplexed
+// connection, but a connection shows the aquarium only once, as a second
+// view would bring a second fish for the same user.
+func (s *Server) handleSession(channel ssh.Channel, requests <-chan *ssh.Request, client aquarium.ClientInfo, started func(), watching *atomic.Bool) {
 	defer channel.Close()
+	defer metrics.Recover("session")
 
 	// Create connection handler
-	conn := connection.New(channel, s.aquarium, username)
+	conn := connection.New(channel, s.rooms, client, s.caps)
+	conn.SetGoodbye(s.goodbye)
+	conn.SetWebURL(s.webURL)
 	defer conn.Close()
 	
-	log.Printf("User '%s' started aquarium session", username)
+	log.Printf("User '%s' started aquarium session", client.Username)
 
 	// Handle requests
 	for req := range requests {
@@ -185,14 +310,60 @@ func (s *Server) handleSession(channel ssh.Channel, requests <-chan *ssh.Request
 			}
 
 		case "shell":
+			started()
 			if req.WantReply {
 				req.Reply(true, nil)
 			}
+			if !watching.CompareAndSwap(false, true) {
+				log.Printf("User '%s' asked for a second aquarium on one connection", client.Username)
+				refuseSession(channel)
+				return
+			}
+			defer watching.Store(false)
+			
+			// Let the owner know someone dropped by
+			if s.doorbell != nil && !s.rooms.IsAdmin(client) {
+				s.doorbell.Ring(doorbell.Visitor{
+					Username:    client.Username,
+					Fingerprint: client.Fingerprint,
+					RemoteAddr:  client.RemoteAddr,
+				})
+			}
 			
 			// Start aquarium session
 			log.Printf("Connection %d: Starting session", conn.ID())
 			conn.Start()
 
+		case "exec":
+			var payload struct{ Command string }
+			if err := ssh.Unmarshal(req.Payload, &payload); err != nil {
+				req.Reply(false, nil)
+				continue
+			}
+			started()
+			if req.WantReply {
+				req.Reply(true, nil)
+			}
+			
+			// Commands run instead of the aquarium and end the session.
+			// The self-test talks to the terminal, the handler runs it.
+			if strings.TrimSpace(payload.Command) == "check" {
+				s.handleCheck(channel, conn, client)
+				return
+			}
+			s.handleExec(channel, payload.Command, client)
+			return
+
+		case "env":
+			var payload struct{ Name, Value string }
+			ok := ssh.Unmarshal(req.Payload, &payload) == nil && conn.SetEnv(payload.Name, payload.Value)
+			if ok {
+				log.Printf("User '%s' sent %s=%q", client.Username, payload.Name, payload.Value)
+			}
+			if req.WantReply {
+				req.Reply(ok, nil)
+			}
+
 		case "window-change":
 			w, h, ok := parseWindowChange(req.Payload)
 			if ok {
@@ -211,6 +382,15 @@ func (s *Server) handleSession(channel ssh.Channel, requests <-chan *ssh.Request
 	}
 }
 
+// refuseSession tells the client that its connection already shows the
+// aquarium and ends the session.
+func refuseSession(channel ssh.Channel) {
+	fmt.Fprint(channel.Stderr(), "This connection already shows the aquarium. For a second view, open a new\r\n"+
+		"connection, e.g. with ssh -o ControlPath=none.\r\n")
+	channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{1}))
+	channel.CloseWrite()
+}
+
 func parsePtyRequest(payload []byte) (width, height uint32, ok bool) {
 	if len(payload) < 8 {
 		return 0, 0, false
@@ -0,0 +1,167 @@
+package store
+
+import (
+	"time"
+)
+
+// Names of the records the typed methods of Dir, Memory and SQLite keep
+// the entities in.
+const (
+	settingsRecord    = "settings"
+	fishRecord        = "fish"
+	sessionsRecord    = "sessions"
+	clicksRecord      = "clicks"
+	popsRecord        = "pops"
+	visitorsRecord    = "visitors"
+	guestbookRecord   = "guestbook"
+	layoutSeedsRecord = "layouts"
+	layoutsRecord     = "layout-slots"
+)
+
+// Settings are a user's preferences, by SSH key fingerprint.
+type Settings struct {
+	FishName      string `json:"fish_name,omitempty"`  // shown instead of the SSH user name
+	FishColor     string `json:"fish_color,omitempty"` // one of aquarium.FishColors
+	ReducedMotion bool   `json:"reduced_motion,omitempty"`
+	HideLabels    bool   `json:"hide_labels,omitempty"`
+	NightLight    bool   `json:"night_light,omitempty"` // warmer, dimmer colors late at night
+	Bell          bool   `json:"bell,omitempty"`        // ring the terminal bell when someone joins or pokes your fish
+	Theme         string `json:"theme,omitempty"`       // one of aquarium.Themes for this user's view only, empty for the room's
+}
+
+// OwnedFish is what is remembered about a user's fish between sessions.
+type OwnedFish struct {
+	Name      string        `json:"name"`  // the name it had last
+	Color     string        `json:"color"` // one of aquarium.FishColors
+	Size      float64       `json:"size"`
+	Eaten     int           `json:"eaten"` // food pellets, all time
+	Sessions  int           `json:"sessions"`
+	TimeSwum  time.Duration `json:"time_swum"` // in all sessions so far
+	FirstSeen time.Time     `json:"first_seen"`
+	LastSeen  time.Time     `json:"last_seen"`
+}
+
+// Session is a session that ended. Like visitors, it doesn't keep the
+// client's address.
+type Session struct {
+	Room         string        `json:"room"`
+	Username     string        `json:"username"`
+	Fingerprint  string        `json:"fingerprint,omitempty"`
+	TermProgram  string        `json:"term_program,omitempty"`
+	Started      time.Time     `json:"started"`
+	Duration     time.Duration `json:"duration_ns"`
+	FramesSent   uint64        `json:"frames_sent"`
+	BytesSent    uint64        `json:"bytes_sent"`
+	SessionBytes uint64        `json:"session_bytes,omitempty"` // over the whole session, 0 if recorded before it was counted
+}
+
+// ClickCounts is how often each fish was clicked on one day, keyed by the
+// fish's name.
+type ClickCounts struct {
+	Day    string         `json:"day"`
+	Counts map[string]int `json:"counts"`
+}
+
+// GuestbookEntry is a message a visitor left.
+type GuestbookEntry struct {
+	ID       uint64    `json:"id"`
+	Name     string    `json:"name"`
+	Message  string    `json:"message"`
+	SignedAt time.Time `json:"signed_at"`
+	Approved bool      `json:"approved"` // shown to everyone, otherwise waiting for an admin
+}
+
+// Layout is how a tank is set up, independent of who is in it.
+type Layout struct {
+	Theme      string `json:"theme"`
+	Floor      string `json:"floor"`
+	LayoutSeed int64  `json:"layout_seed"`
+	NPCFish    int    `json:"npc_fish"`
+}
+
+// entities implements the typed methods of Store for backends keeping each
+// entity as one record, encoded by their own Load and Save.
+type entities struct {
+	records interface {
+		Load(name string, v any) error
+		Save(name string, v any) error
+	}
+}
+
+func (e entities) LoadSettings() (map[string]Settings, error) {
+	return load[map[string]Settings](e, settingsRecord)
+}
+
+func (e entities) SaveSettings(settings map[string]Settings) error {
+	return e.records.Save(settingsRecord, settings)
+}
+
+func (e entities) LoadFish() (map[string]OwnedFish, error) {
+	return load[map[string]OwnedFish](e, fishRecord)
+}
+
+func (e entities) SaveFish(fish map[string]OwnedFish) error {
+	return e.records.Save(fishRecord, fish)
+}
+
+func (e entities) LoadSessions() ([]Session, error) {
+	return load[[]Session](e, sessionsRecord)
+}
+
+func (e entities) SaveSessions(sessions []Session) error {
+	return e.records.Save(sessionsRecord, sessions)
+}
+
+func (e entities) LoadClicks() (ClickCounts, error) {
+	return load[ClickCounts](e, clicksRecord)
+}
+
+func (e entities) SaveClicks(clicks ClickCounts) error {
+	return e.records.Save(clicksRecord, clicks)
+}
+
+func (e entities) LoadPops() (map[string]int, error) {
+	return load[map[string]int](e, popsRecord)
+}
+
+func (e entities) SavePops(pops map[string]int) error {
+	return e.records.Save(popsRecord, pops)
+}
+
+func (e entities) LoadVisitors() ([]string, error) {
+	return load[[]string](e, visitorsRecord)
+}
+
+func (e entities) SaveVisitors(hashes []string) error {
+	return e.records.Save(visitorsRecord, hashes)
+}
+
+func (e entities) LoadGuestbook() ([]GuestbookEntry, error) {
+	return load[[]GuestbookEntry](e, guestbookRecord)
+}
+
+func (e entities) SaveGuestbook(entries []GuestbookEntry) error {
+	return e.records.Save(guestbookRecord, entries)
+}
+
+func (e entities) LoadLayoutSeeds() (map[string]int64, error) {
+	return load[map[string]int64](e, layoutSeedsRecord)
+}
+
+func (e entities) SaveLayoutSeeds(seeds map[string]int64) error {
+	return e.records.Save(layoutSeedsRecord, seeds)
+}
+
+func (e entities) LoadLayouts() (map[string]Layout, error) {
+	return load[map[string]Layout](e, layoutsRecord)
+}
+
+func (e entities) SaveLayouts(layouts map[string]Layout) error {
+	return e.records.Save(layoutsRecord, layouts)
+}
+
+func load[T any](e entities, name string) (T, error) {
+	var v T
+	err := e.records.Load(name, &v)
+	return v, err
+}
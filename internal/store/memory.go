@@ -0,0 +1,49 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// Memory keeps records in memory, for tests, demos and instances that
+// should forget everything on restart.
+type Memory struct {
+	entities
+	mu      sync.Mutex
+	records map[string][]byte
+}
+
+func NewMemory() *Memory {
+	m := &Memory{records: make(map[string][]byte)}
+	m.entities = entities{m}
+	return m
+}
+
+// Load decodes the named record into v. Records are kept encoded, so v
+// never shares memory with what was saved.
+func (m *Memory) Load(name string, v any) error {
+	m.mu.Lock()
+	data, ok := m.records[name]
+	m.mu.Unlock()
+	if !ok {
+		return os.ErrNotExist
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("decode %s: %w", name, err)
+	}
+	return nil
+}
+
+// Save replaces the named record with v.
+func (m *Memory) Save(name string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("encode %s: %w", name, err)
+	}
+	m.mu.Lock()
+	m.records[name] = data
+	m.mu.Unlock()
+	return nil
+}
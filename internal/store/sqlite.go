@@ -0,0 +1,77 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	_ "modernc.org/sqlite" // registers the "sqlite" driver, no cgo needed
+)
+
+// SQLite keeps records as JSON in a table of a SQLite database, for
+// instances that want one file to back up instead of a directory.
+type SQLite struct {
+	entities
+	db *sql.DB
+}
+
+// OpenSQLite opens or creates the database at path.
+func OpenSQLite(path string) (*SQLite, error) {
+	// Statistics, settings and the periodic flush save at the same time.
+	// One connection queues them here instead of failing with SQLITE_BUSY,
+	// the busy timeout covers a backup tool holding the file.
+	db, err := sql.Open("sqlite", path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, fmt.Errorf("open %s: %w", path, err)
+	}
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS records (
+		name TEXT PRIMARY KEY,
+		data BLOB NOT NULL,
+		updated_at INTEGER NOT NULL
+	)`); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("create records table: %w", err)
+	}
+	s := &SQLite{db: db}
+	s.entities = entities{s}
+	return s, nil
+}
+
+// Load decodes the named record into v.
+func (s *SQLite) Load(name string, v any) error {
+	var data []byte
+	err := s.db.QueryRow(`SELECT data FROM records WHERE name = ?`, name).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return os.ErrNotExist
+	}
+	if err != nil {
+		return fmt.Errorf("load %s: %w", name, err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("decode %s: %w", name, err)
+	}
+	return nil
+}
+
+// Save replaces the named record with v in a single statement, so a crash
+// never leaves a half-written record behind.
+func (s *SQLite) Save(name string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("encode %s: %w", name, err)
+	}
+	_, err = s.db.Exec(`INSERT INTO records (name, data, updated_at) VALUES (?, ?, strftime('%s', 'now'))
+		ON CONFLICT (name) DO UPDATE SET data = excluded.data, updated_at = excluded.updated_at`, name, data)
+	if err != nil {
+		return fmt.Errorf("save %s: %w", name, err)
+	}
+	return nil
+}
+
+// Close closes the database.
+func (s *SQLite) Close() error {
+	return s.db.Close()
+}
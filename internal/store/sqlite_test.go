@@ -0,0 +1,143 @@
+package store_test
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/acuqa/ssh-aquarium/internal/aquarium"
+	"github.com/acuqa/ssh-aquarium/internal/store"
+)
+
+// TestSQLiteRoundTrip saves the records the server keeps to a database
+// file and reads them back after reopening it.
+func TestSQLiteRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.db")
+	db, err := store.OpenSQLite(path)
+	if err != nil {
+		t.Fatalf("OpenSQLite: %v", err)
+	}
+
+	settings := aquarium.NewSettingsStore()
+	history := aquarium.NewHistory()
+	clicks := aquarium.NewClickStats()
+	guestbook := aquarium.NewGuestbook()
+	rooms := aquarium.NewRegistry([]string{"lobby"})
+	for _, err := range []error{settings.SetStore(db), history.SetStore(db), clicks.SetStore(db), guestbook.SetStore(db), rooms.SetStore(db)} {
+		if err != nil {
+			t.Fatalf("SetStore: %v", err)
+		}
+	}
+
+	user := aquarium.Settings{FishName: "Nemo", FishColor: "cyan", NightLight: true}
+	if err := settings.Set("SHA256:nemo", user); err != nil {
+		t.Fatalf("saving settings: %v", err)
+	}
+	now := time.Now()
+	history.Record("lobby", aquarium.SessionInfo{Username: "nemo", ConnectedAt: now.Add(-time.Minute), SessionBytes: 4096}, now)
+	history.Save()
+	clicks.Record("nemo")
+	clicks.Record("nemo")
+	clicks.Save()
+	if _, err := guestbook.Sign("nemo", "lovely fish", true); err != nil {
+		t.Fatalf("signing the guestbook: %v", err)
+	}
+	if err := rooms.SaveLayout("calm", "lobby"); err != nil {
+		t.Fatalf("saving a layout: %v", err)
+	}
+	layout := rooms.Default().Layout()
+	if err := db.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	db, err = store.OpenSQLite(path)
+	if err != nil {
+		t.Fatalf("reopening: %v", err)
+	}
+	defer db.Close()
+
+	settings = aquarium.NewSettingsStore()
+	history = aquarium.NewHistory()
+	clicks = aquarium.NewClickStats()
+	guestbook = aquarium.NewGuestbook()
+	rooms = aquarium.NewRegistry([]string{"lobby"})
+	for _, err := range []error{settings.SetStore(db), history.SetStore(db), clicks.SetStore(db), guestbook.SetStore(db), rooms.SetStore(db)} {
+		if err != nil {
+			t.Fatalf("SetStore after reopening: %v", err)
+		}
+	}
+
+	if got := settings.Get("SHA256:nemo"); got != user {
+		t.Errorf("settings = %+v, want %+v", got, user)
+	}
+	if recent := history.Recent(10); len(recent) != 1 || recent[0].Username != "nemo" || recent[0].SessionBytes != 4096 {
+		t.Errorf("history = %+v, want nemo's session of 4096 bytes", recent)
+	}
+	if got := clicks.Snapshot().Counts["nemo"]; got != 2 {
+		t.Errorf("clicks on nemo = %d, want 2", got)
+	}
+	if entries := guestbook.Entries(); len(entries) != 1 || entries[0].Message != "lovely fish" {
+		t.Errorf("guestbook = %+v, want one entry", entries)
+	}
+	slots, err := rooms.Layouts()
+	if err != nil {
+		t.Fatalf("Layouts: %v", err)
+	}
+	if slots["calm"] != layout {
+		t.Errorf("layout calm = %+v, want %+v", slots["calm"], layout)
+	}
+}
+
+// TestOpenBackendSQLite checks that the sqlite backend opens in a fresh
+// state directory.
+func TestOpenBackendSQLite(t *testing.T) {
+	state, err := store.OpenBackend("sqlite", filepath.Join(t.TempDir(), "state"))
+	if err != nil {
+		t.Fatalf("OpenBackend: %v", err)
+	}
+	defer state.(*store.SQLite).Close()
+
+	if err := state.Save("greeting", "hello"); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	var got string
+	if err := state.Load("greeting", &got); err != nil || got != "hello" {
+		t.Errorf("Load = %q, %v, want hello", got, err)
+	}
+}
+
+// TestSQLiteConcurrentSaves saves from several goroutines at once, like
+// the periodic flush and the statistics do.
+func TestSQLiteConcurrentSaves(t *testing.T) {
+	db, err := store.OpenSQLite(filepath.Join(t.TempDir(), "state.db"))
+	if err != nil {
+		t.Fatalf("OpenSQLite: %v", err)
+	}
+	defer db.Close()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 16*50)
+	for worker := range 16 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			name := fmt.Sprintf("record-%d", worker%4)
+			for i := range 50 {
+				if err := db.Save(name, i); err != nil {
+					errs <- err
+				}
+				var got int
+				if err := db.Load(name, &got); err != nil {
+					errs <- err
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("concurrent save: %v", err)
+	}
+}
@@ -0,0 +1,144 @@
+// Package store persists small pieces of server state: user settings and
+// fish, sessions, click and pop statistics, the guestbook and layouts, plus
+// named records such as tank snapshots and terminal capabilities. Features
+// only see the Store interface, so the backend can change without touching
+// them.
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Store keeps what the server remembers. Each entity has its own methods,
+// so a backend can give it a table of its own. Loading an entity that was
+// never saved reports os.ErrNotExist.
+type Store interface {
+	// Users, by SSH key fingerprint
+	LoadSettings() (map[string]Settings, error)
+	SaveSettings(settings map[string]Settings) error
+	LoadFish() (map[string]OwnedFish, error)
+	SaveFish(fish map[string]OwnedFish) error
+
+	// Ended sessions, oldest first
+	LoadSessions() ([]Session, error)
+	SaveSessions(sessions []Session) error
+
+	// Statistics: today's clicks per fish, bubbles popped per user and
+	// hashes of the visitors seen
+	LoadClicks() (ClickCounts, error)
+	SaveClicks(clicks ClickCounts) error
+	LoadPops() (map[string]int, error)
+	SavePops(pops map[string]int) error
+	LoadVisitors() ([]string, error)
+	SaveVisitors(hashes []string) error
+
+	LoadGuestbook() ([]GuestbookEntry, error)
+	SaveGuestbook(entries []GuestbookEntry) error
+
+	// Layouts: the floor seed of each room and the setups saved by name
+	LoadLayoutSeeds() (map[string]int64, error)
+	SaveLayoutSeeds(seeds map[string]int64) error
+	LoadLayouts() (map[string]Layout, error)
+	SaveLayouts(layouts map[string]Layout) error
+
+	// Load decodes any other named record, such as tank snapshots, into v.
+	Load(name string, v any) error
+	// Save replaces the named record with v.
+	Save(name string, v any) error
+}
+
+// Backends are the stores OpenBackend knows.
+var Backends = []string{"dir", "memory", "sqlite"}
+
+// OpenBackend opens the named backend with its data in the state
+// directory at path: dir keeps JSON files there, sqlite a database file,
+// and memory keeps nothing past the process.
+func OpenBackend(backend, path string) (Store, error) {
+	// Typed nils would make a failed open look like a store
+	switch backend {
+	case "dir":
+		dir, err := Open(path)
+		if err != nil {
+			return nil, err
+		}
+		return dir, nil
+	case "memory":
+		return NewMemory(), nil
+	case "sqlite":
+		if err := os.MkdirAll(path, 0o755); err != nil {
+			return nil, fmt.Errorf("create state directory: %w", err)
+		}
+		db, err := OpenSQLite(filepath.Join(path, "state.db"))
+		if err != nil {
+			return nil, err
+		}
+		return db, nil
+	}
+	return nil, fmt.Errorf("unknown store %q, expected one of %s", backend, strings.Join(Backends, ", "))
+}
+
+// Dir is a directory holding one JSON file per record.
+type Dir struct {
+	entities
+	path string
+}
+
+// Open creates the state directory if needed.
+func Open(path string) (*Dir, error) {
+	if err := os.MkdirAll(path, 0o755); err != nil {
+		return nil, fmt.Errorf("create state directory: %w", err)
+	}
+	d := &Dir{path: path}
+	d.entities = entities{d}
+	return d, nil
+}
+
+// Path returns the location of the state directory.
+func (d *Dir) Path() string {
+	return d.path
+}
+
+// Load decodes the named record into v. A missing record is reported as
+// os.ErrNotExist.
+func (d *Dir) Load(name string, v any) error {
+	data, err := os.ReadFile(d.file(name))
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("decode %s: %w", name, err)
+	}
+	return nil
+}
+
+// Save writes v as the named record. The file is replaced atomically so a
+// crash never leaves a half-written record behind.
+func (d *Dir) Save(name string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode %s: %w", name, err)
+	}
+
+	tmp, err := os.CreateTemp(d.path, name+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), d.file(name))
+}
+
+func (d *Dir) file(name string) string {
+	return filepath.Join(d.path, name+".json")
+}
@@ -0,0 +1,38 @@
+package store_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/acuqa/ssh-aquarium/internal/store"
+)
+
+// TestEntitiesPerBackend saves a guestbook entry with every backend and
+// checks that entities never saved are reported missing.
+func TestEntitiesPerBackend(t *testing.T) {
+	for _, backend := range store.Backends {
+		t.Run(backend, func(t *testing.T) {
+			state, err := store.OpenBackend(backend, filepath.Join(t.TempDir(), "state"))
+			if err != nil {
+				t.Fatalf("OpenBackend: %v", err)
+			}
+			if db, ok := state.(*store.SQLite); ok {
+				defer db.Close()
+			}
+
+			if _, err := state.LoadGuestbook(); !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("loading an empty guestbook: %v, want os.ErrNotExist", err)
+			}
+			entry := store.GuestbookEntry{ID: 1, Name: "nemo", Message: "hi", Approved: true}
+			if err := state.SaveGuestbook([]store.GuestbookEntry{entry}); err != nil {
+				t.Fatalf("SaveGuestbook: %v", err)
+			}
+			entries, err := state.LoadGuestbook()
+			if err != nil || len(entries) != 1 || entries[0] != entry {
+				t.Errorf("LoadGuestbook = %+v, %v, want the saved entry", entries, err)
+			}
+		})
+	}
+}
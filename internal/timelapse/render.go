@@ -0,0 +1,104 @@
+package timelapse
+
+import (
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"math"
+
+	"github.com/acuqa/ssh-aquarium/internal/aquarium"
+)
+
+// noWater is the background of tanks with the "none" theme, which use the
+// terminal's own background.
+var noWater = [3]uint8{12, 12, 16}
+
+// render draws a scene width pixels wide, with the fish images left and
+// right, into a paletted image ready for a GIF frame. Fish are drawn as
+// orange blobs if there are no images.
+func render(scene aquarium.Scene, width int, left, right image.Image) *image.Paletted {
+	scale := float64(width) / float64(max(scene.Width, 1))
+	height := max(1, int(math.Round(float64(scene.Height)*scale)))
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	// Water from the surface down to the floor, then the floor strips
+	floorTop := height - int(math.Round(float64(scene.Floor.Rows()*scene.CellHeight)*scale))
+	for y := 0; y < floorTop; y++ {
+		c := noWater
+		if scene.Theme.Water {
+			c = mix(scene.Theme.Surface, scene.Theme.Depth, float64(y)/float64(max(floorTop-1, 1)))
+		}
+		fillRow(img, y, c)
+	}
+	y := floorTop
+	for _, strip := range scene.Floor {
+		end := y + int(math.Round(float64(strip.Rows*scene.CellHeight)*scale))
+		for ; y < min(end, height); y++ {
+			fillRow(img, y, strip.Color)
+		}
+	}
+
+	for _, fish := range scene.Fish {
+		sprite := left
+		if fish.Right {
+			sprite = right
+		}
+		dst := image.Rect(
+			int(fish.X*scale), int(fish.Y*scale),
+			int((fish.X+fish.Width)*scale), int((fish.Y+fish.Height)*scale),
+		)
+		if sprite == nil {
+			draw.Draw(img, dst.Inset(dst.Dy()/4), &image.Uniform{color.RGBA{240, 140, 40, 255}}, image.Point{}, draw.Src)
+			continue
+		}
+		drawScaled(img, dst, sprite)
+	}
+
+	frame := image.NewPaletted(img.Bounds(), palette.Plan9)
+	draw.Draw(frame, frame.Bounds(), img, image.Point{}, draw.Src)
+	return frame
+}
+
+func fillRow(img *image.RGBA, y int, c [3]uint8) {
+	for x := img.Rect.Min.X; x < img.Rect.Max.X; x++ {
+		img.SetRGBA(x, y, color.RGBA{c[0], c[1], c[2], 255})
+	}
+}
+
+// mix blends from a to b, t running from 0 to 1.
+func mix(a, b [3]uint8, t float64) [3]uint8 {
+	var c [3]uint8
+	for i := range c {
+		c[i] = uint8(float64(a[i]) + (float64(b[i])-float64(a[i]))*t)
+	}
+	return c
+}
+
+// drawScaled draws src over dst's rectangle of img, picking the nearest
+// source pixel, which keeps pixel art crisp.
+func drawScaled(img *image.RGBA, dst image.Rectangle, src image.Image) {
+	sb := src.Bounds()
+	if dst.Dx() <= 0 || dst.Dy() <= 0 || sb.Empty() {
+		return
+	}
+	clip := dst.Intersect(img.Rect)
+	for y := clip.Min.Y; y < clip.Max.Y; y++ {
+		sy := sb.Min.Y + (y-dst.Min.Y)*sb.Dy()/dst.Dy()
+		for x := clip.Min.X; x < clip.Max.X; x++ {
+			sx := sb.Min.X + (x-dst.Min.X)*sb.Dx()/dst.Dx()
+			r, g, b, a := src.At(sx, sy).RGBA()
+			if a == 0 {
+				continue
+			}
+			under := img.RGBAAt(x, y)
+			keep := 0xffff - a
+			img.SetRGBA(x, y, color.RGBA{
+				R: uint8((r + uint32(under.R)*keep/0xff) >> 8),
+				G: uint8((g + uint32(under.G)*keep/0xff) >> 8),
+				B: uint8((b + uint32(under.B)*keep/0xff) >> 8),
+				A: 255,
+			})
+		}
+	}
+}
@@ -0,0 +1,148 @@
+// Package timelapse takes a picture of a room every few minutes and turns
+// the last ones into an animated GIF, for sharing a day in the aquarium.
+package timelapse
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/gif"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/acuqa/ssh-aquarium/internal/aquarium"
+)
+
+// Options configure a Recorder.
+type Options struct {
+	Interval time.Duration // between pictures
+	Frames   int           // pictures kept, older ones are dropped
+	Width    int           // of the pictures in pixels, the height follows the tank
+	Delay    time.Duration // how long each picture shows in the GIF
+}
+
+// DefaultOptions keep four hours at one picture every two minutes, played
+// back in twelve seconds.
+var DefaultOptions = Options{
+	Interval: 2 * time.Minute,
+	Frames:   120,
+	Width:    320,
+	Delay:    100 * time.Millisecond,
+}
+
+// ErrNoFrames is returned by GIF before the first picture was taken.
+var ErrNoFrames = errors.New("no pictures yet")
+
+// picture is one frame of the time-lapse.
+type picture struct {
+	img     *image.Paletted
+	takenAt time.Time
+}
+
+// Recorder takes the pictures of a room.
+type Recorder struct {
+	room        *aquarium.Manager
+	opts        Options
+	left, right image.Image // fish images, nil to draw blobs
+
+	mu       sync.Mutex
+	pictures []picture // oldest first
+	cached   []byte    // GIF of the last cachedN pictures up to cachedAt
+	cachedN  int
+	cachedAt time.Time
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// New creates a recorder for room that draws fish with the images left and
+// right.
+func New(room *aquarium.Manager, left, right image.Image, opts Options) *Recorder {
+	return &Recorder{room: room, opts: opts, left: left, right: right, stop: make(chan struct{})}
+}
+
+func (r *Recorder) Start() {
+	r.wg.Add(1)
+	go r.run()
+}
+
+func (r *Recorder) Stop() {
+	close(r.stop)
+	r.wg.Wait()
+}
+
+func (r *Recorder) run() {
+	defer r.wg.Done()
+
+	ticker := time.NewTicker(r.opts.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+			r.capture()
+		}
+	}
+}
+
+// capture takes a picture, unless nobody is watching and the tank is gone.
+func (r *Recorder) capture() {
+	scene, ok := r.room.Scene()
+	if !ok {
+		return
+	}
+	img := render(scene, r.opts.Width, r.left, r.right)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pictures = append(r.pictures, picture{img, scene.TakenAt})
+	if drop := len(r.pictures) - r.opts.Frames; drop > 0 {
+		r.pictures = append(r.pictures[:0], r.pictures[drop:]...)
+	}
+}
+
+// GIF returns the last n pictures as an animated GIF, or all of them if n
+// is 0 or more than there are, and when the newest was taken. The GIF is
+// only encoded again once there is a new picture or n changes.
+func (r *Recorder) GIF(n int) ([]byte, time.Time, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.pictures) == 0 {
+		return nil, time.Time{}, ErrNoFrames
+	}
+	if n <= 0 || n > len(r.pictures) {
+		n = len(r.pictures)
+	}
+	pictures := r.pictures[len(r.pictures)-n:]
+	newest := pictures[len(pictures)-1].takenAt
+	if r.cached != nil && r.cachedN == n && r.cachedAt.Equal(newest) {
+		return r.cached, newest, nil
+	}
+
+	// The tank may have been resized in between, the GIF fits the tallest
+	anim := &gif.GIF{LoopCount: 0}
+	delay := int(r.opts.Delay / (10 * time.Millisecond))
+	for _, p := range pictures {
+		anim.Image = append(anim.Image, p.img)
+		anim.Delay = append(anim.Delay, delay)
+		anim.Disposal = append(anim.Disposal, gif.DisposalBackground)
+		anim.Config.Width = max(anim.Config.Width, p.img.Rect.Dx())
+		anim.Config.Height = max(anim.Config.Height, p.img.Rect.Dy())
+	}
+	anim.Config.ColorModel = color.Palette(palette.Plan9)
+
+	start := time.Now()
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, anim); err != nil {
+		return nil, time.Time{}, err
+	}
+	log.Printf("Encoded time-lapse of %d pictures, %d bytes in %v", n, buf.Len(), time.Since(start).Round(time.Millisecond))
+
+	r.cached, r.cachedN, r.cachedAt = buf.Bytes(), n, newest
+	return r.cached, newest, nil
+}
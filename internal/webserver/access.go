@@ -0,0 +1,73 @@
+package webserver
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// SetCORSOrigins lets web pages from these origins, e.g.
+// https://fish.example.com, read the API. "*" allows any origin. It must be
+// called before Start.
+func (s *Server) SetCORSOrigins(origins []string) {
+	s.corsOrigins = s.corsOrigins[:0]
+	for _, origin := range origins {
+		if origin = strings.TrimRight(strings.TrimSpace(origin), "/"); origin != "" {
+			s.corsOrigins = append(s.corsOrigins, origin)
+		}
+	}
+}
+
+// SetAPIToken requires API requests to carry the token as
+// "Authorization: Bearer <token>". An empty token leaves the API open. It must
+// be called before Start.
+func (s *Server) SetAPIToken(token string) {
+	s.apiToken = token
+}
+
+// guardAPI adds CORS headers for allowed origins, answers preflight requests
+// and checks the API token before passing requests on to next.
+func (s *Server) guardAPI(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		w.Header().Add("Vary", "Origin")
+		allowed := origin != "" && s.allowsOrigin(origin)
+		if allowed {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+		}
+
+		// Browsers ask before sending the Authorization header cross-origin,
+		// without the header itself
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			if !allowed {
+				writeError(w, errorf(http.StatusForbidden, "origin %q not allowed", origin))
+				return
+			}
+			w.Header().Set("Access-Control-Allow-Methods", "GET, HEAD")
+			w.Header().Set("Access-Control-Allow-Headers", "Authorization")
+			w.Header().Set("Access-Control-Max-Age", "3600")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		if !s.authorized(r) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="aquarium"`)
+			writeError(w, errorf(http.StatusUnauthorized, "missing or invalid API token"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) allowsOrigin(origin string) bool {
+	return slices.Contains(s.corsOrigins, "*") || slices.Contains(s.corsOrigins, origin)
+}
+
+func (s *Server) authorized(r *http.Request) bool {
+	if s.apiToken == "" {
+		return true
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(s.apiToken)) == 1
+}
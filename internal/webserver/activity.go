@@ -0,0 +1,105 @@
+package webserver
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	activityWindow   = 24 * time.Hour
+	activityBucket   = 5 * time.Minute  // one point of the graph
+	activitySampling = 10 * time.Second // how often counts are looked at
+)
+
+// activitySample is the peak number of fish and connections during one
+// bucket.
+type activitySample struct {
+	At          time.Time `json:"at"` // start of the bucket
+	Fish        int       `json:"fish"`
+	Connections int       `json:"connections"`
+}
+
+// activityLog keeps the samples of the last activityWindow in memory, oldest
+// first.
+type activityLog struct {
+	mu      sync.Mutex
+	samples []activitySample
+}
+
+// record merges the current counts into the bucket they fall into and drops
+// buckets older than activityWindow.
+func (l *activityLog) record(now time.Time, fish, connections int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	at := now.Truncate(activityBucket)
+	if n := len(l.samples); n > 0 && l.samples[n-1].At.Equal(at) {
+		last := &l.samples[n-1]
+		last.Fish = max(last.Fish, fish)
+		last.Connections = max(last.Connections, connections)
+	} else {
+		l.samples = append(l.samples, activitySample{At: at, Fish: fish, Connections: connections})
+	}
+
+	cutoff := at.Add(-activityWindow)
+	drop := 0
+	for drop < len(l.samples) && !l.samples[drop].At.After(cutoff) {
+		drop++
+	}
+	l.samples = append(l.samples[:0], l.samples[drop:]...)
+}
+
+func (l *activityLog) snapshot() []activitySample {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]activitySample{}, l.samples...)
+}
+
+// recordActivity samples the aquarium until done is closed.
+func (s *Server) recordActivity(done <-chan struct{}) {
+	ticker := time.NewTicker(activitySampling)
+	defer ticker.Stop()
+
+	for {
+		summary := s.summary()
+		s.activity.record(time.Now(), summary.Fish, summary.Connections)
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// activityGraph draws connections and fish over the last activityWindow as
+// an inline SVG, so the page needs no JavaScript to show it.
+func activityGraph(samples []activitySample, now time.Time) string {
+	const width, height = 576, 60
+	buckets := int(activityWindow / activityBucket)
+	start := now.Truncate(activityBucket).Add(-activityWindow)
+
+	peak := 1
+	for _, sample := range samples {
+		peak = max(peak, sample.Fish, sample.Connections)
+	}
+
+	line := func(value func(activitySample) int) string {
+		var points []string
+		for _, sample := range samples {
+			x := float64(sample.At.Sub(start)/activityBucket) * width / float64(buckets)
+			y := height - float64(value(sample))*(height-2)/float64(peak) - 1
+			points = append(points, fmt.Sprintf("%.1f,%.1f", x, y))
+		}
+		return strings.Join(points, " ")
+	}
+
+	return fmt.Sprintf(`<svg width="%d" height="%d" viewBox="0 0 %d %d" role="img" aria-label="Activity over the last 24 hours">
+        <rect width="%d" height="%d" fill="#002244"/>
+        <polyline points="%s" fill="none" stroke="#aaffaa" stroke-width="1.5"/>
+        <polyline points="%s" fill="none" stroke="#66ccff" stroke-width="1.5"/>
+    </svg>`, width, height, width, height, width, height,
+		line(func(s activitySample) int { return s.Fish }),
+		line(func(s activitySample) int { return s.Connections }))
+}
@@ -0,0 +1,240 @@
+package webserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/acuqa/ssh-aquarium/internal/aquarium"
+)
+
+// apiV1 prefixes every route of the current API version. Incompatible
+// changes go into a new version next to it, so existing clients keep working.
+const apiV1 = "/api/v1"
+
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 500
+)
+
+// apiRoute is a read-only endpoint of the web API.
+type apiRoute struct {
+	path     string // below the version prefix, e.g. "/fish"
+	summary  string
+	list     bool     // paginated with limit and offset
+	filters  []string // query parameters that narrow down a list
+	response any      // example of what handle returns, or of a list's items
+	handle   func(r *http.Request) (any, error)
+}
+
+func (s *Server) apiRoutes() []apiRoute {
+	return []apiRoute{
+		{path: "/aquarium", summary: "Fish, connection, room and unique visitor counts", response: aquariumSummary{}, handle: s.apiAquarium},
+		{path: "/rooms", summary: "Rooms with their population", list: true, response: aquarium.RoomInfo{}, handle: s.apiRooms},
+		{path: "/fish", summary: "Fish in all rooms", list: true, filters: []string{"room", "username", "species"}, response: aquarium.FishInfo{}, handle: s.apiFish},
+		{path: "/clients", summary: "Connected sessions by SSH client software", list: true, response: aquarium.ClientCount{}, handle: s.apiClients},
+		{path: "/activity", summary: "Peak fish and connections per 5 minutes over the last 24 hours", response: []activitySample{}, handle: s.apiActivity},
+		{path: "/stats", summary: "Click, bubble pop and visitor statistics", response: aquarium.Stats{}, handle: s.apiStats},
+		{path: "/who", summary: "Who is watching, longest watching first", list: true, filters: []string{"room"}, response: aquarium.Watcher{}, handle: s.apiWho},
+		{path: "/guestbook", summary: "Approved guestbook messages, newest first", list: true, response: aquarium.GuestbookEntry{}, handle: s.apiGuestbook},
+		{path: "/culling", summary: "Decoration left out of frames to stay within the frame budget", response: aquarium.CullStats{}, handle: s.apiCulling},
+	}
+}
+
+// apiError is answered instead of a result, as {"error": {...}}.
+type apiError struct {
+	Status  int    `json:"status"`
+	Message string `json:"message"`
+}
+
+func (e *apiError) Error() string {
+	return e.Message
+}
+
+func errorf(status int, format string, args ...any) error {
+	return &apiError{Status: status, Message: fmt.Sprintf(format, args...)}
+}
+
+// serveAPI checks the method and query parameters of a request before
+// handing it to the route, and encodes whatever the route returns.
+func (s *Server) serveAPI(route apiRoute) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			writeError(w, errorf(http.StatusMethodNotAllowed, "method %s not allowed", r.Method))
+			return
+		}
+		if s.rooms == nil {
+			writeError(w, errorf(http.StatusServiceUnavailable, "aquarium not running"))
+			return
+		}
+		for param := range r.URL.Query() {
+			known := slices.Contains(route.filters, param) ||
+				route.list && (param == "limit" || param == "offset")
+			if !known {
+				writeError(w, errorf(http.StatusBadRequest, "unknown query parameter %q", param))
+				return
+			}
+		}
+
+		body, err := route.handle(r)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, body)
+	}
+}
+
+// apiNotFound answers requests for unknown API paths.
+func apiNotFound(w http.ResponseWriter, r *http.Request) {
+	writeError(w, errorf(http.StatusNotFound, "no such endpoint %s", r.URL.Path))
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Printf("Failed to write API response: %v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	var apiErr *apiError
+	if !errors.As(err, &apiErr) {
+		log.Printf("API request failed: %v", err)
+		apiErr = &apiError{Status: http.StatusInternalServerError, Message: "internal error"}
+	}
+	writeJSON(w, apiErr.Status, struct {
+		Error *apiError `json:"error"`
+	}{apiErr})
+}
+
+// list is one page of a list endpoint's results.
+type list[T any] struct {
+	Items  []T `json:"items"`
+	Total  int `json:"total"` // matching items on all pages
+	Offset int `json:"offset"`
+	Limit  int `json:"limit"`
+}
+
+// newList keeps the items matching the request's filters and cuts out the
+// requested page. A filter given several times matches any of its values.
+func newList[T any](r *http.Request, items []T, filters map[string]func(T) string) (list[T], error) {
+	query := r.URL.Query()
+	limit, err := intParam(query.Get("limit"), defaultPageLimit, 1, maxPageLimit)
+	if err != nil {
+		return list[T]{}, errorf(http.StatusBadRequest, "limit %v", err)
+	}
+	offset, err := intParam(query.Get("offset"), 0, 0, -1)
+	if err != nil {
+		return list[T]{}, errorf(http.StatusBadRequest, "offset %v", err)
+	}
+
+	matching := make([]T, 0, len(items))
+	for _, item := range items {
+		keep := true
+		for name, field := range filters {
+			if values, ok := query[name]; ok && !slices.Contains(values, field(item)) {
+				keep = false
+				break
+			}
+		}
+		if keep {
+			matching = append(matching, item)
+		}
+	}
+
+	start := min(offset, len(matching))
+	end := min(start+limit, len(matching))
+	return list[T]{
+		Items:  matching[start:end],
+		Total:  len(matching),
+		Offset: offset,
+		Limit:  limit,
+	}, nil
+}
+
+// intParam parses a query parameter, returning def when it is missing. A
+// negative hi means no upper bound.
+func intParam(s string, def, lo, hi int) (int, error) {
+	if s == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(s)
+	switch {
+	case err != nil:
+		return 0, errors.New("must be a number")
+	case n < lo:
+		return 0, fmt.Errorf("must be at least %d", lo)
+	case hi >= 0 && n > hi:
+		return 0, fmt.Errorf("must be at most %d", hi)
+	}
+	return n, nil
+}
+
+// aquariumSummary is the body of /api/v1/aquarium.
+type aquariumSummary struct {
+	Fish        int `json:"fish"`
+	Connections int `json:"connections"`
+	Rooms       int `json:"rooms"`
+	Visitors    int `json:"visitors"` // unique, all time
+}
+
+func (s *Server) summary() aquariumSummary {
+	if s.rooms == nil {
+		return aquariumSummary{}
+	}
+	rooms := s.rooms.Rooms()
+	summary := aquariumSummary{Fish: s.rooms.GetFishCount(), Rooms: len(rooms), Visitors: s.rooms.Visitors().Count()}
+	for _, room := range rooms {
+		summary.Connections += room.Population
+	}
+	return summary
+}
+
+func (s *Server) apiAquarium(r *http.Request) (any, error) {
+	return s.summary(), nil
+}
+
+func (s *Server) apiClients(r *http.Request) (any, error) {
+	return newList(r, s.rooms.ClientCounts(), nil)
+}
+
+func (s *Server) apiActivity(r *http.Request) (any, error) {
+	return s.activity.snapshot(), nil
+}
+
+func (s *Server) apiRooms(r *http.Request) (any, error) {
+	return newList(r, s.rooms.Rooms(), nil)
+}
+
+func (s *Server) apiFish(r *http.Request) (any, error) {
+	return newList(r, s.rooms.FishInfo(), map[string]func(aquarium.FishInfo) string{
+		"room":     func(f aquarium.FishInfo) string { return f.Room },
+		"username": func(f aquarium.FishInfo) string { return f.Username },
+		"species":  func(f aquarium.FishInfo) string { return f.Species },
+	})
+}
+
+func (s *Server) apiStats(r *http.Request) (any, error) {
+	return s.stats(), nil
+}
+
+func (s *Server) apiCulling(r *http.Request) (any, error) {
+	return s.rooms.CullStats(), nil
+}
+
+func (s *Server) apiGuestbook(r *http.Request) (any, error) {
+	return newList(r, s.rooms.Guestbook().Entries(), nil)
+}
+
+func (s *Server) apiWho(r *http.Request) (any, error) {
+	return newList(r, s.rooms.Watchers(), map[string]func(aquarium.Watcher) string{
+		"room": func(w aquarium.Watcher) string { return w.Room },
+	})
+}
@@ -0,0 +1,58 @@
+package webserver
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"strings"
+
+	"github.com/acuqa/ssh-aquarium/internal/directory"
+)
+
+// SetDirectory shows the public aquariums dir knows at /aquariums. It must be
+// called before Start.
+func (s *Server) SetDirectory(dir directory.Lister) {
+	s.directory = dir
+}
+
+func (s *Server) aquariumsHandler(w http.ResponseWriter, r *http.Request) {
+	entries, err := s.directory.List()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	var rows strings.Builder
+	for _, entry := range entries {
+		host, port := entry.Address, ""
+		if i := strings.LastIndex(host, ":"); i > 0 && !strings.HasSuffix(host, "]") {
+			host, port = host[:i], " -p "+host[i+1:]
+		}
+		fmt.Fprintf(&rows, "        <tr><td>%s</td><td><code>ssh%s %s</code></td><td>%d</td></tr>\n",
+			html.EscapeString(entry.Name), html.EscapeString(port), html.EscapeString(host), entry.Population)
+	}
+	if len(entries) == 0 {
+		rows.WriteString("        <tr><td colspan=\"3\">No public aquariums right now</td></tr>\n")
+	}
+
+	w.Header().Set("Content-Type", "text/html")
+	fmt.Fprintf(w, `<!DOCTYPE html>
+<html>
+<head>
+    <title>Public Aquariums</title>
+    <style>
+        body { font-family: monospace; margin: 40px; background: #001122; color: #66ccff; }
+        h1 { color: #88ddff; }
+        table { border-collapse: collapse; }
+        th, td { text-align: left; padding: 6px 16px 6px 0; }
+        code { color: #aaffaa; }
+    </style>
+</head>
+<body>
+    <h1>🐠 Public Aquariums</h1>
+    <table>
+        <tr><th>Name</th><th>Connect</th><th>Watching</th></tr>
+%s    </table>
+</body>
+</html>`, rows.String())
+}
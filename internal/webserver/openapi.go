@@ -0,0 +1,228 @@
+package webserver
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// schema is an OpenAPI schema object.
+type schema map[string]any
+
+// openAPI describes the API routes as an OpenAPI 3 document, with response
+// schemas derived from the JSON encoding of each route's response type.
+func (s *Server) openAPI() map[string]any {
+	errorResponse := map[string]any{
+		"description": "Error",
+		"content": map[string]any{
+			"application/json": map[string]any{"schema": schema{"$ref": "#/components/schemas/Error"}},
+		},
+	}
+
+	paths := make(map[string]any)
+	for _, route := range s.apiRoutes() {
+		body := schemaOf(reflect.TypeOf(route.response))
+		var params []any
+		if route.list {
+			body = schema{
+				"type": "object",
+				"properties": map[string]any{
+					"items":  schema{"type": "array", "items": body},
+					"total":  schema{"type": "integer", "description": "Matching items on all pages"},
+					"offset": schema{"type": "integer"},
+					"limit":  schema{"type": "integer"},
+				},
+			}
+			for _, filter := range route.filters {
+				params = append(params, map[string]any{
+					"name":        filter,
+					"in":          "query",
+					"description": "Only items with this " + filter + "; repeat to match any of several",
+					"schema":      schema{"type": "array", "items": schema{"type": "string"}},
+					"explode":     true,
+				})
+			}
+			params = append(params,
+				map[string]any{"name": "limit", "in": "query", "schema": schema{"type": "integer", "minimum": 1, "maximum": maxPageLimit, "default": defaultPageLimit}},
+				map[string]any{"name": "offset", "in": "query", "schema": schema{"type": "integer", "minimum": 0, "default": 0}},
+			)
+		}
+
+		operation := map[string]any{
+			"summary": route.summary,
+			"responses": map[string]any{
+				"200": map[string]any{
+					"description": "OK",
+					"content":     map[string]any{"application/json": map[string]any{"schema": body}},
+				},
+				"default": errorResponse,
+			},
+		}
+		if params != nil {
+			operation["parameters"] = params
+		}
+		paths[apiV1+route.path] = map[string]any{"get": operation}
+	}
+
+	components := map[string]any{
+		"schemas": map[string]any{
+			"Error": schema{
+				"type": "object",
+				"properties": map[string]any{
+					"error": schemaOf(reflect.TypeOf(apiError{})),
+				},
+			},
+		},
+	}
+	doc := map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":   "SSH Aquarium API",
+			"version": strings.TrimPrefix(apiV1, "/api/"),
+		},
+		"paths":      paths,
+		"components": components,
+	}
+	if s.apiToken != "" {
+		components["securitySchemes"] = map[string]any{
+			"token": schema{"type": "http", "scheme": "bearer"},
+		}
+		doc["security"] = []any{map[string]any{"token": []string{}}}
+	}
+	return doc
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schemaOf describes how encoding/json encodes values of type t.
+func schemaOf(t reflect.Type) schema {
+	if t == nil {
+		return schema{}
+	}
+	if t == timeType {
+		return schema{"type": "string", "format": "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return schemaOf(t.Elem())
+	case reflect.Bool:
+		return schema{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return schema{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return schema{"type": "number"}
+	case reflect.String:
+		return schema{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return schema{"type": "array", "items": schemaOf(t.Elem())}
+	case reflect.Map:
+		return schema{"type": "object", "additionalProperties": schemaOf(t.Elem())}
+	case reflect.Struct:
+		props := make(map[string]any)
+		var required []string
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			name, opts, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "-" {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+			props[name] = schemaOf(field.Type)
+			if !strings.Contains(opts, "omitempty") {
+				required = append(required, name)
+			}
+		}
+		s := schema{"type": "object", "properties": props}
+		if required != nil {
+			s["required"] = required
+		}
+		return s
+	}
+	return schema{}
+}
+
+func (s *Server) openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	writeJSON(w, http.StatusOK, s.openAPI())
+}
+
+func docsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html")
+	w.Write([]byte(docsPage))
+}
+
+// docsPage lists the endpoints of the OpenAPI document and lets visitors try
+// them out, without loading anything from other sites.
+const docsPage = `<!DOCTYPE html>
+<html>
+<head>
+    <title>SSH Aquarium API</title>
+    <style>
+        body { font-family: monospace; margin: 40px; background: #001122; color: #66ccff; }
+        h1, h2 { color: #88ddff; }
+        section { background: #002244; padding: 10px 20px 20px; border-radius: 8px; margin: 20px 0; }
+        label { display: inline-block; margin: 4px 12px 4px 0; }
+        input { font-family: monospace; background: #001122; color: #aaffaa; border: 1px solid #336699; }
+        button { font-family: monospace; }
+        pre { background: #001122; padding: 10px; color: #aaffaa; overflow: auto; max-height: 400px; }
+    </style>
+</head>
+<body>
+    <h1>🐠 SSH Aquarium API</h1>
+    <p>Machine-readable description: <a href="/api/v1/openapi.json" style="color: #aaffaa">/api/v1/openapi.json</a></p>
+    <p><label>Token <input id="token" size="40" placeholder="only if the server requires one"></label></p>
+    <div id="routes"></div>
+    <script>
+    function el(tag, text) {
+        const e = document.createElement(tag);
+        if (text) e.textContent = text;
+        return e;
+    }
+
+    fetch("/api/v1/openapi.json").then(r => r.json()).then(doc => {
+        for (const [path, item] of Object.entries(doc.paths)) {
+            const op = item.get;
+            const section = el("section");
+            section.append(el("h2", "GET " + path), el("p", op.summary));
+
+            const inputs = {};
+            for (const param of op.parameters || []) {
+                const label = el("label", param.name + " ");
+                const input = el("input");
+                input.size = 12;
+                label.append(input);
+                section.append(label);
+                inputs[param.name] = input;
+            }
+
+            const out = el("pre");
+            const button = el("button", "Try it");
+            button.onclick = () => {
+                const query = new URLSearchParams();
+                for (const [name, input] of Object.entries(inputs)) {
+                    if (input.value) query.append(name, input.value);
+                }
+                const headers = {};
+                const token = document.getElementById("token").value;
+                if (token) headers.Authorization = "Bearer " + token;
+                const url = path + (query.size ? "?" + query : "");
+                fetch(url, { headers }).then(async r => {
+                    out.textContent = r.status + " " + url + "\n\n" + JSON.stringify(await r.json(), null, 2);
+                });
+            };
+            section.append(el("br"), button, out);
+            document.getElementById("routes").append(section);
+        }
+    });
+    </script>
+</body>
+</html>
+`
@@ -2,41 +2,98 @@ package webserver
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"html"
 	"log"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/acuqa/ssh-aquarium/internal/aquarium"
+	"github.com/acuqa/ssh-aquarium/internal/directory"
+	"github.com/acuqa/ssh-aquarium/internal/metrics"
+	"github.com/acuqa/ssh-aquarium/internal/timelapse"
 )
 
 type Server struct {
 	port        int
 	server      *http.Server
-	aquariumMgr *aquarium.Manager
+	rooms       *aquarium.Registry
+	routes      map[string]http.Handler
+	corsOrigins []string
+	apiToken    string
+	directory   directory.Lister
+	timelapse   *timelapse.Recorder
+	activity    activityLog
+	done        chan struct{}
 }
 
-func New(port int, aquariumMgr *aquarium.Manager) *Server {
+func New(port int, rooms *aquarium.Registry) *Server {
 	return &Server{
 		port:        port,
-		aquariumMgr: aquariumMgr,
+		rooms:       rooms,
+		routes:      make(map[string]http.Handler),
+		done:        make(chan struct{}),
 	}
 }
 
+// Handle registers an additional route. It must be called before Start.
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.routes[pattern] = handler
+}
+
 func (s *Server) Start() error {
 	mux := http.NewServeMux()
 	
 	// Health check endpoint
 	mux.HandleFunc("/health", s.healthHandler)
 	
+	// Fish and click statistics, kept for clients from before /api/v1
+	mux.Handle("/api/stats", s.guardAPI(http.HandlerFunc(s.statsHandler)))
+	
+	// Error counters for Prometheus
+	mux.Handle("/metrics", s.guardAPI(metrics.Handler()))
+	
+	// Versioned web API
+	for _, route := range s.apiRoutes() {
+		mux.Handle(apiV1+route.path, s.guardAPI(s.serveAPI(route)))
+	}
+	mux.Handle("/api/", s.guardAPI(http.HandlerFunc(apiNotFound)))
+	
+	// Time-lapse of the default room
+	if s.timelapse != nil {
+		mux.Handle("/api/timelapse.gif", s.guardAPI(http.HandlerFunc(s.timelapseHandler)))
+	}
+	
+	// API description and docs, open even when the API needs a token
+	mux.HandleFunc(apiV1+"/openapi.json", s.openAPIHandler)
+	mux.HandleFunc("/api/docs", docsHandler)
+	
+	// Public aquariums from the directory
+	if s.directory != nil {
+		mux.HandleFunc("/aquariums", s.aquariumsHandler)
+	}
+	
+	// Embeddable widget for other sites, as public as the start page
+	mux.HandleFunc("/widget", s.widgetHandler)
+	mux.HandleFunc("/widget.json", s.widgetDataHandler)
+	mux.HandleFunc("/widget.js", widgetScriptHandler)
+	
 	// Root endpoint with fish count and connection info
 	mux.HandleFunc("/", s.rootHandler)
 	
+	for pattern, handler := range s.routes {
+		mux.Handle(pattern, handler)
+	}
+	
 	s.server = &http.Server{
 		Addr:    fmt.Sprintf(":%d", s.port),
 		Handler: mux,
 	}
 	
+	go s.recordActivity(s.done)
+	
 	log.Printf("Starting web server on port %d", s.port)
 	return s.server.ListenAndServe()
 }
@@ -47,6 +104,7 @@ func (s *Server) Stop() error {
 	}
 	
 	log.Println("Stopping web server...")
+	close(s.done)
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	
@@ -59,8 +117,47 @@ func (s *Server) healthHandler(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintf(w, `{"status": "ok", "timestamp": "%s"}`, time.Now().UTC().Format(time.RFC3339))
 }
 
+
+func (s *Server) statsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(s.stats()); err != nil {
+		log.Printf("Failed to write stats: %v", err)
+	}
+}
+
+// stats is the body of /api/stats.
+func (s *Server) stats() aquarium.Stats {
+	if s.rooms == nil {
+		return aquarium.Stats{}
+	}
+	return s.rooms.Stats()
+}
+
+// The start page refreshes its fish count: by polling the API every
+// pollInterval, or by reloading every pageRefresh for visitors without
+// JavaScript and when the API needs a token the page doesn't have.
+const (
+	pollInterval = 5 * time.Second
+	pageRefresh  = 30 * time.Second
+)
+
 func (s *Server) rootHandler(w http.ResponseWriter, r *http.Request) {
-	fishCount := s.getFishCount()
+	summary := s.summary()
+	
+	refresh := fmt.Sprintf(`<meta http-equiv="refresh" content="%d">`, int(pageRefresh.Seconds()))
+	poll := ""
+	if s.apiToken == "" {
+		refresh = "<noscript>" + refresh + "</noscript>"
+		poll = fmt.Sprintf(`<script>
+    setInterval(() => {
+        if (document.hidden) return;
+        fetch("%s/aquarium").then(r => r.json()).then(a => {
+            document.getElementById("fish").textContent = a.fish;
+            document.getElementById("visitors").textContent = a.visitors;
+        }).catch(() => {});
+    }, %d);
+    </script>`, apiV1, pollInterval.Milliseconds())
+	}
 	
 	w.Header().Set("Content-Type", "text/html")
 	w.WriteHeader(http.StatusOK)
@@ -69,27 +166,57 @@ func (s *Server) rootHandler(w http.ResponseWriter, r *http.Request) {
 <html>
 <head>
     <title>SSH Aquarium</title>
+    %s
     <style>
         body { font-family: monospace; margin: 40px; background: #001122; color: #66ccff; }
         h1 { color: #88ddff; }
         pre { background: #002244; padding: 20px; border-radius: 8px; color: #aaffaa; }
         .fish-count { font-size: 1.2em; margin: 20px 0; }
+        .guestbook small { color: #447799; }
     </style>
 </head>
 <body>
     <h1>🐠 SSH Aquarium</h1>
-    <div class="fish-count">Fish swimming in the aquarium: %d</div>
+    <div class="fish-count">Fish swimming in the aquarium: <span id="fish">%d</span></div>
+    <p>Visitors so far: <span id="visitors">%d</span></p>
+    <p>Last 24 hours: <span style="color: #66ccff">connections</span>, <span style="color: #aaffaa">fish</span></p>
+    %s
     <p>To connect and see the fish:</p>
     <pre>ssh acqua.fly.dev</pre>
+    %s
+    %s
 </body>
-</html>`, fishCount)
+</html>`, refresh, summary.Fish, summary.Visitors, activityGraph(s.activity.snapshot(), time.Now()), s.guestbookSection(), poll)
 	
 	fmt.Fprint(w, html)
 }
 
-func (s *Server) getFishCount() int {
-	if s.aquariumMgr == nil {
-		return 0
+// guestbookShown is how many guestbook messages the start page shows.
+const guestbookShown = 10
+
+// guestbookSection lists the newest guestbook messages for the start page.
+func (s *Server) guestbookSection() string {
+	if s.rooms == nil {
+		return ""
+	}
+	entries := s.rooms.Guestbook().Entries()
+	if len(entries) > guestbookShown {
+		entries = entries[:guestbookShown]
+	}
+
+	var out strings.Builder
+	out.WriteString(`<h2 id="guestbook">Guestbook</h2>
+    <ul class="guestbook">
+`)
+	for _, entry := range entries {
+		fmt.Fprintf(&out, "        <li><b>%s</b> %s <small>%s</small></li>\n",
+			html.EscapeString(entry.Name), html.EscapeString(entry.Message), entry.SignedAt.Format("2006-01-02"))
+	}
+	if len(entries) == 0 {
+		out.WriteString("        <li>Nobody signed yet.</li>\n")
 	}
-	return s.aquariumMgr.GetFishCount()
+	out.WriteString(`    </ul>
+    <p>Sign it with:</p>
+    <pre>ssh acqua.fly.dev sign "hello fish"</pre>`)
+	return out.String()
 }
\ No newline at end of file
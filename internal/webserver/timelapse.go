@@ -0,0 +1,45 @@
+package webserver
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+
+	"github.com/acuqa/ssh-aquarium/internal/timelapse"
+)
+
+// SetTimelapse serves the recorder's time-lapse at /api/timelapse.gif. It
+// must be called before Start.
+func (s *Server) SetTimelapse(recorder *timelapse.Recorder) {
+	s.timelapse = recorder
+}
+
+// timelapseHandler answers with the time-lapse GIF. ?frames=N limits it to
+// the last N pictures.
+func (s *Server) timelapseHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		writeError(w, errorf(http.StatusMethodNotAllowed, "method %s not allowed", r.Method))
+		return
+	}
+	frames, err := intParam(r.URL.Query().Get("frames"), 0, 1, -1)
+	if err != nil {
+		writeError(w, errorf(http.StatusBadRequest, "frames %v", err))
+		return
+	}
+
+	data, newest, err := s.timelapse.GIF(frames)
+	if errors.Is(err, timelapse.ErrNoFrames) {
+		writeError(w, errorf(http.StatusNotFound, "no pictures yet, they are taken while someone is watching"))
+		return
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/gif")
+	w.Header().Set("Cache-Control", "public, max-age=60")
+	w.Header().Set("Content-Disposition", `inline; filename="aquarium-`+newest.Format("2006-01-02")+`.gif"`)
+	http.ServeContent(w, r, "", newest, bytes.NewReader(data))
+}
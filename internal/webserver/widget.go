@@ -0,0 +1,138 @@
+package webserver
+
+import (
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// widgetTop is how many visitors the widget ranks.
+const widgetTop = 5
+
+// widgetData is what the widget shows, the same numbers as the start page
+// plus the visitors who spent the most time in the water. It is public so
+// any page can embed the widget, whatever -cors-origins allows.
+type widgetData struct {
+	Fish     int             `json:"fish"`
+	Watching int             `json:"watching"`
+	Visitors int             `json:"visitors"` // unique, all time
+	Top      []widgetVisitor `json:"top"`
+}
+
+// widgetVisitor is a user in the widget's ranking. Only users with an SSH
+// key are ranked, by the name their fish had last.
+type widgetVisitor struct {
+	Name     string `json:"name"`
+	TimeSwum int64  `json:"time_swum_s"`
+}
+
+func (s *Server) widgetData() widgetData {
+	summary := s.summary()
+	data := widgetData{Fish: summary.Fish, Watching: summary.Connections, Visitors: summary.Visitors, Top: []widgetVisitor{}}
+	if s.rooms == nil {
+		return data
+	}
+	for _, fish := range s.rooms.Owners().Top(widgetTop) {
+		data.Top = append(data.Top, widgetVisitor{Name: fish.Name, TimeSwum: int64(fish.TimeSwum.Seconds())})
+	}
+	return data
+}
+
+func (s *Server) widgetDataHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Cache-Control", "no-cache")
+	writeJSON(w, http.StatusOK, s.widgetData())
+}
+
+// widgetHandler serves the widget itself, a small page meant for an iframe
+// that polls /widget.json like the start page polls the API.
+func (s *Server) widgetHandler(w http.ResponseWriter, r *http.Request) {
+	data := s.widgetData()
+
+	var top strings.Builder
+	for _, visitor := range data.Top {
+		fmt.Fprintf(&top, "<li><span>%s</span> <small>%s</small></li>",
+			html.EscapeString(visitor.Name), html.EscapeString(formatSwum(time.Duration(visitor.TimeSwum)*time.Second)))
+	}
+
+	w.Header().Set("Content-Type", "text/html")
+	w.Header().Set("Cache-Control", "no-cache")
+	fmt.Fprintf(w, `<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="utf-8">
+    <title>SSH Aquarium</title>
+    <noscript><meta http-equiv="refresh" content="%d"></noscript>
+    <style>
+        body { font-family: monospace; margin: 0; padding: 10px 12px; background: #001122; color: #66ccff; font-size: 13px; }
+        a { color: #88ddff; text-decoration: none; }
+        b { color: #aaffaa; }
+        ol { margin: 6px 0 0; padding-left: 20px; color: #88ddff; }
+        small { color: #447799; }
+        pre { margin: 8px 0 0; color: #aaffaa; }
+    </style>
+</head>
+<body>
+    <a href="/" target="_blank">🐠 SSH Aquarium</a>
+    <div><b id="fish">%d</b> fish, <b id="watching">%d</b> watching, <b id="visitors">%d</b> visitors</div>
+    <ol id="top">%s</ol>
+    <pre>ssh acqua.fly.dev</pre>
+    <script>
+    const swum = s => s >= 3600 ? Math.floor(s / 3600) + "h " + Math.floor(s %% 3600 / 60) + "m" : s >= 60 ? Math.floor(s / 60) + "m" : "<1m";
+    setInterval(() => {
+        if (document.hidden) return;
+        fetch("/widget.json").then(r => r.json()).then(d => {
+            document.getElementById("fish").textContent = d.fish;
+            document.getElementById("watching").textContent = d.watching;
+            document.getElementById("visitors").textContent = d.visitors;
+            const top = document.getElementById("top");
+            top.replaceChildren(...d.top.map(v => {
+                const li = document.createElement("li"), name = document.createElement("span"), time = document.createElement("small");
+                name.textContent = v.name;
+                time.textContent = swum(v.time_swum_s);
+                li.append(name, " ", time);
+                return li;
+            }));
+        }).catch(() => {});
+    }, %d);
+    </script>
+</body>
+</html>`, int(pageRefresh.Seconds()), data.Fish, data.Watching, data.Visitors, top.String(), pollInterval.Milliseconds())
+}
+
+// widgetScript replaces the script tag loading it with the widget in an
+// iframe, so embedding takes a single line.
+const widgetScript = `(function () {
+    const script = document.currentScript;
+    const frame = document.createElement("iframe");
+    frame.src = new URL("/widget", script.src).href;
+    frame.title = "SSH Aquarium";
+    frame.width = "280";
+    frame.height = "200";
+    frame.style.border = "0";
+    frame.style.borderRadius = "8px";
+    script.replaceWith(frame);
+})();
+`
+
+func widgetScriptHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/javascript")
+	w.Header().Set("Cache-Control", "max-age=3600")
+	if _, err := fmt.Fprint(w, widgetScript); err != nil {
+		log.Printf("Failed to write widget script: %v", err)
+	}
+}
+
+// formatSwum shortens a time in the water to hours and minutes.
+func formatSwum(d time.Duration) string {
+	switch {
+	case d >= time.Hour:
+		return fmt.Sprintf("%dh %dm", int(d.Hours()), int(d.Minutes())%60)
+	case d >= time.Minute:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	}
+	return "<1m"
+}